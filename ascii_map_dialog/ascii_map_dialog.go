@@ -0,0 +1,94 @@
+package ascii_map_dialog
+
+import (
+	"fmt"
+	"old-school-rpg-map-editor/common"
+	"old-school-rpg-map-editor/common/ascii_map"
+	"old-school-rpg-map-editor/configuration"
+	"old-school-rpg-map-editor/models/maps_model"
+	"old-school-rpg-map-editor/undo_redo"
+	"old-school-rpg-map-editor/utils"
+	"path/filepath"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+	"github.com/google/uuid"
+)
+
+var _ dialog.Dialog = asciiMapDialog{}
+
+// Диалог ASCII представления выбранного слоя: текст можно скопировать, а можно вставить
+// свой и импортировать его новым слоем. Символы - см. ascii_map.Glyphs и файл GlyphsFile.
+type asciiMapDialog struct {
+	dialog.Dialog
+	parent    fyne.Window
+	textEntry *widget.Entry
+}
+
+const GlyphsFile = "ascii_glyphs.json"
+
+func loadGlyphs() (ascii_map.Glyphs, error) {
+	dir, err := configuration.GetConfigDir()
+	if err != nil {
+		return ascii_map.Glyphs{}, err
+	}
+
+	return ascii_map.LoadGlyphs(filepath.Join(dir, GlyphsFile))
+}
+
+func NewAsciiMapDialog(parent fyne.Window, mapsModel *maps_model.MapsModel, mapId uuid.UUID) asciiMapDialog {
+	textEntry := widget.NewMultiLineEntry()
+	textEntry.TextStyle = fyne.TextStyle{Monospace: true}
+	textEntry.Wrapping = fyne.TextWrapOff
+	textEntry.SetMinRowsVisible(16)
+
+	nameEntry := widget.NewEntry()
+	nameEntry.SetText("ASCII")
+
+	glyphs, err := loadGlyphs()
+	if err != nil {
+		// TODO
+		fmt.Println(err)
+		glyphs = ascii_map.DefaultGlyphs()
+	}
+
+	mapElem := mapsModel.GetById(mapId)
+	text, err := ascii_map.Export(mapElem.Model.Locations(mapElem.SelectedLayerModel.Selected()), glyphs)
+	if err != nil {
+		// TODO
+		fmt.Println(err)
+	}
+	textEntry.SetText(text)
+
+	items := []*widget.FormItem{
+		widget.NewFormItem("Layer", textEntry),
+		widget.NewFormItem("New layer name", nameEntry),
+	}
+
+	d := dialog.NewForm("ASCII map", "Import as new layer", "Close", items, func(b bool) {
+		if !b {
+			return
+		}
+
+		locations, err := ascii_map.Import(textEntry.Text, glyphs, utils.Int2{})
+		if err != nil {
+			dialog.ShowError(err, parent)
+			return
+		}
+
+		err = common.MakeAction(undo_redo.NewImportLayerAction(nameEntry.Text, locations), mapsModel, mapId, nil)
+		if err != nil {
+			dialog.ShowError(err, parent)
+			return
+		}
+	}, parent)
+	d.Resize(fyne.NewSize(parent.Canvas().Size().Width*2/3, parent.Canvas().Size().Height*2/3))
+
+	return asciiMapDialog{d, parent, textEntry}
+}
+
+func (d asciiMapDialog) Show() {
+	d.Dialog.Show()
+	d.parent.Canvas().Focus(d.textEntry)
+}
@@ -6,22 +6,42 @@ import (
 	"image"
 	"image/draw"
 	"image/png"
+	"io/fs"
 	"log"
 	"old-school-rpg-map-editor/common"
+	"old-school-rpg-map-editor/common/autosave"
+	"old-school-rpg-map-editor/common/load_save"
+	"old-school-rpg-map-editor/common/note_links"
+	"old-school-rpg-map-editor/common/note_search"
+	"old-school-rpg-map-editor/common/resources"
+	"old-school-rpg-map-editor/common/session"
+	"old-school-rpg-map-editor/common/tileset"
 	"old-school-rpg-map-editor/configuration"
 	"old-school-rpg-map-editor/models/copy_model"
+	"old-school-rpg-map-editor/models/map_model"
 	"old-school-rpg-map-editor/models/maps_model"
 	"old-school-rpg-map-editor/models/mode_model"
+	"old-school-rpg-map-editor/models/notes_model"
+	"old-school-rpg-map-editor/models/party_model"
 	"old-school-rpg-map-editor/models/selected_map_tab_model"
 	"old-school-rpg-map-editor/models/shortcuts_model"
+	"old-school-rpg-map-editor/models/tilesets_model"
+	"old-school-rpg-map-editor/note_check_dialog"
+	"old-school-rpg-map-editor/note_search_dialog"
 	"old-school-rpg-map-editor/undo_redo"
 	"old-school-rpg-map-editor/widgets/doc_tabs_widget"
+	"old-school-rpg-map-editor/widgets/effects_widget"
 	"old-school-rpg-map-editor/widgets/layer_buttons_widget"
 	"old-school-rpg-map-editor/widgets/layers_widget"
+	"old-school-rpg-map-editor/widgets/level_widget"
+	"old-school-rpg-map-editor/widgets/links_widget"
+	"old-school-rpg-map-editor/widgets/markers_widget"
 	"old-school-rpg-map-editor/widgets/notes_widget"
 	"old-school-rpg-map-editor/widgets/palette_widget"
 	"old-school-rpg-map-editor/widgets/toolbar_widget"
+	"old-school-rpg-map-editor/widgets/wall_kind_widget"
 	"os"
+	"path/filepath"
 	"reflect"
 	"sync"
 	"time"
@@ -29,8 +49,10 @@ import (
 	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/app"
 	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
 	"fyne.io/fyne/v2/driver/desktop"
 	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
 	"github.com/goki/freetype/truetype"
 	"github.com/google/uuid"
 	"github.com/pkg/errors"
@@ -59,6 +81,36 @@ func saveMainWindowSettings(f *os.File, c *configuration.Config, w fyne.Window)
 	c.MainWindowY = int(mainWindowPos.Y)
 }
 
+// Предлагает восстановить карты, которые остались несохранёнными после прошлого запуска
+func offerRecoveries(w fyne.Window, mapsModel *maps_model.MapsModel, recoveries []autosave.Recovery) {
+	text := "Unsaved maps from the previous session were found:\n"
+	for _, r := range recoveries {
+		text += "\n" + r.String()
+	}
+
+	d := dialog.NewConfirm("Restore unsaved maps", text, func(restore bool) {
+		for _, r := range recoveries {
+			var err error
+			if restore {
+				var historyErr error
+				_, historyErr, err = r.Restore(mapsModel)
+				if historyErr != nil {
+					dialog.ShowError(historyErr, w)
+				}
+			} else {
+				err = r.Remove()
+			}
+			if err != nil {
+				// TODO
+				fmt.Println(err)
+			}
+		}
+	}, w)
+	d.SetConfirmText("Restore")
+	d.SetDismissText("Discard")
+	d.Show()
+}
+
 func restoreContentAndToolsSettings(c *configuration.Config, content, tools *container.Split) {
 	content.SetOffset(float64(c.ContentOffset))
 	tools.SetOffset(float64(c.ToolsOffset))
@@ -69,19 +121,43 @@ func saveContentAndToolsSettings(f *os.File, c *configuration.Config, content, t
 	c.ToolsOffset = float32(tools.Offset)
 }
 
-func loadImage(file string) (image.Image, error) {
-	reader, err := os.Open(file)
+// Загружает ресурсы, не завершая программу: вместо ресурса, который не загрузился, берётся
+// заглушка, а ошибка запоминается, чтобы потом показать её пользователю
+type resourceLoader struct {
+	res  *resources.Resources
+	errs []error
+}
+
+func (l *resourceLoader) image(name string) image.Image {
+	img, err := l.res.Image(name)
 	if err != nil {
-		return nil, errors.Wrap(err, "cannot load images")
+		l.errs = append(l.errs, err)
+		return image.NewRGBA(image.Rect(0, 0, 1, 1))
 	}
-	defer reader.Close()
+	return img
+}
+
+func (l *resourceLoader) icon(name string) fyne.Resource {
+	d, err := l.res.ImageFile(name)
+	if err != nil {
+		l.errs = append(l.errs, err)
+		return theme.QuestionIcon()
+	}
+	return fyne.NewStaticResource(name, d)
+}
 
-	image, _, err := image.Decode(reader)
+func (l *resourceLoader) selectedIcon(border image.Image, icon fyne.Resource) fyne.Resource {
+	selectedIcon, err := makeSelectedButtonIcon(border, icon)
 	if err != nil {
-		return nil, errors.Wrap(err, "cannot load images")
+		l.errs = append(l.errs, fmt.Errorf("%s: %w", icon.Name(), err))
+		return icon
 	}
+	return selectedIcon
+}
 
-	return image, nil
+// Все ошибки загрузки, включая переопределённые ресурсы, вместо которых взяты встроенные
+func (l *resourceLoader) errors() []error {
+	return append(append([]error(nil), l.errs...), l.res.Warnings()...)
 }
 
 func makeSelectedButtonIcon(border image.Image, res fyne.Resource) (fyne.Resource, error) {
@@ -104,7 +180,25 @@ func makeSelectedButtonIcon(border image.Image, res fyne.Resource) (fyne.Resourc
 	return fyne.NewStaticResource(fmt.Sprintf("%s.selected.png", res.Name()), buf.Bytes()), nil
 }
 
-func processKeymaps(keyMap map[string]struct{}, shortcutsModel *shortcuts_model.ShortcutsModel, mapsModel *maps_model.MapsModel, selectedMapTabModel *selected_map_tab_model.SelectedMapTabModel) {
+var partyMoves = map[shortcuts_model.ShortcutType]party_model.Move{
+	shortcuts_model.PartyForward:     party_model.Forward,
+	shortcuts_model.PartyBackward:    party_model.Backward,
+	shortcuts_model.PartyStrafeLeft:  party_model.StrafeLeft,
+	shortcuts_model.PartyStrafeRight: party_model.StrafeRight,
+	shortcuts_model.PartyTurnLeft:    party_model.TurnLeft,
+	shortcuts_model.PartyTurnRight:   party_model.TurnRight,
+}
+
+// Фокус у поля ввода: Enter, стрелки и ",", "." набираются в нём и не должны двигать группу
+func textInputFocused(w fyne.Window) bool {
+	_, ok := w.Canvas().Focused().(interface {
+		fyne.Focusable
+		SelectedText() string
+	})
+	return ok
+}
+
+func processKeymaps(w fyne.Window, keyMap map[string]struct{}, shortcutsModel *shortcuts_model.ShortcutsModel, mapsModel *maps_model.MapsModel, selectedMapTabModel *selected_map_tab_model.SelectedMapTabModel, tilesetsModel *tilesets_model.TilesetsModel, floorPaletteWidget *palette_widget.PaletteWidget) {
 	for _, st := range shortcutsModel.Get(shortcuts_model.ShortcutFromMap(keyMap)) {
 		switch st {
 		case shortcuts_model.RotateMapClockwise, shortcuts_model.RotateMapCounterClockwise:
@@ -152,108 +246,123 @@ func processKeymaps(keyMap map[string]struct{}, shortcutsModel *shortcuts_model.
 					return
 				}
 			}
-		}
-	}
-}
-
-func main() {
-	a := app.NewWithID("old-school-rpg-map-editor-4130b499-2e11-4f95-86c4-d2ff537d8bea")
-
-	floorImage, err := loadImage("images/floor.png")
-	if err != nil {
-		log.Fatal(err)
-	}
+		case shortcuts_model.PartyForward, shortcuts_model.PartyBackward, shortcuts_model.PartyStrafeLeft, shortcuts_model.PartyStrafeRight, shortcuts_model.PartyTurnLeft, shortcuts_model.PartyTurnRight:
+			{
+				if textInputFocused(w) {
+					continue
+				}
 
-	wallImage, err := loadImage("images/wall.png")
-	if err != nil {
-		log.Fatal(err)
-	}
+				mapElem := mapsModel.GetById(selectedMapTabModel.Selected())
+				if (mapElem.MapId == uuid.UUID{}) {
+					return
+				}
 
-	floorSelectedImage, err := loadImage("images/floor_selected.png")
-	if err != nil {
-		log.Fatal(err)
-	}
+				layerId := mapElem.Model.LayerInfo(mapElem.SelectedLayerModel.Selected()).Uuid
 
-	wallSelectedImage, err := loadImage("images/wall_selected.png")
-	if err != nil {
-		log.Fatal(err)
-	}
+				err := common.MakeAction(undo_redo.NewStepPartyAction(partyMoves[st], layerId, uint32(floorPaletteWidget.Selected())), mapsModel, mapElem.MapId, nil)
+				if err != nil {
+					dialog.ShowError(err, w)
+					return
+				}
+			}
+		case shortcuts_model.PartyFollowLink:
+			{
+				if textInputFocused(w) {
+					continue
+				}
 
-	borderImage, err := loadImage("images/selected.png")
-	if err != nil {
-		log.Fatal(err)
-	}
+				mapElem := mapsModel.GetById(selectedMapTabModel.Selected())
+				if (mapElem.MapId == uuid.UUID{}) {
+					return
+				}
 
-	rotateLeftIcon, err := fyne.LoadResourceFromPath("images/rotate_left.png")
-	if err != nil {
-		log.Fatal(err)
-	}
+				pos, _ := mapElem.PartyModel.Get()
+				_, link := mapElem.Model.VisibleLink(pos.X, pos.Y)
+				if link == nil {
+					return
+				}
 
-	rotateRightIcon, err := fyne.LoadResourceFromPath("images/rotate_right.png")
-	if err != nil {
-		log.Fatal(err)
+				historyErr, err := doc_tabs_widget.FollowLink(mapsModel, selectedMapTabModel, tilesetsModel, mapElem.MapId, *link)
+				if historyErr != nil {
+					dialog.ShowError(historyErr, w)
+				}
+				if err != nil {
+					// TODO
+					fmt.Println(err)
+					return
+				}
+			}
+		}
 	}
+}
 
-	setModeIcon, err := fyne.LoadResourceFromPath("images/set_mode.png")
-	if err != nil {
-		log.Fatal(err)
+// Подписи count тайлов палитры
+func tileLabels(count int, tile func(index uint32) tileset.Tile) []string {
+	labels := make([]string, count)
+	for i := range labels {
+		labels[i] = fmt.Sprintf("%d: %s", i, tile(uint32(i)))
 	}
+	return labels
+}
 
-	setModeSelectedIcon, err := makeSelectedButtonIcon(borderImage, setModeIcon)
-	if err != nil {
-		log.Fatal(err)
-	}
+func main() {
+	a := app.NewWithID("old-school-rpg-map-editor-4130b499-2e11-4f95-86c4-d2ff537d8bea")
 
-	selectModeIcon, err := fyne.LoadResourceFromPath("images/select_mode.png")
+	imagesDir, err := configuration.GetConfigDir("images")
 	if err != nil {
-		log.Fatal(err)
+		// TODO
+		fmt.Println(err)
 	}
 
-	selectModeSelectedIcon, err := makeSelectedButtonIcon(borderImage, selectModeIcon)
-	if err != nil {
-		log.Fatal(err)
-	}
+	loader := resourceLoader{res: resources.NewResources(imagesDir)}
 
-	moveModeIcon, err := fyne.LoadResourceFromPath("images/move_mode.png")
-	if err != nil {
-		log.Fatal(err)
-	}
+	borderImage := loader.image("selected.png")
+	rotateLeftIcon := loader.icon("rotate_left.png")
+	rotateRightIcon := loader.icon("rotate_right.png")
+	setModeIcon := loader.icon("set_mode.png")
+	setModeSelectedIcon := loader.selectedIcon(borderImage, setModeIcon)
+	selectModeIcon := loader.icon("select_mode.png")
+	selectModeSelectedIcon := loader.selectedIcon(borderImage, selectModeIcon)
+	moveModeIcon := loader.icon("move_mode.png")
+	moveModeSelectedIcon := loader.selectedIcon(borderImage, moveModeIcon)
+	searchNoteIcon := loader.icon("search_note.png")
+	searchNoteSelectedIcon := loader.selectedIcon(borderImage, searchNoteIcon)
 
-	moveModeSelectedIcon, err := makeSelectedButtonIcon(borderImage, moveModeIcon)
+	fnt, err := truetype.Parse(fyne.CurrentApp().Settings().Theme().Font(fyne.TextStyle{Monospace: true}).Content())
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	searchNoteIcon, err := fyne.LoadResourceFromPath("images/search_note.png")
+	configFile, err := configuration.GetConfigFile("config.json")
 	if err != nil {
 		log.Fatal(err)
 	}
+	defer configFile.Close()
 
-	searchNoteSelectedIcon, err := makeSelectedButtonIcon(borderImage, searchNoteIcon)
+	config, err := configuration.LoadConfig(configFile)
 	if err != nil {
 		log.Fatal(err)
 	}
+	defer configuration.SaveConfig(configFile, config)
 
-	fnt, err := truetype.Parse(fyne.CurrentApp().Settings().Theme().Font(fyne.TextStyle{Monospace: true}).Content())
+	// битым может быть только переопределённый набор, вместо него берётся встроенный
+	defaultTileset, err := loader.res.DefaultTileset()
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	configFile, err := configuration.GetConfigFile("config.json")
+	tilesetsDir, err := configuration.GetConfigDir("tilesets")
 	if err != nil {
 		log.Fatal(err)
 	}
-	defer configFile.Close()
 
-	config, err := configuration.LoadConfig(configFile)
+	tilesetsModel, err := tilesets_model.NewTilesetsModel(defaultTileset, tilesetsDir)
 	if err != nil {
 		log.Fatal(err)
 	}
-	defer configuration.SaveConfig(configFile, config)
-
-	imageConfig := configuration.ImageConfig{
-		FloorSize: uint(floorImage.Bounds().Dy()),
-		WallWidth: 16,
+	if err := tilesetsModel.Reload(); err != nil {
+		// TODO
+		fmt.Println(err)
 	}
 
 	w := a.NewWindow("Title")
@@ -264,10 +373,13 @@ func main() {
 	w.SetMaster()
 
 	mapsModel := maps_model.NewMapsModel(8, fnt)
+	mapsModel.SetUndoOptions(config.UndoLimit, config.SaveUndoHistory)
 	copyModel := copy_model.NewCopyModel()
 
-	floorPaletteWidget := palette_widget.NewPaletteWidget(floorImage, imageConfig.FloorSize, imageConfig.FloorSize, 0)
-	wallPaletteWidget := palette_widget.NewPaletteWidget(wallImage, imageConfig.WallWidth, imageConfig.FloorSize, (imageConfig.FloorSize-imageConfig.WallWidth)/2)
+	// картинки палитр задаёт updatePalettes по набору тайлов выбранной карты
+	_, defaultImages := tilesetsModel.Get(tileset.Ref{})
+	floorPaletteWidget := palette_widget.NewPaletteWidget(defaultImages.Floor, defaultTileset.TileSize, defaultTileset.TileSize, 0)
+	wallPaletteWidget := palette_widget.NewPaletteWidget(defaultImages.Wall, defaultTileset.WallWidth, defaultTileset.TileSize, (defaultTileset.TileSize-defaultTileset.WallWidth)/2)
 
 	selectedMapTabModel := selected_map_tab_model.NewSelectedLayerModel()
 
@@ -294,7 +406,7 @@ func main() {
 				keyMap := maps.Clone(keyMap)
 				mutex.Unlock()
 
-				processKeymaps(keyMap, shortcutsModel, mapsModel, selectedMapTabModel)
+				processKeymaps(w, keyMap, shortcutsModel, mapsModel, selectedMapTabModel, tilesetsModel, floorPaletteWidget)
 			}
 		}()
 	}
@@ -302,17 +414,23 @@ func main() {
 	keyS := desktop.CustomShortcut{KeyName: fyne.KeyS, Modifier: fyne.KeyModifierControl}
 	w.Canvas().AddShortcut(&keyS, func(shortcut fyne.Shortcut) {
 		mapElem := mapsModel.GetById(selectedMapTabModel.Selected())
+		var err error
 		if mapElem.ModeModel.Mode() == mode_model.SetMode {
-			toolbar_widget.SetMode(mapsModel, mapElem.MapId, mode_model.SelectMode)
+			err = toolbar_widget.SetMode(mapsModel, mapElem.MapId, mode_model.SelectMode)
 		} else if mapElem.ModeModel.Mode() == mode_model.SelectMode {
-			toolbar_widget.SetMode(mapsModel, mapElem.MapId, mode_model.SetMode)
+			err = toolbar_widget.SetMode(mapsModel, mapElem.MapId, mode_model.SetMode)
+		}
+		if err != nil {
+			dialog.ShowError(err, w)
 		}
 	})
 
 	keyM := desktop.CustomShortcut{KeyName: fyne.KeyM, Modifier: fyne.KeyModifierControl}
 	w.Canvas().AddShortcut(&keyM, func(shortcut fyne.Shortcut) {
 		mapElem := mapsModel.GetById(selectedMapTabModel.Selected())
-		toolbar_widget.SetMode(mapsModel, mapElem.MapId, mode_model.MoveMode)
+		if err := toolbar_widget.SetMode(mapsModel, mapElem.MapId, mode_model.MoveMode); err != nil {
+			dialog.ShowError(err, w)
+		}
 	})
 
 	keyZ := desktop.CustomShortcut{KeyName: fyne.KeyZ, Modifier: fyne.KeyModifierControl}
@@ -328,15 +446,34 @@ func main() {
 	layersWidget := layers_widget.NewLayersWidget(theme.VisibilityIcon(), theme.VisibilityOffIcon())
 
 	layerButtons := layer_buttons_widget.NewLayerButtonsWidget(w, mapsModel, selectedMapTabModel)
+	levelWidget := level_widget.NewLevelWidget(mapsModel, selectedMapTabModel)
 
 	notesWidget := notes_widget.NewNotesWidget(nil, borderImage, searchNoteIcon, searchNoteSelectedIcon)
-	paletteTabFloors := container.NewTabItem("Floors", container.NewVScroll(floorPaletteWidget))
-	paletteTabWalls := container.NewTabItem("Walls", container.NewVScroll(wallPaletteWidget))
+	floorLabel := widget.NewLabel("")
+	floorPaletteWidget.AddSelectedListener(func() {
+		floorLabel.SetText(floorPaletteWidget.SelectedLabel())
+	})
+	paletteTabFloors := container.NewTabItem("Floors", container.NewBorder(nil, floorLabel, nil, nil, container.NewVScroll(floorPaletteWidget)))
+	wallKindWidget := wall_kind_widget.NewWallKindWidget()
+	wallLabel := widget.NewLabel("")
+	wallPaletteWidget.AddSelectedListener(func() {
+		wallLabel.SetText(wallPaletteWidget.SelectedLabel())
+	})
+	paletteTabWalls := container.NewTabItem("Walls", container.NewBorder(wallKindWidget.Container(), wallLabel, nil, nil, container.NewVScroll(wallPaletteWidget)))
 	paletteTabNotes := container.NewTabItem("Notes", notesWidget.Container())
+	linksWidget := links_widget.NewLinksWidget(w, mapsModel, selectedMapTabModel)
+	paletteTabLinks := container.NewTabItem("Links", linksWidget.Container())
+	effectsWidget := effects_widget.NewEffectsWidget(w, mapsModel, selectedMapTabModel)
+	paletteTabEffects := container.NewTabItem("Effects", effectsWidget.Container())
+	markersWidget := markers_widget.NewMarkersWidget()
+	paletteTabMarkers := container.NewTabItem("Markers", markersWidget.Container())
 	paletteTabs := container.NewAppTabs(
 		paletteTabFloors,
 		paletteTabWalls,
 		paletteTabNotes,
+		paletteTabLinks,
+		paletteTabEffects,
+		paletteTabMarkers,
 	)
 
 	isFloorTabSelected := func() bool {
@@ -345,7 +482,7 @@ func main() {
 			return false
 		}
 
-		return selectedTab == paletteTabFloors || selectedTab == paletteTabNotes
+		return selectedTab == paletteTabFloors || selectedTab == paletteTabNotes || selectedTab == paletteTabLinks || selectedTab == paletteTabEffects || selectedTab == paletteTabMarkers
 	}
 
 	paletteTabs.OnSelected = func(ti *container.TabItem) {
@@ -359,17 +496,77 @@ func main() {
 		}
 	}
 
-	mapTabs := doc_tabs_widget.NewDocTabsWidget(mapsModel, selectedMapTabModel, floorPaletteWidget, wallPaletteWidget, notesWidget, paletteTabFloors, paletteTabNotes, paletteTabs, layersWidget, floorImage, wallImage, floorSelectedImage, wallSelectedImage, imageConfig)
+	mapTabs := doc_tabs_widget.NewDocTabsWidget(w, mapsModel, selectedMapTabModel, floorPaletteWidget, wallPaletteWidget, wallKindWidget, notesWidget, linksWidget, effectsWidget, markersWidget, paletteTabFloors, paletteTabNotes, paletteTabLinks, paletteTabEffects, paletteTabMarkers, paletteTabs, layersWidget, tilesetsModel)
 	mapTabs.IsFloorTabSelected = isFloorTabSelected
 
-	tools := container.NewVSplit(paletteTabs, container.NewBorder(nil, layerButtons.Container(), nil, nil, layersWidget))
+	notesWidget.OnSearch = func() {
+		searchDialog := note_search_dialog.NewNoteSearchDialog(w, mapsModel, func(r note_search.Result) {
+			if !r.OnMap {
+				selectedMapTabModel.SetSelected(r.MapId)
+				return
+			}
+
+			err := doc_tabs_widget.ShowCell(mapsModel, selectedMapTabModel, tilesetsModel, r.MapId, r.Cell)
+			if err != nil {
+				dialog.ShowError(err, w)
+			}
+		})
+		searchDialog.Show()
+	}
+	notesWidget.OnCheck = func() {
+		mapId := selectedMapTabModel.Selected()
+		if (mapsModel.GetById(mapId).MapId == uuid.UUID{}) {
+			return
+		}
+
+		note_check_dialog.NewNoteCheckDialog(w, mapsModel, mapId).Show()
+	}
+	notesWidget.OnLink = func(link note_links.Link) {
+		_, historyErr, err := doc_tabs_widget.FollowNoteLink(mapsModel, selectedMapTabModel, tilesetsModel, selectedMapTabModel.Selected(), link)
+		if historyErr != nil {
+			dialog.ShowError(historyErr, w)
+		}
+		if err != nil {
+			dialog.ShowError(err, w)
+			return
+		}
+
+		if len(link.NoteId) > 0 {
+			notesWidget.SelectNote(link.NoteId)
+		}
+	}
+	notesWidget.CheckLink = func(link note_links.Link) error {
+		mapElem := mapsModel.GetById(selectedMapTabModel.Selected())
+		if (mapElem.MapId == uuid.UUID{}) {
+			return nil
+		}
+
+		// открытую карту берём из вкладки, остальные читаем с диска
+		load := func(filePath string) (*map_model.MapModel, *notes_model.NotesModel, error) {
+			if opened := mapsModel.GetByFilePath(filePath); (opened.MapId != uuid.UUID{}) {
+				return opened.Model, opened.NotesModel, nil
+			}
+
+			f, err := os.Open(filePath)
+			if err != nil {
+				return nil, nil, err
+			}
+			defer f.Close()
+
+			return load_save.LoadMapFile(f)
+		}
+
+		return note_links.Check(link, mapElem.Model, mapElem.NotesModel, mapElem.FilePath, load)
+	}
+
+	tools := container.NewVSplit(paletteTabs, container.NewBorder(levelWidget.Container(), layerButtons.Container(), nil, nil, layersWidget))
 	content := container.NewHSplit(mapTabs.Container(), tools)
 	content.SetOffset(0.7)
 
 	restoreContentAndToolsSettings(config, content, tools)
 	defer saveContentAndToolsSettings(configFile, config, content, tools)
 
-	toolbar := toolbar_widget.NewToolbar(w, fnt, mapsModel, selectedMapTabModel, copyModel, rotateLeftIcon, rotateRightIcon, setModeIcon, setModeSelectedIcon, selectModeIcon, selectModeSelectedIcon, moveModeIcon, moveModeSelectedIcon)
+	toolbar := toolbar_widget.NewToolbar(w, fnt, mapsModel, selectedMapTabModel, copyModel, tilesetsModel, rotateLeftIcon, rotateRightIcon, setModeIcon, setModeSelectedIcon, selectModeIcon, selectModeSelectedIcon, moveModeIcon, moveModeSelectedIcon)
 
 	w.SetContent(container.NewBorder(toolbar, nil, nil, nil, content))
 
@@ -389,6 +586,92 @@ func main() {
 	})
 	defer disconnectDataChangeSelectedMapTabModel()
 
+	var paletteTileset *tileset.Tileset
+	updatePalettes := func() {
+		var ref tileset.Ref
+		if mapElem := mapsModel.GetById(selectedMapTabModel.Selected()); mapElem.Model != nil {
+			ref = mapElem.Model.Tileset()
+		}
+
+		t, images := tilesetsModel.Get(ref)
+		if t == paletteTileset {
+			return
+		}
+		paletteTileset = t
+
+		floorPaletteWidget.SetImage(images.Floor, t.TileSize, t.TileSize, 0, tileLabels(images.Floor.Bounds().Dx()/int(t.TileSize), t.FloorTile))
+		wallPaletteWidget.SetImage(images.Wall, t.WallWidth, t.TileSize, (t.TileSize-t.WallWidth)/2, tileLabels(images.Wall.Bounds().Dx()/int(t.WallWidth), t.WallTile))
+
+		floorLabel.SetText(floorPaletteWidget.SelectedLabel())
+		wallLabel.SetText(wallPaletteWidget.SelectedLabel())
+	}
+	disconnectPalettesSelectedMapTabModel := selectedMapTabModel.AddDataChangeListener(updatePalettes)
+	defer disconnectPalettesSelectedMapTabModel()
+	disconnectPalettesMapsModel := mapsModel.AddDataChangeListener(updatePalettes)
+	defer disconnectPalettesMapsModel()
+	disconnectPalettesTilesetsModel := tilesetsModel.AddDataChangeListener(updatePalettes)
+	defer disconnectPalettesTilesetsModel()
+	updatePalettes()
+
+	configDir, err := configuration.GetConfigDir()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	sessionFile := filepath.Join(configDir, "session.json")
+
+	var sessionWarnings []error
+	if s, err := session.Load(sessionFile); err == nil {
+		sessionWarnings = s.Restore(mapsModel, selectedMapTabModel, mapTabs)
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		// TODO
+		fmt.Println(err)
+	}
+
+	defer func() {
+		err := session.Collect(mapsModel, selectedMapTabModel, mapTabs).Save(sessionFile)
+		if err != nil {
+			// TODO
+			fmt.Println(err)
+		}
+	}()
+
+	recoveryDir, err := configuration.GetConfigDir("recovery")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Recoveries надо искать до запуска автосохранения
+	recoveries, err := autosave.Recoveries(recoveryDir)
+	if err != nil {
+		// TODO
+		fmt.Println(err)
+	}
+
+	stopAutosave := autosave.NewAutosave(mapsModel, recoveryDir).Start(time.Minute)
+	defer stopAutosave()
+
 	w.Show()
+
+	if len(sessionWarnings) > 0 {
+		text := "Some files of the previous session were not reopened:\n"
+		for _, warning := range sessionWarnings {
+			text += "\n" + warning.Error()
+		}
+		dialog.ShowInformation("Session", text, w)
+	}
+
+	if resourceErrors := loader.errors(); len(resourceErrors) > 0 {
+		text := "Some resources were not loaded, built-in ones or placeholders are used instead:\n"
+		for _, err := range resourceErrors {
+			text += "\n" + err.Error()
+		}
+		dialog.ShowError(errors.New(text), w)
+	}
+
+	if len(recoveries) > 0 {
+		offerRecoveries(w, mapsModel, recoveries)
+	}
+
 	a.Run()
 }
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"image"
+	"image/draw"
+	"math/rand"
+	"old-school-rpg-map-editor/common/map_renderer"
+	"old-school-rpg-map-editor/models/map_model"
+	"old-school-rpg-map-editor/models/rot_map_model"
+	"old-school-rpg-map-editor/models/rotate_model"
+	"old-school-rpg-map-editor/utils"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Карта size x size, все клетки заполнены
+func benchMap(size int) *map_model.MapModel {
+	r := rand.New(rand.NewSource(1))
+
+	locations := make(map[utils.Int2]map_model.Location, size*size)
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			locations[utils.NewInt2(x, y)] = map_model.Location{
+				Floor:      uint32(1 + r.Intn(4)),
+				RightWall:  uint32(r.Intn(4)),
+				BottomWall: uint32(r.Intn(4)),
+			}
+		}
+	}
+
+	mapModel := map_model.NewMapModel()
+	mapModel.SetDimensions(map_model.Dimensions{Width: size, Height: size})
+	layerIndex := mapModel.AddLayerWithId(uuid.New(), map_model.RegularLayerType, 0)
+	mapModel.SetLocations(layerIndex, locations)
+
+	return mapModel
+}
+
+// Времена кадров по возрастанию
+type frameTimes []time.Duration
+
+func (t frameTimes) p95() time.Duration {
+	return t[len(t)*95/100]
+}
+
+func (t frameTimes) String() string {
+	var total time.Duration
+	for _, d := range t {
+		total += d
+	}
+
+	return fmt.Sprintf("avg %v, p95 %v, max %v", total/time.Duration(len(t)), t.p95(), t[len(t)-1])
+}
+
+// Прокручивает карту по диагонали так же, как MapWidget, и замеряет время кадров
+func runBench(args []string) error {
+	flags := flag.NewFlagSet("bench", flag.ExitOnError)
+	size := flags.Int("size", 500, "map size in cells")
+	width := flags.Int("width", 1920, "view width")
+	height := flags.Int("height", 1080, "view height")
+	scale := flags.Float64("scale", 0.5, "scale, 0.5 is the most zoomed out in the editor")
+	frames := flags.Int("frames", 300, "number of frames")
+	step := flags.Int("step", 16, "pixels the view moves per frame")
+	budget := flags.Duration("budget", 16*time.Millisecond, "p95 frame time limit for the cached renderer")
+	direct := flags.Bool("direct", false, "also measure drawing without the cache")
+	flags.Parse(args)
+
+	if *size <= 0 || *frames <= 0 || *width <= 0 || *height <= 0 {
+		return errors.New("size, frames, width and height must be positive")
+	}
+
+	t, err := loadDefaultTileset()
+	if err != nil {
+		return err
+	}
+	images, err := t.Decode()
+	if err != nil {
+		return err
+	}
+
+	rotateModel := rotate_model.NewRotateModel(0)
+	mapModel := rot_map_model.NewRotMapMode(benchMap(*size), rotateModel)
+
+	imageConfig := t.ImageConfig()
+	fScale := float32(*scale)
+	tiles := map_renderer.NewTiles(map_renderer.TileImages(images), fScale)
+	floorWbSize := int((float32(imageConfig.FloorSize) + 1) * fScale) // With Border
+	floorWobSize := int(float32(imageConfig.FloorSize) * fScale)      // Without Border
+
+	img := image.NewRGBA(image.Rect(0, 0, *width, *height))
+	background := image.NewUniform(image.White)
+
+	measure := func(drawFrame func(f map_renderer.Frame)) frameTimes {
+		times := make(frameTimes, 0, *frames)
+		for i := 0; i < *frames; i++ {
+			offset := utils.NewInt2(i**step, i**step)
+
+			frame := map_renderer.Frame{
+				Map:         mapModel,
+				Tiles:       tiles,
+				ImageConfig: imageConfig,
+				Scale:       fScale,
+				Cells: image.Rect(offset.X/floorWbSize, offset.Y/floorWbSize,
+					(offset.X+*width)/floorWbSize+1, (offset.Y+*height)/floorWbSize+1),
+				FloorRect: func(x, y int) image.Rectangle {
+					pX, pY := x*floorWbSize-offset.X, y*floorWbSize-offset.Y
+					return image.Rect(pX, pY, pX+floorWobSize, pY+floorWobSize)
+				},
+			}
+
+			begin := time.Now()
+			draw.Draw(img, img.Bounds(), background, image.Point{}, draw.Src)
+			drawFrame(frame)
+			times = append(times, time.Since(begin))
+		}
+
+		sort.Slice(times, func(i, j int) bool { return times[i] < times[j] })
+		return times
+	}
+
+	fmt.Printf("map %dx%d, view %dx%d, scale %v, %d frames\n", *size, *size, *width, *height, *scale, *frames)
+
+	if *direct {
+		fmt.Println("direct:", measure(func(f map_renderer.Frame) { map_renderer.Draw(img, f) }))
+	}
+
+	cache := map_renderer.NewChunkCache()
+	cached := measure(func(f map_renderer.Frame) { cache.Draw(img, f) })
+	fmt.Println("cached:", cached)
+
+	if cached.p95() > *budget {
+		return fmt.Errorf("p95 frame time %v exceeds the budget %v", cached.p95(), *budget)
+	}
+	return nil
+}
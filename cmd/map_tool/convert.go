@@ -0,0 +1,36 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"old-school-rpg-map-editor/common/formats"
+)
+
+func runConvert(args []string) error {
+	flags := flag.NewFlagSet("convert", flag.ExitOnError)
+	flags.Parse(args)
+
+	if flags.NArg() != 2 {
+		return errors.New("need input and output files")
+	}
+	input, output := flags.Arg(0), flags.Arg(1)
+
+	format, err := formats.ByPath(output)
+	if err != nil {
+		return err
+	}
+	if format.Write == nil {
+		return fmt.Errorf("%s: format %s cannot be written", output, format.Name)
+	}
+
+	mapModel, notesModel, err := loadMap(input)
+	if err != nil {
+		return err
+	}
+
+	return writeFile(output, func(w io.Writer) error {
+		return format.Write(w, mapModel, notesModel)
+	})
+}
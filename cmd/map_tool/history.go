@@ -0,0 +1,85 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"old-school-rpg-map-editor/common/load_save"
+	"old-school-rpg-map-editor/undo_redo"
+	"os"
+	"strings"
+)
+
+// Печатает дерево правок: каждая правка с отступом по глубине, ветки - по порядку создания
+func printHistory(filePath string, history *undo_redo.History) {
+	fmt.Println(filePath)
+	if history == nil {
+		fmt.Println("  no undo history")
+		return
+	}
+
+	var printNode func(e undo_redo.UndoRedoElement, depth int)
+	printNode = func(e undo_redo.UndoRedoElement, depth int) {
+		name := "start"
+		if e.Action != nil {
+			name = undo_redo.ActionName(e.Action)
+		}
+
+		current := ""
+		if e.ChangeGeneration == history.ChangeGeneration {
+			current = " <- saved"
+		}
+
+		fmt.Printf("  %s%d %s%s\n", strings.Repeat("  ", depth), e.ChangeGeneration, name, current)
+
+		children := history.Queue.Children(e.ChangeGeneration)
+		for _, child := range children {
+			// у цепочки без ветвлений отступ не растёт, иначе дерево уезжает вправо
+			childDepth := depth
+			if len(children) > 1 {
+				childDepth++
+			}
+			printNode(child, childDepth)
+		}
+	}
+	printNode(history.Queue.Root(), 0)
+}
+
+func runHistory(args []string) error {
+	flags := flag.NewFlagSet("history", flag.ExitOnError)
+	flags.Parse(args)
+
+	if flags.NArg() == 0 {
+		return errors.New("no files")
+	}
+
+	var firstErr error
+	for _, filePath := range flags.Args() {
+		err := func() error {
+			f, err := os.Open(filePath)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+
+			_, _, history, historyErr, err := load_save.LoadMapFileWithHistory(f)
+			if err != nil {
+				return fmt.Errorf("%s: %w", filePath, err)
+			}
+			if historyErr != nil {
+				return fmt.Errorf("%s: %w", filePath, historyErr)
+			}
+
+			printHistory(filePath, history)
+			return nil
+		}()
+		if err != nil {
+			fmt.Println(err)
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+
+	return firstErr
+}
@@ -0,0 +1,120 @@
+// map_tool - работа с .map файлами без GUI: картинки, конвертация, статистика, проверка.
+//
+//	map_tool render [flags] file.map...
+//	map_tool convert [flags] input output
+//	map_tool stats file.map...
+//	map_tool validate [-strict] file.map...
+//	map_tool bench [flags]
+//	map_tool history file.map...
+package main
+
+import (
+	"fmt"
+	"io"
+	"old-school-rpg-map-editor/common/formats"
+	"old-school-rpg-map-editor/models/map_model"
+	"old-school-rpg-map-editor/models/notes_model"
+	"os"
+	"strings"
+)
+
+type command struct {
+	name  string
+	usage string
+	run   func(args []string) error
+}
+
+var commands []command
+
+func init() {
+	commands = []command{
+		{name: "render", usage: "render [flags] file.map... - render maps to images", run: runRender},
+		{name: "convert", usage: "convert input output - convert a map to the format of output", run: runConvert},
+		{name: "stats", usage: "stats file... - print map statistics", run: runStats},
+		{name: "validate", usage: "validate [-strict] file... - check maps, exit status 1 if there are problems(or warnings with -strict)", run: runValidate},
+		{name: "bench", usage: "bench [flags] - measure map drawing time while panning, exit status 1 if over budget", run: runBench},
+		{name: "history", usage: "history file.map... - print the undo history saved in maps", run: runHistory},
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: map_tool <command> [arguments]")
+	fmt.Fprintln(os.Stderr)
+	for _, c := range commands {
+		fmt.Fprintln(os.Stderr, "  "+c.usage)
+	}
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "Run map_tool <command> -h for the command flags.")
+
+	var names []string
+	for _, f := range formats.Formats() {
+		names = append(names, f.Name+" ("+strings.Join(f.Extensions, ", ")+")")
+	}
+	fmt.Fprintln(os.Stderr, "Formats: "+strings.Join(names, ", "))
+}
+
+// Загружает карту в формате, определённом по расширению файла
+func loadMap(filePath string) (*map_model.MapModel, *notes_model.NotesModel, error) {
+	format, err := formats.ByPath(filePath)
+	if err != nil {
+		return nil, nil, err
+	}
+	if format.Read == nil {
+		return nil, nil, fmt.Errorf("%s: format %s cannot be read", filePath, format.Name)
+	}
+
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+
+	mapModel, notesModel, err := format.Read(f)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", filePath, err)
+	}
+
+	return mapModel, notesModel, nil
+}
+
+// Пишет файл через write; если write вернул ошибку, недописанный файл удаляется,
+// чтобы make не посчитал цель готовой
+func writeFile(filePath string, write func(w io.Writer) error) error {
+	f, err := os.Create(filePath)
+	if err != nil {
+		return err
+	}
+
+	err = write(f)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(filePath)
+	}
+
+	return err
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+
+	for _, c := range commands {
+		if c.name == os.Args[1] {
+			if err := c.run(os.Args[2:]); err != nil {
+				fmt.Fprintln(os.Stderr, "map_tool "+c.name+":", err)
+				os.Exit(1)
+			}
+			return
+		}
+	}
+
+	if os.Args[1] != "-h" && os.Args[1] != "help" {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n", os.Args[1])
+	}
+	usage()
+	os.Exit(2)
+}
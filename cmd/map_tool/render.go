@@ -0,0 +1,171 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"old-school-rpg-map-editor/common/map_renderer"
+	"old-school-rpg-map-editor/common/resources"
+	"old-school-rpg-map-editor/common/tileset"
+	"old-school-rpg-map-editor/configuration"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/goki/freetype/truetype"
+	"golang.org/x/image/font/gofont/gomono"
+)
+
+const notesFontSize = 8 // как в редакторе
+
+// Набор тайлов карты: встроенный в неё, из tilesets по имени или defaultTileset
+func mapTileset(ref tileset.Ref, defaultTileset *tileset.Tileset, tilesets []*tileset.Tileset) (*tileset.Tileset, error) {
+	if ref.Embedded != nil {
+		return ref.Embedded, nil
+	}
+	if len(ref.Name) == 0 {
+		return defaultTileset, nil
+	}
+
+	if t := tileset.Find(append([]*tileset.Tileset{defaultTileset}, tilesets...), ref.Name); t != nil {
+		return t, nil
+	}
+	return nil, fmt.Errorf("tileset %q not found, see -tilesets", ref.Name)
+}
+
+// Встроенный набор по умолчанию с переопределениями редактора(см. resources)
+func loadDefaultTileset() (*tileset.Tileset, error) {
+	imagesDir, err := configuration.GetConfigDir("images")
+	if err != nil {
+		return nil, err
+	}
+
+	res := resources.NewResources(imagesDir)
+	t, err := res.DefaultTileset()
+	for _, warning := range res.Warnings() {
+		fmt.Fprintln(os.Stderr, warning)
+	}
+
+	return t, err
+}
+
+// Путь картинки для карты filePath: output, если задан, иначе файл с расширением ext в outDir(или рядом с картой)
+func renderOutput(filePath, output, outDir, ext string) string {
+	if len(output) > 0 {
+		return output
+	}
+
+	if len(outDir) == 0 {
+		outDir = filepath.Dir(filePath)
+	}
+	name := strings.TrimSuffix(filepath.Base(filePath), filepath.Ext(filePath))
+
+	return filepath.Join(outDir, name+ext)
+}
+
+func runRender(args []string) error {
+	flags := flag.NewFlagSet("render", flag.ExitOnError)
+	output := flags.String("o", "", "output file, only for a single map")
+	outDir := flags.String("out-dir", "", "directory for images, by default next to the maps")
+	format := flags.String("format", "png", "image format: png or svg")
+	imagesDir := flags.String("images", "", "directory of the default tileset, by default the built-in one")
+	tilesetsDir := flags.String("tilesets", "", "directory with tilesets referenced by maps, by default the editor's one")
+	scale := flags.Float64("scale", 1, "scale")
+	angle := flags.Int("angle", 0, "rotation, multiple of 90")
+	level := flags.Int("level", 0, "dungeon level")
+	rulers := flags.Bool("rulers", false, "draw cell coordinates")
+	notes := flags.Bool("notes", false, "draw note ids")
+	legend := flags.Bool("legend", false, "draw the legend of used tiles")
+	fontSize := flags.Float64("font-size", 10, "font size of rulers and legend")
+	flags.Parse(args)
+
+	if flags.NArg() == 0 {
+		return errors.New("no files")
+	}
+	if len(*output) > 0 && flags.NArg() > 1 {
+		return errors.New("-o needs a single map, use -out-dir")
+	}
+	if *angle%90 != 0 {
+		return fmt.Errorf("angle %d is not a multiple of 90", *angle)
+	}
+	export := map_renderer.ExportPNG
+	switch *format {
+	case "png":
+	case "svg":
+		export = map_renderer.ExportSVG
+	default:
+		return fmt.Errorf("unknown image format %q", *format)
+	}
+
+	var defaultTileset *tileset.Tileset
+	var err error
+	if len(*imagesDir) > 0 {
+		defaultTileset, err = tileset.LoadDir(*imagesDir)
+	} else {
+		defaultTileset, err = loadDefaultTileset()
+	}
+	if err != nil {
+		return err
+	}
+
+	if len(*tilesetsDir) == 0 {
+		*tilesetsDir, err = configuration.GetConfigDir("tilesets")
+		if err != nil {
+			return err
+		}
+	}
+	tilesets, err := tileset.LoadAll(*tilesetsDir)
+	if err != nil {
+		// карте битый набор может быть и не нужен
+		fmt.Fprintln(os.Stderr, err)
+	}
+
+	fnt, err := truetype.Parse(gomono.TTF)
+	if err != nil {
+		return err
+	}
+
+	opts := map_renderer.ExportOptions{
+		Scale:    float32(*scale),
+		Angle:    *angle,
+		Level:    int32(*level),
+		Rulers:   *rulers,
+		Notes:    *notes,
+		Legend:   *legend,
+		Font:     fnt,
+		FontSize: *fontSize,
+	}
+
+	var firstErr error
+	for _, filePath := range flags.Args() {
+		err := func() error {
+			mapModel, notesModel, err := loadMap(filePath)
+			if err != nil {
+				return err
+			}
+			notesModel.SetFont(notesFontSize, fnt)
+
+			t, err := mapTileset(mapModel.Tileset(), defaultTileset, tilesets)
+			if err != nil {
+				return err
+			}
+			images, err := t.Decode()
+			if err != nil {
+				return err
+			}
+
+			return writeFile(renderOutput(filePath, *output, *outDir, "."+*format), func(w io.Writer) error {
+				return export(w, mapModel, notesModel, map_renderer.TileImages(images), t.ImageConfig(), opts)
+			})
+		}()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", filePath, err)
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+
+	return firstErr
+}
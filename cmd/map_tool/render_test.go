@@ -0,0 +1,54 @@
+package main
+
+import (
+	"io"
+	"old-school-rpg-map-editor/common/map_renderer"
+	"old-school-rpg-map-editor/common/tileset"
+	"old-school-rpg-map-editor/images"
+	"path/filepath"
+	"testing"
+)
+
+// Набор тайлов каждой карты из testdata load_save находится, и карта рисуется, как в map_tool render
+func TestRenderFixtures(t *testing.T) {
+	defaultTileset, err := tileset.Load(images.FS)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	filePaths, err := filepath.Glob(filepath.Join("..", "..", "common", "load_save", "testdata", "v*.map"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(filePaths) == 0 {
+		t.Fatal("no fixtures")
+	}
+
+	for _, filePath := range filePaths {
+		t.Run(filepath.Base(filePath), func(t *testing.T) {
+			mapModel, notesModel, err := loadMap(filePath)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			ref := mapModel.Tileset()
+			ts, err := mapTileset(ref, defaultTileset, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// имя, которое показывают stats и редактор, тоже должно находиться
+			if byName, err := mapTileset(tileset.Ref{Name: ref.String()}, defaultTileset, nil); err != nil || byName != ts {
+				t.Errorf("tileset %q: got %v(%v), want %q", ref, byName, err, ts.Name)
+			}
+
+			decoded, err := ts.Decode()
+			if err != nil {
+				t.Fatal(err)
+			}
+			opts := map_renderer.ExportOptions{Scale: 1}
+			if err := map_renderer.ExportPNG(io.Discard, mapModel, notesModel, map_renderer.TileImages(decoded), ts.ImageConfig(), opts); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
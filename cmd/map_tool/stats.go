@@ -0,0 +1,110 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"old-school-rpg-map-editor/models/map_model"
+	"old-school-rpg-map-editor/models/notes_model"
+	"strconv"
+	"strings"
+)
+
+type counts struct {
+	cells, floors, walls, notes, links, effects, markers int
+}
+
+func (c *counts) add(location map_model.Location) {
+	if location.IsEmptyLocation() {
+		return
+	}
+
+	c.cells++
+	if location.Floor > 0 {
+		c.floors++
+	}
+	if location.RightWall > 0 {
+		c.walls++
+	}
+	if location.BottomWall > 0 {
+		c.walls++
+	}
+	if len(location.NoteId) > 0 {
+		c.notes++
+	}
+	if location.Link != nil {
+		c.links++
+	}
+	if location.Effects != 0 {
+		c.effects++
+	}
+	c.markers += len(location.Markers)
+}
+
+func (c counts) String() string {
+	return fmt.Sprintf("%d cells, %d floors, %d walls, %d notes, %d links, %d effects, %d markers", c.cells, c.floors, c.walls, c.notes, c.links, c.effects, c.markers)
+}
+
+func printStats(filePath string, mapModel *map_model.MapModel, notesModel *notes_model.NotesModel) {
+	fmt.Println(filePath)
+	fmt.Println("  dimensions:", mapModel.Dimensions())
+
+	var levels []string
+	for _, level := range mapModel.Levels() {
+		levels = append(levels, strconv.Itoa(int(level)))
+	}
+	fmt.Println("  levels:", strings.Join(levels, ", "))
+
+	var total counts
+	for i, info := range mapModel.LayerInfos() {
+		var c counts
+		for _, location := range mapModel.Locations(int32(i)) {
+			c.add(location)
+		}
+		if info.Type == map_model.RegularLayerType {
+			total.cells += c.cells
+			total.floors += c.floors
+			total.walls += c.walls
+			total.notes += c.notes
+			total.links += c.links
+			total.effects += c.effects
+			total.markers += c.markers
+		}
+
+		layerType := "regular"
+		if info.Type == map_model.MoveLayerType {
+			layerType = "move"
+		}
+		leftTop, rightBottom := mapModel.Bounds(int32(i))
+		fmt.Printf("  layer %d %q (%s, level %d): %s, bounds (%d, %d)-(%d, %d)\n", i, info.Name, layerType, info.Level, c,
+			leftTop.X, leftTop.Y, rightBottom.X, rightBottom.Y)
+	}
+
+	fmt.Println("  total:", total)
+	fmt.Println("  notes:", notesModel.Len())
+}
+
+func runStats(args []string) error {
+	flags := flag.NewFlagSet("stats", flag.ExitOnError)
+	flags.Parse(args)
+
+	if flags.NArg() == 0 {
+		return errors.New("no files")
+	}
+
+	var firstErr error
+	for _, filePath := range flags.Args() {
+		mapModel, notesModel, err := loadMap(filePath)
+		if err != nil {
+			fmt.Println(err)
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+
+		printStats(filePath, mapModel, notesModel)
+	}
+
+	return firstErr
+}
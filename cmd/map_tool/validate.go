@@ -0,0 +1,42 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"old-school-rpg-map-editor/common/validate"
+)
+
+var errProblems = errors.New("problems found")
+
+func runValidate(args []string) error {
+	flags := flag.NewFlagSet("validate", flag.ExitOnError)
+	strict := flags.Bool("strict", false, "fail on warnings too, e.g. notes that are not on the map")
+	flags.Parse(args)
+
+	if flags.NArg() == 0 {
+		return errors.New("no files")
+	}
+
+	failed := false
+	for _, filePath := range flags.Args() {
+		mapModel, notesModel, err := loadMap(filePath)
+		if err != nil {
+			fmt.Println(err)
+			failed = true
+			continue
+		}
+
+		for _, p := range validate.Validate(mapModel, notesModel) {
+			fmt.Printf("%s: %s\n", filePath, p)
+			if !p.Warning || *strict {
+				failed = true
+			}
+		}
+	}
+
+	if failed {
+		return errProblems
+	}
+	return nil
+}
@@ -0,0 +1,331 @@
+// Текстовое представление слоя карты для форумов и баг-трекеров.
+//
+// Одна клетка - один символ, между клетками - стены:
+//
+//	+-+-+-+
+//	|. . .|
+//	+-+D+ +
+//	  |.> |
+//	  +-+-+
+//
+// Строки и столбцы с чётными номерами(с нуля) - границы клеток, с нечётными - сами клетки:
+//   - (2x+1, 2y+1) - пол клетки (x, y), см. Glyphs.Floors;
+//   - (2x+2, 2y+1) - правая стена клетки (x, y), см. Glyphs.VerticalWalls;
+//   - (2x+1, 2y+2) - нижняя стена клетки (x, y), см. Glyphs.HorizontalWalls;
+//   - (2x, 2y) - угол, при импорте не важен, при экспорте Glyphs.Corner, если к углу примыкает стена.
+//
+// Первая строка и первый столбец - нижние и правые стены клеток y = -1 и x = -1. Пробел(и конец
+// строки) - нет пола(стены). Заметки, link'и и effects не переносятся.
+package ascii_map
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"old-school-rpg-map-editor/models/map_model"
+	"old-school-rpg-map-editor/utils"
+	"os"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+type WallGlyph struct {
+	Wall uint32             `json:"wall"`
+	Kind map_model.WallKind `json:"kind,omitempty"`
+}
+
+// Соответствие символов тайлам. Ключи - строки из одного символа, пробел занят под "пусто".
+type Glyphs struct {
+	Corner          string               `json:"corner"`
+	Floors          map[string]uint32    `json:"floors"`
+	VerticalWalls   map[string]WallGlyph `json:"vertical_walls"`
+	HorizontalWalls map[string]WallGlyph `json:"horizontal_walls"`
+}
+
+var ErrNoGlyph = errors.New("no glyph")
+
+func DefaultGlyphs() Glyphs {
+	g := Glyphs{
+		Corner: "+",
+		Floors: make(map[string]uint32),
+		VerticalWalls: map[string]WallGlyph{
+			"|": {Wall: 1},
+			"D": {Wall: 1, Kind: map_model.DoorWall},
+			"L": {Wall: 1, Kind: map_model.LockedDoorWall},
+			"S": {Wall: 1, Kind: map_model.SecretDoorWall},
+			">": {Wall: 1, Kind: map_model.OneWayForwardWall},
+			"<": {Wall: 1, Kind: map_model.OneWayBackwardWall},
+			"?": {Wall: 1, Kind: map_model.IllusionaryWall},
+		},
+		HorizontalWalls: map[string]WallGlyph{
+			"-": {Wall: 1},
+			"D": {Wall: 1, Kind: map_model.DoorWall},
+			"L": {Wall: 1, Kind: map_model.LockedDoorWall},
+			"S": {Wall: 1, Kind: map_model.SecretDoorWall},
+			"v": {Wall: 1, Kind: map_model.OneWayForwardWall},
+			"^": {Wall: 1, Kind: map_model.OneWayBackwardWall},
+			"?": {Wall: 1, Kind: map_model.IllusionaryWall},
+		},
+	}
+
+	for i, r := range ".#~=:;%&@*o$!x_" {
+		g.Floors[string(r)] = uint32(i + 1)
+	}
+
+	return g
+}
+
+// Загружает Glyphs из json файла. Если файла нет - DefaultGlyphs.
+func LoadGlyphs(filePath string) (Glyphs, error) {
+	d, err := os.ReadFile(filePath)
+	if errors.Is(err, os.ErrNotExist) {
+		return DefaultGlyphs(), nil
+	}
+	if err != nil {
+		return Glyphs{}, err
+	}
+
+	var g Glyphs
+	if err := json.Unmarshal(d, &g); err != nil {
+		return Glyphs{}, fmt.Errorf("%s: %w", filePath, err)
+	}
+	if err := g.Check(); err != nil {
+		return Glyphs{}, fmt.Errorf("%s: %w", filePath, err)
+	}
+
+	return g, nil
+}
+
+func (g Glyphs) Check() error {
+	check := func(glyph string) error {
+		if utf8.RuneCountInString(glyph) != 1 || glyph == " " {
+			return fmt.Errorf("invalid glyph %q: must be one character, not a space", glyph)
+		}
+		return nil
+	}
+
+	if err := check(g.Corner); err != nil {
+		return err
+	}
+	for glyph := range g.Floors {
+		if err := check(glyph); err != nil {
+			return err
+		}
+	}
+	for glyph := range g.VerticalWalls {
+		if err := check(glyph); err != nil {
+			return err
+		}
+	}
+	for glyph := range g.HorizontalWalls {
+		if err := check(glyph); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Символ пола index
+func (g Glyphs) floorGlyph(index uint32) (rune, error) {
+	if index == 0 {
+		return ' ', nil
+	}
+
+	for _, glyph := range sortedKeys(g.Floors) {
+		if g.Floors[glyph] == index {
+			return []rune(glyph)[0], nil
+		}
+	}
+
+	return 0, fmt.Errorf("%w for floor %d", ErrNoGlyph, index)
+}
+
+// Символ стены wall вида kind. Если символа именно для этого тайла нет, то берётся символ
+// с тем же видом стены и другим тайлом.
+func wallGlyph(glyphs map[string]WallGlyph, wall uint32, kind map_model.WallKind) (rune, error) {
+	if wall == 0 {
+		return ' ', nil
+	}
+
+	keys := sortedKeys(glyphs)
+	for _, glyph := range keys {
+		if glyphs[glyph] == (WallGlyph{Wall: wall, Kind: kind}) {
+			return []rune(glyph)[0], nil
+		}
+	}
+	for _, glyph := range keys {
+		if glyphs[glyph].Kind == kind {
+			return []rune(glyph)[0], nil
+		}
+	}
+
+	return 0, fmt.Errorf("%w for %s", ErrNoGlyph, kind)
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Клетки, которые надо вывести: содержимое слоя без крайнего левого столбца(верхней строки),
+// если в нём только правые(нижние) стены - они и так попадают в первый столбец(строку) текста
+func exportBounds(locations map[utils.Int2]map_model.Location) (leftTop, rightBottom utils.Int2) {
+	leftTop = utils.NewInt2(math.MaxInt, math.MaxInt)
+	rightBottom = utils.NewInt2(math.MinInt, math.MinInt)
+
+	for pos, location := range locations {
+		if location.IsEmptyLocation() {
+			continue
+		}
+		leftTop = utils.NewInt2(utils.Min(leftTop.X, pos.X), utils.Min(leftTop.Y, pos.Y))
+		rightBottom = utils.NewInt2(utils.Max(rightBottom.X, pos.X+1), utils.Max(rightBottom.Y, pos.Y+1))
+	}
+	if leftTop.X == math.MaxInt {
+		return utils.Int2{}, utils.Int2{}
+	}
+
+	onlyRight, onlyBottom := true, true
+	for pos, location := range locations {
+		if location.Floor != 0 || location.BottomWall != 0 {
+			onlyRight = onlyRight && pos.X != leftTop.X
+		}
+		if location.Floor != 0 || location.RightWall != 0 {
+			onlyBottom = onlyBottom && pos.Y != leftTop.Y
+		}
+	}
+	if onlyRight {
+		leftTop.X++
+	}
+	if onlyBottom {
+		leftTop.Y++
+	}
+
+	return leftTop, rightBottom
+}
+
+// Переводит клетки слоя в текст, клетка leftTop содержимого слоя становится клеткой (0, 0) текста
+func Export(locations map[utils.Int2]map_model.Location, glyphs Glyphs) (string, error) {
+	leftTop, rightBottom := exportBounds(locations)
+	width, height := utils.Max(rightBottom.X-leftTop.X, 0), utils.Max(rightBottom.Y-leftTop.Y, 0)
+	if width == 0 || height == 0 {
+		return "", nil
+	}
+
+	corner := []rune(glyphs.Corner)[0]
+
+	lines := make([][]rune, 2*height+1)
+	for i := range lines {
+		lines[i] = []rune(strings.Repeat(" ", 2*width+1))
+	}
+
+	// x, y - координаты клеток текста, (-1, -1) - клетка левее и выше первой
+	for y := -1; y < height; y++ {
+		for x := -1; x < width; x++ {
+			location := locations[utils.NewInt2(x+leftTop.X, y+leftTop.Y)]
+
+			if x >= 0 && y >= 0 {
+				glyph, err := glyphs.floorGlyph(location.Floor)
+				if err != nil {
+					return "", fmt.Errorf("(%d, %d): %w", x+leftTop.X, y+leftTop.Y, err)
+				}
+				lines[2*y+1][2*x+1] = glyph
+			}
+
+			if y >= 0 {
+				glyph, err := wallGlyph(glyphs.VerticalWalls, location.RightWall, location.RightWallKind)
+				if err != nil {
+					return "", fmt.Errorf("(%d, %d): %w", x+leftTop.X, y+leftTop.Y, err)
+				}
+				lines[2*y+1][2*x+2] = glyph
+			}
+
+			if x >= 0 {
+				glyph, err := wallGlyph(glyphs.HorizontalWalls, location.BottomWall, location.BottomWallKind)
+				if err != nil {
+					return "", fmt.Errorf("(%d, %d): %w", x+leftTop.X, y+leftTop.Y, err)
+				}
+				lines[2*y+2][2*x+1] = glyph
+			}
+		}
+	}
+
+	// углы, к которым примыкает хотя бы одна стена
+	at := func(col, row int) rune {
+		if row < 0 || row >= len(lines) || col < 0 || col >= len(lines[row]) {
+			return ' '
+		}
+		return lines[row][col]
+	}
+	for row := 0; row < len(lines); row += 2 {
+		for col := 0; col < len(lines[row]); col += 2 {
+			if at(col-1, row) != ' ' || at(col+1, row) != ' ' || at(col, row-1) != ' ' || at(col, row+1) != ' ' {
+				lines[row][col] = corner
+			}
+		}
+	}
+
+	var b strings.Builder
+	for _, line := range lines {
+		b.WriteString(strings.TrimRight(string(line), " "))
+		b.WriteByte('\n')
+	}
+
+	return b.String(), nil
+}
+
+// Переводит текст(см. Export) в клетки слоя, клетка (0, 0) текста становится клеткой origin
+func Import(text string, glyphs Glyphs, origin utils.Int2) (map[utils.Int2]map_model.Location, error) {
+	locations := make(map[utils.Int2]map_model.Location)
+
+	lines := strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+	for row, line := range lines {
+		for col, r := range []rune(line) {
+			if r == ' ' || r == '\t' || (row%2 == 0 && col%2 == 0) {
+				continue
+			}
+
+			glyph := string(r)
+			// клетка, к которой относится символ: стены - к клетке левее(выше) границы
+			pos := utils.NewInt2((col-1)/2+origin.X, (row-1)/2+origin.Y)
+			if col == 0 {
+				pos.X = origin.X - 1
+			}
+			if row == 0 {
+				pos.Y = origin.Y - 1
+			}
+			location := locations[pos]
+
+			switch {
+			case row%2 == 1 && col%2 == 1:
+				floor, ok := glyphs.Floors[glyph]
+				if !ok {
+					return nil, fmt.Errorf("line %d, column %d: unknown floor %q", row+1, col+1, glyph)
+				}
+				location.Floor = floor
+			case row%2 == 1:
+				wall, ok := glyphs.VerticalWalls[glyph]
+				if !ok {
+					return nil, fmt.Errorf("line %d, column %d: unknown vertical wall %q", row+1, col+1, glyph)
+				}
+				location.RightWall, location.RightWallKind = wall.Wall, wall.Kind
+			default:
+				wall, ok := glyphs.HorizontalWalls[glyph]
+				if !ok {
+					return nil, fmt.Errorf("line %d, column %d: unknown horizontal wall %q", row+1, col+1, glyph)
+				}
+				location.BottomWall, location.BottomWallKind = wall.Wall, wall.Kind
+			}
+
+			locations[pos] = location
+		}
+	}
+
+	return locations, nil
+}
@@ -0,0 +1,164 @@
+package autosave
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"old-school-rpg-map-editor/common/load_save"
+	"old-school-rpg-map-editor/models/maps_model"
+	"old-school-rpg-map-editor/utils"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Для каждой несохранённой карты в директории восстановления лежат два файла:
+// <id>.map - сама карта и <id>.json - recoveryInfo
+const (
+	mapExt  = ".map"
+	infoExt = ".json"
+)
+
+type recoveryInfo struct {
+	FilePath string    `json:"file_path"` // исходный файл карты, пустой если карту ещё не сохраняли
+	SavedAt  time.Time `json:"saved_at"`
+}
+
+// Периодически сохраняет изменённые(ChangeGeneration != SavedChangeGeneration) карты в директорию
+// восстановления и удаляет оттуда сохранённые и закрытые карты
+type Autosave struct {
+	mutex     sync.Mutex
+	mapsModel *maps_model.MapsModel
+	dir       string
+	saved     map[uuid.UUID]uint64 // ChangeGeneration, с которым карта лежит в dir
+}
+
+func NewAutosave(mapsModel *maps_model.MapsModel, dir string) *Autosave {
+	return &Autosave{
+		mapsModel: mapsModel,
+		dir:       dir,
+		saved:     make(map[uuid.UUID]uint64),
+	}
+}
+
+// Запускает автосохранение раз в interval. Возвращает функцию, которая делает последнее
+// сохранение и останавливает автосохранение.
+func (a *Autosave) Start(interval time.Duration) (stop func()) {
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+
+	go func() {
+		defer close(stopped)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				err := a.Save()
+				if err != nil {
+					// TODO
+					fmt.Println(err)
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		<-stopped
+
+		err := a.Save()
+		if err != nil {
+			// TODO
+			fmt.Println(err)
+		}
+	}
+}
+
+// Один проход автосохранения
+func (a *Autosave) Save() error {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	var firstErr error // проход не прерывается из-за одной карты
+
+	alive := make(map[uuid.UUID]struct{})
+	for _, mapElem := range a.mapsModel.MapElems() {
+		if mapElem.ChangeGeneration == mapElem.SavedChangeGeneration {
+			continue
+		}
+
+		alive[mapElem.MapId] = struct{}{}
+
+		if generation, exists := a.saved[mapElem.MapId]; exists && generation == mapElem.ChangeGeneration {
+			continue
+		}
+
+		err := a.write(mapElem)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+
+		a.saved[mapElem.MapId] = mapElem.ChangeGeneration
+	}
+
+	// карту сохранили или закрыли - восстанавливать нечего
+	for mapId := range a.saved {
+		if _, exists := alive[mapId]; !exists {
+			err := removeRecovery(a.dir, mapId.String())
+			if err != nil {
+				if firstErr == nil {
+					firstErr = err
+				}
+				continue
+			}
+
+			delete(a.saved, mapId)
+		}
+	}
+
+	return firstErr
+}
+
+func (a *Autosave) write(mapElem maps_model.MapElem) error {
+	base := filepath.Join(a.dir, mapElem.MapId.String())
+
+	err := utils.WriteFileAtomic(base+mapExt, func(w io.Writer) error {
+		return load_save.SaveMapFileWithHistory(w, mapElem.Model, mapElem.NotesModel, a.mapsModel.History(mapElem.MapId))
+	})
+	if err != nil {
+		return err
+	}
+
+	return utils.WriteFileAtomic(base+infoExt, func(w io.Writer) error {
+		return json.NewEncoder(w).Encode(recoveryInfo{FilePath: mapElem.FilePath, SavedAt: time.Now()})
+	})
+}
+
+func removeRecovery(dir string, id string) error {
+	base := filepath.Join(dir, id)
+
+	err := os.Remove(base + mapExt)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	err = os.Remove(base + infoExt)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,98 @@
+package autosave
+
+import (
+	"encoding/json"
+	"fmt"
+	"old-school-rpg-map-editor/common/load_save"
+	"old-school-rpg-map-editor/models/maps_model"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Карта, оставшаяся в директории восстановления после прошлого запуска
+type Recovery struct {
+	dir      string
+	id       string
+	FilePath string // исходный файл карты, пустой если карту ни разу не сохраняли
+	SavedAt  time.Time
+}
+
+func (r Recovery) String() string {
+	name := r.FilePath
+	if len(name) == 0 {
+		name = "Untitled"
+	}
+	return fmt.Sprintf("%s (%s)", name, r.SavedAt.Format("2006-01-02 15:04:05"))
+}
+
+// Ищет в dir карты, оставшиеся после прошлого запуска. Должна вызываться до запуска Autosave
+// в этой же директории.
+func Recoveries(dir string) ([]Recovery, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []Recovery
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || filepath.Ext(name) != infoExt {
+			continue
+		}
+
+		id := strings.TrimSuffix(name, infoExt)
+		if _, err := os.Stat(filepath.Join(dir, id+mapExt)); err != nil {
+			continue
+		}
+
+		d, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			return nil, err
+		}
+
+		var info recoveryInfo
+		err = json.Unmarshal(d, &info)
+		if err != nil {
+			// битый файл - восстановить всё равно не получится
+			continue
+		}
+
+		result = append(result, Recovery{dir: dir, id: id, FilePath: info.FilePath, SavedAt: info.SavedAt})
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].SavedAt.Before(result[j].SavedAt)
+	})
+
+	return result, nil
+}
+
+// Открывает восстановленную карту в mapsModel как несохранённую и удаляет файлы восстановления.
+// historyErr - см. maps_model.MapsModel.Open
+func (r Recovery) Restore(mapsModel *maps_model.MapsModel) (mapId uuid.UUID, historyErr error, err error) {
+	f, err := os.Open(filepath.Join(r.dir, r.id+mapExt))
+	if err != nil {
+		return uuid.UUID{}, nil, err
+	}
+	defer f.Close()
+
+	mapModel, notesModel, history, historyErr, err := load_save.LoadMapFileWithHistory(f)
+	if err != nil {
+		return uuid.UUID{}, nil, err
+	}
+
+	mapId = mapsModel.AddLoaded(mapModel, notesModel, history, r.FilePath)
+	mapsModel.MarkUnsaved(mapId)
+
+	return mapId, historyErr, r.Remove()
+}
+
+// Удаляет файлы восстановления
+func (r Recovery) Remove() error {
+	return removeRecovery(r.dir, r.id)
+}
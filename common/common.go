@@ -19,7 +19,11 @@ func MakeAction(action undo_redo.UndoRedoAction, mapsModel *maps_model.MapsModel
 	mapElem := mapsModel.GetById(mapId)
 
 	if _, ok := action.(undo_redo.UndoRedoActionContainer); !ok {
-		action.Redo(undo_redo.NewUndoRedoActionModels(mapElem.Model, mapElem.RotateModel, mapElem.RotMapModel, mapElem.RotSelectModel, mapElem.SelectModel, mapElem.ModeModel, mapElem.SelectedLayerModel, mapElem.CenterModel))
+		action.Redo(undo_redo.NewUndoRedoActionModels(mapElem.Model, mapElem.RotateModel, mapElem.RotMapModel, mapElem.RotSelectModel, mapElem.SelectModel, mapElem.ModeModel, mapElem.SelectedLayerModel, mapElem.CenterModel, mapElem.PartyModel, mapElem.NotesModel))
+		// неудачный Redo ничего не изменил, в историю его не кладём
+		if err := undo_redo.ActionErr(action); err != nil {
+			return err
+		}
 	}
 
 	regularAddAction := func(action undo_redo.UndoRedoAction) error {
@@ -38,7 +42,10 @@ func MakeAction(action undo_redo.UndoRedoAction, mapsModel *maps_model.MapsModel
 	} else {
 		act := mapElem.UndoRedoQueue.Action(mapElem.ChangeGeneration).Action
 		t := reflect.TypeOf(act)
-		if container, ok := act.(undo_redo.UndoRedoActionContainer); ok && t == addToContainer {
+		// в контейнер, после которого уже есть правки(мы в нём после Undo), добавлять нельзя:
+		// эти правки делались без добавленного
+		hasAfter := mapElem.UndoRedoQueue.ActionAfter(mapElem.ChangeGeneration).Action != nil
+		if container, ok := act.(undo_redo.UndoRedoActionContainer); ok && t == addToContainer && !hasAfter {
 			if !container.Add(action) {
 				return regularAddAction(action)
 			}
@@ -56,3 +63,25 @@ func MakeAction(action undo_redo.UndoRedoAction, mapsModel *maps_model.MapsModel
 		}
 	}
 }
+
+// Переходит по истории правок карты mapId в правку changeGeneration, например, в брошенную ветку
+func SwitchHistory(mapsModel *maps_model.MapsModel, mapId uuid.UUID, changeGeneration uint64) error {
+	mapElem := mapsModel.GetById(mapId)
+
+	undo, redo, err := mapElem.UndoRedoQueue.Switch(mapElem.ChangeGeneration, changeGeneration)
+	if err != nil {
+		return err
+	}
+
+	actionModels := undo_redo.NewUndoRedoActionModels(mapElem.Model, mapElem.RotateModel, mapElem.RotMapModel, mapElem.RotSelectModel, mapElem.SelectModel, mapElem.ModeModel, mapElem.SelectedLayerModel, mapElem.CenterModel, mapElem.PartyModel, mapElem.NotesModel)
+	for _, e := range undo {
+		e.Action.Undo(actionModels)
+	}
+	for _, e := range redo {
+		e.Action.Redo(actionModels)
+	}
+
+	mapsModel.SetChangeGeneration(mapId, changeGeneration)
+
+	return nil
+}
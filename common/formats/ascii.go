@@ -0,0 +1,79 @@
+package formats
+
+import (
+	"io"
+	"old-school-rpg-map-editor/common/ascii_map"
+	"old-school-rpg-map-editor/models/map_model"
+	"old-school-rpg-map-editor/models/notes_model"
+	"old-school-rpg-map-editor/utils"
+
+	"github.com/google/uuid"
+)
+
+func init() {
+	formats = append(formats, Format{
+		Name:       "ascii",
+		Extensions: []string{".txt"},
+		Read:       readASCII,
+		Write:      writeASCII,
+	})
+}
+
+// Карта из одного слоя на уровне 0, см. ascii_map
+func readASCII(reader io.Reader) (*map_model.MapModel, *notes_model.NotesModel, error) {
+	d, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	locations, err := ascii_map.Import(string(d), ascii_map.DefaultGlyphs(), utils.Int2{})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	mapModel := map_model.NewMapModel()
+	layerIndex := mapModel.AddLayerWithId(uuid.New(), map_model.RegularLayerType, 0)
+	mapModel.SetName(layerIndex, "ASCII")
+	err = mapModel.SetLocations(layerIndex, locations)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return mapModel, notes_model.NewNotesModel(8, nil), nil
+}
+
+// Видимые полы и стены текущего уровня, как их показывает редактор
+func visibleLocations(mapModel *map_model.MapModel) map[utils.Int2]map_model.Location {
+	cells := make(map[utils.Int2]struct{})
+	for _, layerIndex := range mapModel.LayerIndicesByLevel(mapModel.Level()) {
+		for pos := range mapModel.Locations(layerIndex) {
+			cells[pos] = struct{}{}
+		}
+	}
+
+	locations := make(map[utils.Int2]map_model.Location)
+	for pos := range cells {
+		var location map_model.Location
+		_, location.Floor = mapModel.VisibleFloor(pos.X, pos.Y)
+		_, location.RightWall = mapModel.VisibleWall(pos.X, pos.Y, true)
+		_, location.BottomWall = mapModel.VisibleWall(pos.X, pos.Y, false)
+		_, location.RightWallKind = mapModel.VisibleWallKind(pos.X, pos.Y, true)
+		_, location.BottomWallKind = mapModel.VisibleWallKind(pos.X, pos.Y, false)
+
+		if !location.IsEmptyLocation() {
+			locations[pos] = location
+		}
+	}
+
+	return locations
+}
+
+func writeASCII(writer io.Writer, mapModel *map_model.MapModel, notesModel *notes_model.NotesModel) error {
+	text, err := ascii_map.Export(visibleLocations(mapModel), ascii_map.DefaultGlyphs())
+	if err != nil {
+		return err
+	}
+
+	_, err = io.WriteString(writer, text)
+	return err
+}
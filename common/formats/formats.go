@@ -0,0 +1,80 @@
+package formats
+
+import (
+	"fmt"
+	"io"
+	"old-school-rpg-map-editor/common/load_save"
+	"old-school-rpg-map-editor/models/map_model"
+	"old-school-rpg-map-editor/models/notes_model"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/exp/slices"
+)
+
+// Формат файла карты. Read или Write может быть nil, если формат только для экспорта(импорта).
+type Format struct {
+	Name       string
+	Extensions []string // с точкой, в нижнем регистре
+	Read       func(reader io.Reader) (*map_model.MapModel, *notes_model.NotesModel, error)
+	Write      func(writer io.Writer, mapModel *map_model.MapModel, notesModel *notes_model.NotesModel) error
+}
+
+// Формат, в котором редактор хранит карты
+const NativeFormat = "map"
+
+var formats = []Format{
+	{
+		Name:       NativeFormat,
+		Extensions: []string{".map"},
+		Read:       load_save.LoadMapFile,
+		Write:      load_save.SaveMapFile,
+	},
+	{
+		Name:       "json",
+		Extensions: []string{".json"},
+		Read: func(reader io.Reader) (*map_model.MapModel, *notes_model.NotesModel, error) {
+			d, err := io.ReadAll(reader)
+			if err != nil {
+				return nil, nil, err
+			}
+			return load_save.Decode(d)
+		},
+		Write: func(writer io.Writer, mapModel *map_model.MapModel, notesModel *notes_model.NotesModel) error {
+			d, err := load_save.Encode(mapModel, notesModel)
+			if err != nil {
+				return err
+			}
+			_, err = writer.Write(d)
+			return err
+		},
+	},
+}
+
+func Formats() []Format {
+	return slices.Clone(formats)
+}
+
+// Расширения форматов, которые можно читать(read) или писать
+func Extensions(read bool) []string {
+	var result []string
+	for _, f := range formats {
+		if (read && f.Read != nil) || (!read && f.Write != nil) {
+			result = append(result, f.Extensions...)
+		}
+	}
+	return result
+}
+
+// Формат по расширению файла
+func ByPath(filePath string) (Format, error) {
+	ext := strings.ToLower(filepath.Ext(filePath))
+
+	for _, f := range formats {
+		if slices.Contains(f.Extensions, ext) {
+			return f, nil
+		}
+	}
+
+	return Format{}, fmt.Errorf("unknown format of %s", filePath)
+}
@@ -0,0 +1,42 @@
+package formats
+
+import (
+	"io"
+	"old-school-rpg-map-editor/common/tiled"
+	"old-school-rpg-map-editor/models/map_model"
+	"old-school-rpg-map-editor/models/notes_model"
+)
+
+func init() {
+	formats = append(formats,
+		Format{
+			Name:       "tmx",
+			Extensions: []string{".tmx"},
+			Read:       readTiled(tiled.ReadTMX),
+			Write:      writeTiled(tiled.WriteTMX),
+		},
+		Format{
+			Name:       "tmj",
+			Extensions: []string{".tmj"},
+			Read:       readTiled(tiled.ReadTMJ),
+			Write:      writeTiled(tiled.WriteTMJ),
+		},
+	)
+}
+
+func readTiled(read func(io.Reader) (*tiled.Map, error)) func(io.Reader) (*map_model.MapModel, *notes_model.NotesModel, error) {
+	return func(reader io.Reader) (*map_model.MapModel, *notes_model.NotesModel, error) {
+		m, err := read(reader)
+		if err != nil {
+			return nil, nil, err
+		}
+		return tiled.Import(m)
+	}
+}
+
+// Полы ссылаются на стандартный набор тайлов, см. tiled.DefaultTileset
+func writeTiled(write func(io.Writer, *tiled.Map) error) func(io.Writer, *map_model.MapModel, *notes_model.NotesModel) error {
+	return func(writer io.Writer, mapModel *map_model.MapModel, notesModel *notes_model.NotesModel) error {
+		return write(writer, tiled.Export(mapModel, notesModel, tiled.DefaultTileset()))
+	}
+}
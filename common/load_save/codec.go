@@ -0,0 +1,136 @@
+package load_save
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"old-school-rpg-map-editor/models/map_model"
+	"old-school-rpg-map-editor/models/notes_model"
+	"old-school-rpg-map-editor/undo_redo"
+)
+
+// Версия формата, которую пишет редактор. История версий - см. migrations
+const CurrentVersion = 8
+
+var ErrUnsupportedVersion = errors.New("unsupported map file version")
+
+// Документ .map файла последней версии
+type document struct {
+	Version    int                     `json:"version"`
+	MapModel   *map_model.MapModel     `json:"map"`
+	NotesModel *notes_model.NotesModel `json:"notes"`
+	History    json.RawMessage         `json:"history,omitempty"` // undo_redo.History, если её сохраняли
+}
+
+// Документ произвольной версии, в таком виде его меняют миграции
+type rawDocument map[string]any
+
+func (d rawDocument) version() (int, error) {
+	v, ok := d["version"].(json.Number)
+	if !ok {
+		return 0, fmt.Errorf("%w: no version", ErrUnsupportedVersion)
+	}
+
+	version, err := v.Int64()
+	if err != nil {
+		return 0, fmt.Errorf("%w: %v", ErrUnsupportedVersion, err)
+	}
+
+	return int(version), nil
+}
+
+// Переводит json документ любой поддерживаемой версии в модели
+func Decode(d []byte) (*map_model.MapModel, *notes_model.NotesModel, error) {
+	mapModel, notesModel, _, _, err := DecodeWithHistory(d)
+	return mapModel, notesModel, err
+}
+
+// То же, что Decode, но ещё возвращает историю правок. Если истории нет или она не читается,
+// то history == nil: карта без истории всё равно нужна. Почему история не прочиталась,
+// возвращается в historyErr, это не ошибка загрузки карты
+func DecodeWithHistory(d []byte) (mapModel *map_model.MapModel, notesModel *notes_model.NotesModel, history *undo_redo.History, historyErr error, err error) {
+	decoder := json.NewDecoder(bytes.NewReader(d))
+	decoder.UseNumber() // чтобы при миграции не терять точность uint32/int64
+
+	var raw rawDocument
+	err = decoder.Decode(&raw)
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+
+	version, err := raw.version()
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+	if version < 1 || version > CurrentVersion {
+		return nil, nil, nil, nil, fmt.Errorf("%w: %d", ErrUnsupportedVersion, version)
+	}
+
+	err = migrate(raw, version)
+	if err != nil {
+		return nil, nil, nil, nil, fmt.Errorf("migration from version %d: %w", version, err)
+	}
+
+	d, err = json.Marshal(raw)
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+
+	var t document
+	err = json.Unmarshal(d, &t)
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+
+	if t.MapModel == nil || t.NotesModel == nil {
+		return nil, nil, nil, nil, errors.New("map file has no map or notes")
+	}
+
+	if len(t.History) > 0 {
+		history, historyErr = decodeHistory(t.History)
+	}
+
+	return t.MapModel, t.NotesModel, history, historyErr, nil
+}
+
+func decodeHistory(d []byte) (*undo_redo.History, error) {
+	history := &undo_redo.History{Queue: undo_redo.NewUndoRedoQueue(0)}
+
+	err := json.Unmarshal(d, history)
+	if err != nil {
+		return nil, fmt.Errorf("undo history: %w", err)
+	}
+	if !history.Queue.Contains(history.ChangeGeneration) {
+		return nil, fmt.Errorf("undo history: no generation %d", history.ChangeGeneration)
+	}
+	if history.Angle < 0 || history.Angle >= 360 || history.Angle%90 != 0 {
+		return nil, fmt.Errorf("undo history: bad angle %d", history.Angle)
+	}
+
+	return history, nil
+}
+
+// Переводит модели в json документ версии CurrentVersion
+func Encode(mapModel *map_model.MapModel, notesModel *notes_model.NotesModel) ([]byte, error) {
+	return EncodeWithHistory(mapModel, notesModel, nil)
+}
+
+// То же, что Encode, но с историей правок. history == nil - без истории
+func EncodeWithHistory(mapModel *map_model.MapModel, notesModel *notes_model.NotesModel, history *undo_redo.History) ([]byte, error) {
+	t := document{
+		Version:    CurrentVersion,
+		MapModel:   mapModel,
+		NotesModel: notesModel,
+	}
+
+	if history != nil {
+		var err error
+		t.History, err = json.Marshal(history)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return json.Marshal(&t)
+}
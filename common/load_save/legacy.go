@@ -0,0 +1,105 @@
+package load_save
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/exp/slices"
+)
+
+// Старые версии формата в том виде, в каком их писал редактор. Миграции разбирают старые данные
+// только этими типами, а не моделями: изменения моделей не должны менять чтение старых файлов.
+
+// Клетка слоя версии 7, "(x,y)" в ключе locations
+type locationV7 struct {
+	Floor          uint32 `json:"floor,omitempty"`
+	RightWall      uint32 `json:"right_wall,omitempty"`
+	BottomWall     uint32 `json:"bottom_wall,omitempty"`
+	RightWallKind  int    `json:"right_wall_kind,omitempty"` // 0 - обычная стена
+	BottomWallKind int    `json:"bottom_wall_kind,omitempty"`
+	NoteId         string `json:"note_id,omitempty"`
+	Link           any    `json:"link,omitempty"`
+	Effects        uint32 `json:"effects,omitempty"`
+	Markers        []any  `json:"markers,omitempty"`
+}
+
+func parsePosV7(key string) (x, y int, err error) {
+	_, err = fmt.Sscanf(key, "(%d,%d)", &x, &y)
+	return x, y, err
+}
+
+func (l locationV7) hasRightWall() bool {
+	return l.RightWall != 0 || l.RightWallKind != 0
+}
+
+func (l locationV7) hasBottomWall() bool {
+	return l.BottomWall != 0 || l.BottomWallKind != 0
+}
+
+// Есть ли в клетке что-то кроме стен
+func (l locationV7) hasContent() bool {
+	return l.Floor != 0 || len(l.NoteId) > 0 || l.Link != nil || l.Effects != 0 || len(l.Markers) > 0
+}
+
+// Заметка версии 6
+type noteV6 struct {
+	Id      string    `json:"id"`
+	Title   string    `json:"title"`
+	Body    string    `json:"body"`
+	Tags    []string  `json:"tags,omitempty"`
+	Color   string    `json:"color,omitempty"`
+	Created time.Time `json:"created"`
+}
+
+// Строка, с которой начинается заметка в тексте версии 5: "- id заголовок"
+var noteLineV5 = regexp.MustCompile(`^-\s*(\S{1,5})\b\s*(.*)$`)
+
+// Разбирает заметки версии 5. Повторная заметка с тем же id дописывается к первой, текст до
+// первой заметки становится заметкой со свободным числовым id
+func parseNotesV5(text string) []noteV6 {
+	notes := []noteV6{}
+	var preamble []string
+
+	current := -1
+	for _, s := range strings.Split(text, "\n") {
+		sub := noteLineV5.FindStringSubmatch(s)
+		if len(sub) != 3 {
+			if current == -1 {
+				preamble = append(preamble, s)
+			} else {
+				notes[current].Body += "\n" + s
+			}
+			continue
+		}
+
+		noteId, title := sub[1], strings.TrimLeft(sub[2], " \t.:)-")
+
+		current = slices.IndexFunc(notes, func(n noteV6) bool { return n.Id == noteId })
+		if current == -1 {
+			notes = append(notes, noteV6{Id: noteId, Title: title})
+			current = len(notes) - 1
+		} else {
+			notes[current].Body += "\n" + title
+		}
+	}
+
+	for i := range notes {
+		notes[i].Body = strings.TrimSpace(notes[i].Body)
+	}
+
+	if body := strings.TrimSpace(strings.Join(preamble, "\n")); len(body) > 0 {
+		freeId := ""
+		for i := 1; len(freeId) == 0; i++ {
+			noteId := strconv.Itoa(i)
+			if slices.IndexFunc(notes, func(n noteV6) bool { return n.Id == noteId }) == -1 {
+				freeId = noteId
+			}
+		}
+		notes = append([]noteV6{{Id: freeId, Body: body}}, notes...)
+	}
+
+	return notes
+}
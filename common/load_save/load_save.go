@@ -2,38 +2,52 @@ package load_save
 
 import (
 	"compress/gzip"
-	"encoding/json"
-	"errors"
 	"io"
 	"old-school-rpg-map-editor/models/map_model"
 	"old-school-rpg-map-editor/models/notes_model"
+	"old-school-rpg-map-editor/undo_redo"
 )
 
-func LoadMapFile(reader io.ReadCloser) (*map_model.MapModel, *notes_model.NotesModel, error) {
+// Загружает .map файл(gzip + json) любой поддерживаемой версии
+func LoadMapFile(reader io.Reader) (*map_model.MapModel, *notes_model.NotesModel, error) {
+	mapModel, notesModel, _, _, err := LoadMapFileWithHistory(reader)
+	return mapModel, notesModel, err
+}
+
+// То же, что LoadMapFile, но ещё возвращает историю правок(см. DecodeWithHistory)
+func LoadMapFileWithHistory(reader io.Reader) (mapModel *map_model.MapModel, notesModel *notes_model.NotesModel, history *undo_redo.History, historyErr error, err error) {
 	greader, err := gzip.NewReader(reader)
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, nil, nil, err
 	}
 
 	d, err := io.ReadAll(greader)
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, nil, nil, err
 	}
 
-	var t struct {
-		Version    int                     `json:"version"`
-		MapModel   *map_model.MapModel     `json:"map"`
-		NotesModel *notes_model.NotesModel `json:"notes"`
-	}
+	return DecodeWithHistory(d)
+}
 
-	err = json.Unmarshal(d, &t)
+// Сохраняет .map файл в версии CurrentVersion
+func SaveMapFile(writer io.Writer, mapModel *map_model.MapModel, notesModel *notes_model.NotesModel) error {
+	return SaveMapFileWithHistory(writer, mapModel, notesModel, nil)
+}
+
+// То же, что SaveMapFile, но с историей правок. history == nil - без истории
+func SaveMapFileWithHistory(writer io.Writer, mapModel *map_model.MapModel, notesModel *notes_model.NotesModel, history *undo_redo.History) error {
+	d, err := EncodeWithHistory(mapModel, notesModel, history)
 	if err != nil {
-		return nil, nil, err
+		return err
 	}
 
-	if t.Version != 1 {
-		return nil, nil, errors.New("unsupported version")
+	gwriter := gzip.NewWriter(writer)
+
+	_, err = gwriter.Write(d)
+	if err != nil {
+		gwriter.Close()
+		return err
 	}
 
-	return t.MapModel, t.NotesModel, nil
+	return gwriter.Close()
 }
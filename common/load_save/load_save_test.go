@@ -0,0 +1,139 @@
+package load_save
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"old-school-rpg-map-editor/common/tileset"
+	"old-school-rpg-map-editor/models/map_model"
+	"old-school-rpg-map-editor/models/notes_model"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/exp/slices"
+)
+
+// Файлы testdata/vN.map - одна и та же карта, сохранённая редактором версии N: слой с полом, стенами
+// и заметкой в клетке (0, 0), заметки "1" и "2". Размеры появились в версии 3,
+// набор тайлов - в 4(для набора по умолчанию редактор пишет пустой Ref), заметки-записи - в 6,
+// отметки - в 7. Версия 7 не проверяла размеры, в v7.map есть клетка (9, 2) за краем 8x8,
+// см. migrateV7ToV8
+func loadFixture(t *testing.T, version int) (*map_model.MapModel, *notes_model.NotesModel) {
+	t.Helper()
+
+	f, err := os.Open(filepath.Join("testdata", fmt.Sprintf("v%d.map", version)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	mapModel, notesModel, err := LoadMapFile(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return mapModel, notesModel
+}
+
+func TestLoadFixtures(t *testing.T) {
+	for version := 1; version <= CurrentVersion; version++ {
+		t.Run(fmt.Sprintf("v%d", version), func(t *testing.T) {
+			mapModel, notesModel := loadFixture(t, version)
+
+			if mapModel.NumLayers() != 1 {
+				t.Fatalf("layers: got %d, want 1", mapModel.NumLayers())
+			}
+			if level := mapModel.LayerInfo(0).Level; level != 0 {
+				t.Errorf("layer level: got %d, want 0", level)
+			}
+			if mapModel.Level() != 0 {
+				t.Errorf("level: got %d, want 0", mapModel.Level())
+			}
+
+			if floor := mapModel.Floor(0, 0, 0); floor != 1 {
+				t.Errorf("floor: got %d, want 1", floor)
+			}
+			if wall := mapModel.Wall(0, 0, 0, true); wall != 2 {
+				t.Errorf("right wall: got %d, want 2", wall)
+			}
+			if wall := mapModel.Wall(1, 0, 0, false); wall != 1 {
+				t.Errorf("bottom wall: got %d, want 1", wall)
+			}
+			if noteId := mapModel.NoteId(0, 0, 0); noteId != "1" {
+				t.Errorf("note id: got %q, want %q", noteId, "1")
+			}
+
+			wantDimensions := map_model.Dimensions{}
+			switch {
+			case version == 7:
+				// клетка (9, 2) за краем 8x8
+				wantDimensions = map_model.Dimensions{Width: 10, Height: 8}
+			case version >= 3:
+				wantDimensions = map_model.Dimensions{Width: 8, Height: 8}
+			}
+			if mapModel.Dimensions() != wantDimensions {
+				t.Errorf("dimensions: got %v, want %v", mapModel.Dimensions(), wantDimensions)
+			}
+
+			if mapModel.Tileset() != (tileset.Ref{}) {
+				t.Errorf("tileset: got %v, want the default", mapModel.Tileset())
+			}
+
+			// в версиях 1-5 заметки - текст, их разбирает migrateV5ToV6
+			wantNotes := []notes_model.Note{
+				{Id: "1", Title: "Entrance", Body: "Stairs up"},
+				{Id: "2", Title: "Hall"},
+			}
+			if notes := notesModel.Notes(); !slices.EqualFunc(notes, wantNotes, func(a, b notes_model.Note) bool {
+				return a.Id == b.Id && a.Title == b.Title && a.Body == b.Body && len(a.Tags) == 0
+			}) {
+				t.Errorf("notes: got %+v, want %+v", notes, wantNotes)
+			}
+
+			var wantMarkers []map_model.Marker
+			if version >= 7 {
+				wantMarkers = []map_model.Marker{{Icon: map_model.ChestMarker, NoteId: "1"}}
+			}
+			if markers := mapModel.Markers(0, 0, 0); !slices.Equal(markers, wantMarkers) {
+				t.Errorf("markers: got %v, want %v", markers, wantMarkers)
+			}
+		})
+	}
+}
+
+func TestEncodeDecodeRoundTrip(t *testing.T) {
+	for version := 1; version <= CurrentVersion; version++ {
+		t.Run(fmt.Sprintf("v%d", version), func(t *testing.T) {
+			mapModel, notesModel := loadFixture(t, version)
+
+			d, err := Encode(mapModel, notesModel)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			decoder := json.NewDecoder(bytes.NewReader(d))
+			decoder.UseNumber()
+			var raw rawDocument
+			if err := decoder.Decode(&raw); err != nil {
+				t.Fatal(err)
+			}
+			if v, err := raw.version(); err != nil || v != CurrentVersion {
+				t.Fatalf("version: got %d(%v), want %d", v, err, CurrentVersion)
+			}
+
+			mapModel2, notesModel2, err := Decode(d)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			d2, err := Encode(mapModel2, notesModel2)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(d, d2) {
+				t.Errorf("round trip changed the document:\n%s\n%s", d, d2)
+			}
+		})
+	}
+}
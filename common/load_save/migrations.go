@@ -0,0 +1,227 @@
+package load_save
+
+import (
+	"encoding/json"
+	"errors"
+	"old-school-rpg-map-editor/utils"
+	"strconv"
+)
+
+// Миграция документа версии N в версию N+1
+type migration func(raw rawDocument) error
+
+// migrations[N] переводит документ из версии N в N+1. При изменении формата надо увеличить
+// CurrentVersion и добавить сюда миграцию с предыдущей версии.
+var migrations = map[int]migration{
+	1: migrateV1ToV2, // у слоёв появился уровень(этаж) подземелья
+	2: migrateV2ToV3, // у карты появились размеры(ограниченная/завёрнутая карта)
+	3: migrateV3ToV4, // у карты появился набор тайлов
+	4: migrateV4ToV5, // в файле может быть история правок
+	5: migrateV5ToV6, // заметки - записи вместо одного текста
+	6: migrateV6ToV7, // в клетках могут быть отметки
+	7: migrateV7ToV8, // непустые клетки лежат только на карте
+}
+
+// Применяет к raw все миграции начиная с version
+func migrate(raw rawDocument, version int) error {
+	for v := version; v < CurrentVersion; v++ {
+		m, exists := migrations[v]
+		if !exists {
+			return errors.New("no migration")
+		}
+
+		err := m(raw)
+		if err != nil {
+			return err
+		}
+
+		raw["version"] = json.Number(strconv.Itoa(v + 1))
+	}
+
+	return nil
+}
+
+// Возвращает объект по пути keys(например "map", "layers"), nil если его нет
+func rawObject(raw map[string]any, keys ...string) map[string]any {
+	for _, key := range keys {
+		next, ok := raw[key].(map[string]any)
+		if !ok {
+			return nil
+		}
+		raw = next
+	}
+	return raw
+}
+
+// Все слои версии 1 лежат на уровне 0
+func migrateV1ToV2(raw rawDocument) error {
+	mapObject := rawObject(raw, "map")
+	if mapObject == nil {
+		return nil
+	}
+
+	layers, _ := mapObject["layers"].([]any)
+	for _, layer := range layers {
+		layerObject, _ := layer.(map[string]any)
+		info := rawObject(layerObject, "info")
+		if info == nil {
+			return errors.New("layer without info")
+		}
+		if _, exists := info["level"]; !exists {
+			info["level"] = json.Number("0")
+		}
+	}
+
+	return nil
+}
+
+// Карты версии 2 не ограничены
+func migrateV2ToV3(raw rawDocument) error {
+	mapObject := rawObject(raw, "map")
+	if mapObject == nil {
+		return nil
+	}
+
+	if _, exists := mapObject["dimensions"]; !exists {
+		mapObject["dimensions"] = map[string]any{}
+	}
+
+	return nil
+}
+
+// Карты версии 3 рисуются набором тайлов по умолчанию
+func migrateV3ToV4(raw rawDocument) error {
+	mapObject := rawObject(raw, "map")
+	if mapObject == nil {
+		return nil
+	}
+
+	if _, exists := mapObject["tileset"]; !exists {
+		mapObject["tileset"] = map[string]any{}
+	}
+
+	return nil
+}
+
+// В файлах версии 4 нет истории правок, а история необязательна
+func migrateV4ToV5(raw rawDocument) error {
+	return nil
+}
+
+// В версии 5 заметки - один текст, заметка начинается строкой "- id"
+func migrateV5ToV6(raw rawDocument) error {
+	notesObject := rawObject(raw, "notes")
+	if notesObject == nil {
+		return nil
+	}
+
+	text, _ := notesObject["text"].(string)
+	raw["notes"] = map[string]any{"notes": parseNotesV5(text)}
+
+	return nil
+}
+
+// В файлах версии 6 нет отметок, а отметки у клеток необязательны
+func migrateV6ToV7(raw rawDocument) error {
+	return nil
+}
+
+// В версии 7 правки могли положить клетки за край ограниченной карты. Размеры расширяются так,
+// чтобы все непустые клетки оказались на карте: ось с клетками левее(выше) 0 становится
+// неограниченной, иначе размер растёт до самой дальней клетки
+func migrateV7ToV8(raw rawDocument) error {
+	mapObject := rawObject(raw, "map")
+	if mapObject == nil {
+		return nil
+	}
+
+	dimensionsObject, _ := mapObject["dimensions"].(map[string]any)
+	if dimensionsObject == nil {
+		return nil
+	}
+
+	width, err := rawInt(dimensionsObject, "width")
+	if err != nil {
+		return err
+	}
+	height, err := rawInt(dimensionsObject, "height")
+	if err != nil {
+		return err
+	}
+	if width == 0 && height == 0 {
+		return nil
+	}
+
+	// крайние клетки по осям, стены левой(верхней) границы карты лежат в клетке -1
+	minX, minY, maxX, maxY := 0, 0, -1, -1
+	add := func(x, y int) {
+		minX, maxX = utils.Min(minX, x), utils.Max(maxX, x)
+		minY, maxY = utils.Min(minY, y), utils.Max(maxY, y)
+	}
+
+	layers, _ := mapObject["layers"].([]any)
+	for _, layer := range layers {
+		layerObject, _ := layer.(map[string]any)
+		locations, _ := layerObject["locations"].(map[string]any)
+		for key, value := range locations {
+			x, y, err := parsePosV7(key)
+			if err != nil {
+				return err
+			}
+
+			data, err := json.Marshal(value)
+			if err != nil {
+				return err
+			}
+			var location locationV7
+			err = json.Unmarshal(data, &location)
+			if err != nil {
+				return err
+			}
+
+			if location.hasRightWall() {
+				if x == -1 {
+					add(0, y)
+				} else {
+					add(x, y)
+				}
+			}
+			if location.hasBottomWall() {
+				if y == -1 {
+					add(x, 0)
+				} else {
+					add(x, y)
+				}
+			}
+			if location.hasContent() {
+				add(x, y)
+			}
+		}
+	}
+
+	fit := func(key string, size, min, max int) {
+		if size == 0 {
+			return
+		}
+		if min < 0 {
+			delete(dimensionsObject, key)
+		} else if max >= size {
+			dimensionsObject[key] = json.Number(strconv.Itoa(max + 1))
+		}
+	}
+	fit("width", width, minX, maxX)
+	fit("height", height, minY, maxY)
+
+	return nil
+}
+
+// Целое поле key объекта, 0 если его нет
+func rawInt(object map[string]any, key string) (int, error) {
+	v, ok := object[key].(json.Number)
+	if !ok {
+		return 0, nil
+	}
+
+	i, err := v.Int64()
+	return int(i), err
+}
@@ -0,0 +1,169 @@
+package map_renderer
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"old-school-rpg-map-editor/common/overlays"
+	"old-school-rpg-map-editor/configuration"
+	"old-school-rpg-map-editor/utils"
+	"sort"
+	"sync"
+)
+
+const (
+	chunkPixels = 256 // примерный размер куска в пикселях
+	maxChunks   = 256 // сколько кусков держать в памяти, кусок - не больше chunkPixels^2*4 байт
+)
+
+var chunkBackgroundUniform = image.NewUniform(color.RGBA{0xff, 0xff, 0xff, 0xff})
+
+// Кэш отрисованной карты. Карта рисуется квадратными кусками по несколько клеток, кусок
+// перерисовывается, только если изменились его клетки(см. Invalidate), масштаб или тайлы.
+// При прокрутке куски просто копируются на экран.
+type ChunkCache struct {
+	mutex      sync.Mutex
+	key        chunkKey
+	chunkCells int // клеток по стороне куска
+	chunks     map[utils.Int2]*chunk
+	frame      uint64 // номер кадра, давно не видимые куски вытесняются
+}
+
+type chunk struct {
+	img       *image.RGBA // в координатах мира: клетка (x, y) начинается в (x, y) * размер клетки с границей
+	lastFrame uint64
+}
+
+// При изменении любого из полей весь кэш устаревает
+type chunkKey struct {
+	tiles       Tiles
+	imageConfig configuration.ImageConfig
+	scale       float32
+}
+
+func NewChunkCache() *ChunkCache {
+	return &ChunkCache{}
+}
+
+func (c *ChunkCache) InvalidateAll() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.chunks = nil
+}
+
+// Выкидывает куски с клетками cells(в повёрнутых координатах)
+func (c *ChunkCache) Invalidate(cells image.Rectangle) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.chunks == nil {
+		return
+	}
+
+	// стены и рамки заходят на соседние клетки, а стена при повороте переезжает в соседнюю клетку
+	cells = cells.Inset(-2)
+
+	n := c.chunkCells
+	for y := floorDiv(cells.Min.Y, n); y <= floorDiv(cells.Max.Y-1, n); y++ {
+		for x := floorDiv(cells.Min.X, n); x <= floorDiv(cells.Max.X-1, n); x++ {
+			delete(c.chunks, utils.NewInt2(x, y))
+		}
+	}
+}
+
+// Рисует то же, что Draw, но из кэша. f.FloorRect должен раскладывать клетки сеткой, как
+// MapWidget: клетка (x, y) - со сдвига (x, y) * (размер клетки с границей) от клетки (0, 0).
+// Партия рисуется поверх кусков и в кэш не попадает.
+func (c *ChunkCache) Draw(img *image.RGBA, f Frame) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	origin := f.FloorRect(0, 0)
+	floorWbSize := f.FloorRect(1, 0).Min.X - origin.Min.X // With Border
+	floorWobSize := origin.Dx()                           // Without Border
+	if floorWbSize <= 0 {
+		return
+	}
+
+	key := chunkKey{tiles: f.Tiles, imageConfig: f.ImageConfig, scale: f.Scale}
+	if c.chunks == nil || c.key != key {
+		c.chunks = make(map[utils.Int2]*chunk)
+		c.key = key
+		c.chunkCells = utils.Max(1, chunkPixels/floorWbSize)
+	}
+	c.frame++
+
+	worldFloorRect := func(x, y int) image.Rectangle {
+		return image.Rect(x*floorWbSize, y*floorWbSize, x*floorWbSize+floorWobSize, y*floorWbSize+floorWobSize)
+	}
+
+	n := c.chunkCells
+	for y := floorDiv(f.Cells.Min.Y, n); y <= floorDiv(f.Cells.Max.Y-1, n); y++ {
+		for x := floorDiv(f.Cells.Min.X, n); x <= floorDiv(f.Cells.Max.X-1, n); x++ {
+			pos := utils.NewInt2(x, y)
+
+			ch := c.chunks[pos]
+			if ch == nil {
+				cells := image.Rect(x*n, y*n, (x+1)*n, (y+1)*n)
+				bounds := image.Rect(cells.Min.X*floorWbSize, cells.Min.Y*floorWbSize, cells.Max.X*floorWbSize, cells.Max.Y*floorWbSize)
+
+				ch = &chunk{img: image.NewRGBA(bounds)}
+				draw.Draw(ch.img, bounds, chunkBackgroundUniform, image.Point{}, draw.Src)
+
+				// соседние клетки тоже рисуются, их стены заходят на кусок; лишнее обрежется по bounds
+				chunkFrame := f
+				chunkFrame.Party = nil
+				chunkFrame.Cells = cells.Inset(-1)
+				chunkFrame.FloorRect = worldFloorRect
+				Draw(ch.img, chunkFrame)
+
+				c.chunks[pos] = ch
+			}
+			ch.lastFrame = c.frame
+
+			bounds := ch.img.Bounds()
+			draw.Draw(img, bounds.Add(origin.Min), ch.img, bounds.Min, draw.Src)
+		}
+	}
+
+	c.evict()
+
+	if f.Party != nil {
+		x, y := f.Party.Pos.X, f.Party.Pos.Y
+		if x >= f.Cells.Min.X && x < f.Cells.Max.X && y >= f.Cells.Min.Y && y < f.Cells.Max.Y {
+			overlays.DrawArrow(img, f.FloorRect(x, y), f.Party.Direction.X, f.Party.Direction.Y, partyColor)
+		}
+	}
+}
+
+// Выкидывает самые давно не видимые куски сверх maxChunks
+func (c *ChunkCache) evict() {
+	if len(c.chunks) <= maxChunks {
+		return
+	}
+
+	positions := make([]utils.Int2, 0, len(c.chunks))
+	for pos := range c.chunks {
+		positions = append(positions, pos)
+	}
+	sort.Slice(positions, func(i, j int) bool {
+		return c.chunks[positions[i]].lastFrame < c.chunks[positions[j]].lastFrame
+	})
+
+	for _, pos := range positions[:len(positions)-maxChunks] {
+		if c.chunks[pos].lastFrame == c.frame {
+			break
+		}
+		delete(c.chunks, pos)
+	}
+}
+
+// Деление с округлением в меньшую сторону: floorDiv(-1, 2) == -1
+func floorDiv(a, b int) int {
+	res := a / b
+	if a < 0 && a%b != 0 {
+		res--
+	}
+	return res
+}
@@ -0,0 +1,123 @@
+package map_renderer
+
+import (
+	"image"
+	"image/draw"
+	"math/rand"
+	"old-school-rpg-map-editor/common/tileset"
+	"old-school-rpg-map-editor/images"
+	"old-school-rpg-map-editor/models/map_model"
+	"old-school-rpg-map-editor/models/rot_map_model"
+	"old-school-rpg-map-editor/models/rotate_model"
+	"old-school-rpg-map-editor/utils"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+// Те же параметры, что у map_tool bench по умолчанию. Бюджет времени кадра проверяет map_tool bench:
+// в go test замеры времени зависят от загрузки машины
+const (
+	panMapSize = 500
+	panWidth   = 1920
+	panHeight  = 1080
+	panScale   = 0.5
+	panFrames  = 300
+	panStep    = 16
+)
+
+// Карта size x size, все клетки заполнены, как benchMap в map_tool bench
+func benchMap(size int) *map_model.MapModel {
+	r := rand.New(rand.NewSource(1))
+
+	locations := make(map[utils.Int2]map_model.Location, size*size)
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			locations[utils.NewInt2(x, y)] = map_model.Location{
+				Floor:      uint32(1 + r.Intn(4)),
+				RightWall:  uint32(r.Intn(4)),
+				BottomWall: uint32(r.Intn(4)),
+			}
+		}
+	}
+
+	mapModel := map_model.NewMapModel()
+	mapModel.SetDimensions(map_model.Dimensions{Width: size, Height: size})
+	layerIndex := mapModel.AddLayerWithId(uuid.New(), map_model.RegularLayerType, 0)
+	mapModel.SetLocations(layerIndex, locations)
+
+	return mapModel
+}
+
+// Кадры прокрутки карты benchMap(panMapSize) по диагонали, как в MapWidget
+type panner struct {
+	floorWbSize  int // With Border
+	floorWobSize int // Without Border
+
+	img        *image.RGBA
+	background *image.Uniform
+	frame      Frame
+}
+
+func newPanner(tb testing.TB) *panner {
+	tb.Helper()
+
+	t, err := tileset.Load(images.FS)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	decoded, err := t.Decode()
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	p := &panner{
+		floorWbSize:  int((float32(t.TileSize) + 1) * panScale),
+		floorWobSize: int(float32(t.TileSize) * panScale),
+		img:          image.NewRGBA(image.Rect(0, 0, panWidth, panHeight)),
+		background:   image.NewUniform(image.White),
+		frame: Frame{
+			Map:         rot_map_model.NewRotMapMode(benchMap(panMapSize), rotate_model.NewRotateModel(0)),
+			Tiles:       NewTiles(TileImages(decoded), panScale),
+			ImageConfig: t.ImageConfig(),
+			Scale:       panScale,
+		},
+	}
+
+	return p
+}
+
+// Очищает картинку и рисует кадр i через drawFrame
+func (p *panner) draw(i int, drawFrame func(img *image.RGBA, f Frame)) {
+	offset := utils.NewInt2((i%panFrames)*panStep, (i%panFrames)*panStep)
+
+	f := p.frame
+	f.Cells = image.Rect(offset.X/p.floorWbSize, offset.Y/p.floorWbSize,
+		(offset.X+panWidth)/p.floorWbSize+1, (offset.Y+panHeight)/p.floorWbSize+1)
+	f.FloorRect = func(x, y int) image.Rectangle {
+		pX, pY := x*p.floorWbSize-offset.X, y*p.floorWbSize-offset.Y
+		return image.Rect(pX, pY, pX+p.floorWobSize, pY+p.floorWobSize)
+	}
+
+	draw.Draw(p.img, p.img.Bounds(), p.background, image.Point{}, draw.Src)
+	drawFrame(p.img, f)
+}
+
+func BenchmarkChunkCachePan(b *testing.B) {
+	p := newPanner(b)
+	cache := NewChunkCache()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		p.draw(i, cache.Draw)
+	}
+}
+
+func BenchmarkDrawDirect(b *testing.B) {
+	p := newPanner(b)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		p.draw(i, Draw)
+	}
+}
@@ -0,0 +1,287 @@
+package map_renderer
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"old-school-rpg-map-editor/common/overlays"
+	"old-school-rpg-map-editor/configuration"
+	"old-school-rpg-map-editor/models/map_model"
+	"old-school-rpg-map-editor/utils"
+
+	"github.com/google/uuid"
+)
+
+// Карта в повёрнутых координатах, см. rot_map_model.RotMapModel
+type MapSource interface {
+	NormalizePos(x, y int) (nX, nY int, err error)
+	NormalizeWallPos(x, y int, isRight bool) (nX, nY int, err error)
+	VisibleFloor(x, y int) (layerUuid uuid.UUID, floor uint32)
+	VisibleWall(x, y int, isRight bool) (layerUuid uuid.UUID, wall uint32)
+	VisibleWallKind(x, y int, isRight bool) (layerUuid uuid.UUID, kind map_model.WallKind)
+	VisibleNoteId(x, y int) (layerUuid uuid.UUID, noteId string)
+	VisibleEffects(x, y int) map_model.Effects
+	VisibleLink(x, y int) (layerUuid uuid.UUID, link *map_model.Link)
+	VisibleMarkers(x, y int) (layerUuid uuid.UUID, markers []map_model.Marker)
+}
+
+// Выделение в повёрнутых координатах, см. rot_select_model.RotSelectModel
+type SelectSource interface {
+	IsFloorSelected(x, y int) bool
+	IsWallSelected(x, y int, isRight bool) bool
+	SelectedMarkers(x, y int) uint32
+}
+
+// См. notes_model.NotesModel
+type NotesSource interface {
+	GetNoteImage(noteId string) image.Image
+}
+
+// Партия в повёрнутых координатах
+type Party struct {
+	Pos       utils.Int2
+	Direction utils.Int2 // вектор направления
+}
+
+// Что и куда рисовать
+type Frame struct {
+	Map    MapSource
+	Select SelectSource // nil - без выделения
+	Notes  NotesSource  // nil - без заметок
+	Party  *Party       // nil - без партии
+
+	Tiles       Tiles
+	ImageConfig configuration.ImageConfig
+	Scale       float32
+
+	Cells     image.Rectangle                // клетки(в повёрнутых координатах), которые надо нарисовать
+	FloorRect func(x, y int) image.Rectangle // клетка на картинке без границы
+}
+
+var (
+	wallUniform    = image.NewUniform(color.RGBA{0xaa, 0xaa, 0xaa, 0xff})
+	ghostUniform   = image.NewUniform(color.NRGBA{0xff, 0xff, 0xff, 0x99})
+	outsideUniform = image.NewUniform(color.RGBA{0xdd, 0xdd, 0xdd, 0xff})
+	partyColor     = color.RGBA{0xdd, 0x22, 0x22, 0xff}
+)
+
+// Рисует клетки f.Cells карты поверх img: пол, стены, выделение, заметки, эффекты, link'и, отметки и партию
+func Draw(img *image.RGBA, f Frame) {
+	fFloorSize := float32(f.ImageConfig.FloorSize)
+
+	scaledWallWidth := int(float32(f.ImageConfig.WallWidth) * f.Scale)
+	halfScaledWallWidth := int(float32(f.ImageConfig.WallWidth) * f.Scale / 2)
+
+	mapLeft, mapTop := f.Cells.Min.X, f.Cells.Min.Y
+	mapRight, mapBottom := f.Cells.Max.X, f.Cells.Max.Y
+
+	// Клетки экрана, приведённые к клеткам карты(см. map_model.Dimensions). За краем завёрнутой карты
+	// рисуются её клетки с противоположного края(призраки), за краем ограниченной - ничего.
+	type visibleCell struct {
+		x, y    int
+		ghost   bool
+		outside bool
+	}
+
+	cellsWidth := mapRight - mapLeft
+	cells := make([]visibleCell, cellsWidth*(mapBottom-mapTop))
+	for y := mapTop; y < mapBottom; y++ {
+		for x := mapLeft; x < mapRight; x++ {
+			nX, nY, err := f.Map.NormalizePos(x, y)
+			cells[(y-mapTop)*cellsWidth+x-mapLeft] = visibleCell{x: nX, y: nY, ghost: err == nil && (nX != x || nY != y), outside: err != nil}
+
+			if err != nil {
+				rect := f.FloorRect(x, y)
+				rect.Max = rect.Max.Add(image.Pt(int(f.Scale), int(f.Scale)))
+				draw.Draw(img, rect, outsideUniform, image.Point{}, draw.Src)
+			}
+		}
+	}
+	cellAt := func(x, y int) visibleCell {
+		return cells[(y-mapTop)*cellsWidth+x-mapLeft]
+	}
+
+	for y := mapTop; y < mapBottom; y++ {
+		for x := mapLeft; x < mapRight; x++ {
+			c := cellAt(x, y)
+			if c.outside {
+				continue
+			}
+
+			_, index := f.Map.VisibleFloor(c.x, c.y)
+			if index > 0 {
+				rect := f.FloorRect(x, y)
+				draw.Draw(img, rect, f.Tiles.Floor, image.Pt(int(index)*int(fFloorSize*f.Scale), 0), draw.Src)
+			}
+		}
+	}
+
+	// клетка карты со стеной клетки экрана (x, y), ok == false - стена за краем карты. Стены левой
+	// и верхней границы ограниченной карты лежат в клетках за краем(см. map_model.Dimensions.NormalizeWall)
+	wallCell := func(x, y int, isRight bool) (nX, nY int, ok bool) {
+		if x >= mapLeft && y >= mapTop {
+			if c := cellAt(x, y); !c.outside {
+				return c.x, c.y, true
+			}
+		}
+		nX, nY, err := f.Map.NormalizeWallPos(x, y, isRight)
+		return nX, nY, err == nil
+	}
+
+	// у клеток левее и выше f.Cells рисуются только стены на их границе
+	for y := mapTop - 1; y < mapBottom; y++ {
+		for x := mapLeft - 1; x < mapRight; x++ {
+			rect := f.FloorRect(x, y)
+
+			if y >= mapTop {
+				if wX, wY, ok := wallCell(x, y, true); ok {
+					_, index := f.Map.VisibleWall(wX, wY, true)
+					if index > 0 {
+						wallRect := image.Rect(rect.Max.X-halfScaledWallWidth, rect.Min.Y, rect.Max.X+halfScaledWallWidth, rect.Max.Y)
+						draw.Draw(img, wallRect, f.Tiles.Wall, image.Pt(int(index)*scaledWallWidth, 0), draw.Over)
+
+						if _, kind := f.Map.VisibleWallKind(wX, wY, true); kind != map_model.RegularWall {
+							overlays.DrawWallKind(img, wallRect, true, kind)
+						}
+					} else {
+						wallRect := image.Rect(rect.Max.X, rect.Min.Y, rect.Max.X+int(f.Scale), rect.Max.Y)
+						draw.Draw(img, wallRect, wallUniform, image.Point{}, draw.Src)
+					}
+				}
+			}
+			if x >= mapLeft {
+				if wX, wY, ok := wallCell(x, y, false); ok {
+					_, index := f.Map.VisibleWall(wX, wY, false)
+					if index > 0 {
+						wallRect := image.Rect(rect.Min.X, rect.Max.Y-halfScaledWallWidth, rect.Max.X, rect.Max.Y+halfScaledWallWidth)
+						draw.Draw(img, wallRect, f.Tiles.Wall90, image.Pt(0, int(index)*scaledWallWidth), draw.Over)
+
+						if _, kind := f.Map.VisibleWallKind(wX, wY, false); kind != map_model.RegularWall {
+							overlays.DrawWallKind(img, wallRect, false, kind)
+						}
+					} else {
+						wallRect := image.Rect(rect.Min.X, rect.Max.Y, rect.Max.X, rect.Max.Y+int(f.Scale))
+						draw.Draw(img, wallRect, wallUniform, image.Point{}, draw.Src)
+					}
+				}
+			}
+		}
+	}
+
+	if f.Select != nil {
+		for y := mapTop; y < mapBottom; y++ {
+			for x := mapLeft; x < mapRight; x++ {
+				c := cellAt(x, y)
+				if c.outside {
+					continue
+				}
+
+				if f.Select.IsFloorSelected(c.x, c.y) {
+					rect := f.FloorRect(x, y)
+					draw.Draw(img, rect, f.Tiles.FloorSelected, image.Pt(0, 0), draw.Over)
+				}
+			}
+		}
+
+		for y := mapTop; y < mapBottom; y++ {
+			for x := mapLeft; x < mapRight; x++ {
+				c := cellAt(x, y)
+				if c.outside {
+					continue
+				}
+
+				rect := f.FloorRect(x, y)
+
+				if f.Select.IsWallSelected(c.x, c.y, true) {
+					wallRect := image.Rect(rect.Max.X-halfScaledWallWidth, rect.Min.Y, rect.Max.X+halfScaledWallWidth, rect.Max.Y)
+					draw.Draw(img, wallRect, f.Tiles.WallSelected, image.Pt(0, 0), draw.Over)
+				}
+
+				if f.Select.IsWallSelected(c.x, c.y, false) {
+					wallRect := image.Rect(rect.Min.X, rect.Max.Y-halfScaledWallWidth, rect.Max.X, rect.Max.Y+halfScaledWallWidth)
+					draw.Draw(img, wallRect, f.Tiles.WallSelected90, image.Pt(0, 0), draw.Over)
+				}
+			}
+		}
+	}
+
+	if f.Notes != nil {
+		for y := mapTop; y < mapBottom; y++ {
+			for x := mapLeft; x < mapRight; x++ {
+				c := cellAt(x, y)
+				if c.outside {
+					continue
+				}
+
+				_, value := f.Map.VisibleNoteId(c.x, c.y)
+				if len(value) > 0 {
+					rect := f.FloorRect(x, y)
+					if noteImg := f.Notes.GetNoteImage(value); noteImg != nil {
+						draw.Draw(img, rect, noteImg, image.Point{}, draw.Over)
+					}
+				}
+			}
+		}
+	}
+
+	for y := mapTop; y < mapBottom; y++ {
+		for x := mapLeft; x < mapRight; x++ {
+			c := cellAt(x, y)
+			if c.outside {
+				continue
+			}
+
+			if effects := f.Map.VisibleEffects(c.x, c.y); effects != 0 {
+				overlays.DrawEffects(img, f.FloorRect(x, y), effects)
+			}
+		}
+	}
+
+	for y := mapTop; y < mapBottom; y++ {
+		for x := mapLeft; x < mapRight; x++ {
+			c := cellAt(x, y)
+			if c.outside {
+				continue
+			}
+
+			_, link := f.Map.VisibleLink(c.x, c.y)
+			if link != nil {
+				overlays.DrawLink(img, f.FloorRect(x, y), link.Type)
+			}
+		}
+	}
+
+	for y := mapTop; y < mapBottom; y++ {
+		for x := mapLeft; x < mapRight; x++ {
+			c := cellAt(x, y)
+			if c.outside {
+				continue
+			}
+
+			_, markers := f.Map.VisibleMarkers(c.x, c.y)
+			if len(markers) > 0 {
+				// выделенный floor уже подсвечивает всю клетку
+				var selected uint32
+				if f.Select != nil && !f.Select.IsFloorSelected(c.x, c.y) {
+					selected = f.Select.SelectedMarkers(c.x, c.y)
+				}
+				overlays.DrawMarkers(img, f.FloorRect(x, y), markers, selected)
+			}
+		}
+	}
+
+	for y := mapTop; y < mapBottom; y++ {
+		for x := mapLeft; x < mapRight; x++ {
+			if c := cellAt(x, y); c.ghost {
+				draw.Draw(img, f.FloorRect(x, y), ghostUniform, image.Point{}, draw.Over)
+			}
+		}
+	}
+
+	if f.Party != nil {
+		x, y := f.Party.Pos.X, f.Party.Pos.Y
+		if x >= mapLeft && x < mapRight && y >= mapTop && y < mapBottom {
+			overlays.DrawArrow(img, f.FloorRect(x, y), f.Party.Direction.X, f.Party.Direction.Y, partyColor)
+		}
+	}
+}
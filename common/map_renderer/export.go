@@ -0,0 +1,276 @@
+package map_renderer
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"io"
+	"old-school-rpg-map-editor/configuration"
+	"old-school-rpg-map-editor/models/map_model"
+	"old-school-rpg-map-editor/models/notes_model"
+	"old-school-rpg-map-editor/models/rot_map_model"
+	"old-school-rpg-map-editor/models/rotate_model"
+	"old-school-rpg-map-editor/utils"
+	"sort"
+	"strconv"
+
+	"github.com/goki/freetype/truetype"
+	"github.com/google/uuid"
+	"golang.org/x/exp/slices"
+)
+
+type ExportOptions struct {
+	Scale  float32
+	Angle  int             // поворот, как у RotateModel
+	Level  int32           // уровень(этаж) подземелья
+	Layers []uuid.UUID     // слои уровня Level, которые попадут в картинку; пусто - видимые слои
+	Bounds image.Rectangle // клетки карты(не повёрнутые); пустой - размеры карты или всё содержимое
+
+	Rulers bool // координаты клеток сверху и слева
+	Notes  bool // id заметок в клетках, см. NotesModel.GetNoteImage
+	Legend bool // список использованных тайлов справа
+
+	Font     *truetype.Font // для Rulers и Legend
+	FontSize float64
+}
+
+var ErrEmptyExport = errors.New("nothing to export")
+
+var (
+	backgroundUniform = image.NewUniform(color.RGBA{0xff, 0xff, 0xff, 0xff})
+	borderUniform     = image.NewUniform(color.RGBA{0x66, 0x66, 0x66, 0xff})
+)
+
+const textPadding = 4
+
+// Копия слоёв opts.Layers(или видимых слоёв opts.Level), все видимые и на одном уровне.
+// withHidden - без opts.Layers берутся и скрытые слои уровня, Visible у них сохраняется.
+func exportMapModel(mapModel *map_model.MapModel, opts ExportOptions, withHidden bool) *map_model.MapModel {
+	result := map_model.NewMapModel()
+	result.SetDimensions(mapModel.Dimensions())
+	result.SetLevel(opts.Level)
+
+	for i, info := range mapModel.LayerInfos() {
+		if info.Level != opts.Level || info.Type != map_model.RegularLayerType {
+			continue
+		}
+		if len(opts.Layers) > 0 {
+			if !slices.Contains(opts.Layers, info.Uuid) {
+				continue
+			}
+		} else if !info.Visible && !withHidden {
+			continue
+		}
+
+		layer := mapModel.Layer(int32(i)).Clone()
+		if len(opts.Layers) > 0 || !withHidden {
+			layer.Visible = true
+		}
+		result.AddLayer(layer)
+	}
+
+	return result
+}
+
+// Клетки(не повёрнутые), которые попадут в картинку
+func exportBounds(mapModel *map_model.MapModel, opts ExportOptions) image.Rectangle {
+	if !opts.Bounds.Empty() {
+		return opts.Bounds
+	}
+
+	dimensions := mapModel.Dimensions()
+	if dimensions.Width > 0 && dimensions.Height > 0 {
+		return image.Rect(0, 0, dimensions.Width, dimensions.Height)
+	}
+
+	var bounds image.Rectangle
+	for i := 0; i < mapModel.NumLayers(); i++ {
+		leftTop, rightBottom := mapModel.Bounds(int32(i))
+		bounds = bounds.Union(image.Rect(leftTop.X, leftTop.Y, rightBottom.X, rightBottom.Y))
+	}
+
+	return bounds
+}
+
+// Переводит прямоугольник клеток карты в повёрнутые координаты
+func rotateBounds(rotateModel *rotate_model.RotateModel, bounds image.Rectangle) image.Rectangle {
+	x0, y0 := rotateModel.TransformFromRot(bounds.Min.X, bounds.Min.Y)
+	x1, y1 := rotateModel.TransformFromRot(bounds.Max.X-1, bounds.Max.Y-1)
+
+	return image.Rect(utils.Min(x0, x1), utils.Min(y0, y1), utils.Max(x0, x1)+1, utils.Max(y0, y1)+1)
+}
+
+type legendItem struct {
+	isWall bool
+	index  uint32
+	label  image.Image
+}
+
+// Рисует карту в картинку, см. ExportOptions
+func RenderImage(mapModel *map_model.MapModel, notesModel *notes_model.NotesModel, images TileImages, imageConfig configuration.ImageConfig, opts ExportOptions) (*image.RGBA, error) {
+	if opts.Scale <= 0 {
+		return nil, fmt.Errorf("invalid scale %v", opts.Scale)
+	}
+	if (opts.Rulers || opts.Legend) && opts.Font == nil {
+		return nil, errors.New("rulers and legend need a font")
+	}
+
+	model := exportMapModel(mapModel, opts, false)
+	if model.NumLayers() == 0 {
+		return nil, fmt.Errorf("%w: no layers on level %d", ErrEmptyExport, opts.Level)
+	}
+
+	bounds := exportBounds(model, opts)
+	if bounds.Empty() {
+		return nil, ErrEmptyExport
+	}
+
+	rotateModel := rotate_model.NewRotateModel(0)
+	rotateModel.SetAngle(opts.Angle)
+	rotMapModel := rot_map_model.NewRotMapMode(model, rotateModel)
+	cells := rotateBounds(rotateModel, bounds)
+
+	fFloorSize := float32(imageConfig.FloorSize)
+	floorWbSize := int((fFloorSize + 1) * opts.Scale) // With Border
+	floorWobSize := int(fFloorSize * opts.Scale)      // Without Border
+	padding := int(float32(imageConfig.WallWidth)*opts.Scale/2) + 1
+
+	text := func(s string) image.Image {
+		return notes_model.TextImage(s, opts.Font, opts.FontSize)
+	}
+
+	// подписи линеек: для столбца(строки) - та координата карты, которая в нём меняется
+	var columnLabels, rowLabels []image.Image
+	rulerWidth, rulerHeight := 0, 0
+	if opts.Rulers {
+		label := func(x0, y0, x1, y1 int) image.Image {
+			mX0, mY0 := rotateModel.TransformToRot(x0, y0)
+			mX1, _ := rotateModel.TransformToRot(x1, y1)
+			if mX0 != mX1 {
+				return text(strconv.Itoa(mX0))
+			}
+			return text(strconv.Itoa(mY0))
+		}
+
+		for x := cells.Min.X; x < cells.Max.X; x++ {
+			l := label(x, cells.Min.Y, x+1, cells.Min.Y)
+			columnLabels = append(columnLabels, l)
+			rulerHeight = utils.Max(rulerHeight, l.Bounds().Dy()+2*textPadding)
+		}
+		for y := cells.Min.Y; y < cells.Max.Y; y++ {
+			l := label(cells.Min.X, y, cells.Min.X, y+1)
+			rowLabels = append(rowLabels, l)
+			rulerWidth = utils.Max(rulerWidth, l.Bounds().Dx()+2*textPadding)
+		}
+	}
+
+	originX := rulerWidth + padding
+	originY := rulerHeight + padding
+	mapWidth := originX + cells.Dx()*floorWbSize + padding
+	mapHeight := originY + cells.Dy()*floorWbSize + padding
+
+	var legend []legendItem
+	legendWidth, legendHeight := 0, 0
+	if opts.Legend {
+		floors := make(map[uint32]struct{})
+		walls := make(map[uint32]struct{})
+		for y := cells.Min.Y; y < cells.Max.Y; y++ {
+			for x := cells.Min.X; x < cells.Max.X; x++ {
+				if _, floor := rotMapModel.VisibleFloor(x, y); floor > 0 {
+					floors[floor] = struct{}{}
+				}
+				if _, wall := rotMapModel.VisibleWall(x, y, true); wall > 0 {
+					walls[wall] = struct{}{}
+				}
+				if _, wall := rotMapModel.VisibleWall(x, y, false); wall > 0 {
+					walls[wall] = struct{}{}
+				}
+			}
+		}
+
+		add := func(indices map[uint32]struct{}, isWall bool, name string) {
+			sorted := make([]uint32, 0, len(indices))
+			for index := range indices {
+				sorted = append(sorted, index)
+			}
+			sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+			for _, index := range sorted {
+				label := text(fmt.Sprintf("%s %d", name, index))
+				legend = append(legend, legendItem{isWall: isWall, index: index, label: label})
+				legendWidth = utils.Max(legendWidth, int(imageConfig.FloorSize)+3*textPadding+label.Bounds().Dx())
+			}
+		}
+		add(floors, false, "Floor")
+		add(walls, true, "Wall")
+
+		legendHeight = len(legend)*(int(imageConfig.FloorSize)+textPadding) + textPadding
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, mapWidth+legendWidth, utils.Max(mapHeight, legendHeight)))
+	draw.Draw(img, img.Bounds(), backgroundUniform, image.Point{}, draw.Src)
+
+	frame := Frame{
+		Map:         rotMapModel,
+		Tiles:       NewTiles(images, opts.Scale),
+		ImageConfig: imageConfig,
+		Scale:       opts.Scale,
+		Cells:       cells,
+		FloorRect: func(x, y int) image.Rectangle {
+			pX := originX + (x-cells.Min.X)*floorWbSize
+			pY := originY + (y-cells.Min.Y)*floorWbSize
+			return image.Rect(pX, pY, pX+floorWobSize, pY+floorWobSize)
+		},
+	}
+	if opts.Notes && notesModel != nil {
+		frame.Notes = notesModel
+	}
+
+	Draw(img, frame)
+
+	for i, l := range columnLabels {
+		rect := frame.FloorRect(cells.Min.X+i, cells.Min.Y)
+		pt := image.Pt(rect.Min.X+(rect.Dx()-l.Bounds().Dx())/2, textPadding)
+		draw.Draw(img, l.Bounds().Add(pt), l, image.Point{}, draw.Over)
+	}
+	for i, l := range rowLabels {
+		rect := frame.FloorRect(cells.Min.X, cells.Min.Y+i)
+		pt := image.Pt(rulerWidth-textPadding-l.Bounds().Dx(), rect.Min.Y+(rect.Dy()-l.Bounds().Dy())/2)
+		draw.Draw(img, l.Bounds().Add(pt), l, image.Point{}, draw.Over)
+	}
+
+	for i, item := range legend {
+		floorSize := int(imageConfig.FloorSize)
+		top := textPadding + i*(floorSize+textPadding)
+		tileRect := image.Rect(mapWidth+textPadding, top, mapWidth+textPadding+floorSize, top+floorSize)
+
+		draw.Draw(img, tileRect.Inset(-1), borderUniform, image.Point{}, draw.Src)
+		draw.Draw(img, tileRect, backgroundUniform, image.Point{}, draw.Src)
+		if item.isWall {
+			wallWidth := int(imageConfig.WallWidth)
+			wallRect := image.Rect(tileRect.Min.X+(floorSize-wallWidth)/2, tileRect.Min.Y, tileRect.Min.X+(floorSize+wallWidth)/2, tileRect.Max.Y)
+			draw.Draw(img, wallRect, images.Wall, image.Pt(int(item.index)*wallWidth, 0), draw.Over)
+		} else {
+			draw.Draw(img, tileRect, images.Floor, image.Pt(int(item.index)*floorSize, 0), draw.Src)
+		}
+
+		labelBounds := item.label.Bounds()
+		pt := image.Pt(tileRect.Max.X+2*textPadding, top+(floorSize-labelBounds.Dy())/2)
+		draw.Draw(img, labelBounds.Add(pt), item.label, image.Point{}, draw.Over)
+	}
+
+	return img, nil
+}
+
+// Рисует карту(см. RenderImage) и пишет её в writer в формате PNG
+func ExportPNG(writer io.Writer, mapModel *map_model.MapModel, notesModel *notes_model.NotesModel, images TileImages, imageConfig configuration.ImageConfig, opts ExportOptions) error {
+	img, err := RenderImage(mapModel, notesModel, images, imageConfig, opts)
+	if err != nil {
+		return err
+	}
+
+	return png.Encode(writer, img)
+}
@@ -0,0 +1,63 @@
+package map_renderer
+
+import (
+	"bytes"
+	"fmt"
+	"old-school-rpg-map-editor/common/tileset"
+	"old-school-rpg-map-editor/images"
+	"old-school-rpg-map-editor/models/map_model"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+// Стены левой и верхней границы ограниченной карты лежат в клетках -1 и попадают в картинку
+// при любом повороте
+func TestExportBorderWalls(t *testing.T) {
+	ts, err := tileset.Load(images.FS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := ts.Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mapModel := map_model.NewMapModel()
+	if err := mapModel.SetDimensions(map_model.Dimensions{Width: 4, Height: 3}); err != nil {
+		t.Fatal(err)
+	}
+	layerIndex := mapModel.AddLayerWithId(uuid.New(), map_model.RegularLayerType, 0)
+	for _, wall := range []struct {
+		x, y    int
+		isRight bool
+	}{
+		{-1, 0, true},
+		{1, -1, false},
+		{3, 2, true},
+		{0, 2, false},
+	} {
+		if err := mapModel.SetWall(wall.x, wall.y, layerIndex, wall.isRight, 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, angle := range []int{0, 90, 180, 270} {
+		t.Run(fmt.Sprintf("angle %d", angle), func(t *testing.T) {
+			opts := ExportOptions{Scale: 1, Angle: angle}
+
+			var b bytes.Buffer
+			if err := ExportSVG(&b, mapModel, nil, TileImages(decoded), ts.ImageConfig(), opts); err != nil {
+				t.Fatal(err)
+			}
+			if n := strings.Count(b.String(), "class=\"wall\""); n != 4 {
+				t.Errorf("svg walls: got %d, want 4", n)
+			}
+
+			if _, err := RenderImage(mapModel, nil, TileImages(decoded), ts.ImageConfig(), opts); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
@@ -0,0 +1,340 @@
+package map_renderer
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"io"
+	"old-school-rpg-map-editor/configuration"
+	"old-school-rpg-map-editor/models/map_model"
+	"old-school-rpg-map-editor/models/notes_model"
+	"old-school-rpg-map-editor/models/rot_map_model"
+	"old-school-rpg-map-editor/models/rotate_model"
+	"strconv"
+	"strings"
+)
+
+// Стили видов стен; значок вида рисуется поверх стены отдельной линией, у односторонних стен -
+// стрелкой в сторону прохода
+const svgStyle = `
+.grid { stroke: #aaaaaa; stroke-width: 1; }
+.wall { stroke-linecap: square; }
+.door, .locked-door { stroke: #996633; }
+.locked-door { stroke-dasharray: 4 2; }
+.secret-door { stroke: #8822cc; stroke-dasharray: 2 2; }
+.one-way-forward, .one-way-backward { fill: #dd2222; }
+.illusionary { stroke: #ffffff; stroke-opacity: 0.66; stroke-dasharray: 4 4; }
+.note, .ruler { font-family: monospace; fill: #000000; }
+.marker { stroke: #ffffff; stroke-width: 0.5; }
+.marker-chest { fill: #996633; }
+.marker-monster { fill: #cc1111; }
+.marker-quest { fill: #eecc22; }
+.marker-npc { fill: #228822; }
+.marker-key { fill: #cc9900; }
+.marker-treasure { fill: #eebb00; }
+.marker-danger { fill: #ee6600; }
+.marker-info { fill: #2255aa; }
+`
+
+func wallKindClass(kind map_model.WallKind) string {
+	switch kind {
+	case map_model.DoorWall:
+		return "door"
+	case map_model.LockedDoorWall:
+		return "locked-door"
+	case map_model.SecretDoorWall:
+		return "secret-door"
+	case map_model.OneWayForwardWall:
+		return "one-way-forward"
+	case map_model.OneWayBackwardWall:
+		return "one-way-backward"
+	case map_model.IllusionaryWall:
+		return "illusionary"
+	}
+
+	return ""
+}
+
+// Подсказка к отметке: значок и заметка, если есть
+func markerTitle(marker map_model.Marker) string {
+	if len(marker.NoteId) > 0 {
+		return marker.Icon.String() + ": " + marker.NoteId
+	}
+	return marker.Icon.String()
+}
+
+func svgFloat(v float32) string {
+	return strconv.FormatFloat(float64(v), 'f', -1, 32)
+}
+
+func svgEscape(s string) string {
+	var b bytes.Buffer
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+func svgColor(c color.RGBA) string {
+	return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+}
+
+// Тайл пола index в виде data: URL для <image>
+func floorTileURL(images TileImages, imageConfig configuration.ImageConfig, index uint32) (string, error) {
+	size := int(imageConfig.FloorSize)
+	tile := image.NewRGBA(image.Rect(0, 0, size, size))
+	draw.Draw(tile, tile.Bounds(), images.Floor, image.Pt(int(index)*size, 0), draw.Src)
+
+	var b bytes.Buffer
+	if err := png.Encode(&b, tile); err != nil {
+		return "", err
+	}
+
+	return "data:image/png;base64," + base64.StdEncoding.EncodeToString(b.Bytes()), nil
+}
+
+// Средний цвет непрозрачных пикселей тайла стены index
+func wallTileColor(images TileImages, imageConfig configuration.ImageConfig, index uint32) color.RGBA {
+	width := int(imageConfig.WallWidth)
+	bounds := images.Wall.Bounds()
+	rect := image.Rect(int(index)*width, bounds.Min.Y, int(index+1)*width, bounds.Max.Y).Intersect(bounds)
+
+	var r, g, b, n uint64
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		for x := rect.Min.X; x < rect.Max.X; x++ {
+			c := color.NRGBAModel.Convert(images.Wall.At(x, y)).(color.NRGBA)
+			if c.A < 0x80 {
+				continue
+			}
+			r, g, b, n = r+uint64(c.R), g+uint64(c.G), b+uint64(c.B), n+1
+		}
+	}
+
+	if n == 0 {
+		return color.RGBA{0x00, 0x00, 0x00, 0xff}
+	}
+	return color.RGBA{uint8(r / n), uint8(g / n), uint8(b / n), 0xff}
+}
+
+// Пишет карту в writer в формате SVG. Каждый слой уровня opts.Level - отдельная группа(слой Inkscape),
+// скрытые слои тоже попадают в файл, но скрытыми группами. Полы - прямоугольники с узором из тайла,
+// стены - линии с толщиной по imageConfig.WallWidth, заметки - текст. opts.Legend и opts.Font не используются.
+func ExportSVG(writer io.Writer, mapModel *map_model.MapModel, notesModel *notes_model.NotesModel, images TileImages, imageConfig configuration.ImageConfig, opts ExportOptions) error {
+	if opts.Scale <= 0 {
+		return fmt.Errorf("invalid scale %v", opts.Scale)
+	}
+	fontSize := float32(opts.FontSize)
+	if fontSize <= 0 {
+		fontSize = 10
+	}
+
+	model := exportMapModel(mapModel, opts, true)
+	if model.NumLayers() == 0 {
+		return fmt.Errorf("%w: no layers on level %d", ErrEmptyExport, opts.Level)
+	}
+
+	bounds := exportBounds(model, opts)
+	if bounds.Empty() {
+		return ErrEmptyExport
+	}
+
+	rotateModel := rotate_model.NewRotateModel(0)
+	rotateModel.SetAngle(opts.Angle)
+	rotMapModel := rot_map_model.NewRotMapMode(model, rotateModel)
+	cells := rotateBounds(rotateModel, bounds)
+
+	floorWbSize := (float32(imageConfig.FloorSize) + 1) * opts.Scale // With Border
+	floorWobSize := float32(imageConfig.FloorSize) * opts.Scale      // Without Border
+	wallWidth := float32(imageConfig.WallWidth) * opts.Scale         // как у стены в RenderImage
+	padding := float32(imageConfig.WallWidth)*opts.Scale/2 + 1
+
+	rulerSize := float32(0)
+	if opts.Rulers {
+		rulerSize = fontSize * 3
+	}
+
+	originX, originY := rulerSize+padding, rulerSize+padding
+	width := originX + float32(cells.Dx())*floorWbSize + padding
+	height := originY + float32(cells.Dy())*floorWbSize + padding
+
+	cellX := func(x int) float32 { return originX + float32(x-cells.Min.X)*floorWbSize }
+	cellY := func(y int) float32 { return originY + float32(y-cells.Min.Y)*floorWbSize }
+
+	var b bytes.Buffer
+
+	fmt.Fprintf(&b, "<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n")
+	fmt.Fprintf(&b, "<svg xmlns=\"http://www.w3.org/2000/svg\" xmlns:xlink=\"http://www.w3.org/1999/xlink\" xmlns:inkscape=\"http://www.inkscape.org/namespaces/inkscape\" width=\"%s\" height=\"%s\" viewBox=\"0 0 %s %s\">\n",
+		svgFloat(width), svgFloat(height), svgFloat(width), svgFloat(height))
+	fmt.Fprintf(&b, "<style>%s</style>\n", svgStyle)
+
+	// узоры для использованных тайлов пола
+	fmt.Fprintf(&b, "<defs>\n")
+	floors := make(map[uint32]struct{})
+	for i := 0; i < model.NumLayers(); i++ {
+		for y := cells.Min.Y; y < cells.Max.Y; y++ {
+			for x := cells.Min.X; x < cells.Max.X; x++ {
+				index := rotMapModel.Floor(x, y, int32(i))
+				if _, ok := floors[index]; index == 0 || ok {
+					continue
+				}
+				floors[index] = struct{}{}
+
+				url, err := floorTileURL(images, imageConfig, index)
+				if err != nil {
+					return err
+				}
+				fmt.Fprintf(&b, "<pattern id=\"floor-%d\" width=\"1\" height=\"1\" patternContentUnits=\"objectBoundingBox\"><image width=\"1\" height=\"1\" preserveAspectRatio=\"none\" xlink:href=\"%s\"/></pattern>\n", index, url)
+			}
+		}
+	}
+	fmt.Fprintf(&b, "</defs>\n")
+
+	fmt.Fprintf(&b, "<rect width=\"100%%\" height=\"100%%\" fill=\"#ffffff\"/>\n")
+
+	// сетка клеток
+	fmt.Fprintf(&b, "<g id=\"grid\" class=\"grid\" inkscape:groupmode=\"layer\" inkscape:label=\"Grid\">\n")
+	for x := cells.Min.X; x <= cells.Max.X; x++ {
+		pX := cellX(x) - opts.Scale/2
+		fmt.Fprintf(&b, "<line x1=\"%s\" y1=\"%s\" x2=\"%s\" y2=\"%s\"/>\n", svgFloat(pX), svgFloat(cellY(cells.Min.Y)), svgFloat(pX), svgFloat(cellY(cells.Max.Y)))
+	}
+	for y := cells.Min.Y; y <= cells.Max.Y; y++ {
+		pY := cellY(y) - opts.Scale/2
+		fmt.Fprintf(&b, "<line x1=\"%s\" y1=\"%s\" x2=\"%s\" y2=\"%s\"/>\n", svgFloat(cellX(cells.Min.X)), svgFloat(pY), svgFloat(cellX(cells.Max.X)), svgFloat(pY))
+	}
+	fmt.Fprintf(&b, "</g>\n")
+
+	wallColors := make(map[uint32]string)
+	for i, info := range model.LayerInfos() {
+		layerIndex := int32(i)
+
+		style := ""
+		if !info.Visible {
+			style = " style=\"display:none\""
+		}
+		fmt.Fprintf(&b, "<g id=\"layer-%s\" inkscape:groupmode=\"layer\" inkscape:label=\"%s\"%s>\n", info.Uuid, svgEscape(info.Name), style)
+
+		for y := cells.Min.Y; y < cells.Max.Y; y++ {
+			for x := cells.Min.X; x < cells.Max.X; x++ {
+				if index := rotMapModel.Floor(x, y, layerIndex); index > 0 {
+					fmt.Fprintf(&b, "<rect x=\"%s\" y=\"%s\" width=\"%s\" height=\"%s\" fill=\"url(#floor-%d)\"/>\n",
+						svgFloat(cellX(x)), svgFloat(cellY(y)), svgFloat(floorWobSize), svgFloat(floorWobSize), index)
+				}
+			}
+		}
+
+		// у клеток левее и выше cells - только стены на их границе: там лежат стены левой и верхней
+		// границы ограниченной карты(см. map_model.Dimensions.NormalizeWall)
+		for y := cells.Min.Y - 1; y < cells.Max.Y; y++ {
+			for x := cells.Min.X - 1; x < cells.Max.X; x++ {
+				for _, isRight := range []bool{true, false} {
+					if (isRight && y < cells.Min.Y) || (!isRight && x < cells.Min.X) {
+						continue
+					}
+
+					index := rotMapModel.Wall(x, y, layerIndex, isRight)
+					if index == 0 {
+						continue
+					}
+
+					c, ok := wallColors[index]
+					if !ok {
+						c = svgColor(wallTileColor(images, imageConfig, index))
+						wallColors[index] = c
+					}
+
+					// линия посередине границы между клетками
+					var x1, y1, x2, y2 float32
+					if isRight {
+						x1, y1 = cellX(x+1)-opts.Scale/2, cellY(y)
+						x2, y2 = x1, cellY(y+1)
+					} else {
+						x1, y1 = cellX(x), cellY(y+1)-opts.Scale/2
+						x2, y2 = cellX(x+1), y1
+					}
+					fmt.Fprintf(&b, "<line class=\"wall\" x1=\"%s\" y1=\"%s\" x2=\"%s\" y2=\"%s\" stroke=\"%s\" stroke-width=\"%s\"/>\n",
+						svgFloat(x1), svgFloat(y1), svgFloat(x2), svgFloat(y2), c, svgFloat(wallWidth))
+
+					kind := rotMapModel.WallKind(x, y, layerIndex, isRight)
+					if kind == map_model.OneWayForwardWall || kind == map_model.OneWayBackwardWall {
+						// стрелка поперёк середины стены, вперёд - вправо(вниз), как в overlays.DrawWallKind
+						forwardX, forwardY := float32(0), float32(1)
+						if isRight {
+							forwardX, forwardY = 1, 0
+						}
+						if kind == map_model.OneWayBackwardWall {
+							forwardX, forwardY = -forwardX, -forwardY
+						}
+						cX, cY := (x1+x2)/2, (y1+y2)/2
+						size := floorWbSize / 6
+						fmt.Fprintf(&b, "<polygon class=\"%s\" points=\"%s,%s %s,%s %s,%s\"/>\n", wallKindClass(kind),
+							svgFloat(cX+forwardX*size), svgFloat(cY+forwardY*size),
+							svgFloat(cX-forwardX*size+forwardY*size), svgFloat(cY-forwardY*size+forwardX*size),
+							svgFloat(cX-forwardX*size-forwardY*size), svgFloat(cY-forwardY*size-forwardX*size))
+					} else if class := wallKindClass(kind); len(class) > 0 {
+						// значок вида - средняя треть стены
+						dX, dY := (x2-x1)/3, (y2-y1)/3
+						fmt.Fprintf(&b, "<line class=\"%s\" x1=\"%s\" y1=\"%s\" x2=\"%s\" y2=\"%s\" stroke-width=\"%s\"/>\n",
+							class, svgFloat(x1+dX), svgFloat(y1+dY), svgFloat(x2-dX), svgFloat(y2-dY), svgFloat(wallWidth))
+					}
+				}
+			}
+		}
+
+		if opts.Notes && notesModel != nil {
+			for y := cells.Min.Y; y < cells.Max.Y; y++ {
+				for x := cells.Min.X; x < cells.Max.X; x++ {
+					if noteId := rotMapModel.NoteId(x, y, layerIndex); len(noteId) > 0 {
+						fmt.Fprintf(&b, "<text class=\"note\" x=\"%s\" y=\"%s\" font-size=\"%s\">%s</text>\n",
+							svgFloat(cellX(x)+opts.Scale), svgFloat(cellY(y)+fontSize), svgFloat(fontSize), svgEscape(noteId))
+					}
+				}
+			}
+		}
+
+		// отметки кружками в левой нижней четверти клетки, как в overlays.MarkerSlot, но все
+		markerSize := floorWobSize / 4
+		for y := cells.Min.Y; y < cells.Max.Y; y++ {
+			for x := cells.Min.X; x < cells.Max.X; x++ {
+				for i, marker := range rotMapModel.Markers(x, y, layerIndex) {
+					cX := cellX(x) + (float32(i%4)+0.5)*markerSize
+					cY := cellY(y) + floorWobSize - (float32(i/4)+0.5)*markerSize
+					fmt.Fprintf(&b, "<circle class=\"marker marker-%s\" cx=\"%s\" cy=\"%s\" r=\"%s\"><title>%s</title></circle>\n",
+						strings.ToLower(marker.Icon.String()), svgFloat(cX), svgFloat(cY), svgFloat(markerSize*0.4), svgEscape(markerTitle(marker)))
+				}
+			}
+		}
+
+		fmt.Fprintf(&b, "</g>\n")
+	}
+
+	if opts.Rulers {
+		// подписи линеек, как в RenderImage
+		label := func(x0, y0, x1, y1 int) string {
+			mX0, mY0 := rotateModel.TransformToRot(x0, y0)
+			mX1, _ := rotateModel.TransformToRot(x1, y1)
+			if mX0 != mX1 {
+				return strconv.Itoa(mX0)
+			}
+			return strconv.Itoa(mY0)
+		}
+
+		fmt.Fprintf(&b, "<g id=\"rulers\" class=\"ruler\" font-size=\"%s\" inkscape:groupmode=\"layer\" inkscape:label=\"Rulers\">\n", svgFloat(fontSize))
+		for x := cells.Min.X; x < cells.Max.X; x++ {
+			fmt.Fprintf(&b, "<text x=\"%s\" y=\"%s\" text-anchor=\"middle\">%s</text>\n",
+				svgFloat(cellX(x)+floorWobSize/2), svgFloat(rulerSize-fontSize/2), label(x, cells.Min.Y, x+1, cells.Min.Y))
+		}
+		for y := cells.Min.Y; y < cells.Max.Y; y++ {
+			fmt.Fprintf(&b, "<text x=\"%s\" y=\"%s\" text-anchor=\"end\" dominant-baseline=\"middle\">%s</text>\n",
+				svgFloat(rulerSize-fontSize/2), svgFloat(cellY(y)+floorWobSize/2), label(cells.Min.X, y, cells.Min.X, y+1))
+		}
+		fmt.Fprintf(&b, "</g>\n")
+	}
+
+	fmt.Fprintf(&b, "</svg>\n")
+
+	_, err := writer.Write(b.Bytes())
+	return err
+}
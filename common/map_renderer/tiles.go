@@ -0,0 +1,65 @@
+package map_renderer
+
+import (
+	"image"
+	"image/draw"
+
+	"github.com/disintegration/imaging"
+)
+
+// Исходные картинки тайлов. Тайлы лежат в ряд, индекс тайла - номер по горизонтали.
+type TileImages struct {
+	Floor         image.Image
+	Wall          image.Image
+	FloorSelected image.Image
+	WallSelected  image.Image
+}
+
+// Тайлы, отмасштабированные под scale
+type Tiles struct {
+	Floor          image.Image
+	Wall           image.Image
+	Wall90         image.Image
+	FloorSelected  image.Image
+	WallSelected   image.Image
+	WallSelected90 image.Image
+}
+
+func NewTiles(images TileImages, scale float32) Tiles {
+	resize := func(img image.Image) image.Image {
+		if scale == 1. {
+			return img
+		}
+
+		bounds := img.Bounds()
+		return imaging.Resize(img, int(float32(bounds.Dx())*scale), int(float32(bounds.Dy())*scale), imaging.Lanczos)
+	}
+
+	tiles := Tiles{
+		Floor:         resize(images.Floor),
+		Wall:          resize(images.Wall),
+		FloorSelected: resize(images.FloorSelected),
+		WallSelected:  resize(images.WallSelected),
+	}
+	tiles.Wall90 = imaging.Rotate270(tiles.Wall)
+	tiles.WallSelected90 = imaging.Rotate270(tiles.WallSelected)
+
+	// draw.Draw копирует *image.RGBA в *image.RGBA без попиксельного пересчёта, а png и imaging
+	// дают NRGBA, который пересчитывается при каждой отрисовке клетки
+	for _, img := range []*image.Image{&tiles.Floor, &tiles.Wall, &tiles.Wall90, &tiles.FloorSelected, &tiles.WallSelected, &tiles.WallSelected90} {
+		*img = toRGBA(*img)
+	}
+
+	return tiles
+}
+
+func toRGBA(img image.Image) *image.RGBA {
+	if rgba, ok := img.(*image.RGBA); ok {
+		return rgba
+	}
+
+	bounds := img.Bounds()
+	result := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(result, result.Bounds(), img, bounds.Min, draw.Src)
+	return result
+}
@@ -0,0 +1,214 @@
+package note_links
+
+import (
+	"errors"
+	"fmt"
+	"old-school-rpg-map-editor/models/map_model"
+	"old-school-rpg-map-editor/models/notes_model"
+	"old-school-rpg-map-editor/utils"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/text"
+	"golang.org/x/exp/slices"
+)
+
+// Ссылки в тексте заметки - обычные ссылки Markdown со своими схемами:
+//
+//	[текст](note:id)                заметка этой карты
+//	[текст](cell:x,y)               клетка этой карты на текущем уровне
+//	[текст](cell:x,y,level)         клетка этой карты на уровне level
+//	[текст](map:file.map)           другая карта, путь относительно папки карты
+//	[текст](map:file.map#note:id)   заметка другой карты
+//	[текст](map:file.map#cell:x,y)  клетка другой карты
+//
+// [[id]] - то же, что [id](note:id). Путь с пробелами пишется в угловых скобках: [текст](<map:my map.map>)
+
+const (
+	noteScheme = "note:"
+	cellScheme = "cell:"
+	mapScheme  = "map:"
+)
+
+var (
+	ErrBadLink      = errors.New("bad link")
+	ErrUnsavedMap   = errors.New("relative link from unsaved map")
+	ErrNoLinkedNote = errors.New("no such note")
+	ErrNoLinkedCell = errors.New("no such cell")
+)
+
+// Ссылка из текста заметки на заметку, клетку или другую карту
+type Link struct {
+	File   string      // другая карта, путь как в тексте; пустой - эта же карта
+	NoteId string      // заметка; пустой - ссылка на клетку или на карту
+	Cell   *utils.Int2 // клетка, координаты карты(без учёта поворота)
+	Level  *int32      // уровень клетки, nil - текущий уровень карты
+}
+
+func (l Link) target() string {
+	if len(l.NoteId) > 0 {
+		return noteScheme + l.NoteId
+	}
+	if l.Cell != nil {
+		s := fmt.Sprintf("%s%d,%d", cellScheme, l.Cell.X, l.Cell.Y)
+		if l.Level != nil {
+			s += fmt.Sprintf(",%d", *l.Level)
+		}
+		return s
+	}
+	return ""
+}
+
+func (l Link) String() string {
+	if len(l.File) == 0 {
+		return l.target()
+	}
+	if target := l.target(); len(target) > 0 {
+		return mapScheme + l.File + "#" + target
+	}
+	return mapScheme + l.File
+}
+
+// Разбирает "note:..." или "cell:..."
+func parseTarget(s string) (Link, error) {
+	switch {
+	case strings.HasPrefix(s, noteScheme):
+		noteId := strings.TrimPrefix(s, noteScheme)
+		if err := notes_model.ValidateNoteId(noteId); err != nil {
+			return Link{}, fmt.Errorf("%w %q: %v", ErrBadLink, s, err)
+		}
+		return Link{NoteId: noteId}, nil
+
+	case strings.HasPrefix(s, cellScheme):
+		parts := strings.Split(strings.TrimPrefix(s, cellScheme), ",")
+		if len(parts) != 2 && len(parts) != 3 {
+			return Link{}, fmt.Errorf("%w %q: expected x,y or x,y,level", ErrBadLink, s)
+		}
+
+		var values []int
+		for _, part := range parts {
+			v, err := strconv.Atoi(strings.TrimSpace(part))
+			if err != nil {
+				return Link{}, fmt.Errorf("%w %q: %v", ErrBadLink, s, err)
+			}
+			values = append(values, v)
+		}
+
+		link := Link{Cell: utils.ToPtr(utils.NewInt2(values[0], values[1]))}
+		if len(values) == 3 {
+			link.Level = utils.ToPtr(int32(values[2]))
+		}
+		return link, nil
+	}
+
+	return Link{}, fmt.Errorf("%w %q", ErrBadLink, s)
+}
+
+// Разбирает адрес ссылки. ok == false - это не ссылка внутри карт(например https://...), её открывает браузер
+func Parse(destination string) (link Link, ok bool, err error) {
+	destination = strings.TrimSpace(destination)
+
+	switch {
+	case strings.HasPrefix(destination, noteScheme), strings.HasPrefix(destination, cellScheme):
+		link, err = parseTarget(destination)
+		return link, true, err
+
+	case strings.HasPrefix(destination, mapScheme):
+		file, target, _ := strings.Cut(strings.TrimPrefix(destination, mapScheme), "#")
+		if len(file) == 0 {
+			return Link{}, true, fmt.Errorf("%w %q: no file", ErrBadLink, destination)
+		}
+
+		if len(target) > 0 {
+			link, err = parseTarget(target)
+			if err != nil {
+				return Link{}, true, err
+			}
+		}
+		link.File = file
+		return link, true, nil
+	}
+
+	return Link{}, false, nil
+}
+
+var shortNoteLink = regexp.MustCompile(`\[\[([^\[\]\s]+)\]\]`)
+
+// Текст заметки для разбора Markdown: [[id]] становится [id](note:id)
+func Markdown(body string) string {
+	return shortNoteLink.ReplaceAllString(body, "[$1]("+noteScheme+"$1)")
+}
+
+// Адреса всех ссылок текста заметки по порядку, как их видит разбор Markdown
+func Destinations(body string) []string {
+	source := []byte(Markdown(body))
+	doc := goldmark.DefaultParser().Parse(text.NewReader(source))
+
+	var destinations []string
+	ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if link, ok := n.(*ast.Link); ok && entering {
+			destinations = append(destinations, string(link.Destination))
+		}
+		return ast.WalkContinue, nil
+	})
+
+	return destinations
+}
+
+// Путь к карте ссылки. Относительный путь считается от папки карты mapFilePath
+func ResolveFile(file, mapFilePath string) (string, error) {
+	if filepath.IsAbs(file) {
+		return file, nil
+	}
+	if len(mapFilePath) == 0 {
+		return "", ErrUnsavedMap
+	}
+	return filepath.Join(filepath.Dir(mapFilePath), file), nil
+}
+
+// Проверяет, что заметка(в списке или в клетке) или клетка ссылки есть в карте mapModel. File ссылки не проверяется
+func CheckTarget(link Link, mapModel *map_model.MapModel, notesModel *notes_model.NotesModel) error {
+	if len(link.NoteId) > 0 {
+		if _, ok := notesModel.Note(link.NoteId); ok {
+			return nil
+		}
+		if _, exists := mapModel.NoteCells()[link.NoteId]; exists {
+			return nil
+		}
+		return fmt.Errorf("%w %q", ErrNoLinkedNote, link.NoteId)
+	}
+
+	if link.Cell != nil {
+		if link.Level != nil && !slices.Contains(mapModel.Levels(), *link.Level) {
+			return fmt.Errorf("%w (%d, %d): no level %d", ErrNoLinkedCell, link.Cell.X, link.Cell.Y, *link.Level)
+		}
+		if _, err := mapModel.Dimensions().Normalize(*link.Cell); err != nil {
+			return fmt.Errorf("%w: %v", ErrNoLinkedCell, err)
+		}
+	}
+
+	return nil
+}
+
+// Проверяет ссылку из заметки карты mapModel, сохранённой в mapFilePath. Карту другого файла даёт load
+func Check(link Link, mapModel *map_model.MapModel, notesModel *notes_model.NotesModel, mapFilePath string, load func(filePath string) (*map_model.MapModel, *notes_model.NotesModel, error)) error {
+	if len(link.File) == 0 {
+		return CheckTarget(link, mapModel, notesModel)
+	}
+
+	filePath, err := ResolveFile(link.File, mapFilePath)
+	if err != nil {
+		return err
+	}
+
+	linkedMapModel, linkedNotesModel, err := load(filePath)
+	if err != nil {
+		return err
+	}
+
+	return CheckTarget(link, linkedMapModel, linkedNotesModel)
+}
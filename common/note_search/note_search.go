@@ -0,0 +1,96 @@
+package note_search
+
+import (
+	"old-school-rpg-map-editor/models/map_model"
+	"old-school-rpg-map-editor/models/maps_model"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/google/uuid"
+	"golang.org/x/exp/slices"
+)
+
+// Найденная заметка. Заметка на нескольких клетках даёт по результату на клетку
+type Result struct {
+	MapId   uuid.UUID
+	MapName string // как в табе карты
+	NoteId  string
+	Title   string              // заголовок заметки, пустой если заметка есть только на клетках
+	OnMap   bool                // заметка стоит на клетке Cell, иначе она есть только в тексте
+	Cell    map_model.LayerCell // координаты карты(без учёта поворота)
+	Level   int32               // уровень слоя клетки
+}
+
+func mapName(mapElem maps_model.MapElem) string {
+	if len(mapElem.FilePath) == 0 {
+		return "Unknown"
+	}
+	return filepath.Base(mapElem.FilePath)
+}
+
+// Ищет query без учёта регистра в id, заголовке, тексте и тегах заметок всех открытых карт. Пустой
+// query - все заметки. Результаты по картам, внутри карты - по порядку заметок в списке.
+func Search(mapsModel *maps_model.MapsModel, query string) []Result {
+	query = strings.ToLower(strings.TrimSpace(query))
+
+	mapElems := mapsModel.MapElems()
+	sort.SliceStable(mapElems, func(i, j int) bool {
+		return mapName(mapElems[i]) < mapName(mapElems[j])
+	})
+
+	var results []Result
+	for _, mapElem := range mapElems {
+		noteCells := mapElem.Model.NoteCells()
+
+		// заметки, которых нет в списке, идут после остальных
+		noteIds := mapElem.NotesModel.GetNoteIds()
+		var onlyOnMap []string
+		for noteId := range noteCells {
+			if !slices.Contains(noteIds, noteId) {
+				onlyOnMap = append(onlyOnMap, noteId)
+			}
+		}
+		sort.Strings(onlyOnMap)
+		noteIds = append(noteIds, onlyOnMap...)
+
+		layerInfos := mapElem.Model.LayerInfos()
+
+		for _, noteId := range noteIds {
+			note, _ := mapElem.NotesModel.Note(noteId)
+			fields := append([]string{noteId, note.Title, note.Body}, note.Tags...)
+			if slices.IndexFunc(fields, func(s string) bool { return strings.Contains(strings.ToLower(s), query) }) == -1 {
+				continue
+			}
+
+			result := Result{MapId: mapElem.MapId, MapName: mapName(mapElem), NoteId: noteId, Title: note.Title}
+
+			cells, exists := noteCells[noteId]
+			if !exists {
+				results = append(results, result)
+				continue
+			}
+
+			for _, cell := range cells {
+				if int(cell.LayerIndex) >= len(layerInfos) {
+					continue
+				}
+				result.OnMap = true
+				result.Cell = cell
+				result.Level = layerInfos[cell.LayerIndex].Level
+				results = append(results, result)
+			}
+		}
+	}
+
+	return results
+}
+
+// Число карт в результатах
+func MapCount(results []Result) int {
+	mapIds := make(map[uuid.UUID]struct{})
+	for _, r := range results {
+		mapIds[r.MapId] = struct{}{}
+	}
+	return len(mapIds)
+}
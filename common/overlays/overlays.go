@@ -0,0 +1,337 @@
+package overlays
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"old-school-rpg-map-editor/models/map_model"
+	"old-school-rpg-map-editor/utils"
+)
+
+// Значки, которые рисуются поверх клеток карты. Рисуются процедурно, чтобы не зависеть от масштаба.
+
+var (
+	stairsUpColor   = color.RGBA{0x22, 0x88, 0x22, 0xff}
+	stairsDownColor = color.RGBA{0x88, 0x55, 0x22, 0xff}
+	teleportColor   = color.RGBA{0x88, 0x22, 0xcc, 0xff}
+	pitColor        = color.RGBA{0x22, 0x22, 0x22, 0xff}
+	chuteColor      = color.RGBA{0x22, 0x55, 0xaa, 0xff}
+)
+
+// Рисует в rect треугольник, который смотрит в направлении (dX, dY)
+func DrawArrow(img draw.Image, rect image.Rectangle, dX, dY int, c color.Color) {
+	cX := float32(rect.Min.X+rect.Max.X) / 2
+	cY := float32(rect.Min.Y+rect.Max.Y) / 2
+	r := float32(rect.Dx()) / 2 * 0.8
+
+	fDX, fDY := float32(dX), float32(dY)
+	pX, pY := -fDY, fDX // перпендикуляр к направлению
+
+	aX, aY := cX+fDX*r, cY+fDY*r
+	bX, bY := cX-fDX*r*0.6+pX*r*0.7, cY-fDY*r*0.6+pY*r*0.7
+	dcX, dcY := cX-fDX*r*0.6-pX*r*0.7, cY-fDY*r*0.6-pY*r*0.7
+
+	edge := func(x1, y1, x2, y2, x, y float32) float32 {
+		return (x2-x1)*(y-y1) - (y2-y1)*(x-x1)
+	}
+
+	bounds := rect.Intersect(img.Bounds())
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			fX, fY := float32(x)+0.5, float32(y)+0.5
+
+			e1 := edge(aX, aY, bX, bY, fX, fY)
+			e2 := edge(bX, bY, dcX, dcY, fX, fY)
+			e3 := edge(dcX, dcY, aX, aY, fX, fY)
+
+			hasNeg := e1 < 0 || e2 < 0 || e3 < 0
+			hasPos := e1 > 0 || e2 > 0 || e3 > 0
+			if !(hasNeg && hasPos) {
+				img.Set(x, y, c)
+			}
+		}
+	}
+}
+
+// Рисует круг(если inner > 0, то кольцо) с центром в центре rect
+func drawCircle(img draw.Image, rect image.Rectangle, inner float32, c color.Color) {
+	cX := float32(rect.Min.X+rect.Max.X) / 2
+	cY := float32(rect.Min.Y+rect.Max.Y) / 2
+	r := float32(rect.Dx()) / 2
+
+	bounds := rect.Intersect(img.Bounds())
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			dX, dY := float32(x)+0.5-cX, float32(y)+0.5-cY
+			d := dX*dX + dY*dY
+			if d <= r*r && d >= inner*inner*r*r {
+				img.Set(x, y, c)
+			}
+		}
+	}
+}
+
+// Рисует ступеньки: isUp - ступеньки поднимаются слева направо
+func drawStairs(img draw.Image, rect image.Rectangle, isUp bool, c color.Color) {
+	const steps = 3
+
+	stepWidth := rect.Dx() / steps
+	stepHeight := rect.Dy() / steps
+
+	for i := 0; i < steps; i++ {
+		height := (i + 1) * stepHeight
+		if !isUp {
+			height = (steps - i) * stepHeight
+		}
+
+		stepRect := image.Rect(rect.Min.X+i*stepWidth, rect.Max.Y-height, rect.Min.X+(i+1)*stepWidth, rect.Max.Y)
+		draw.Draw(img, stepRect, image.NewUniform(c), image.Point{}, draw.Over)
+	}
+}
+
+// Рисует значок link'а в правом нижнем углу клетки rect
+func DrawLink(img draw.Image, rect image.Rectangle, linkType map_model.LinkType) {
+	size := rect.Dx() / 2
+	if size < 4 {
+		size = rect.Dx()
+	}
+
+	iconRect := image.Rect(rect.Max.X-size, rect.Max.Y-size, rect.Max.X, rect.Max.Y).Inset(size / 8)
+
+	switch linkType {
+	case map_model.StairsUpLink:
+		drawStairs(img, iconRect, true, stairsUpColor)
+	case map_model.StairsDownLink:
+		drawStairs(img, iconRect, false, stairsDownColor)
+	case map_model.TeleportLink:
+		drawCircle(img, iconRect, 0.6, teleportColor)
+		drawCircle(img, iconRect.Inset(iconRect.Dx()/3), 0, teleportColor)
+	case map_model.PitLink:
+		drawCircle(img, iconRect, 0, pitColor)
+	case map_model.ChuteLink:
+		drawCircle(img, iconRect, 0, chuteColor)
+		DrawArrow(img, iconRect.Inset(iconRect.Dx()/6), 0, 1, color.White)
+	}
+}
+
+var (
+	doorColor        = color.RGBA{0x99, 0x66, 0x33, 0xff}
+	lockColor        = color.RGBA{0xee, 0xcc, 0x22, 0xff}
+	secretDoorColor  = color.RGBA{0x88, 0x22, 0xcc, 0xff}
+	oneWayColor      = color.RGBA{0xdd, 0x22, 0x22, 0xff}
+	illusionaryColor = color.RGBA{0xff, 0xff, 0xff, 0xaa}
+)
+
+// Рисует поверх стены wallRect значок её вида. isRight - стена вертикальная(правая у клетки).
+// Направление односторонней стены задаётся в координатах экрана.
+func DrawWallKind(img draw.Image, wallRect image.Rectangle, isRight bool, kind map_model.WallKind) {
+	var length, side int
+	if isRight {
+		length, side = wallRect.Dy(), wallRect.Dx()
+	} else {
+		length, side = wallRect.Dx(), wallRect.Dy()
+	}
+
+	// часть стены посередине длиной part
+	middle := func(part int) image.Rectangle {
+		if isRight {
+			cY := (wallRect.Min.Y + wallRect.Max.Y) / 2
+			return image.Rect(wallRect.Min.X, cY-part/2, wallRect.Max.X, cY+part/2)
+		}
+		cX := (wallRect.Min.X + wallRect.Max.X) / 2
+		return image.Rect(cX-part/2, wallRect.Min.Y, cX+part/2, wallRect.Max.Y)
+	}
+
+	forwardX, forwardY := 0, 1
+	if isRight {
+		forwardX, forwardY = 1, 0
+	}
+
+	switch kind {
+	case map_model.DoorWall:
+		draw.Draw(img, middle(length/3), image.NewUniform(doorColor), image.Point{}, draw.Over)
+	case map_model.LockedDoorWall:
+		draw.Draw(img, middle(length/3), image.NewUniform(doorColor), image.Point{}, draw.Over)
+		draw.Draw(img, middle(side).Inset(side/4), image.NewUniform(lockColor), image.Point{}, draw.Over)
+	case map_model.SecretDoorWall:
+		drawCircle(img, middle(side), 0.5, secretDoorColor)
+	case map_model.OneWayForwardWall:
+		DrawArrow(img, middle(side), forwardX, forwardY, oneWayColor)
+	case map_model.OneWayBackwardWall:
+		DrawArrow(img, middle(side), -forwardX, -forwardY, oneWayColor)
+	case map_model.IllusionaryWall:
+		// пунктир вдоль стены
+		dash := utils.Max(side/2, 2)
+		for offset := 0; offset < length; offset += 2 * dash {
+			var dashRect image.Rectangle
+			if isRight {
+				dashRect = image.Rect(wallRect.Min.X, wallRect.Min.Y+offset, wallRect.Max.X, wallRect.Min.Y+offset+dash)
+			} else {
+				dashRect = image.Rect(wallRect.Min.X+offset, wallRect.Min.Y, wallRect.Min.X+offset+dash, wallRect.Max.Y)
+			}
+			draw.Draw(img, dashRect.Intersect(wallRect), image.NewUniform(illusionaryColor), image.Point{}, draw.Over)
+		}
+	}
+}
+
+var (
+	darknessColor  = color.RGBA{0x00, 0x00, 0x00, 0x66}
+	spinnerColor   = color.RGBA{0xee, 0x88, 0x00, 0xff}
+	antiMagicColor = color.RGBA{0x44, 0x66, 0x99, 0xff}
+	damageColor    = color.RGBA{0xcc, 0x11, 0x11, 0xff}
+	encounterColor = color.RGBA{0xcc, 0x22, 0xaa, 0xff}
+	waterColor     = color.RGBA{0x22, 0x77, 0xee, 0xff}
+	trapColor      = color.RGBA{0x33, 0x33, 0x33, 0xff}
+)
+
+// Рисует значок одного effect в rect
+func DrawEffectIcon(img draw.Image, rect image.Rectangle, effect map_model.Effects) {
+	switch effect {
+	case map_model.DarknessEffect:
+		draw.Draw(img, rect, image.NewUniform(color.Black), image.Point{}, draw.Over)
+	case map_model.SpinnerEffect:
+		drawCircle(img, rect, 0.5, spinnerColor)
+	case map_model.AntiMagicEffect:
+		draw.Draw(img, rect.Inset(rect.Dx()/8), image.NewUniform(antiMagicColor), image.Point{}, draw.Over)
+	case map_model.DamageEffect:
+		DrawArrow(img, rect, 0, -1, damageColor)
+	case map_model.EncounterEffect:
+		drawCircle(img, rect, 0, encounterColor)
+	case map_model.WaterEffect:
+		drawCircle(img, rect, 0, waterColor)
+		drawCircle(img, rect.Inset(rect.Dx()/4), 0, color.White)
+	case map_model.TrapEffect:
+		DrawArrow(img, rect, 0, 1, trapColor)
+	}
+}
+
+// Рисует effects клетки rect: темнота затемняет всю клетку, остальные - значки в ряд по верхнему краю
+func DrawEffects(img draw.Image, rect image.Rectangle, effects map_model.Effects) {
+	if effects.Has(map_model.DarknessEffect) {
+		draw.Draw(img, rect, image.NewUniform(darknessColor), image.Point{}, draw.Over)
+	}
+
+	size := utils.Max(rect.Dx()/4, 3)
+	iconRect := image.Rect(rect.Min.X, rect.Min.Y, rect.Min.X+size, rect.Min.Y+size)
+
+	for _, effect := range map_model.AllEffects {
+		if effect == map_model.DarknessEffect || !effects.Has(effect) {
+			continue
+		}
+
+		DrawEffectIcon(img, iconRect.Inset(1), effect)
+
+		iconRect = iconRect.Add(image.Pt(size, 0))
+		if iconRect.Max.X > rect.Max.X {
+			iconRect = image.Rect(rect.Min.X, iconRect.Max.Y, rect.Min.X+size, iconRect.Max.Y+size)
+		}
+	}
+}
+
+var (
+	chestColor          = color.RGBA{0x99, 0x66, 0x33, 0xff}
+	monsterColor        = color.RGBA{0xcc, 0x11, 0x11, 0xff}
+	questColor          = color.RGBA{0xee, 0xcc, 0x22, 0xff}
+	npcColor            = color.RGBA{0x22, 0x88, 0x22, 0xff}
+	keyColor            = color.RGBA{0xcc, 0x99, 0x00, 0xff}
+	treasureColor       = color.RGBA{0xee, 0xbb, 0x00, 0xff}
+	dangerColor         = color.RGBA{0xee, 0x66, 0x00, 0xff}
+	infoColor           = color.RGBA{0x22, 0x55, 0xaa, 0xff}
+	moreColor           = color.RGBA{0x66, 0x66, 0x66, 0xff}
+	markerSelectedColor = color.RGBA{0x00, 0x99, 0xff, 0xff}
+)
+
+// Рисует значок отметки в rect
+func DrawMarkerIcon(img draw.Image, rect image.Rectangle, icon map_model.MarkerIcon) {
+	d := rect.Dx()
+
+	switch icon {
+	case map_model.ChestMarker:
+		draw.Draw(img, rect.Inset(d/8), image.NewUniform(chestColor), image.Point{}, draw.Over)
+		band := rect.Inset(d / 8)
+		band.Min.Y = rect.Min.Y + d*3/8
+		band.Max.Y = band.Min.Y + utils.Max(d/8, 1)
+		draw.Draw(img, band, image.NewUniform(keyColor), image.Point{}, draw.Over)
+	case map_model.MonsterMarker:
+		drawCircle(img, rect, 0, monsterColor)
+		DrawArrow(img, rect.Inset(d/4), 0, -1, color.White)
+	case map_model.QuestMarker:
+		drawCircle(img, rect, 0, questColor)
+		cX := (rect.Min.X + rect.Max.X) / 2
+		w := utils.Max(d/8, 1)
+		draw.Draw(img, image.Rect(cX-w/2, rect.Min.Y+d/5, cX-w/2+w, rect.Min.Y+d*3/5), image.NewUniform(color.Black), image.Point{}, draw.Over)
+		draw.Draw(img, image.Rect(cX-w/2, rect.Max.Y-d/5-w, cX-w/2+w, rect.Max.Y-d/5), image.NewUniform(color.Black), image.Point{}, draw.Over)
+	case map_model.NpcMarker:
+		drawCircle(img, rect, 0, npcColor)
+		drawCircle(img, rect.Inset(d/3), 0, color.White)
+	case map_model.KeyMarker:
+		ring := image.Rect(rect.Min.X, rect.Min.Y+d/4, rect.Min.X+d/2, rect.Min.Y+d*3/4)
+		drawCircle(img, ring, 0.5, keyColor)
+		bar := image.Rect(ring.Max.X, (rect.Min.Y+rect.Max.Y)/2-utils.Max(d/16, 1), rect.Max.X, (rect.Min.Y+rect.Max.Y)/2+utils.Max(d/16, 1))
+		draw.Draw(img, bar, image.NewUniform(keyColor), image.Point{}, draw.Over)
+	case map_model.TreasureMarker:
+		drawCircle(img, rect, 0, treasureColor)
+		drawCircle(img, rect.Inset(d/4), 0.6, chestColor)
+	case map_model.DangerMarker:
+		DrawArrow(img, rect, 0, -1, dangerColor)
+	case map_model.InfoMarker:
+		drawCircle(img, rect, 0, infoColor)
+		drawCircle(img, rect.Inset(d*3/8), 0, color.White)
+	}
+}
+
+// Сколько мест в кучке отметок клетки. Если отметок больше, последнее место занимает значок "ещё"
+const markerSlots = 4
+
+// Место i кучки отметок клетки rect: сетка 2x2 в левой нижней четверти клетки, чтобы пол было видно
+func MarkerSlot(rect image.Rectangle, i int) image.Rectangle {
+	size := utils.Max(rect.Dx()/4, 3)
+	x := rect.Min.X + i%2*size
+	y := rect.Max.Y - (2-i/2)*size
+	return image.Rect(x, y, x+size, y+size)
+}
+
+// Индекс отметки, место которой в клетке rect содержит pt, или -1. Отметки под значком "ещё"
+// по отдельности не выбираются
+func MarkerAt(rect image.Rectangle, count int, pt image.Point) int {
+	shown := count
+	if count > markerSlots {
+		shown = markerSlots - 1
+	}
+
+	for i := 0; i < shown; i++ {
+		if pt.In(MarkerSlot(rect, i)) {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// Рисует отметки клетки rect кучкой, selected - биты выделенных отметок(см. select_model.Selected.Markers)
+func DrawMarkers(img draw.Image, rect image.Rectangle, markers []map_model.Marker, selected uint32) {
+	shown := len(markers)
+	if shown > markerSlots {
+		shown = markerSlots - 1
+	}
+
+	for i := 0; i < shown; i++ {
+		slot := MarkerSlot(rect, i)
+		if selected&(1<<i) != 0 {
+			draw.Draw(img, slot, image.NewUniform(markerSelectedColor), image.Point{}, draw.Over)
+		}
+		DrawMarkerIcon(img, slot.Inset(1), markers[i].Icon)
+	}
+
+	if shown < len(markers) {
+		slot := MarkerSlot(rect, shown).Inset(1)
+		drawCircle(img, slot, 0, moreColor)
+		// три точки
+		dot := utils.Max(slot.Dx()/6, 1)
+		cY := (slot.Min.Y + slot.Max.Y) / 2
+		for i := 1; i <= 3; i++ {
+			cX := slot.Min.X + slot.Dx()*i/4
+			draw.Draw(img, image.Rect(cX-dot/2, cY-dot/2, cX-dot/2+dot, cY-dot/2+dot), image.NewUniform(color.White), image.Point{}, draw.Over)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+// Ресурсы редактора: картинки и набор тайлов по умолчанию.
+//
+// Ресурсы встроены в бинарник(см. images), поэтому редактор не зависит от рабочей директории.
+// Любой ресурс можно переопределить файлом с тем же именем в директории overrideDir(обычно
+// <директория настроек>/images). Если переопределённый файл не читается или битый, то берётся
+// встроенный, а ошибка запоминается, чтобы показать её пользователю(см. Warnings).
+package resources
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/png"
+	"io/fs"
+	"old-school-rpg-map-editor/common/tileset"
+	"old-school-rpg-map-editor/images"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+type Resources struct {
+	mutex       sync.Mutex
+	overrideDir string // если пустая, то только встроенные ресурсы
+	warnings    []error
+}
+
+func NewResources(overrideDir string) *Resources {
+	return &Resources{overrideDir: overrideDir}
+}
+
+func (r *Resources) warn(err error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.warnings = append(r.warnings, err)
+}
+
+// Ошибки переопределённых ресурсов, вместо которых были взяты встроенные
+func (r *Resources) Warnings() []error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return append([]error(nil), r.warnings...)
+}
+
+// Содержимое переопределённого ресурса, false если его нет или он не читается
+func (r *Resources) readOverride(name string) ([]byte, bool) {
+	if len(r.overrideDir) == 0 {
+		return nil, false
+	}
+
+	d, err := os.ReadFile(filepath.Join(r.overrideDir, name))
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			r.warn(err)
+		}
+		return nil, false
+	}
+
+	return d, true
+}
+
+// Содержимое картинки name. Переопределённая картинка, которая не раскодировалась, заменяется
+// встроенной.
+func (r *Resources) ImageFile(name string) ([]byte, error) {
+	if d, ok := r.readOverride(name); ok {
+		_, _, err := image.Decode(bytes.NewReader(d))
+		if err == nil {
+			return d, nil
+		}
+		r.warn(fmt.Errorf("%s: %w", filepath.Join(r.overrideDir, name), err))
+	}
+
+	return fs.ReadFile(images.FS, name)
+}
+
+func (r *Resources) Image(name string) (image.Image, error) {
+	d, err := r.ImageFile(name)
+	if err != nil {
+		return nil, err
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(d))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+
+	return img, nil
+}
+
+// Набор тайлов по умолчанию. Его файлы(описание и картинки) переопределяются по одному, если
+// получившийся набор не загрузился, то берётся встроенный.
+func (r *Resources) DefaultTileset() (*tileset.Tileset, error) {
+	if len(r.overrideDir) > 0 {
+		t, err := tileset.Load(overlayFS{override: os.DirFS(r.overrideDir), base: images.FS})
+		if err == nil {
+			return t, nil
+		}
+		r.warn(fmt.Errorf("default tileset in %s: %w", r.overrideDir, err))
+	}
+
+	return tileset.Load(images.FS)
+}
+
+// Файлы из override, а тех, которых там нет, - из base
+type overlayFS struct {
+	override fs.FS
+	base     fs.FS
+}
+
+func (o overlayFS) Open(name string) (fs.File, error) {
+	f, err := o.override.Open(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return o.base.Open(name)
+	}
+	return f, err
+}
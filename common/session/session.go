@@ -0,0 +1,127 @@
+package session
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"old-school-rpg-map-editor/models/maps_model"
+	"old-school-rpg-map-editor/models/selected_map_tab_model"
+	"old-school-rpg-map-editor/utils"
+	"os"
+
+	"github.com/google/uuid"
+)
+
+// Состояние открытой карты. Карты без файла в сессию не попадают, их восстанавливает autosave.
+type MapState struct {
+	FilePath      string     `json:"file_path"`
+	Center        utils.Int2 `json:"center"` // см. CenterModel, в пикселях при Scale
+	Angle         int        `json:"angle"`
+	Scale         float32    `json:"scale,omitempty"`
+	Level         int32      `json:"level"`
+	SelectedLayer int32      `json:"selected_layer"`
+}
+
+type Session struct {
+	Maps     []MapState `json:"maps"`               // в порядке табов
+	Selected string     `json:"selected,omitempty"` // файл выбранного таба
+}
+
+// Табы карт: их порядок и масштаб, который хранят виджеты карт
+type Tabs interface {
+	MapIds() []uuid.UUID
+	Scale(mapId uuid.UUID) float32 // 0 - неизвестен
+	SetScale(mapId uuid.UUID, scale float32)
+}
+
+// Собирает сессию из открытых табов
+func Collect(mapsModel *maps_model.MapsModel, selectedMapTabModel *selected_map_tab_model.SelectedMapTabModel, tabs Tabs) Session {
+	var s Session
+
+	for _, mapId := range tabs.MapIds() {
+		mapElem := mapsModel.GetById(mapId)
+		if (mapElem.MapId == uuid.UUID{}) || len(mapElem.FilePath) == 0 {
+			continue
+		}
+
+		state := MapState{
+			FilePath:      mapElem.FilePath,
+			Center:        mapElem.CenterModel.Get(),
+			Angle:         mapElem.RotateModel.Angle(),
+			Level:         mapElem.Model.Level(),
+			SelectedLayer: mapElem.SelectedLayerModel.Selected(),
+			Scale:         tabs.Scale(mapId),
+		}
+
+		s.Maps = append(s.Maps, state)
+
+		if mapElem.MapId == selectedMapTabModel.Selected() {
+			s.Selected = mapElem.FilePath
+		}
+	}
+
+	return s
+}
+
+// Открывает файлы сессии и восстанавливает их состояние. Файлы, которые не удалось открыть,
+// пропускаются, ошибки по ним возвращаются в warnings.
+func (s Session) Restore(mapsModel *maps_model.MapsModel, selectedMapTabModel *selected_map_tab_model.SelectedMapTabModel, tabs Tabs) (warnings []error) {
+	for _, state := range s.Maps {
+		if (mapsModel.GetByFilePath(state.FilePath).MapId != uuid.UUID{}) {
+			continue
+		}
+
+		mapId, historyErr, err := mapsModel.Open(state.FilePath)
+		if err != nil {
+			warnings = append(warnings, fmt.Errorf("%s: %w", state.FilePath, err))
+			continue
+		}
+		if historyErr != nil {
+			warnings = append(warnings, fmt.Errorf("%s: %w", state.FilePath, historyErr))
+		}
+
+		mapElem := mapsModel.GetById(mapId)
+
+		mapElem.Model.SetLevel(state.Level)
+
+		// center зависит от поворота и масштаба, поэтому он последний. Если у карты есть история
+		// правок, то поворот из неё: action'ы хранят повёрнутые координаты
+		if mapElem.UndoRedoQueue.IsEmpty() {
+			mapElem.RotateModel.SetAngle(state.Angle)
+		}
+		if state.Scale > 0 {
+			tabs.SetScale(mapId, state.Scale)
+		}
+		mapElem.CenterModel.Set(state.Center)
+
+		if state.SelectedLayer >= 0 && int(state.SelectedLayer) < mapElem.Model.NumLayers() {
+			mapElem.SelectedLayerModel.SetSelected(state.SelectedLayer)
+		}
+	}
+
+	if len(s.Selected) > 0 {
+		if mapElem := mapsModel.GetByFilePath(s.Selected); (mapElem.MapId != uuid.UUID{}) {
+			selectedMapTabModel.SetSelected(mapElem.MapId)
+		}
+	}
+
+	return warnings
+}
+
+func Load(filePath string) (Session, error) {
+	var s Session
+
+	d, err := os.ReadFile(filePath)
+	if err != nil {
+		return s, err
+	}
+
+	err = json.Unmarshal(d, &s)
+	return s, err
+}
+
+func (s Session) Save(filePath string) error {
+	return utils.WriteFileAtomic(filePath, func(w io.Writer) error {
+		return json.NewEncoder(w).Encode(s)
+	})
+}
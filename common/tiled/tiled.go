@@ -0,0 +1,520 @@
+// Импорт и экспорт карт в формате редактора Tiled(https://www.mapeditor.org): TMX(xml) и TMJ(json).
+//
+// Каждый обычный слой карты - тайловый слой Tiled с полами, за ним, если в слое что-то есть,
+// слой объектов "<имя> walls" со стенами(ломаные) и "<имя> objects" с заметками, link'ами и effects(точки).
+// Uuid и уровень слоя, размеры карты и заметки(json) хранятся в custom properties,
+// поэтому карта, прошедшая через Tiled, загружается обратно без потерь.
+package tiled
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"math"
+	"old-school-rpg-map-editor/models/map_model"
+	"old-school-rpg-map-editor/models/notes_model"
+	"old-school-rpg-map-editor/utils"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+	"golang.org/x/exp/slices"
+)
+
+const (
+	tileLayerKind   = "tilelayer"
+	objectGroupKind = "objectgroup"
+
+	wallsSuffix   = " walls"
+	objectsSuffix = " objects"
+
+	wallClass    = "wall"
+	noteClass    = "note"
+	linkClass    = "link"
+	effectsClass = "effects"
+	markerClass  = "marker"
+
+	gidMask = 0x1fffffff // без флагов отражения тайла
+)
+
+var ErrUnsupported = errors.New("unsupported Tiled map")
+
+type Property struct {
+	Name  string
+	Type  string // string, int, bool
+	Value string
+}
+
+type Point struct {
+	X, Y float64
+}
+
+type Object struct {
+	Id         int
+	Name       string
+	Class      string
+	X, Y       float64
+	Point      bool
+	Polyline   []Point
+	Properties []Property
+}
+
+type Layer struct {
+	Id         int
+	Kind       string // tileLayerKind или objectGroupKind
+	Name       string
+	Visible    bool
+	Width      int
+	Height     int
+	Data       []uint32 // gid'ы тайлов по строкам, только у tileLayerKind
+	Objects    []Object
+	Properties []Property
+}
+
+// Набор тайлов: картинка с тайлами пола в ряд, как images/floor.png
+type Tileset struct {
+	FirstGid    int
+	Name        string
+	TileWidth   int
+	TileHeight  int
+	TileCount   int
+	Columns     int
+	Image       string // путь относительно файла карты
+	ImageWidth  int
+	ImageHeight int
+}
+
+// Карта Tiled, общая для TMX и TMJ
+type Map struct {
+	Width      int
+	Height     int
+	TileWidth  int
+	TileHeight int
+	Properties []Property
+	Tilesets   []Tileset
+	Layers     []Layer
+}
+
+// Набор тайлов из стандартных images/floor.png редактора
+func DefaultTileset() Tileset {
+	return NewTileset("images/floor.png", image.Pt(512, 32), 32)
+}
+
+func NewTileset(imagePath string, imageSize image.Point, tileSize int) Tileset {
+	columns := imageSize.X / tileSize
+	return Tileset{
+		FirstGid:    1,
+		Name:        "floor",
+		TileWidth:   tileSize,
+		TileHeight:  tileSize,
+		TileCount:   columns * (imageSize.Y / tileSize),
+		Columns:     columns,
+		Image:       imagePath,
+		ImageWidth:  imageSize.X,
+		ImageHeight: imageSize.Y,
+	}
+}
+
+func stringProperty(name, value string) Property {
+	return Property{Name: name, Type: "string", Value: value}
+}
+
+func intProperty(name string, value int) Property {
+	return Property{Name: name, Type: "int", Value: strconv.Itoa(value)}
+}
+
+func boolProperty(name string, value bool) Property {
+	return Property{Name: name, Type: "bool", Value: strconv.FormatBool(value)}
+}
+
+func findProperty(properties []Property, name string) (string, bool) {
+	for _, p := range properties {
+		if p.Name == name {
+			return p.Value, true
+		}
+	}
+	return "", false
+}
+
+func intPropertyValue(properties []Property, name string, defaultValue int) int {
+	if value, ok := findProperty(properties, name); ok {
+		if v, err := strconv.ParseFloat(value, 64); err == nil {
+			return int(v)
+		}
+	}
+	return defaultValue
+}
+
+func sortedPositions(locations map[utils.Int2]map_model.Location) []utils.Int2 {
+	positions := make([]utils.Int2, 0, len(locations))
+	for pos := range locations {
+		positions = append(positions, pos)
+	}
+	sort.Slice(positions, func(i, j int) bool {
+		if positions[i].Y != positions[j].Y {
+			return positions[i].Y < positions[j].Y
+		}
+		return positions[i].X < positions[j].X
+	})
+	return positions
+}
+
+// Клетки карты, которые попадут в тайловые слои: размеры карты или всё содержимое
+func exportBounds(mapModel *map_model.MapModel) image.Rectangle {
+	dimensions := mapModel.Dimensions()
+	if dimensions.Width > 0 && dimensions.Height > 0 {
+		return image.Rect(0, 0, dimensions.Width, dimensions.Height)
+	}
+
+	var bounds image.Rectangle
+	for i := 0; i < mapModel.NumLayers(); i++ {
+		leftTop, rightBottom := mapModel.Bounds(int32(i))
+		bounds = bounds.Union(image.Rect(leftTop.X, leftTop.Y, rightBottom.X, rightBottom.Y))
+	}
+	if bounds.Empty() {
+		bounds = image.Rect(0, 0, 1, 1)
+	}
+
+	return bounds
+}
+
+// Переводит карту в карту Tiled. Полы берутся из tileset, notesModel может быть nil.
+func Export(mapModel *map_model.MapModel, notesModel *notes_model.NotesModel, tileset Tileset) *Map {
+	bounds := exportBounds(mapModel)
+	dimensions := mapModel.Dimensions()
+	tw, th := float64(tileset.TileWidth), float64(tileset.TileHeight)
+
+	m := &Map{
+		Width:      bounds.Dx(),
+		Height:     bounds.Dy(),
+		TileWidth:  tileset.TileWidth,
+		TileHeight: tileset.TileHeight,
+		Properties: []Property{
+			intProperty("origin_x", bounds.Min.X),
+			intProperty("origin_y", bounds.Min.Y),
+			intProperty("dimensions_width", dimensions.Width),
+			intProperty("dimensions_height", dimensions.Height),
+			boolProperty("dimensions_wrap", dimensions.Wrap),
+			intProperty("level", int(mapModel.Level())),
+		},
+		Tilesets: []Tileset{tileset},
+	}
+	if notesModel != nil {
+		notes, err := json.Marshal(notesModel)
+		if err != nil {
+			// TODO
+			fmt.Println(err)
+		}
+		m.Properties = append(m.Properties, stringProperty("notes_json", string(notes)))
+	}
+
+	layerId, objectId := 0, 0
+	addLayer := func(l Layer) {
+		layerId++
+		l.Id = layerId
+		m.Layers = append(m.Layers, l)
+	}
+	addObject := func(objects []Object, o Object) []Object {
+		objectId++
+		o.Id = objectId
+		return append(objects, o)
+	}
+
+	for i, info := range mapModel.LayerInfos() {
+		if info.Type != map_model.RegularLayerType {
+			continue
+		}
+
+		locations := mapModel.Locations(int32(i))
+
+		tileLayer := Layer{
+			Kind:    tileLayerKind,
+			Name:    info.Name,
+			Visible: info.Visible,
+			Width:   bounds.Dx(),
+			Height:  bounds.Dy(),
+			Data:    make([]uint32, bounds.Dx()*bounds.Dy()),
+			Properties: []Property{
+				stringProperty("uuid", info.Uuid.String()),
+				intProperty("level", int(info.Level)),
+			},
+		}
+
+		var walls, objects []Object
+		for _, pos := range sortedPositions(locations) {
+			location := locations[pos]
+			x, y := pos.X-bounds.Min.X, pos.Y-bounds.Min.Y
+
+			if location.Floor > 0 && image.Pt(pos.X, pos.Y).In(bounds) {
+				tileLayer.Data[y*bounds.Dx()+x] = uint32(tileset.FirstGid) + location.Floor
+			}
+
+			addWall := func(isRight bool, wall uint32, kind map_model.WallKind) {
+				o := Object{Name: kind.String(), Class: wallClass}
+				if isRight {
+					o.X, o.Y = float64(x+1)*tw, float64(y)*th
+					o.Polyline = []Point{{0, 0}, {0, th}}
+					o.Properties = append(o.Properties, stringProperty("side", "right"))
+				} else {
+					o.X, o.Y = float64(x)*tw, float64(y+1)*th
+					o.Polyline = []Point{{0, 0}, {tw, 0}}
+					o.Properties = append(o.Properties, stringProperty("side", "bottom"))
+				}
+				o.Properties = append(o.Properties, intProperty("wall", int(wall)), intProperty("kind", int(kind)))
+				walls = addObject(walls, o)
+			}
+			if location.RightWall > 0 {
+				addWall(true, location.RightWall, location.RightWallKind)
+			}
+			if location.BottomWall > 0 {
+				addWall(false, location.BottomWall, location.BottomWallKind)
+			}
+
+			// точки - в центре клетки
+			cX, cY := (float64(x)+0.5)*tw, (float64(y)+0.5)*th
+			if len(location.NoteId) > 0 {
+				o := Object{Name: location.NoteId, Class: noteClass, X: cX, Y: cY, Point: true}
+				if notesModel != nil {
+					if note, ok := notesModel.Note(location.NoteId); ok {
+						o.Properties = append(o.Properties, stringProperty("text", note.Text()))
+					}
+				}
+				objects = addObject(objects, o)
+			}
+			if link := location.Link; link != nil {
+				objects = addObject(objects, Object{Name: link.Type.String(), Class: linkClass, X: cX, Y: cY, Point: true, Properties: []Property{
+					intProperty("type", int(link.Type)),
+					stringProperty("file", link.File),
+					intProperty("level", int(link.Level)),
+					intProperty("target_x", link.Target.X),
+					intProperty("target_y", link.Target.Y),
+				}})
+			}
+			if location.Effects != 0 {
+				objects = addObject(objects, Object{Name: location.Effects.String(), Class: effectsClass, X: cX, Y: cY, Point: true, Properties: []Property{
+					intProperty("effects", int(location.Effects)),
+				}})
+			}
+			// по точке на отметку, порядок точек - порядок отметок в клетке
+			for _, marker := range location.Markers {
+				o := Object{Name: marker.Icon.String(), Class: markerClass, X: cX, Y: cY, Point: true, Properties: []Property{
+					intProperty("icon", int(marker.Icon)),
+				}}
+				if len(marker.NoteId) > 0 {
+					o.Properties = append(o.Properties, stringProperty("note_id", marker.NoteId))
+				}
+				objects = addObject(objects, o)
+			}
+		}
+
+		addLayer(tileLayer)
+
+		groupProperties := []Property{stringProperty("layer_uuid", info.Uuid.String())}
+		if len(walls) > 0 {
+			addLayer(Layer{Kind: objectGroupKind, Name: info.Name + wallsSuffix, Visible: info.Visible, Objects: walls, Properties: groupProperties})
+		}
+		if len(objects) > 0 {
+			addLayer(Layer{Kind: objectGroupKind, Name: info.Name + objectsSuffix, Visible: info.Visible, Objects: objects, Properties: groupProperties})
+		}
+	}
+
+	return m
+}
+
+// Номер тайла пола по gid, 0 - пусто
+func (m *Map) floor(gid uint32) uint32 {
+	gid &= gidMask
+	if gid == 0 {
+		return 0
+	}
+
+	firstGid := 0
+	for _, t := range m.Tilesets {
+		if t.FirstGid <= int(gid) && t.FirstGid > firstGid {
+			firstGid = t.FirstGid
+		}
+	}
+
+	return gid - uint32(firstGid)
+}
+
+// Переводит карту Tiled в карту редактора. Слои объектов относятся к слою с uuid из свойства layer_uuid,
+// а без него - к предыдущему тайловому слою.
+func Import(m *Map) (*map_model.MapModel, *notes_model.NotesModel, error) {
+	if m.TileWidth <= 0 || m.TileHeight <= 0 {
+		return nil, nil, fmt.Errorf("%w: invalid tile size %dx%d", ErrUnsupported, m.TileWidth, m.TileHeight)
+	}
+	tw, th := float64(m.TileWidth), float64(m.TileHeight)
+
+	originX := intPropertyValue(m.Properties, "origin_x", 0)
+	originY := intPropertyValue(m.Properties, "origin_y", 0)
+	wrap, _ := findProperty(m.Properties, "dimensions_wrap")
+
+	mapModel := map_model.NewMapModel()
+	mapModel.SetDimensions(map_model.Dimensions{
+		Width:  intPropertyValue(m.Properties, "dimensions_width", 0),
+		Height: intPropertyValue(m.Properties, "dimensions_height", 0),
+		Wrap:   wrap == "true",
+	})
+
+	type importedLayer struct {
+		info      map_model.LayerInfo
+		locations map[utils.Int2]map_model.Location
+	}
+	var layers []*importedLayer
+	byUuid := make(map[uuid.UUID]*importedLayer)
+
+	var noteTexts []string
+	for _, l := range m.Layers {
+		switch l.Kind {
+		case tileLayerKind:
+			if len(l.Data) != l.Width*l.Height {
+				return nil, nil, fmt.Errorf("%w: layer %q has %d tiles instead of %dx%d", ErrUnsupported, l.Name, len(l.Data), l.Width, l.Height)
+			}
+
+			layerUuid := uuid.New()
+			if value, ok := findProperty(l.Properties, "uuid"); ok {
+				if id, err := uuid.Parse(value); err == nil && byUuid[id] == nil {
+					layerUuid = id
+				}
+			}
+
+			layer := &importedLayer{
+				info: map_model.LayerInfo{
+					Uuid:    layerUuid,
+					Name:    l.Name,
+					Visible: l.Visible,
+					Type:    map_model.RegularLayerType,
+					Level:   int32(intPropertyValue(l.Properties, "level", 0)),
+				},
+				locations: make(map[utils.Int2]map_model.Location),
+			}
+			for i, gid := range l.Data {
+				if floor := m.floor(gid); floor > 0 {
+					pos := utils.NewInt2(i%l.Width+originX, i/l.Width+originY)
+					location := layer.locations[pos]
+					location.Floor = floor
+					layer.locations[pos] = location
+				}
+			}
+
+			layers = append(layers, layer)
+			byUuid[layerUuid] = layer
+
+		case objectGroupKind:
+			var layer *importedLayer
+			if value, ok := findProperty(l.Properties, "layer_uuid"); ok {
+				if id, err := uuid.Parse(value); err == nil {
+					layer = byUuid[id]
+				}
+			}
+			if layer == nil && len(layers) > 0 {
+				layer = layers[len(layers)-1]
+			}
+			if layer == nil {
+				return nil, nil, fmt.Errorf("%w: object layer %q is not after a tile layer", ErrUnsupported, l.Name)
+			}
+
+			for _, o := range l.Objects {
+				// клетка, в которой лежит точка
+				pos := utils.NewInt2(int(math.Floor(o.X/tw))+originX, int(math.Floor(o.Y/th))+originY)
+
+				switch o.Class {
+				case wallClass:
+					wall := uint32(intPropertyValue(o.Properties, "wall", 1))
+					kind := map_model.WallKind(intPropertyValue(o.Properties, "kind", 0))
+					side, _ := findProperty(o.Properties, "side")
+
+					// стена лежит на границе клеток
+					pos = utils.NewInt2(int(math.Round(o.X/tw))+originX, int(math.Round(o.Y/th))+originY)
+					isRight := side == "right"
+					if isRight {
+						pos.X--
+					} else {
+						pos.Y--
+					}
+
+					location := layer.locations[pos]
+					if isRight {
+						location.RightWall, location.RightWallKind = wall, kind
+					} else {
+						location.BottomWall, location.BottomWallKind = wall, kind
+					}
+					layer.locations[pos] = location
+
+				case noteClass:
+					location := layer.locations[pos]
+					location.NoteId = o.Name
+					layer.locations[pos] = location
+
+					if text, ok := findProperty(o.Properties, "text"); ok && len(text) > 0 && !slices.Contains(noteTexts, text) {
+						noteTexts = append(noteTexts, text)
+					}
+
+				case linkClass:
+					location := layer.locations[pos]
+					file, _ := findProperty(o.Properties, "file")
+					location.Link = &map_model.Link{
+						Type:   map_model.LinkType(intPropertyValue(o.Properties, "type", int(map_model.TeleportLink))),
+						File:   file,
+						Level:  int32(intPropertyValue(o.Properties, "level", 0)),
+						Target: utils.NewInt2(intPropertyValue(o.Properties, "target_x", 0), intPropertyValue(o.Properties, "target_y", 0)),
+					}
+					layer.locations[pos] = location
+
+				case effectsClass:
+					location := layer.locations[pos]
+					location.Effects |= map_model.Effects(intPropertyValue(o.Properties, "effects", 0))
+					layer.locations[pos] = location
+
+				case markerClass:
+					location := layer.locations[pos]
+					if len(location.Markers) < map_model.MaxMarkers {
+						noteId, _ := findProperty(o.Properties, "note_id")
+						location.Markers = append(location.Markers, map_model.Marker{
+							Icon:   map_model.MarkerIcon(intPropertyValue(o.Properties, "icon", int(map_model.InfoMarker))),
+							NoteId: noteId,
+						})
+					}
+					layer.locations[pos] = location
+				}
+			}
+		}
+	}
+
+	if len(layers) == 0 {
+		return nil, nil, fmt.Errorf("%w: no tile layers", ErrUnsupported)
+	}
+
+	for _, layer := range layers {
+		layerIndex := mapModel.AddLayerWithId(layer.info.Uuid, layer.info.Type, layer.info.Level)
+		mapModel.SetName(layerIndex, layer.info.Name)
+		mapModel.SetVisible(layerIndex, layer.info.Visible)
+		if err := mapModel.SetLocations(layerIndex, layer.locations); err != nil {
+			return nil, nil, err
+		}
+	}
+	mapModel.SetLevel(int32(intPropertyValue(m.Properties, "level", int(layers[0].info.Level))))
+
+	// заметки, в старых файлах - полный текст заметок, если нет и его - собираем из текстов точек
+	notesModel := notes_model.NewNotesModel(8, nil)
+	if notes, ok := findProperty(m.Properties, "notes_json"); ok {
+		err := json.Unmarshal([]byte(notes), notesModel)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%w: notes: %v", ErrUnsupported, err)
+		}
+	} else {
+		text, ok := findProperty(m.Properties, "notes")
+		if !ok {
+			text = strings.Join(noteTexts, "\n")
+		}
+		err := notesModel.SetNotes(notes_model.ParseText(text))
+		if err != nil {
+			return nil, nil, fmt.Errorf("%w: notes: %v", ErrUnsupported, err)
+		}
+	}
+
+	return mapModel, notesModel, nil
+}
@@ -0,0 +1,250 @@
+package tiled
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"old-school-rpg-map-editor/utils"
+	"strconv"
+)
+
+type jsonProperty struct {
+	Name  string `json:"name"`
+	Type  string `json:"type"`
+	Value any    `json:"value"`
+}
+
+type jsonTileset struct {
+	FirstGid    int    `json:"firstgid"`
+	Name        string `json:"name,omitempty"`
+	TileWidth   int    `json:"tilewidth,omitempty"`
+	TileHeight  int    `json:"tileheight,omitempty"`
+	TileCount   int    `json:"tilecount,omitempty"`
+	Columns     int    `json:"columns,omitempty"`
+	Image       string `json:"image,omitempty"`
+	ImageWidth  int    `json:"imagewidth,omitempty"`
+	ImageHeight int    `json:"imageheight,omitempty"`
+}
+
+type jsonPoint struct {
+	X float64 `json:"x"`
+	Y float64 `json:"y"`
+}
+
+type jsonObject struct {
+	Id         int            `json:"id"`
+	Name       string         `json:"name"`
+	Type       string         `json:"type"`
+	Class      string         `json:"class,omitempty"` // Tiled 1.9+ вместо type
+	X          float64        `json:"x"`
+	Y          float64        `json:"y"`
+	Width      float64        `json:"width"`
+	Height     float64        `json:"height"`
+	Rotation   float64        `json:"rotation"`
+	Visible    bool           `json:"visible"`
+	Point      bool           `json:"point,omitempty"`
+	Polyline   []jsonPoint    `json:"polyline,omitempty"`
+	Properties []jsonProperty `json:"properties,omitempty"`
+}
+
+type jsonLayer struct {
+	Id          int             `json:"id"`
+	Type        string          `json:"type"`
+	Name        string          `json:"name"`
+	Visible     bool            `json:"visible"`
+	Opacity     float64         `json:"opacity"`
+	X           int             `json:"x"`
+	Y           int             `json:"y"`
+	Width       int             `json:"width,omitempty"`
+	Height      int             `json:"height,omitempty"`
+	Encoding    string          `json:"encoding,omitempty"`
+	Compression string          `json:"compression,omitempty"`
+	Data        json.RawMessage `json:"data,omitempty"` // массив gid'ов или строка base64
+	DrawOrder   string          `json:"draworder,omitempty"`
+	Objects     []jsonObject    `json:"objects,omitempty"`
+	Properties  []jsonProperty  `json:"properties,omitempty"`
+}
+
+type jsonMap struct {
+	Type         string         `json:"type"`
+	Version      string         `json:"version"`
+	Orientation  string         `json:"orientation"`
+	RenderOrder  string         `json:"renderorder"`
+	Width        int            `json:"width"`
+	Height       int            `json:"height"`
+	TileWidth    int            `json:"tilewidth"`
+	TileHeight   int            `json:"tileheight"`
+	Infinite     bool           `json:"infinite"`
+	NextLayerId  int            `json:"nextlayerid"`
+	NextObjectId int            `json:"nextobjectid"`
+	Properties   []jsonProperty `json:"properties,omitempty"`
+	Tilesets     []jsonTileset  `json:"tilesets"`
+	Layers       []jsonLayer    `json:"layers"`
+}
+
+func toJsonProperties(properties []Property) []jsonProperty {
+	var result []jsonProperty
+	for _, p := range properties {
+		jp := jsonProperty{Name: p.Name, Type: p.Type, Value: p.Value}
+		switch p.Type {
+		case "int":
+			jp.Value, _ = strconv.Atoi(p.Value)
+		case "bool":
+			jp.Value = p.Value == "true"
+		}
+		result = append(result, jp)
+	}
+	return result
+}
+
+func fromJsonProperties(properties []jsonProperty) []Property {
+	var result []Property
+	for _, jp := range properties {
+		p := Property{Name: jp.Name, Type: jp.Type}
+		switch v := jp.Value.(type) {
+		case float64:
+			p.Value = strconv.FormatFloat(v, 'f', -1, 64)
+		case nil:
+		default:
+			p.Value = fmt.Sprint(v)
+		}
+		result = append(result, p)
+	}
+	return result
+}
+
+func WriteTMJ(writer io.Writer, m *Map) error {
+	jm := jsonMap{
+		Type:        "map",
+		Version:     "1.10",
+		Orientation: "orthogonal",
+		RenderOrder: "right-down",
+		Width:       m.Width,
+		Height:      m.Height,
+		TileWidth:   m.TileWidth,
+		TileHeight:  m.TileHeight,
+		Properties:  toJsonProperties(m.Properties),
+		Layers:      []jsonLayer{},
+	}
+
+	for _, t := range m.Tilesets {
+		jm.Tilesets = append(jm.Tilesets, jsonTileset(t))
+	}
+
+	for _, l := range m.Layers {
+		jl := jsonLayer{
+			Id:         l.Id,
+			Type:       l.Kind,
+			Name:       l.Name,
+			Visible:    l.Visible,
+			Opacity:    1,
+			Properties: toJsonProperties(l.Properties),
+		}
+		jm.NextLayerId = utils.Max(jm.NextLayerId, l.Id+1)
+
+		if l.Kind == tileLayerKind {
+			jl.Width, jl.Height = l.Width, l.Height
+
+			data, err := json.Marshal(l.Data)
+			if err != nil {
+				return err
+			}
+			jl.Data = data
+		} else {
+			jl.DrawOrder = "topdown"
+			jl.Objects = []jsonObject{}
+
+			for _, o := range l.Objects {
+				jo := jsonObject{Id: o.Id, Name: o.Name, Type: o.Class, X: o.X, Y: o.Y, Visible: true, Point: o.Point, Properties: toJsonProperties(o.Properties)}
+				for _, p := range o.Polyline {
+					jo.Polyline = append(jo.Polyline, jsonPoint(p))
+				}
+				jl.Objects = append(jl.Objects, jo)
+				jm.NextObjectId = utils.Max(jm.NextObjectId, o.Id+1)
+			}
+		}
+
+		jm.Layers = append(jm.Layers, jl)
+	}
+
+	encoder := json.NewEncoder(writer)
+	encoder.SetIndent("", " ")
+	return encoder.Encode(jm)
+}
+
+func ReadTMJ(reader io.Reader) (*Map, error) {
+	var jm jsonMap
+	if err := json.NewDecoder(reader).Decode(&jm); err != nil {
+		return nil, err
+	}
+	if jm.Infinite {
+		return nil, fmt.Errorf("%w: infinite maps", ErrUnsupported)
+	}
+	if len(jm.Orientation) > 0 && jm.Orientation != "orthogonal" {
+		return nil, fmt.Errorf("%w: %s orientation", ErrUnsupported, jm.Orientation)
+	}
+
+	m := &Map{
+		Width:      jm.Width,
+		Height:     jm.Height,
+		TileWidth:  jm.TileWidth,
+		TileHeight: jm.TileHeight,
+		Properties: fromJsonProperties(jm.Properties),
+	}
+
+	for _, jt := range jm.Tilesets {
+		m.Tilesets = append(m.Tilesets, Tileset(jt))
+	}
+
+	for _, jl := range jm.Layers {
+		l := Layer{
+			Id:         jl.Id,
+			Kind:       jl.Type,
+			Name:       jl.Name,
+			Visible:    jl.Visible,
+			Width:      jl.Width,
+			Height:     jl.Height,
+			Properties: fromJsonProperties(jl.Properties),
+		}
+
+		switch jl.Type {
+		case tileLayerKind:
+			if len(jl.Data) > 0 && jl.Data[0] == '"' {
+				var text string
+				if err := json.Unmarshal(jl.Data, &text); err != nil {
+					return nil, err
+				}
+
+				data, err := decodeData(jl.Encoding, jl.Compression, text)
+				if err != nil {
+					return nil, fmt.Errorf("layer %q: %w", jl.Name, err)
+				}
+				l.Data = data
+			} else if err := json.Unmarshal(jl.Data, &l.Data); err != nil {
+				return nil, fmt.Errorf("layer %q: %w", jl.Name, err)
+			}
+
+		case objectGroupKind:
+			for _, jo := range jl.Objects {
+				o := Object{Id: jo.Id, Name: jo.Name, Class: jo.Type, X: jo.X, Y: jo.Y, Point: jo.Point, Properties: fromJsonProperties(jo.Properties)}
+				if len(jo.Class) > 0 {
+					o.Class = jo.Class
+				}
+				for _, p := range jo.Polyline {
+					o.Polyline = append(o.Polyline, Point(p))
+				}
+				l.Objects = append(l.Objects, o)
+			}
+
+		case "group":
+			return nil, fmt.Errorf("%w: group layers", ErrUnsupported)
+
+		default:
+			continue
+		}
+
+		m.Layers = append(m.Layers, l)
+	}
+
+	return m, nil
+}
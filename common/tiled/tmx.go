@@ -0,0 +1,366 @@
+package tiled
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"old-school-rpg-map-editor/utils"
+	"strconv"
+	"strings"
+)
+
+type xmlProperty struct {
+	Name  string `xml:"name,attr"`
+	Type  string `xml:"type,attr,omitempty"`
+	Value string `xml:"value,attr,omitempty"`
+	Text  string `xml:",chardata"` // Tiled пишет многострочные строки содержимым тега
+}
+
+type xmlProperties struct {
+	Properties []xmlProperty `xml:"property"`
+}
+
+type xmlImage struct {
+	Source string `xml:"source,attr"`
+	Width  int    `xml:"width,attr"`
+	Height int    `xml:"height,attr"`
+}
+
+type xmlTileset struct {
+	FirstGid   int       `xml:"firstgid,attr"`
+	Source     string    `xml:"source,attr,omitempty"`
+	Name       string    `xml:"name,attr,omitempty"`
+	TileWidth  int       `xml:"tilewidth,attr,omitempty"`
+	TileHeight int       `xml:"tileheight,attr,omitempty"`
+	TileCount  int       `xml:"tilecount,attr,omitempty"`
+	Columns    int       `xml:"columns,attr,omitempty"`
+	Image      *xmlImage `xml:"image"`
+}
+
+type xmlData struct {
+	Encoding    string `xml:"encoding,attr,omitempty"`
+	Compression string `xml:"compression,attr,omitempty"`
+	Text        string `xml:",chardata"`
+}
+
+type xmlPolyline struct {
+	Points string `xml:"points,attr"`
+}
+
+type xmlObject struct {
+	Id         int            `xml:"id,attr"`
+	Name       string         `xml:"name,attr,omitempty"`
+	Type       string         `xml:"type,attr,omitempty"`
+	Class      string         `xml:"class,attr,omitempty"` // Tiled 1.9+ вместо type
+	X          float64        `xml:"x,attr"`
+	Y          float64        `xml:"y,attr"`
+	Properties *xmlProperties `xml:"properties"`
+	Point      *struct{}      `xml:"point"`
+	Polyline   *xmlPolyline   `xml:"polyline"`
+}
+
+// <layer> или <objectgroup>, порядок слоёв в файле важен, поэтому они в одном списке
+type xmlLayer struct {
+	XMLName    xml.Name
+	Id         int            `xml:"id,attr"`
+	Name       string         `xml:"name,attr"`
+	Width      int            `xml:"width,attr,omitempty"`
+	Height     int            `xml:"height,attr,omitempty"`
+	Visible    string         `xml:"visible,attr,omitempty"` // по умолчанию 1
+	Properties *xmlProperties `xml:"properties"`
+	Data       *xmlData       `xml:"data"`
+	Objects    []xmlObject    `xml:"object"`
+}
+
+type xmlMap struct {
+	XMLName      xml.Name       `xml:"map"`
+	Version      string         `xml:"version,attr"`
+	Orientation  string         `xml:"orientation,attr"`
+	RenderOrder  string         `xml:"renderorder,attr"`
+	Width        int            `xml:"width,attr"`
+	Height       int            `xml:"height,attr"`
+	TileWidth    int            `xml:"tilewidth,attr"`
+	TileHeight   int            `xml:"tileheight,attr"`
+	Infinite     int            `xml:"infinite,attr"`
+	NextLayerId  int            `xml:"nextlayerid,attr"`
+	NextObjectId int            `xml:"nextobjectid,attr"`
+	Properties   *xmlProperties `xml:"properties"`
+	Tilesets     []xmlTileset   `xml:"tileset"`
+	Layers       []xmlLayer     `xml:",any"`
+}
+
+func toXmlProperties(properties []Property) *xmlProperties {
+	if len(properties) == 0 {
+		return nil
+	}
+
+	result := &xmlProperties{}
+	for _, p := range properties {
+		xp := xmlProperty{Name: p.Name, Type: p.Type}
+		if p.Type == "string" {
+			xp.Type = ""
+		}
+		if strings.Contains(p.Value, "\n") {
+			xp.Text = p.Value
+		} else {
+			xp.Value = p.Value
+		}
+		result.Properties = append(result.Properties, xp)
+	}
+	return result
+}
+
+func fromXmlProperties(properties *xmlProperties) []Property {
+	if properties == nil {
+		return nil
+	}
+
+	var result []Property
+	for _, xp := range properties.Properties {
+		p := Property{Name: xp.Name, Type: xp.Type, Value: xp.Value}
+		if len(p.Type) == 0 {
+			p.Type = "string"
+		}
+		if len(p.Value) == 0 {
+			p.Value = xp.Text
+		}
+		result = append(result, p)
+	}
+	return result
+}
+
+// gid'ы тайлового слоя из csv или base64(возможно сжатого)
+func decodeData(encoding, compression, text string) ([]uint32, error) {
+	switch encoding {
+	case "csv":
+		var result []uint32
+		for _, s := range strings.Split(text, ",") {
+			s = strings.TrimSpace(s)
+			if len(s) == 0 {
+				continue
+			}
+			v, err := strconv.ParseUint(s, 10, 32)
+			if err != nil {
+				return nil, err
+			}
+			result = append(result, uint32(v))
+		}
+		return result, nil
+
+	case "base64":
+		d, err := base64.StdEncoding.DecodeString(strings.TrimSpace(text))
+		if err != nil {
+			return nil, err
+		}
+
+		var reader io.Reader = bytes.NewReader(d)
+		switch compression {
+		case "":
+		case "gzip":
+			reader, err = gzip.NewReader(reader)
+		case "zlib":
+			reader, err = zlib.NewReader(reader)
+		default:
+			return nil, fmt.Errorf("%w: compression %q", ErrUnsupported, compression)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		d, err = io.ReadAll(reader)
+		if err != nil {
+			return nil, err
+		}
+
+		result := make([]uint32, len(d)/4)
+		for i := range result {
+			result[i] = binary.LittleEndian.Uint32(d[i*4:])
+		}
+		return result, nil
+	}
+
+	return nil, fmt.Errorf("%w: layer data encoding %q", ErrUnsupported, encoding)
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+func WriteTMX(writer io.Writer, m *Map) error {
+	xm := xmlMap{
+		Version:     "1.10",
+		Orientation: "orthogonal",
+		RenderOrder: "right-down",
+		Width:       m.Width,
+		Height:      m.Height,
+		TileWidth:   m.TileWidth,
+		TileHeight:  m.TileHeight,
+		Properties:  toXmlProperties(m.Properties),
+	}
+
+	for _, t := range m.Tilesets {
+		xm.Tilesets = append(xm.Tilesets, xmlTileset{
+			FirstGid:   t.FirstGid,
+			Name:       t.Name,
+			TileWidth:  t.TileWidth,
+			TileHeight: t.TileHeight,
+			TileCount:  t.TileCount,
+			Columns:    t.Columns,
+			Image:      &xmlImage{Source: t.Image, Width: t.ImageWidth, Height: t.ImageHeight},
+		})
+	}
+
+	for _, l := range m.Layers {
+		xl := xmlLayer{
+			XMLName:    xml.Name{Local: "layer"},
+			Id:         l.Id,
+			Name:       l.Name,
+			Properties: toXmlProperties(l.Properties),
+		}
+		if !l.Visible {
+			xl.Visible = "0"
+		}
+		xm.NextLayerId = utils.Max(xm.NextLayerId, l.Id+1)
+
+		if l.Kind == tileLayerKind {
+			xl.Width, xl.Height = l.Width, l.Height
+
+			var b strings.Builder
+			for i, gid := range l.Data {
+				if i%l.Width == 0 {
+					b.WriteString("\n")
+				}
+				b.WriteString(strconv.FormatUint(uint64(gid), 10))
+				if i != len(l.Data)-1 {
+					b.WriteString(",")
+				}
+			}
+			b.WriteString("\n")
+			xl.Data = &xmlData{Encoding: "csv", Text: b.String()}
+		} else {
+			xl.XMLName.Local = "objectgroup"
+
+			for _, o := range l.Objects {
+				xo := xmlObject{Id: o.Id, Name: o.Name, Type: o.Class, X: o.X, Y: o.Y, Properties: toXmlProperties(o.Properties)}
+				if o.Point {
+					xo.Point = &struct{}{}
+				}
+				if len(o.Polyline) > 0 {
+					var points []string
+					for _, p := range o.Polyline {
+						points = append(points, formatFloat(p.X)+","+formatFloat(p.Y))
+					}
+					xo.Polyline = &xmlPolyline{Points: strings.Join(points, " ")}
+				}
+				xl.Objects = append(xl.Objects, xo)
+				xm.NextObjectId = utils.Max(xm.NextObjectId, o.Id+1)
+			}
+		}
+
+		xm.Layers = append(xm.Layers, xl)
+	}
+
+	if _, err := io.WriteString(writer, xml.Header); err != nil {
+		return err
+	}
+
+	encoder := xml.NewEncoder(writer)
+	encoder.Indent("", " ")
+	if err := encoder.Encode(xm); err != nil {
+		return err
+	}
+
+	_, err := io.WriteString(writer, "\n")
+	return err
+}
+
+func ReadTMX(reader io.Reader) (*Map, error) {
+	var xm xmlMap
+	if err := xml.NewDecoder(reader).Decode(&xm); err != nil {
+		return nil, err
+	}
+	if xm.Infinite != 0 {
+		return nil, fmt.Errorf("%w: infinite maps", ErrUnsupported)
+	}
+	if len(xm.Orientation) > 0 && xm.Orientation != "orthogonal" {
+		return nil, fmt.Errorf("%w: %s orientation", ErrUnsupported, xm.Orientation)
+	}
+
+	m := &Map{
+		Width:      xm.Width,
+		Height:     xm.Height,
+		TileWidth:  xm.TileWidth,
+		TileHeight: xm.TileHeight,
+		Properties: fromXmlProperties(xm.Properties),
+	}
+
+	for _, xt := range xm.Tilesets {
+		// картинка внешнего набора(.tsx) не нужна, для полов хватает firstgid
+		t := Tileset{FirstGid: xt.FirstGid, Name: xt.Name, TileWidth: xt.TileWidth, TileHeight: xt.TileHeight, TileCount: xt.TileCount, Columns: xt.Columns}
+		if xt.Image != nil {
+			t.Image, t.ImageWidth, t.ImageHeight = xt.Image.Source, xt.Image.Width, xt.Image.Height
+		}
+		m.Tilesets = append(m.Tilesets, t)
+	}
+
+	for _, xl := range xm.Layers {
+		l := Layer{
+			Id:         xl.Id,
+			Name:       xl.Name,
+			Visible:    xl.Visible != "0",
+			Width:      xl.Width,
+			Height:     xl.Height,
+			Properties: fromXmlProperties(xl.Properties),
+		}
+
+		switch xl.XMLName.Local {
+		case "layer":
+			l.Kind = tileLayerKind
+			if xl.Data == nil {
+				return nil, fmt.Errorf("%w: layer %q has no data", ErrUnsupported, xl.Name)
+			}
+
+			data, err := decodeData(xl.Data.Encoding, xl.Data.Compression, xl.Data.Text)
+			if err != nil {
+				return nil, fmt.Errorf("layer %q: %w", xl.Name, err)
+			}
+			l.Data = data
+
+		case "objectgroup":
+			l.Kind = objectGroupKind
+
+			for _, xo := range xl.Objects {
+				o := Object{Id: xo.Id, Name: xo.Name, Class: xo.Type, X: xo.X, Y: xo.Y, Point: xo.Point != nil, Properties: fromXmlProperties(xo.Properties)}
+				if len(xo.Class) > 0 {
+					o.Class = xo.Class
+				}
+				if xo.Polyline != nil {
+					for _, s := range strings.Fields(xo.Polyline.Points) {
+						var p Point
+						if _, err := fmt.Sscanf(s, "%g,%g", &p.X, &p.Y); err != nil {
+							return nil, fmt.Errorf("object %d: %w", xo.Id, err)
+						}
+						o.Polyline = append(o.Polyline, p)
+					}
+				}
+				l.Objects = append(l.Objects, o)
+			}
+
+		case "group":
+			return nil, fmt.Errorf("%w: group layers", ErrUnsupported)
+
+		default:
+			// картинки, настройки редактора и т.п.
+			continue
+		}
+
+		m.Layers = append(m.Layers, l)
+	}
+
+	return m, nil
+}
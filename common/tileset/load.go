@@ -0,0 +1,89 @@
+package tileset
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// Загружает набор из fsys: DescriptorFile и картинки
+func Load(fsys fs.FS) (*Tileset, error) {
+	d, err := fs.ReadFile(fsys, DescriptorFile)
+	if err != nil {
+		return nil, err
+	}
+
+	var t Tileset
+	if err := json.Unmarshal(d, &t); err != nil {
+		return nil, fmt.Errorf("%s: %w", DescriptorFile, err)
+	}
+
+	t.Images = &Images{}
+	for _, f := range []struct {
+		name string
+		data *[]byte
+	}{
+		{FloorFile, &t.Images.Floor},
+		{WallFile, &t.Images.Wall},
+		{FloorSelectedFile, &t.Images.FloorSelected},
+		{WallSelectedFile, &t.Images.WallSelected},
+	} {
+		*f.data, err = fs.ReadFile(fsys, f.name)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// сразу проверяем картинки, чтобы битый набор не попал в список
+	if _, err := t.Decode(); err != nil {
+		return nil, err
+	}
+
+	return &t, nil
+}
+
+func LoadDir(dir string) (*Tileset, error) {
+	t, err := Load(os.DirFS(dir))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", dir, err)
+	}
+	return t, nil
+}
+
+// Загружает наборы из поддиректорий dir. Поддиректории без DescriptorFile пропускаются.
+// Если какой-то набор не загрузился, то возвращается первая ошибка, остальные наборы
+// всё равно загружаются.
+func LoadAll(dir string) ([]*Tileset, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []*Tileset
+	var firstErr error
+
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+
+		subDir := filepath.Join(dir, e.Name())
+		if _, err := os.Stat(filepath.Join(subDir, DescriptorFile)); err != nil {
+			continue
+		}
+
+		t, err := LoadDir(subDir)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+
+		result = append(result, t)
+	}
+
+	return result, firstErr
+}
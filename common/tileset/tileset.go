@@ -0,0 +1,174 @@
+// Наборы тайлов: картинки полов и стен, их размеры и описания тайлов.
+//
+// Набор лежит в директории: описание в DescriptorFile и картинки FloorFile, WallFile,
+// FloorSelectedFile, WallSelectedFile рядом с ним. Пользовательские наборы - поддиректории
+// <директория настроек>/tilesets. Набор можно встроить в карту, тогда картинки хранятся
+// в самом .map файле(см. Ref).
+package tileset
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/png"
+	"old-school-rpg-map-editor/configuration"
+	"strings"
+)
+
+const (
+	DescriptorFile    = "tileset.json"
+	FloorFile         = "floor.png"
+	WallFile          = "wall.png"
+	FloorSelectedFile = "floor_selected.png"
+	WallSelectedFile  = "wall_selected.png"
+)
+
+// Имя встроенного набора по умолчанию(см. images/tileset.json), так пустой Ref показывает String
+const DefaultName = "Default"
+
+var ErrInvalidTileset = errors.New("invalid tileset")
+
+// Описание тайла: подпись в палитре и смысловые теги(например "water", "solid")
+type Tile struct {
+	Label string   `json:"label"`
+	Tags  []string `json:"tags,omitempty"`
+}
+
+func (t Tile) String() string {
+	if len(t.Tags) == 0 {
+		return t.Label
+	}
+	return fmt.Sprintf("%s (%s)", t.Label, strings.Join(t.Tags, ", "))
+}
+
+// png картинки набора
+type Images struct {
+	Floor         []byte `json:"floor"`
+	Wall          []byte `json:"wall"`
+	FloorSelected []byte `json:"floor_selected"`
+	WallSelected  []byte `json:"wall_selected"`
+}
+
+type Tileset struct {
+	Name      string  `json:"name"`
+	TileSize  uint    `json:"tile_size"`  // размер пола и высота стены
+	WallWidth uint    `json:"wall_width"` // ширина стены
+	Floors    []Tile  `json:"floors,omitempty"`
+	Walls     []Tile  `json:"walls,omitempty"`
+	Images    *Images `json:"images,omitempty"` // в DescriptorFile не пишется, картинки лежат рядом
+}
+
+// Набор тайлов карты. Пустой Ref - набор по умолчанию.
+type Ref struct {
+	Name     string   `json:"name,omitempty"`     // набор из директории настроек
+	Embedded *Tileset `json:"embedded,omitempty"` // набор, встроенный в карту
+}
+
+func (r Ref) String() string {
+	if r.Embedded != nil {
+		return r.Embedded.Name + " (embedded)"
+	}
+	if len(r.Name) == 0 {
+		return DefaultName
+	}
+	return r.Name
+}
+
+// Раскодированные картинки, тайлы лежат в ряд, индекс тайла - номер по горизонтали.
+// FloorSelected и WallSelected - рамки выделения, у них берётся первый тайл.
+type Decoded struct {
+	Floor         image.Image
+	Wall          image.Image
+	FloorSelected image.Image
+	WallSelected  image.Image
+}
+
+func (t *Tileset) ImageConfig() configuration.ImageConfig {
+	return configuration.ImageConfig{
+		FloorSize: t.TileSize,
+		WallWidth: t.WallWidth,
+	}
+}
+
+// Описание пола index, Floors[0] - пустая клетка
+func (t *Tileset) FloorTile(index uint32) Tile {
+	if int(index) < len(t.Floors) {
+		return t.Floors[index]
+	}
+	return Tile{Label: fmt.Sprintf("Floor %d", index)}
+}
+
+// Описание стены index, Walls[0] - нет стены
+func (t *Tileset) WallTile(index uint32) Tile {
+	if int(index) < len(t.Walls) {
+		return t.Walls[index]
+	}
+	return Tile{Label: fmt.Sprintf("Wall %d", index)}
+}
+
+func (t *Tileset) Check() error {
+	if len(t.Name) == 0 {
+		return fmt.Errorf("%w: no name", ErrInvalidTileset)
+	}
+	if t.TileSize == 0 || t.WallWidth == 0 || t.WallWidth > t.TileSize {
+		return fmt.Errorf("%w %q: tile size %d and wall width %d must be positive, wall width must not exceed tile size", ErrInvalidTileset, t.Name, t.TileSize, t.WallWidth)
+	}
+	if t.Images == nil {
+		return fmt.Errorf("%w %q: no images", ErrInvalidTileset, t.Name)
+	}
+	return nil
+}
+
+// Раскодирует картинки и проверяет, что их размеры соответствуют TileSize и WallWidth
+func (t *Tileset) Decode() (Decoded, error) {
+	if err := t.Check(); err != nil {
+		return Decoded{}, err
+	}
+
+	decode := func(name string, d []byte, tileWidth uint) (image.Image, error) {
+		img, err := png.Decode(bytes.NewReader(d))
+		if err != nil {
+			return nil, fmt.Errorf("tileset %q, %s image: %w", t.Name, name, err)
+		}
+
+		size := img.Bounds().Size()
+		if size.Y != int(t.TileSize) || size.X == 0 || size.X%int(tileWidth) != 0 {
+			return nil, fmt.Errorf("%w %q: %s image is %dx%d, expected height %d and width multiple of %d", ErrInvalidTileset, t.Name, name, size.X, size.Y, t.TileSize, tileWidth)
+		}
+
+		return img, nil
+	}
+
+	var result Decoded
+	var err error
+
+	if result.Floor, err = decode("floor", t.Images.Floor, t.TileSize); err != nil {
+		return Decoded{}, err
+	}
+	if result.Wall, err = decode("wall", t.Images.Wall, t.WallWidth); err != nil {
+		return Decoded{}, err
+	}
+	if result.FloorSelected, err = decode("selected floor", t.Images.FloorSelected, t.TileSize); err != nil {
+		return Decoded{}, err
+	}
+	if result.WallSelected, err = decode("selected wall", t.Images.WallSelected, t.WallWidth); err != nil {
+		return Decoded{}, err
+	}
+
+	return result, nil
+}
+
+// Набор с именем name, nil если его нет. tilesets[0] - набор по умолчанию, его находит и
+// DefaultName без учёта регистра, даже если набор переопределён и называется иначе
+func Find(tilesets []*Tileset, name string) *Tileset {
+	for _, t := range tilesets {
+		if t.Name == name {
+			return t
+		}
+	}
+	if len(tilesets) > 0 && strings.EqualFold(name, DefaultName) {
+		return tilesets[0]
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package validate
+
+import (
+	"old-school-rpg-map-editor/models/map_model"
+	"old-school-rpg-map-editor/models/notes_model"
+	"sort"
+	"strings"
+
+	"golang.org/x/exp/slices"
+)
+
+// Клетка, в которой стоит id заметки
+type NoteRef struct {
+	Cell   map_model.LayerCell // координаты карты(без учёта поворота)
+	NoteId string
+}
+
+// Расхождения между клетками карты и заметками
+type NotesReport struct {
+	Dangling   []NoteRef  // клетки с id, которого нет в заметках
+	Unused     []string   // заметки, которых нет ни в одной клетке
+	Duplicates [][]string // группы id, которые отличаются только регистром, их легко спутать
+}
+
+func (r NotesReport) IsEmpty() bool {
+	return len(r.Dangling) == 0 && len(r.Unused) == 0 && len(r.Duplicates) == 0
+}
+
+// Id из Dangling без повторов, по алфавиту
+func (r NotesReport) DanglingIds() []string {
+	var noteIds []string
+	for _, ref := range r.Dangling {
+		if !slices.Contains(noteIds, ref.NoteId) {
+			noteIds = append(noteIds, ref.NoteId)
+		}
+	}
+	sort.Strings(noteIds)
+	return noteIds
+}
+
+// Сверяет id заметок во всех слоях карты с заметками notesModel
+func CheckNotes(mapModel *map_model.MapModel, notesModel *notes_model.NotesModel) NotesReport {
+	var report NotesReport
+
+	noteCells := mapModel.NoteCells()
+	noteIds := notesModel.GetNoteIds()
+
+	cellIds := make([]string, 0, len(noteCells))
+	for noteId := range noteCells {
+		cellIds = append(cellIds, noteId)
+	}
+	sort.Strings(cellIds)
+
+	for _, noteId := range cellIds {
+		if slices.Contains(noteIds, noteId) {
+			continue
+		}
+		for _, cell := range noteCells[noteId] {
+			report.Dangling = append(report.Dangling, NoteRef{Cell: cell, NoteId: noteId})
+		}
+	}
+	// как в Validate: по слоям, потом по строкам
+	sort.SliceStable(report.Dangling, func(i, j int) bool {
+		a, b := report.Dangling[i].Cell, report.Dangling[j].Cell
+		if a.LayerIndex != b.LayerIndex {
+			return a.LayerIndex < b.LayerIndex
+		}
+		if a.Pos.Y != b.Pos.Y {
+			return a.Pos.Y < b.Pos.Y
+		}
+		return a.Pos.X < b.Pos.X
+	})
+
+	groups := make(map[string][]string)
+	var keys []string
+	for _, noteId := range noteIds {
+		if _, exists := noteCells[noteId]; !exists {
+			report.Unused = append(report.Unused, noteId)
+		}
+
+		key := strings.ToLower(noteId)
+		if _, exists := groups[key]; !exists {
+			keys = append(keys, key)
+		}
+		groups[key] = append(groups[key], noteId)
+	}
+
+	for _, key := range keys {
+		if len(groups[key]) > 1 {
+			report.Duplicates = append(report.Duplicates, groups[key])
+		}
+	}
+
+	return report
+}
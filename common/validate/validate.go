@@ -0,0 +1,136 @@
+package validate
+
+import (
+	"fmt"
+	"old-school-rpg-map-editor/common/note_links"
+	"old-school-rpg-map-editor/models/map_model"
+	"old-school-rpg-map-editor/models/notes_model"
+	"old-school-rpg-map-editor/utils"
+	"sort"
+
+	"github.com/google/uuid"
+	"golang.org/x/exp/slices"
+)
+
+// Проблема в карте. Pos имеет смысл, только если Layer >= 0.
+type Problem struct {
+	Layer   int32 // индекс слоя, -1 - проблема не в слое
+	Pos     utils.Int2
+	Message string
+	Warning bool // с картой всё в порядке, но стоит посмотреть(например, заметка не стоит ни в одной клетке)
+}
+
+func (p Problem) String() string {
+	message := p.Message
+	if p.Warning {
+		message = "warning: " + message
+	}
+	if p.Layer < 0 {
+		return message
+	}
+	return fmt.Sprintf("layer %d (%d, %d): %s", p.Layer, p.Pos.X, p.Pos.Y, message)
+}
+
+// Клетки слоя в постоянном порядке, чтобы вывод не менялся от запуска к запуску
+func sortedPositions(locations map[utils.Int2]map_model.Location) []utils.Int2 {
+	positions := make([]utils.Int2, 0, len(locations))
+	for pos := range locations {
+		positions = append(positions, pos)
+	}
+	sort.Slice(positions, func(i, j int) bool {
+		if positions[i].Y != positions[j].Y {
+			return positions[i].Y < positions[j].Y
+		}
+		return positions[i].X < positions[j].X
+	})
+	return positions
+}
+
+// Проверяет карту и заметки. notesModel может быть nil, тогда заметки не проверяются.
+func Validate(mapModel *map_model.MapModel, notesModel *notes_model.NotesModel) []Problem {
+	var problems []Problem
+
+	dimensions := mapModel.Dimensions()
+	infos := mapModel.LayerInfos()
+
+	var levels []int32
+	for _, info := range infos {
+		if !slices.Contains(levels, info.Level) {
+			levels = append(levels, info.Level)
+		}
+	}
+
+	uuids := make(map[uuid.UUID]int32)
+	for i, info := range infos {
+		layerIndex := int32(i)
+
+		if first, ok := uuids[info.Uuid]; ok {
+			problems = append(problems, Problem{Layer: -1, Message: fmt.Sprintf("layers %d and %d have the same uuid %s", first, layerIndex, info.Uuid)})
+		} else {
+			uuids[info.Uuid] = layerIndex
+		}
+
+		locations := mapModel.Locations(layerIndex)
+		for _, pos := range sortedPositions(locations) {
+			location := locations[pos]
+			if location.IsEmptyLocation() {
+				continue
+			}
+
+			add := func(format string, a ...any) {
+				problems = append(problems, Problem{Layer: layerIndex, Pos: pos, Message: fmt.Sprintf(format, a...)})
+			}
+
+			if dimensions.IsBounded() && !dimensions.Wrap {
+				if _, err := dimensions.Normalize(pos); err != nil {
+					add("cell is outside of map %s", dimensions)
+				}
+			}
+
+			if link := location.Link; link != nil && len(link.File) == 0 {
+				if !slices.Contains(levels, link.Level) {
+					add("%s leads to level %d without layers", link.Type, link.Level)
+				} else if _, err := dimensions.Normalize(link.Target); err != nil {
+					add("%s target (%d, %d) is outside of map %s", link.Type, link.Target.X, link.Target.Y, dimensions)
+				}
+			}
+
+			if len(location.Markers) > map_model.MaxMarkers {
+				add("%d markers, at most %d are allowed", len(location.Markers), map_model.MaxMarkers)
+			}
+			for _, marker := range location.Markers {
+				if !slices.Contains(map_model.MarkerIcons, marker.Icon) {
+					add("marker has unknown icon %d", marker.Icon)
+				}
+			}
+		}
+	}
+
+	if notesModel != nil {
+		report := CheckNotes(mapModel, notesModel)
+		for _, ref := range report.Dangling {
+			problems = append(problems, Problem{Layer: ref.Cell.LayerIndex, Pos: ref.Cell.Pos, Message: fmt.Sprintf("note %q is not in notes", ref.NoteId)})
+		}
+		for _, noteId := range report.Unused {
+			problems = append(problems, Problem{Layer: -1, Message: fmt.Sprintf("note %q is not on map", noteId), Warning: true})
+		}
+		for _, noteIds := range report.Duplicates {
+			problems = append(problems, Problem{Layer: -1, Message: fmt.Sprintf("notes %q differ only in case", noteIds), Warning: true})
+		}
+
+		// ссылки на другие карты здесь не проверяются - их файлы не загружены
+		for _, note := range notesModel.Notes() {
+			for _, destination := range note_links.Destinations(note.Body) {
+				link, ok, err := note_links.Parse(destination)
+				if ok && err == nil && len(link.File) == 0 {
+					err = note_links.CheckTarget(link, mapModel, notesModel)
+				}
+				if err != nil {
+					problems = append(problems, Problem{Layer: -1, Message: fmt.Sprintf("note %q: broken link %q: %v", note.Id, destination, err)})
+				}
+			}
+		}
+	}
+
+	return problems
+}
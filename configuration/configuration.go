@@ -17,6 +17,9 @@ type Config struct {
 
 	ContentOffset float32 `json:"content-offset"`
 	ToolsOffset   float32 `json:"tools-offset"`
+
+	UndoLimit       int  `json:"undo-limit"`        // сколько правок помнить для каждой карты, 0 - без ограничения
+	SaveUndoHistory bool `json:"save-undo-history"` // сохранять историю правок в .map файлы
 }
 
 type ImageConfig struct {
@@ -24,16 +27,26 @@ type ImageConfig struct {
 	WallWidth uint
 }
 
-func GetConfigFile(fileName string) (*os.File, error) {
+// Возвращает директорию настроек редактора(или её поддиректорию subDirs), создавая её при необходимости
+func GetConfigDir(subDirs ...string) (string, error) {
 	dir, err := os.UserConfigDir()
 	if err != nil {
-		return nil, err
+		return "", err
 	}
 
-	configDir := filepath.Join(dir, "old-school-rpg-map-editor")
+	configDir := filepath.Join(append([]string{dir, "old-school-rpg-map-editor"}, subDirs...)...)
 
-	err = os.Mkdir(configDir, os.ModePerm)
+	err = os.MkdirAll(configDir, os.ModePerm)
 	if err != nil && !errors.Is(err, os.ErrExist) {
+		return "", err
+	}
+
+	return configDir, nil
+}
+
+func GetConfigFile(fileName string) (*os.File, error) {
+	configDir, err := GetConfigDir()
+	if err != nil {
 		return nil, err
 	}
 
@@ -64,6 +77,7 @@ func LoadConfig(f *os.File) (*Config, error) {
 			MainWindowHeight: 600,
 			ContentOffset:    0.7,
 			ToolsOffset:      0.5,
+			UndoLimit:        1000,
 		}
 	}
 
@@ -0,0 +1,117 @@
+package export_png_dialog
+
+import (
+	"errors"
+	"fmt"
+	"old-school-rpg-map-editor/common/map_renderer"
+	"old-school-rpg-map-editor/configuration"
+	"old-school-rpg-map-editor/models/maps_model"
+	"strconv"
+	"strings"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/storage"
+	"fyne.io/fyne/v2/widget"
+	"github.com/goki/freetype/truetype"
+	"github.com/google/uuid"
+)
+
+var _ dialog.Dialog = exportPngDialog{}
+
+// Диалог экспорта текущего уровня карты в PNG(или SVG, по расширению файла) с текущим поворотом
+type exportPngDialog struct {
+	dialog.Dialog
+	parent     fyne.Window
+	scaleEntry *widget.Entry
+}
+
+func scaleValidator(s string) error {
+	v, err := strconv.ParseFloat(s, 32)
+	if err != nil {
+		return err
+	}
+	if v <= 0 || v > 6 {
+		return errors.New("scale must be in (0, 6]")
+	}
+	return nil
+}
+
+func NewExportPngDialog(parent fyne.Window, mapsModel *maps_model.MapsModel, mapId uuid.UUID, images map_renderer.TileImages, imageConfig configuration.ImageConfig, fnt *truetype.Font) exportPngDialog {
+	scaleEntry := widget.NewEntry()
+	scaleEntry.SetText("1")
+	scaleEntry.Validator = scaleValidator
+
+	rulersCheck := widget.NewCheck("", nil)
+	rulersCheck.SetChecked(true)
+	notesCheck := widget.NewCheck("", nil)
+	notesCheck.SetChecked(true)
+	legendCheck := widget.NewCheck("", nil)
+
+	items := []*widget.FormItem{
+		widget.NewFormItem("Scale", scaleEntry),
+		widget.NewFormItem("Coordinates", rulersCheck),
+		widget.NewFormItem("Notes", notesCheck),
+		widget.NewFormItem("Legend", legendCheck),
+	}
+
+	d := dialog.NewForm("Export image", "Export", "Cancel", items, func(b bool) {
+		if !b {
+			return
+		}
+
+		mapElem := mapsModel.GetById(mapId)
+		if (mapElem.MapId == uuid.UUID{}) {
+			return
+		}
+
+		scale, _ := strconv.ParseFloat(scaleEntry.Text, 32)
+
+		opts := map_renderer.ExportOptions{
+			Scale:    float32(scale),
+			Angle:    mapElem.RotateModel.Angle(),
+			Level:    mapElem.Model.Level(),
+			Rulers:   rulersCheck.Checked,
+			Notes:    notesCheck.Checked,
+			Legend:   legendCheck.Checked,
+			Font:     fnt,
+			FontSize: 10,
+		}
+
+		saveDialog := dialog.NewFileSave(func(uc fyne.URIWriteCloser, err error) {
+			if uc == nil {
+				return
+			}
+
+			defer uc.Close()
+
+			if err != nil {
+				// TODO
+				fmt.Println(err)
+				return
+			}
+
+			export := map_renderer.ExportPNG
+			if strings.EqualFold(uc.URI().Extension(), ".svg") {
+				export = map_renderer.ExportSVG
+			}
+
+			err = export(uc, mapElem.Model, mapElem.NotesModel, images, imageConfig, opts)
+			if err != nil {
+				dialog.ShowError(err, parent)
+				return
+			}
+		}, parent)
+		saveDialog.SetFilter(storage.NewExtensionFileFilter([]string{".png", ".svg"}))
+		saveDialog.SetFileName("map.png")
+		saveDialog.Resize(parent.Canvas().Size())
+		saveDialog.Show()
+	}, parent)
+
+	return exportPngDialog{d, parent, scaleEntry}
+}
+
+func (d exportPngDialog) Show() {
+	d.Dialog.Show()
+	d.parent.Canvas().Focus(d.scaleEntry)
+}
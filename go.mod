@@ -9,6 +9,7 @@ require github.com/disintegration/imaging v1.6.2
 require (
 	github.com/elliotchance/pie/v2 v2.0.1
 	github.com/google/uuid v1.3.0
+	github.com/yuin/goldmark v1.4.13
 )
 
 require (
@@ -37,7 +38,6 @@ require (
 	github.com/srwiley/oksvg v0.0.0-20220731023508-a61f04f16b76 // indirect
 	github.com/srwiley/rasterx v0.0.0-20220730225603-2ab79fcdd4ef // indirect
 	github.com/stretchr/testify v1.8.0 // indirect
-	github.com/yuin/goldmark v1.4.13 // indirect
 	golang.org/x/exp v0.0.0-20220722155223-a9213eeb770e
 	golang.org/x/image v0.0.0-20220902085622-e7cb96979f69
 	golang.org/x/net v0.0.0-20220802222814-0bcc04d9c69b // indirect
@@ -0,0 +1,8 @@
+// Картинки редактора и набор тайлов по умолчанию, встроенные в бинарник. Загружать их надо
+// через common/resources, чтобы работало переопределение из директории настроек.
+package images
+
+import "embed"
+
+//go:embed *.png tileset.json
+var FS embed.FS
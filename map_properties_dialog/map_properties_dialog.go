@@ -0,0 +1,107 @@
+package map_properties_dialog
+
+import (
+	"errors"
+	"old-school-rpg-map-editor/common"
+	"old-school-rpg-map-editor/models/map_model"
+	"old-school-rpg-map-editor/models/maps_model"
+	"old-school-rpg-map-editor/undo_redo"
+	"strconv"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+	"github.com/google/uuid"
+)
+
+var _ dialog.Dialog = mapPropertiesDialog{}
+
+// Диалог размеров карты. Пустая или нулевая ширина(высота) - карта не ограничена по этой оси.
+type mapPropertiesDialog struct {
+	dialog.Dialog
+	parent      fyne.Window
+	widthEntry  *widget.Entry
+	heightEntry *widget.Entry
+}
+
+func sizeToText(v int) string {
+	if v == 0 {
+		return ""
+	}
+	return strconv.Itoa(v)
+}
+
+func sizeValidator(s string) error {
+	if len(s) == 0 {
+		return nil
+	}
+
+	v, err := strconv.Atoi(s)
+	if err != nil {
+		return err
+	}
+	if v < 0 {
+		return errors.New("size must not be negative")
+	}
+
+	return nil
+}
+
+func textToSize(s string) int {
+	v, _ := strconv.Atoi(s)
+	return v
+}
+
+func NewMapPropertiesDialog(parent fyne.Window, mapsModel *maps_model.MapsModel, mapId uuid.UUID) mapPropertiesDialog {
+	dimensions := mapsModel.GetById(mapId).Model.Dimensions()
+
+	widthEntry := widget.NewEntry()
+	widthEntry.SetText(sizeToText(dimensions.Width))
+	widthEntry.Validator = sizeValidator
+
+	heightEntry := widget.NewEntry()
+	heightEntry.SetText(sizeToText(dimensions.Height))
+	heightEntry.Validator = sizeValidator
+
+	wrapCheck := widget.NewCheck("", nil)
+	wrapCheck.SetChecked(dimensions.Wrap)
+
+	items := []*widget.FormItem{
+		widget.NewFormItem("Width", widthEntry),
+		widget.NewFormItem("Height", heightEntry),
+		widget.NewFormItem("Wrap around", wrapCheck),
+	}
+
+	d := dialog.NewForm("Map properties", "Ok", "Cancel", items, func(b bool) {
+		if !b {
+			return
+		}
+
+		mapElem := mapsModel.GetById(mapId)
+		if (mapElem.MapId == uuid.UUID{}) {
+			return
+		}
+
+		newDimensions := map_model.Dimensions{
+			Width:  textToSize(widthEntry.Text),
+			Height: textToSize(heightEntry.Text),
+			Wrap:   wrapCheck.Checked,
+		}
+		if newDimensions == mapElem.Model.Dimensions() {
+			return
+		}
+
+		err := common.MakeAction(undo_redo.NewSetDimensionsAction(newDimensions), mapsModel, mapId, nil)
+		if err != nil {
+			dialog.ShowError(err, parent)
+			return
+		}
+	}, parent)
+
+	return mapPropertiesDialog{d, parent, widthEntry, heightEntry}
+}
+
+func (d mapPropertiesDialog) Show() {
+	d.Dialog.Show()
+	d.parent.Canvas().Focus(d.widthEntry)
+}
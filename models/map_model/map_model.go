@@ -2,8 +2,14 @@ package map_model
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"math"
+	"old-school-rpg-map-editor/common/tileset"
 	"old-school-rpg-map-editor/utils"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
 
 	"github.com/google/uuid"
@@ -11,15 +17,346 @@ import (
 	"golang.org/x/exp/slices"
 )
 
+type LinkType int
+
+const (
+	StairsUpLink   LinkType = 1
+	StairsDownLink LinkType = 2
+	TeleportLink   LinkType = 3
+	PitLink        LinkType = 4
+	ChuteLink      LinkType = 5
+)
+
+func (t LinkType) String() string {
+	switch t {
+	case StairsUpLink:
+		return "Stairs up"
+	case StairsDownLink:
+		return "Stairs down"
+	case TeleportLink:
+		return "Teleport"
+	case PitLink:
+		return "Pit"
+	case ChuteLink:
+		return "Chute"
+	}
+
+	return "Unknown"
+}
+
+// Переход(лестница, телепорт и т.д.) из клетки в клетку Target на уровне Level.
+// Target задаётся в координатах карты(без учёта поворота RotateModel).
+type Link struct {
+	Type   LinkType   `json:"type"`
+	File   string     `json:"file,omitempty"` // путь к другому .map файлу; если пустой, то переход внутри этой карты
+	Level  int32      `json:"level"`
+	Target utils.Int2 `json:"target"`
+}
+
+// Сравнивает link'и по значению, nil равен только nil
+func (l *Link) Equal(o *Link) bool {
+	if l == nil || o == nil {
+		return l == o
+	}
+	return *l == *o
+}
+
+// Чем является стена. Направления у односторонних стен задаются в координатах карты:
+// "вперёд" - в сторону увеличения x для правой стены и в сторону увеличения y для нижней.
+type WallKind int
+
+const (
+	RegularWall        WallKind = 0
+	DoorWall           WallKind = 1
+	LockedDoorWall     WallKind = 2
+	SecretDoorWall     WallKind = 3
+	OneWayForwardWall  WallKind = 4 // пройти можно только вперёд
+	OneWayBackwardWall WallKind = 5 // пройти можно только назад
+	IllusionaryWall    WallKind = 6 // выглядит как стена, но проходима
+)
+
+var WallKinds = []WallKind{RegularWall, DoorWall, LockedDoorWall, SecretDoorWall, OneWayForwardWall, OneWayBackwardWall, IllusionaryWall}
+
+func (k WallKind) String() string {
+	switch k {
+	case RegularWall:
+		return "Wall"
+	case DoorWall:
+		return "Door"
+	case LockedDoorWall:
+		return "Locked door"
+	case SecretDoorWall:
+		return "Secret door"
+	case OneWayForwardWall:
+		return "One-way (right/down)"
+	case OneWayBackwardWall:
+		return "One-way (left/up)"
+	case IllusionaryWall:
+		return "Illusionary wall"
+	}
+
+	return "Unknown"
+}
+
+// Та же стена, но если смотреть с другой стороны(меняет направление у односторонних стен)
+func (k WallKind) Reversed() WallKind {
+	switch k {
+	case OneWayForwardWall:
+		return OneWayBackwardWall
+	case OneWayBackwardWall:
+		return OneWayForwardWall
+	}
+
+	return k
+}
+
+// Особые свойства клетки(битовая маска)
+type Effects uint32
+
+const (
+	DarknessEffect  Effects = 1 << 0
+	SpinnerEffect   Effects = 1 << 1
+	AntiMagicEffect Effects = 1 << 2
+	DamageEffect    Effects = 1 << 3
+	EncounterEffect Effects = 1 << 4
+	WaterEffect     Effects = 1 << 5
+	TrapEffect      Effects = 1 << 6
+)
+
+var AllEffects = []Effects{DarknessEffect, SpinnerEffect, AntiMagicEffect, DamageEffect, EncounterEffect, WaterEffect, TrapEffect}
+
+func (e Effects) String() string {
+	switch e {
+	case DarknessEffect:
+		return "Darkness"
+	case SpinnerEffect:
+		return "Spinner"
+	case AntiMagicEffect:
+		return "Anti-magic"
+	case DamageEffect:
+		return "Damage"
+	case EncounterEffect:
+		return "Encounter"
+	case WaterEffect:
+		return "Water"
+	case TrapEffect:
+		return "Trap"
+	}
+
+	// несколько флагов
+	var names []string
+	for _, effect := range AllEffects {
+		if e.Has(effect) {
+			names = append(names, effect.String())
+		}
+	}
+
+	return strings.Join(names, ", ")
+}
+
+// Есть ли все флаги из flags
+func (e Effects) Has(flags Effects) bool {
+	return e&flags == flags
+}
+
+// Значок отметки в клетке
+type MarkerIcon uint32
+
+const (
+	ChestMarker    MarkerIcon = 0
+	MonsterMarker  MarkerIcon = 1
+	QuestMarker    MarkerIcon = 2
+	NpcMarker      MarkerIcon = 3
+	KeyMarker      MarkerIcon = 4
+	TreasureMarker MarkerIcon = 5
+	DangerMarker   MarkerIcon = 6
+	InfoMarker     MarkerIcon = 7
+)
+
+var MarkerIcons = []MarkerIcon{ChestMarker, MonsterMarker, QuestMarker, NpcMarker, KeyMarker, TreasureMarker, DangerMarker, InfoMarker}
+
+func (i MarkerIcon) String() string {
+	switch i {
+	case ChestMarker:
+		return "Chest"
+	case MonsterMarker:
+		return "Monster"
+	case QuestMarker:
+		return "Quest"
+	case NpcMarker:
+		return "NPC"
+	case KeyMarker:
+		return "Key"
+	case TreasureMarker:
+		return "Treasure"
+	case DangerMarker:
+		return "Danger"
+	case InfoMarker:
+		return "Info"
+	}
+
+	return "Unknown"
+}
+
+// Сколько отметок может быть в клетке, см. select_model.Selected.Markers
+const MaxMarkers = 16
+
+var ErrTooManyMarkers = errors.New("too many markers in a cell")
+
+// Проверяет, что в клетке pos не больше MaxMarkers отметок, иначе возвращает ErrTooManyMarkers
+func checkMarkers(pos utils.Int2, markers []Marker) error {
+	if len(markers) > MaxMarkers {
+		return fmt.Errorf("%w: %d at (%d, %d), at most %d are allowed", ErrTooManyMarkers, len(markers), pos.X, pos.Y, MaxMarkers)
+	}
+	return nil
+}
+
+// Отметка в клетке: значок и, если есть, id заметки
+type Marker struct {
+	Icon   MarkerIcon `json:"icon"`
+	NoteId string     `json:"note_id,omitempty"`
+}
+
 type Location struct {
-	Floor      uint32 `json:"floor,omitempty"`
-	RightWall  uint32 `json:"right_wall,omitempty"`
-	BottomWall uint32 `json:"bottom_wall,omitempty"`
-	NoteId     string `json:"note_id,omitempty"` // id заметки для этой клетки
+	Floor          uint32   `json:"floor,omitempty"`
+	RightWall      uint32   `json:"right_wall,omitempty"`
+	BottomWall     uint32   `json:"bottom_wall,omitempty"`
+	RightWallKind  WallKind `json:"right_wall_kind,omitempty"`
+	BottomWallKind WallKind `json:"bottom_wall_kind,omitempty"`
+	NoteId         string   `json:"note_id,omitempty"` // id заметки для этой клетки
+	Link           *Link    `json:"link,omitempty"`    // Link не меняется после создания, только заменяется целиком
+	Effects        Effects  `json:"effects,omitempty"`
+	Markers        []Marker `json:"markers,omitempty"` // как и Link, не меняется после создания, только заменяется целиком
 }
 
 func (l *Location) IsEmptyLocation() bool {
-	return l.Floor == 0 && l.RightWall == 0 && l.BottomWall == 0 && len(l.NoteId) == 0
+	return l.Floor == 0 && l.RightWall == 0 && l.BottomWall == 0 && l.RightWallKind == RegularWall && l.BottomWallKind == RegularWall && len(l.NoteId) == 0 && l.Link == nil && l.Effects == 0 && len(l.Markers) == 0
+}
+
+func (l *Location) Equal(o Location) bool {
+	return l.Floor == o.Floor && l.RightWall == o.RightWall && l.BottomWall == o.BottomWall && l.RightWallKind == o.RightWallKind && l.BottomWallKind == o.BottomWallKind && l.NoteId == o.NoteId && l.Link.Equal(o.Link) && l.Effects == o.Effects && slices.Equal(l.Markers, o.Markers)
+}
+
+// Размеры карты. Клетки карты - это [0, Width) x [0, Height). Если Width(Height) == 0, то по этой оси
+// карта не ограничена.
+type Dimensions struct {
+	Width  int  `json:"width,omitempty"`
+	Height int  `json:"height,omitempty"`
+	Wrap   bool `json:"wrap,omitempty"` // выход за край карты приводит на противоположный край
+}
+
+var ErrOutOfBounds = errors.New("position is out of map bounds")
+
+func (d Dimensions) IsBounded() bool {
+	return d.Width > 0 || d.Height > 0
+}
+
+func (d Dimensions) String() string {
+	size := func(v int) string {
+		if v == 0 {
+			return "inf"
+		}
+		return strconv.Itoa(v)
+	}
+
+	result := size(d.Width) + "x" + size(d.Height)
+	if d.Wrap {
+		result += " wrap"
+	}
+	return result
+}
+
+// Проверяет, что pos - клетка карты(без заворачивания), иначе возвращает ErrOutOfBounds
+func (d Dimensions) Check(pos utils.Int2) error {
+	if (d.Width > 0 && (pos.X < 0 || pos.X >= d.Width)) || (d.Height > 0 && (pos.Y < 0 || pos.Y >= d.Height)) {
+		return fmt.Errorf("%w: (%d, %d) is outside of %s", ErrOutOfBounds, pos.X, pos.Y, d)
+	}
+	return nil
+}
+
+// Проверяет, что стена клетки pos лежит на карте. Левая(верхняя) граница карты - это правая(нижняя)
+// стена клетки за краем, поэтому по оси стены допускается и клетка -1
+func (d Dimensions) checkWall(pos utils.Int2, isRight bool) error {
+	wallPos := pos
+	if isRight && pos.X == -1 {
+		wallPos.X = 0
+	}
+	if !isRight && pos.Y == -1 {
+		wallPos.Y = 0
+	}
+	if err := d.Check(wallPos); err != nil {
+		return fmt.Errorf("%w: (%d, %d) is outside of %s", ErrOutOfBounds, pos.X, pos.Y, d)
+	}
+	return nil
+}
+
+// Проверяет, что всё содержимое клетки location лежит на карте
+func (d Dimensions) checkLocation(pos utils.Int2, location Location) error {
+	if location.RightWall != 0 || location.RightWallKind != RegularWall {
+		if err := d.checkWall(pos, true); err != nil {
+			return err
+		}
+	}
+	if location.BottomWall != 0 || location.BottomWallKind != RegularWall {
+		if err := d.checkWall(pos, false); err != nil {
+			return err
+		}
+	}
+
+	location.RightWall, location.RightWallKind = 0, RegularWall
+	location.BottomWall, location.BottomWallKind = 0, RegularWall
+	if !location.IsEmptyLocation() {
+		return d.Check(pos)
+	}
+	return nil
+}
+
+// Проверяет, что все непустые клетки locations лежат на карте и в них не слишком много отметок
+func (d Dimensions) checkLocations(locations map[utils.Int2]Location) error {
+	for pos, location := range locations {
+		if err := d.checkLocation(pos, location); err != nil {
+			return err
+		}
+		if err := checkMarkers(pos, location.Markers); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Приводит pos к клетке карты: при Wrap заворачивает координаты, иначе возвращает ErrOutOfBounds,
+// если pos за краем карты
+func (d Dimensions) Normalize(pos utils.Int2) (utils.Int2, error) {
+	normalize := func(v int, size int) (int, bool) {
+		if size == 0 {
+			return v, true
+		}
+		if d.Wrap {
+			v %= size
+			if v < 0 {
+				v += size
+			}
+			return v, true
+		}
+		return v, v >= 0 && v < size
+	}
+
+	x, okX := normalize(pos.X, d.Width)
+	y, okY := normalize(pos.Y, d.Height)
+	if !okX || !okY {
+		return pos, fmt.Errorf("%w: (%d, %d) is outside of %s", ErrOutOfBounds, pos.X, pos.Y, d)
+	}
+
+	return utils.NewInt2(x, y), nil
+}
+
+// Как Normalize, но для стены клетки pos: по оси стены допускается и клетка -1(см. checkWall).
+// На завёрнутой карте стена -1 - это стена последней клетки
+func (d Dimensions) NormalizeWall(pos utils.Int2, isRight bool) (utils.Int2, error) {
+	if d.Wrap {
+		return d.Normalize(pos)
+	}
+	return pos, d.checkWall(pos, isRight)
 }
 
 type LayerType int
@@ -34,6 +371,7 @@ type LayerInfo struct {
 	Name    string    `json:"name"`
 	Visible bool      `json:"visible"`
 	Type    LayerType `json:"type"`
+	Level   int32     `json:"level"` // уровень(этаж) подземелья, на котором лежит слой
 }
 
 type Layer struct {
@@ -41,8 +379,8 @@ type Layer struct {
 	locations map[utils.Int2]Location
 }
 
-func newLayer(uuid uuid.UUID, layerType LayerType) *Layer {
-	return &Layer{LayerInfo: LayerInfo{Uuid: uuid, Visible: true, Type: layerType}, locations: make(map[utils.Int2]Location)}
+func newLayer(uuid uuid.UUID, layerType LayerType, level int32) *Layer {
+	return &Layer{LayerInfo: LayerInfo{Uuid: uuid, Visible: true, Type: layerType, Level: level}, locations: make(map[utils.Int2]Location)}
 }
 
 func (l *Layer) MarshalJSON() ([]byte, error) {
@@ -78,9 +416,41 @@ func (l *Layer) Clone() *Layer {
 	}
 }
 
+// Что изменилось в карте, см. Change
+type ChangeProperty int
+
+const (
+	CellsChange        ChangeProperty = iota // клетки слоя
+	LayersChange                             // список слоёв: добавление, удаление, порядок
+	LayerNameChange                          // имя слоя
+	LayerVisibleChange                       // видимость слоя
+	LayerLevelChange                         // уровень слоя
+	LevelChange                              // текущий уровень
+	DimensionsChange                         // размеры карты
+	TilesetChange                            // набор тайлов
+)
+
+// Изменение карты для listener'ов AddChangeListener
+type Change struct {
+	Property   ChangeProperty
+	LayerIndex int32        // изменённый слой(при LayersChange - добавленный, удалённый или перемещённый), -1 - не слой
+	Cells      utils.Region // клетки, картинка которых изменилась; пустая - картинка карты не изменилась
+}
+
+func newCellChange(x, y int, layerIndex int32) Change {
+	return Change{Property: CellsChange, LayerIndex: layerIndex, Cells: utils.NewCellRegion(x, y)}
+}
+
+func newChange(property ChangeProperty, layerIndex int32) Change {
+	return Change{Property: property, LayerIndex: layerIndex, Cells: utils.NewAllRegion()}
+}
+
 type MapModel struct {
-	mutex  sync.Mutex
-	layers []*Layer
+	mutex      sync.Mutex
+	layers     []*Layer
+	dimensions Dimensions
+	tileset    tileset.Ref
+	level      int32 // текущий уровень; Visible* функции смотрят только на слои этого уровня
 
 	listeners utils.Signal0 // listener'ы на изменение списка
 
@@ -89,6 +459,8 @@ type MapModel struct {
 
 	beforeMoveLayerListeners utils.Signal0
 	afterMoveLayerListeners  utils.Signal0
+
+	changeListeners utils.Signal1[Change] // что изменилось, до listeners
 }
 
 func NewMapModel() *MapModel {
@@ -100,8 +472,10 @@ func (m *MapModel) MarshalJSON() ([]byte, error) {
 	defer m.mutex.Unlock()
 
 	t := struct {
-		Layers []*Layer `json:"layers"`
-	}{Layers: m.layers}
+		Dimensions Dimensions  `json:"dimensions"`
+		Tileset    tileset.Ref `json:"tileset"`
+		Layers     []*Layer    `json:"layers"`
+	}{Dimensions: m.dimensions, Tileset: m.tileset, Layers: m.layers}
 
 	return json.Marshal(t)
 }
@@ -111,7 +485,9 @@ func (m *MapModel) UnmarshalJSON(d []byte) error {
 	defer m.mutex.Unlock()
 
 	var t struct {
-		Layers []*Layer `json:"layers"`
+		Dimensions Dimensions  `json:"dimensions"`
+		Tileset    tileset.Ref `json:"tileset"`
+		Layers     []*Layer    `json:"layers"`
 	}
 
 	err := json.Unmarshal(d, &t)
@@ -119,11 +495,93 @@ func (m *MapModel) UnmarshalJSON(d []byte) error {
 		return err
 	}
 
+	m.dimensions = t.Dimensions
+	m.tileset = t.Tileset
 	m.layers = t.Layers
 
 	return nil
 }
 
+func (m *MapModel) Dimensions() Dimensions {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	return m.dimensions
+}
+
+// Меняет размеры карты. Если какая-то непустая клетка окажется за краем, то возвращает ErrOutOfBounds
+func (m *MapModel) SetDimensions(dimensions Dimensions) error {
+	send, err := func() (bool, error) {
+		m.mutex.Lock()
+		defer m.mutex.Unlock()
+
+		if m.dimensions == dimensions {
+			return false, nil
+		}
+
+		for _, l := range m.layers {
+			if err := dimensions.checkLocations(l.locations); err != nil {
+				return false, err
+			}
+		}
+
+		m.dimensions = dimensions
+
+		return true, nil
+	}()
+
+	if send {
+		m.changeListeners.Emit(newChange(DimensionsChange, -1))
+		m.listeners.Emit()
+	}
+
+	return err
+}
+
+func (m *MapModel) Tileset() tileset.Ref {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	return m.tileset
+}
+
+func (m *MapModel) SetTileset(ref tileset.Ref) {
+	send := func() bool {
+		m.mutex.Lock()
+		defer m.mutex.Unlock()
+
+		if m.tileset == ref {
+			return false
+		}
+
+		m.tileset = ref
+
+		return true
+	}()
+
+	if send {
+		m.changeListeners.Emit(newChange(TilesetChange, -1))
+		m.listeners.Emit()
+	}
+}
+
+// Проверяет, что клетка (x, y) лежит на карте(без заворачивания). Непустые клетки бывают только
+// на карте(и стены её левой и верхней границы): правки, которые кладут что-то за её край,
+// возвращают ErrOutOfBounds и ничего не меняют
+func (m *MapModel) CheckPos(x, y int) error {
+	return m.Dimensions().Check(utils.NewInt2(x, y))
+}
+
+// См. Dimensions.Normalize
+func (m *MapModel) NormalizePos(x, y int) (utils.Int2, error) {
+	return m.Dimensions().Normalize(utils.NewInt2(x, y))
+}
+
+// См. Dimensions.NormalizeWall
+func (m *MapModel) NormalizeWallPos(x, y int, isRight bool) (utils.Int2, error) {
+	return m.Dimensions().NormalizeWall(utils.NewInt2(x, y), isRight)
+}
+
 func (m *MapModel) LayerIndexById(uuid uuid.UUID) int32 {
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
@@ -150,12 +608,94 @@ func (m *MapModel) LayerIndexByType(layerType LayerType) []int32 {
 	return result
 }
 
-func (m *MapModel) AddLayerWithId(uuid uuid.UUID, layerType LayerType) (layerIndex int32) {
+func (m *MapModel) LayerIndicesByLevel(level int32) []int32 {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	return m.layerIndicesByLevel(level)
+}
+
+func (m *MapModel) layerIndicesByLevel(level int32) []int32 {
+	var result []int32
+	for index, l := range m.layers {
+		if l.Level == level {
+			result = append(result, int32(index))
+		}
+	}
+
+	return result
+}
+
+func (m *MapModel) Level() int32 {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	return m.level
+}
+
+func (m *MapModel) SetLevel(level int32) {
+	send := func() bool {
+		m.mutex.Lock()
+		defer m.mutex.Unlock()
+
+		if m.level == level {
+			return false
+		}
+
+		m.level = level
+
+		return true
+	}()
+
+	if send {
+		m.changeListeners.Emit(newChange(LevelChange, -1))
+		m.listeners.Emit()
+	}
+}
+
+// Отсортированный список уровней, на которых есть слои. Текущий уровень есть в списке всегда.
+func (m *MapModel) Levels() []int32 {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	result := []int32{m.level}
+	for _, l := range m.layers {
+		if !slices.Contains(result, l.Level) {
+			result = append(result, l.Level)
+		}
+	}
+
+	slices.Sort(result)
+
+	return result
+}
+
+func (m *MapModel) SetLayerLevel(layerIndex int32, level int32) {
+	send := func() bool {
+		m.mutex.Lock()
+		defer m.mutex.Unlock()
+
+		if m.layers[layerIndex].Level == level {
+			return false
+		}
+
+		m.layers[layerIndex].Level = level
+
+		return true
+	}()
+
+	if send {
+		m.changeListeners.Emit(newChange(LayerLevelChange, layerIndex))
+		m.listeners.Emit()
+	}
+}
+
+func (m *MapModel) AddLayerWithId(uuid uuid.UUID, layerType LayerType, level int32) (layerIndex int32) {
 	send := func() bool {
 		m.mutex.Lock()
 		defer m.mutex.Unlock()
 
-		m.layers = append(m.layers, newLayer(uuid, layerType))
+		m.layers = append(m.layers, newLayer(uuid, layerType, level))
 
 		layerIndex = int32(len(m.layers) - 1)
 
@@ -163,6 +703,7 @@ func (m *MapModel) AddLayerWithId(uuid uuid.UUID, layerType LayerType) (layerInd
 	}()
 
 	if send {
+		m.changeListeners.Emit(newChange(LayersChange, layerIndex))
 		m.listeners.Emit()
 	}
 
@@ -182,6 +723,7 @@ func (m *MapModel) AddLayer(layer *Layer) (layerIndex int32) {
 	}()
 
 	if send {
+		m.changeListeners.Emit(newChange(LayersChange, layerIndex))
 		m.listeners.Emit()
 	}
 
@@ -199,20 +741,26 @@ func (m *MapModel) DeleteLayer(layerIndex int32) {
 	}()
 
 	m.afterDeleteLayerListeners.Emit()
+	m.changeListeners.Emit(newChange(LayersChange, layerIndex))
 	m.listeners.Emit()
 }
 
 func (m *MapModel) ClearLayer(layerIndex int32) {
+	change := Change{Property: CellsChange, LayerIndex: layerIndex}
+
 	send := func() bool {
 		m.mutex.Lock()
 		defer m.mutex.Unlock()
 
+		change.Cells = utils.NewRegion(m.bounds(layerIndex))
+
 		m.layers[layerIndex].locations = make(map[utils.Int2]Location)
 
 		return true
 	}()
 
 	if send {
+		m.changeListeners.Emit(change)
 		m.listeners.Emit()
 	}
 }
@@ -275,6 +823,7 @@ func (m *MapModel) MoveUp(layerIndex int32, offset int32) {
 	}()
 
 	m.afterMoveLayerListeners.Emit()
+	m.changeListeners.Emit(newChange(LayersChange, layerIndex))
 	m.listeners.Emit()
 }
 
@@ -332,6 +881,7 @@ func (m *MapModel) MoveDown(layerIndex int32, offset int32) {
 	}()
 
 	m.afterMoveLayerListeners.Emit()
+	m.changeListeners.Emit(newChange(LayersChange, layerIndex))
 	m.listeners.Emit()
 }
 
@@ -380,6 +930,13 @@ func (m *MapModel) Locations(layerIndex int32) map[utils.Int2]Location {
 	return maps.Clone(m.layers[layerIndex].locations)
 }
 
+func (m *MapModel) Location(x, y int, layerIndex int32) Location {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	return m.layers[layerIndex].locations[utils.NewInt2(x, y)]
+}
+
 func (m *MapModel) SetVisible(layerIndex int32, value bool) {
 	send := func() bool {
 		m.mutex.Lock()
@@ -395,6 +952,7 @@ func (m *MapModel) SetVisible(layerIndex int32, value bool) {
 	}()
 
 	if send {
+		m.changeListeners.Emit(newChange(LayerVisibleChange, layerIndex))
 		m.listeners.Emit()
 	}
 }
@@ -414,23 +972,37 @@ func (m *MapModel) SetName(layerIndex int32, value string) {
 	}()
 
 	if send {
+		m.changeListeners.Emit(Change{Property: LayerNameChange, LayerIndex: layerIndex})
 		m.listeners.Emit()
 	}
 }
 
-func (m *MapModel) SetLocations(layerIndex int32, value map[utils.Int2]Location) {
-	send := func() bool {
+func (m *MapModel) SetLocations(layerIndex int32, value map[utils.Int2]Location) error {
+	change := Change{Property: CellsChange, LayerIndex: layerIndex}
+
+	send, err := func() (bool, error) {
 		m.mutex.Lock()
 		defer m.mutex.Unlock()
 
+		if err := m.dimensions.checkLocations(value); err != nil {
+			return false, err
+		}
+
+		change.Cells = utils.NewRegion(m.bounds(layerIndex))
+
 		m.layers[layerIndex].locations = value
 
-		return true
+		change.Cells = change.Cells.Union(utils.NewRegion(m.bounds(layerIndex)))
+
+		return true, nil
 	}()
 
 	if send {
+		m.changeListeners.Emit(change)
 		m.listeners.Emit()
 	}
+
+	return err
 }
 
 func (m *MapModel) VisibleFloor(x, y int) (layerUuid uuid.UUID, floor uint32) {
@@ -442,7 +1014,7 @@ func (m *MapModel) VisibleFloor(x, y int) (layerUuid uuid.UUID, floor uint32) {
 	}
 
 	for _, l := range m.layers {
-		if l.Visible {
+		if l.Visible && l.Level == m.level {
 			v, exists := l.locations[utils.NewInt2(x, y)]
 			if exists && v.Floor > 0 {
 				return l.Uuid, v.Floor
@@ -482,23 +1054,35 @@ func (m *MapModel) setFloor(x, y int, layerIndex int32, value uint32) {
 	}
 }
 
-func (m *MapModel) SetFloor(x, y int, layerIndex int32, value uint32) {
+func (m *MapModel) SetFloor(x, y int, layerIndex int32, value uint32) error {
 	if layerIndex < 0 {
-		return
+		return nil
 	}
 
-	send := func() bool {
+	send, err := func() (bool, error) {
 		m.mutex.Lock()
 		defer m.mutex.Unlock()
 
+		if value > 0 {
+			if err := m.dimensions.Check(utils.NewInt2(x, y)); err != nil {
+				return false, err
+			}
+		}
+
 		m.setFloor(x, y, layerIndex, value)
 
-		return true
+		return true, nil
 	}()
+	if err != nil {
+		return err
+	}
 
 	if send {
+		m.changeListeners.Emit(newCellChange(x, y, layerIndex))
 		m.listeners.Emit()
 	}
+
+	return nil
 }
 
 func (m *MapModel) VisibleWall(x, y int, isRight bool) (layerUuid uuid.UUID, wall uint32) {
@@ -510,7 +1094,7 @@ func (m *MapModel) VisibleWall(x, y int, isRight bool) (layerUuid uuid.UUID, wal
 	}
 
 	for _, l := range m.layers {
-		if l.Visible {
+		if l.Visible && l.Level == m.level {
 			v, exists := l.locations[utils.NewInt2(x, y)]
 			if isRight && exists && v.RightWall > 0 {
 				return l.Uuid, v.RightWall
@@ -547,10 +1131,17 @@ func (m *MapModel) setWall(x, y int, layerIndex int32, isRight bool, value uint3
 
 	f, exists := m.layers[layerIndex].locations[pos]
 	if exists || value > 0 {
+		// у убранной стены не может быть вида
 		if isRight {
 			f.RightWall = value
+			if value == 0 {
+				f.RightWallKind = RegularWall
+			}
 		} else {
 			f.BottomWall = value
+			if value == 0 {
+				f.BottomWallKind = RegularWall
+			}
 		}
 		m.layers[layerIndex].locations[pos] = f
 	}
@@ -560,23 +1151,126 @@ func (m *MapModel) setWall(x, y int, layerIndex int32, isRight bool, value uint3
 	}
 }
 
-func (m *MapModel) SetWall(x, y int, layerIndex int32, isRight bool, value uint32) {
+func (m *MapModel) SetWall(x, y int, layerIndex int32, isRight bool, value uint32) error {
 	if layerIndex < 0 {
-		return
+		return nil
 	}
 
-	send := func() bool {
+	send, err := func() (bool, error) {
 		m.mutex.Lock()
 		defer m.mutex.Unlock()
 
+		if value > 0 {
+			if err := m.dimensions.checkWall(utils.NewInt2(x, y), isRight); err != nil {
+				return false, err
+			}
+		}
+
 		m.setWall(x, y, layerIndex, isRight, value)
 
-		return true
+		return true, nil
 	}()
+	if err != nil {
+		return err
+	}
 
 	if send {
+		m.changeListeners.Emit(newCellChange(x, y, layerIndex))
 		m.listeners.Emit()
 	}
+
+	return nil
+}
+
+// Вид стены, которую возвращает VisibleWall
+func (m *MapModel) VisibleWallKind(x, y int, isRight bool) (layerUuid uuid.UUID, kind WallKind) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if len(m.layers) == 0 {
+		return uuid.UUID{}, RegularWall
+	}
+
+	for _, l := range m.layers {
+		if l.Visible && l.Level == m.level {
+			v, exists := l.locations[utils.NewInt2(x, y)]
+			if isRight && exists && v.RightWall > 0 {
+				return l.Uuid, v.RightWallKind
+			}
+			if !isRight && exists && v.BottomWall > 0 {
+				return l.Uuid, v.BottomWallKind
+			}
+		}
+	}
+
+	return m.layers[0].Uuid, RegularWall
+}
+
+func (m *MapModel) wallKind(x, y int, layerIndex int32, isRight bool) WallKind {
+	v, exists := m.layers[layerIndex].locations[utils.NewInt2(x, y)]
+	if isRight && exists {
+		return v.RightWallKind
+	}
+	if !isRight && exists {
+		return v.BottomWallKind
+	}
+	return RegularWall
+}
+
+func (m *MapModel) WallKind(x, y int, layerIndex int32, isRight bool) WallKind {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	return m.wallKind(x, y, layerIndex, isRight)
+}
+
+func (m *MapModel) setWallKind(x, y int, layerIndex int32, isRight bool, value WallKind) {
+	pos := utils.NewInt2(x, y)
+
+	f, exists := m.layers[layerIndex].locations[pos]
+	if exists || value != RegularWall {
+		if isRight {
+			f.RightWallKind = value
+		} else {
+			f.BottomWallKind = value
+		}
+		m.layers[layerIndex].locations[pos] = f
+	}
+
+	if f.IsEmptyLocation() {
+		delete(m.layers[layerIndex].locations, pos)
+	}
+}
+
+func (m *MapModel) SetWallKind(x, y int, layerIndex int32, isRight bool, value WallKind) error {
+	if layerIndex < 0 {
+		return nil
+	}
+
+	send, err := func() (bool, error) {
+		m.mutex.Lock()
+		defer m.mutex.Unlock()
+
+		if value != RegularWall {
+			if err := m.dimensions.checkWall(utils.NewInt2(x, y), isRight); err != nil {
+				return false, err
+			}
+		}
+
+		m.setWallKind(x, y, layerIndex, isRight, value)
+
+		return true, nil
+	}()
+	if err != nil {
+		return err
+	}
+
+	if send {
+		m.changeListeners.Emit(newCellChange(x, y, layerIndex))
+		m.listeners.Emit()
+	}
+
+	return nil
 }
 
 func (m *MapModel) VisibleNoteId(x, y int) (layerUuid uuid.UUID, noteId string) {
@@ -588,7 +1282,7 @@ func (m *MapModel) VisibleNoteId(x, y int) (layerUuid uuid.UUID, noteId string)
 	}
 
 	for _, l := range m.layers {
-		if l.Visible {
+		if l.Visible && l.Level == m.level {
 			v, exists := l.locations[utils.NewInt2(x, y)]
 			if exists && len(v.NoteId) > 0 {
 				return l.Uuid, v.NoteId
@@ -614,6 +1308,44 @@ func (m *MapModel) NoteId(x, y int, layerIndex int32) string {
 	return m.noteId(x, y, layerIndex)
 }
 
+// Клетки всех слоёв с заметками(в клетке или в её отметках): id заметки -> клетки, по слоям и по строкам
+func (m *MapModel) NoteCells() map[string][]LayerCell {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	cells := make(map[string][]LayerCell)
+	for layerIndex, layer := range m.layers {
+		for pos, location := range layer.locations {
+			cell := LayerCell{LayerIndex: int32(layerIndex), Pos: pos}
+
+			noteIds := []string{location.NoteId}
+			for _, marker := range location.Markers {
+				noteIds = append(noteIds, marker.NoteId)
+			}
+
+			for i, noteId := range noteIds {
+				if len(noteId) > 0 && !slices.Contains(noteIds[:i], noteId) {
+					cells[noteId] = append(cells[noteId], cell)
+				}
+			}
+		}
+	}
+
+	for _, c := range cells {
+		sort.Slice(c, func(i, j int) bool {
+			if c[i].LayerIndex != c[j].LayerIndex {
+				return c[i].LayerIndex < c[j].LayerIndex
+			}
+			if c[i].Pos.Y != c[j].Pos.Y {
+				return c[i].Pos.Y < c[j].Pos.Y
+			}
+			return c[i].Pos.X < c[j].Pos.X
+		})
+	}
+
+	return cells
+}
+
 func (m *MapModel) setNoteId(x, y int, layerIndex int32, value string) {
 	pos := utils.NewInt2(x, y)
 
@@ -628,19 +1360,259 @@ func (m *MapModel) setNoteId(x, y int, layerIndex int32, value string) {
 	}
 }
 
-func (m *MapModel) SetNoteId(x, y int, layerIndex int32, value string) {
-	send := func() bool {
+func (m *MapModel) SetNoteId(x, y int, layerIndex int32, value string) error {
+	send, err := func() (bool, error) {
 		m.mutex.Lock()
 		defer m.mutex.Unlock()
 
+		if len(value) > 0 {
+			if err := m.dimensions.Check(utils.NewInt2(x, y)); err != nil {
+				return false, err
+			}
+		}
+
 		m.setNoteId(x, y, layerIndex, value)
 
-		return true
+		return true, nil
+	}()
+	if err != nil {
+		return err
+	}
+
+	if send {
+		m.changeListeners.Emit(newCellChange(x, y, layerIndex))
+		m.listeners.Emit()
+	}
+
+	return nil
+}
+
+// Отметки верхнего видимого слоя текущего уровня, в котором они есть
+func (m *MapModel) VisibleMarkers(x, y int) (layerUuid uuid.UUID, markers []Marker) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if len(m.layers) == 0 {
+		return uuid.UUID{}, nil
+	}
+
+	for _, l := range m.layers {
+		if l.Visible && l.Level == m.level {
+			v, exists := l.locations[utils.NewInt2(x, y)]
+			if exists && len(v.Markers) > 0 {
+				return l.Uuid, v.Markers
+			}
+		}
+	}
+
+	return m.layers[0].Uuid, nil
+}
+
+func (m *MapModel) Markers(x, y int, layerIndex int32) []Marker {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	return m.layers[layerIndex].locations[utils.NewInt2(x, y)].Markers
+}
+
+func (m *MapModel) setMarkers(x, y int, layerIndex int32, value []Marker) {
+	pos := utils.NewInt2(x, y)
+
+	f, exists := m.layers[layerIndex].locations[pos]
+	if exists || len(value) > 0 {
+		f.Markers = value
+		m.layers[layerIndex].locations[pos] = f
+	}
+
+	if f.IsEmptyLocation() {
+		delete(m.layers[layerIndex].locations, pos)
+	}
+}
+
+// Заменяет отметки клетки. value после вызова менять нельзя
+func (m *MapModel) SetMarkers(x, y int, layerIndex int32, value []Marker) error {
+	send, err := func() (bool, error) {
+		m.mutex.Lock()
+		defer m.mutex.Unlock()
+
+		if len(value) > 0 {
+			if err := m.dimensions.Check(utils.NewInt2(x, y)); err != nil {
+				return false, err
+			}
+			if err := checkMarkers(utils.NewInt2(x, y), value); err != nil {
+				return false, err
+			}
+		}
+
+		if len(value) == 0 {
+			value = nil
+		}
+		m.setMarkers(x, y, layerIndex, value)
+
+		return true, nil
+	}()
+	if err != nil {
+		return err
+	}
+
+	if send {
+		m.changeListeners.Emit(newCellChange(x, y, layerIndex))
+		m.listeners.Emit()
+	}
+
+	return nil
+}
+
+func (m *MapModel) VisibleLink(x, y int) (layerUuid uuid.UUID, link *Link) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if len(m.layers) == 0 {
+		return uuid.UUID{}, nil
+	}
+
+	for _, l := range m.layers {
+		if l.Visible && l.Level == m.level {
+			v, exists := l.locations[utils.NewInt2(x, y)]
+			if exists && v.Link != nil {
+				return l.Uuid, v.Link
+			}
+		}
+	}
+
+	return m.layers[0].Uuid, nil
+}
+
+func (m *MapModel) link(x, y int, layerIndex int32) *Link {
+	v, exists := m.layers[layerIndex].locations[utils.NewInt2(x, y)]
+	if !exists {
+		return nil
+	}
+	return v.Link
+}
+
+func (m *MapModel) Link(x, y int, layerIndex int32) *Link {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	return m.link(x, y, layerIndex)
+}
+
+func (m *MapModel) setLink(x, y int, layerIndex int32, value *Link) {
+	pos := utils.NewInt2(x, y)
+
+	f, exists := m.layers[layerIndex].locations[pos]
+	if exists || value != nil {
+		f.Link = value
+		m.layers[layerIndex].locations[pos] = f
+	}
+
+	if f.IsEmptyLocation() {
+		delete(m.layers[layerIndex].locations, pos)
+	}
+}
+
+func (m *MapModel) SetLink(x, y int, layerIndex int32, value *Link) error {
+	if layerIndex < 0 {
+		return nil
+	}
+
+	send, err := func() (bool, error) {
+		m.mutex.Lock()
+		defer m.mutex.Unlock()
+
+		if value != nil {
+			if err := m.dimensions.Check(utils.NewInt2(x, y)); err != nil {
+				return false, err
+			}
+		}
+
+		m.setLink(x, y, layerIndex, value)
+
+		return true, nil
 	}()
+	if err != nil {
+		return err
+	}
 
 	if send {
+		m.changeListeners.Emit(newCellChange(x, y, layerIndex))
 		m.listeners.Emit()
 	}
+
+	return nil
+}
+
+// Объединение effects у всех видимых слоёв текущего уровня
+func (m *MapModel) VisibleEffects(x, y int) Effects {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	var effects Effects
+
+	for _, l := range m.layers {
+		if l.Visible && l.Level == m.level {
+			effects |= l.locations[utils.NewInt2(x, y)].Effects
+		}
+	}
+
+	return effects
+}
+
+func (m *MapModel) effects(x, y int, layerIndex int32) Effects {
+	return m.layers[layerIndex].locations[utils.NewInt2(x, y)].Effects
+}
+
+func (m *MapModel) Effects(x, y int, layerIndex int32) Effects {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	return m.effects(x, y, layerIndex)
+}
+
+func (m *MapModel) setEffects(x, y int, layerIndex int32, value Effects) {
+	pos := utils.NewInt2(x, y)
+
+	f, exists := m.layers[layerIndex].locations[pos]
+	if exists || value != 0 {
+		f.Effects = value
+		m.layers[layerIndex].locations[pos] = f
+	}
+
+	if f.IsEmptyLocation() {
+		delete(m.layers[layerIndex].locations, pos)
+	}
+}
+
+func (m *MapModel) SetEffects(x, y int, layerIndex int32, value Effects) error {
+	if layerIndex < 0 {
+		return nil
+	}
+
+	send, err := func() (bool, error) {
+		m.mutex.Lock()
+		defer m.mutex.Unlock()
+
+		if value != 0 {
+			if err := m.dimensions.Check(utils.NewInt2(x, y)); err != nil {
+				return false, err
+			}
+		}
+
+		m.setEffects(x, y, layerIndex, value)
+
+		return true, nil
+	}()
+	if err != nil {
+		return err
+	}
+
+	if send {
+		m.changeListeners.Emit(newCellChange(x, y, layerIndex))
+		m.listeners.Emit()
+	}
+
+	return nil
 }
 
 func (m *MapModel) bounds(layerIndex int32) (leftTop, rightBottom utils.Int2) {
@@ -683,16 +1655,23 @@ func (m *MapModel) Bounds(layerIndex int32) (leftTop, rightBottom utils.Int2) {
 	return m.bounds(layerIndex)
 }
 
-func (m *MapModel) MoveTo(layerIndex int32, offsetX, offsetY int) {
-	send := func() bool {
+func (m *MapModel) MoveTo(layerIndex int32, offsetX, offsetY int) error {
+	change := Change{Property: CellsChange, LayerIndex: layerIndex}
+
+	send, err := func() (bool, error) {
 		m.mutex.Lock()
 		defer m.mutex.Unlock()
 
 		leftTop, rightBottom := m.bounds(layerIndex)
 		if leftTop == rightBottom {
-			return false
+			return false, nil
 		}
 
+		// старое и новое место слоя
+		movedLeftTop := utils.NewInt2(leftTop.X+offsetX, leftTop.Y+offsetY)
+		movedRightBottom := utils.NewInt2(rightBottom.X+offsetX, rightBottom.Y+offsetY)
+		change.Cells = utils.NewRegion(leftTop, rightBottom).Union(utils.NewRegion(movedLeftTop, movedRightBottom))
+
 		newLocations := make(map[utils.Int2]Location)
 
 		for y := leftTop.Y; y < rightBottom.Y; y++ {
@@ -703,19 +1682,131 @@ func (m *MapModel) MoveTo(layerIndex int32, offsetX, offsetY int) {
 			}
 		}
 
+		if err := m.dimensions.checkLocations(newLocations); err != nil {
+			return false, err
+		}
+
 		m.layers[layerIndex].locations = newLocations
 
-		return true
+		return true, nil
 	}()
 
 	if send {
+		m.changeListeners.Emit(change)
+		m.listeners.Emit()
+	}
+
+	return err
+}
+
+// Клетка слоя
+type LayerCell struct {
+	LayerIndex int32
+	Pos        utils.Int2
+}
+
+// Содержимое клетки до и после транзакции
+type LocationEdit struct {
+	Before, After Location
+}
+
+// Транзакция MapModel.Edit: чтение и правка клеток под блокировкой карты
+type Tx struct {
+	m      *MapModel
+	before map[LayerCell]Location
+	change Change
+	err    error // первая неудачная правка, после неё правки не делаются
+}
+
+func (t *Tx) Location(x, y int, layerIndex int32) Location {
+	return t.m.layers[layerIndex].locations[utils.NewInt2(x, y)]
+}
+
+func (t *Tx) SetLocation(x, y int, layerIndex int32, location Location) {
+	if t.err != nil {
+		return
+	}
+
+	cell := LayerCell{LayerIndex: layerIndex, Pos: utils.NewInt2(x, y)}
+	locations := t.m.layers[layerIndex].locations
+
+	old := locations[cell.Pos]
+	if old.Equal(location) {
+		return
+	}
+	if err := t.m.dimensions.checkLocation(cell.Pos, location); err != nil {
+		t.err = err
+		return
+	}
+	if err := checkMarkers(cell.Pos, location.Markers); err != nil {
+		t.err = err
+		return
+	}
+	if _, exists := t.before[cell]; !exists {
+		t.before[cell] = old
+	}
+
+	if location.IsEmptyLocation() {
+		delete(locations, cell.Pos)
+	} else {
+		locations[cell.Pos] = location
+	}
+
+	if t.change.Cells.IsEmpty() {
+		t.change.LayerIndex = layerIndex
+	} else if t.change.LayerIndex != layerIndex {
+		t.change.LayerIndex = -1
+	}
+	t.change.Cells = t.change.Cells.Union(utils.NewCellRegion(x, y))
+}
+
+// Применяет правки edit атомарно: другие методы MapModel не увидят промежуточного состояния,
+// а listener'ы получат одно изменение на все клетки. Внутри edit можно вызывать только методы t.
+// Возвращает изменённые клетки, по ним правку можно откатить или повторить. Если какая-то правка
+// не получилась(например, клетка за краем карты), то откатывает все правки и возвращает ошибку.
+func (m *MapModel) Edit(edit func(t *Tx)) (map[LayerCell]LocationEdit, error) {
+	t := &Tx{m: m, before: make(map[LayerCell]Location), change: Change{Property: CellsChange}}
+
+	edits := func() map[LayerCell]LocationEdit {
+		m.mutex.Lock()
+		defer m.mutex.Unlock()
+
+		edit(t)
+
+		if t.err != nil {
+			for cell, before := range t.before {
+				if before.IsEmptyLocation() {
+					delete(m.layers[cell.LayerIndex].locations, cell.Pos)
+				} else {
+					m.layers[cell.LayerIndex].locations[cell.Pos] = before
+				}
+			}
+			return nil
+		}
+
+		edits := make(map[LayerCell]LocationEdit, len(t.before))
+		for cell, before := range t.before {
+			after := m.layers[cell.LayerIndex].locations[cell.Pos]
+			if !after.Equal(before) {
+				edits[cell] = LocationEdit{Before: before, After: after}
+			}
+		}
+		return edits
+	}()
+
+	if len(edits) > 0 {
+		m.changeListeners.Emit(t.change)
 		m.listeners.Emit()
 	}
+
+	return edits, t.err
 }
 
 func (m *MapModel) HasVisible() bool {
+	level := m.Level()
+
 	for _, l := range m.LayerInfos() {
-		if l.Visible {
+		if l.Visible && l.Level == level {
 			return true
 		}
 	}
@@ -727,6 +1818,11 @@ func (m *MapModel) AddDataChangeListener(listener func()) func() {
 	return m.listeners.AddSlot(listener)
 }
 
+// listener получает изменение до listener'ов AddDataChangeListener
+func (m *MapModel) AddChangeListener(listener func(change Change)) func() {
+	return m.changeListeners.AddSlot(listener)
+}
+
 func (m *MapModel) AddBeforeDeleteLayerListener(listener func()) func() {
 	return m.beforeDeleteLayerListeners.AddSlot(listener)
 }
@@ -0,0 +1,26 @@
+package map_model
+
+import (
+	"old-school-rpg-map-editor/utils"
+	"testing"
+)
+
+func TestLocationEqualComparesLinksByValue(t *testing.T) {
+	link := func() *Link {
+		return &Link{Type: StairsDownLink, Level: 1, Target: utils.NewInt2(2, 3)}
+	}
+
+	a := Location{Floor: 1, Link: link()}
+	if b := (Location{Floor: 1, Link: link()}); !a.Equal(b) {
+		t.Error("equal links on different cells compare unequal")
+	}
+
+	other := link()
+	other.Level = 2
+	if b := (Location{Floor: 1, Link: other}); a.Equal(b) {
+		t.Error("different links compare equal")
+	}
+	if b := (Location{Floor: 1}); a.Equal(b) || b.Equal(a) {
+		t.Error("a link compares equal to no link")
+	}
+}
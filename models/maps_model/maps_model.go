@@ -2,11 +2,16 @@ package maps_model
 
 import (
 	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"math"
 	"old-school-rpg-map-editor/common/load_save"
 	"old-school-rpg-map-editor/models/center_model"
 	"old-school-rpg-map-editor/models/map_model"
 	"old-school-rpg-map-editor/models/mode_model"
 	"old-school-rpg-map-editor/models/notes_model"
+	"old-school-rpg-map-editor/models/party_model"
 	"old-school-rpg-map-editor/models/rot_map_model"
 	"old-school-rpg-map-editor/models/rot_select_model"
 	"old-school-rpg-map-editor/models/rotate_model"
@@ -15,10 +20,12 @@ import (
 	"old-school-rpg-map-editor/undo_redo"
 	"old-school-rpg-map-editor/utils"
 	"os"
+	"path/filepath"
 	"sync"
 
 	"github.com/goki/freetype/truetype"
 	"github.com/google/uuid"
+	"golang.org/x/exp/maps"
 )
 
 type MapElem struct {
@@ -32,6 +39,7 @@ type MapElem struct {
 	UndoRedoQueue         *undo_redo.UndoRedoQueue
 	SelectedLayerModel    *selected_layer_model.SelectedLayerModel
 	CenterModel           *center_model.CenterModel
+	PartyModel            *party_model.PartyModel
 	MapId                 uuid.UUID
 	FilePath              string // если пустой, то файла нет
 	ChangeGeneration      uint64 // используется чтобы определять был изменён файл или нет
@@ -40,11 +48,13 @@ type MapElem struct {
 }
 
 type MapsModel struct {
-	mutex     sync.Mutex
-	fontSize  float64
-	fnt       *truetype.Font
-	maps      map[uuid.UUID]MapElem
-	listeners utils.Signal0 // listener'ы на изменение списка
+	mutex       sync.Mutex
+	fontSize    float64
+	fnt         *truetype.Font
+	maps        map[uuid.UUID]MapElem
+	undoLimit   int           // сколько правок помнить, 0 - без ограничения
+	saveHistory bool          // сохранять историю правок в .map файл
+	listeners   utils.Signal0 // listener'ы на изменение списка
 }
 
 func NewMapsModel(fontSize float64, fnt *truetype.Font) *MapsModel {
@@ -56,6 +66,44 @@ func NewMapsModel(fontSize float64, fnt *truetype.Font) *MapsModel {
 	}
 }
 
+// undoLimit - сколько правок помнить(0 - без ограничения), saveHistory - сохранять ли историю правок в .map файл
+func (m *MapsModel) SetUndoOptions(undoLimit int, saveHistory bool) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.undoLimit = undoLimit
+	m.saveHistory = saveHistory
+
+	for _, mapElem := range m.maps {
+		mapElem.UndoRedoQueue.SetMaxElements(undoLimit)
+	}
+}
+
+// История правок для новой карты
+func (m *MapsModel) NewUndoRedoQueue() *undo_redo.UndoRedoQueue {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	return undo_redo.NewUndoRedoQueue(m.undoLimit)
+}
+
+// История правок для сохранения в .map файл, nil если её сохранять не надо
+func (m *MapsModel) History(mapId uuid.UUID) *undo_redo.History {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	mapElem, exists := m.maps[mapId]
+	if !exists || !m.saveHistory {
+		return nil
+	}
+
+	return &undo_redo.History{
+		Queue:            mapElem.UndoRedoQueue,
+		ChangeGeneration: mapElem.ChangeGeneration,
+		Angle:            mapElem.RotateModel.Angle(),
+	}
+}
+
 func (m *MapsModel) MarshalJSON() ([]byte, error) {
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
@@ -82,33 +130,80 @@ func (m *MapsModel) UnmarshalJSON(d []byte) error {
 	}
 
 	for _, file := range t.OpenFiles {
-		f, err := os.Open(file)
-		if err != nil {
+		// без истории правок карта всё равно открыта, показать это при старте некому
+		_, _, err := m.Open(file)
+
+		// файл не открылся(удалили, нет прав и т.д.) - пропускаем
+		var pathErr *fs.PathError
+		if errors.As(err, &pathErr) {
 			continue
 		}
-
-		mapModel, notesModel, err := load_save.LoadMapFile(f)
 		if err != nil {
 			return err
 		}
+	}
 
-		notesModel.SetFont(m.fontSize, m.fnt)
+	return nil
+}
 
-		selectedLayerModel := selected_layer_model.NewSelectedLayerModel()
-		rotateModel := rotate_model.NewRotateModel(0)
-		selectModel := select_model.NewSelectModel(mapModel, selectedLayerModel)
-		rotMapModel := rot_map_model.NewRotMapMode(mapModel, rotateModel)
-		rotSelectModel := rot_select_model.NewRotSelectModel(selectModel, rotateModel)
-		undoRedoQueue := undo_redo.NewUndoRedoQueue(100 /*TODO*/)
-		centerModel := center_model.NewCenterModel(utils.Int2{})
+// Загружает .map файл и добавляет его в модель. historyErr - почему не прочиталась история правок
+// из файла(см. load_save.DecodeWithHistory), карта при этом открывается без истории
+func (m *MapsModel) Open(filePath string) (mapId uuid.UUID, historyErr error, err error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return uuid.UUID{}, nil, err
+	}
+	defer f.Close()
 
-		m.Add(mapModel, selectModel, mode_model.NewModeModel(), rotateModel, rotMapModel, rotSelectModel, notesModel, undoRedoQueue, selectedLayerModel, centerModel, file)
+	return m.Load(f, filePath)
+}
+
+// Загружает .map файл из reader и добавляет его в модель как файл filePath, historyErr - см. Open
+func (m *MapsModel) Load(reader io.Reader, filePath string) (mapId uuid.UUID, historyErr error, err error) {
+	mapModel, notesModel, history, historyErr, err := load_save.LoadMapFileWithHistory(reader)
+	if err != nil {
+		return uuid.UUID{}, nil, err
 	}
 
-	return nil
+	return m.AddLoaded(mapModel, notesModel, history, filePath), historyErr, nil
 }
 
-func (m *MapsModel) Add(model *map_model.MapModel, selectModel *select_model.SelectModel, modeModel *mode_model.ModeModel, rotateModel *rotate_model.RotateModel, rotMapModel *rot_map_model.RotMapModel, rotSelectModel *rot_select_model.RotSelectModel, notesModel *notes_model.NotesModel, undoRedoQueue *undo_redo.UndoRedoQueue, selectedLayerModel *selected_layer_model.SelectedLayerModel, centerModel *center_model.CenterModel, filePath string) (mapId uuid.UUID) {
+// Добавляет загруженную карту, создавая для неё остальные модели. history - история правок
+// из файла или nil
+func (m *MapsModel) AddLoaded(mapModel *map_model.MapModel, notesModel *notes_model.NotesModel, history *undo_redo.History, filePath string) (mapId uuid.UUID) {
+	m.mutex.Lock()
+	fontSize, fnt, undoLimit := m.fontSize, m.fnt, m.undoLimit
+	m.mutex.Unlock()
+
+	notesModel.SetFont(fontSize, fnt)
+
+	undoRedoQueue := undo_redo.NewUndoRedoQueue(undoLimit)
+	angle := 0
+	if history != nil {
+		undoRedoQueue = history.Queue
+		undoRedoQueue.SetMaxElements(undoLimit)
+		angle = history.Angle
+	}
+
+	selectedLayerModel := selected_layer_model.NewSelectedLayerModel()
+	rotateModel := rotate_model.NewRotateModel(angle)
+	selectModel := select_model.NewSelectModel(mapModel, selectedLayerModel)
+	rotMapModel := rot_map_model.NewRotMapMode(mapModel, rotateModel)
+	rotSelectModel := rot_select_model.NewRotSelectModel(selectModel, rotateModel)
+	centerModel := center_model.NewCenterModel(utils.Int2{})
+	partyModel := party_model.NewPartyModel(utils.Int2{}, party_model.North)
+
+	mapId = m.Add(mapModel, selectModel, mode_model.NewModeModel(), rotateModel, rotMapModel, rotSelectModel, notesModel, undoRedoQueue, selectedLayerModel, centerModel, partyModel, filePath)
+
+	if history != nil {
+		m.SetChangeGeneration(mapId, history.ChangeGeneration)
+		m.UpdateSaveChangeGeneration(mapId)
+	}
+
+	return mapId
+}
+
+func (m *MapsModel) Add(model *map_model.MapModel, selectModel *select_model.SelectModel, modeModel *mode_model.ModeModel, rotateModel *rotate_model.RotateModel, rotMapModel *rot_map_model.RotMapModel, rotSelectModel *rot_select_model.RotSelectModel, notesModel *notes_model.NotesModel, undoRedoQueue *undo_redo.UndoRedoQueue, selectedLayerModel *selected_layer_model.SelectedLayerModel, centerModel *center_model.CenterModel, partyModel *party_model.PartyModel, filePath string) (mapId uuid.UUID) {
 	listeners := func() utils.Signal0 {
 		m.mutex.Lock()
 		defer m.mutex.Unlock()
@@ -126,6 +221,7 @@ func (m *MapsModel) Add(model *map_model.MapModel, selectModel *select_model.Sel
 			UndoRedoQueue:      undoRedoQueue,
 			SelectedLayerModel: selectedLayerModel,
 			CenterModel:        centerModel,
+			PartyModel:         partyModel,
 			MapId:              mapId,
 			FilePath:           filePath,
 		}
@@ -171,6 +267,19 @@ func (m *MapsModel) GetByExternalData(externalData any) MapElem {
 	return MapElem{}
 }
 
+func (m *MapsModel) GetByFilePath(filePath string) MapElem {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	for _, el := range m.maps {
+		if len(el.FilePath) > 0 && filepath.Clean(el.FilePath) == filepath.Clean(filePath) {
+			return el
+		}
+	}
+
+	return MapElem{}
+}
+
 type IdAndExternalData struct {
 	MapId        uuid.UUID
 	ExternalData any
@@ -261,6 +370,33 @@ func (m *MapsModel) UpdateSaveChangeGeneration(mapId uuid.UUID) {
 	listeners.Emit()
 }
 
+// Помечает карту как несохранённую, например, если она восстановлена из автосохранения
+func (m *MapsModel) MarkUnsaved(mapId uuid.UUID) {
+	listeners := func() utils.Signal0 {
+		m.mutex.Lock()
+		defer m.mutex.Unlock()
+
+		mp, exists := m.maps[mapId]
+		if exists {
+			// такого ChangeGeneration не бывает, так что карта не совпадёт с сохранённой, пока её не сохранят
+			mp.SavedChangeGeneration = math.MaxUint64
+			m.maps[mapId] = mp
+			return m.listeners.Clone()
+		}
+
+		return utils.Signal0{}
+	}()
+
+	listeners.Emit()
+}
+
+func (m *MapsModel) MapElems() []MapElem {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	return maps.Values(m.maps)
+}
+
 func (m *MapsModel) Length() int {
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
@@ -2,12 +2,18 @@ package notes_model
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"image"
+	"image/color"
 	"log"
 	"old-school-rpg-map-editor/utils"
 	"regexp"
+	"strconv"
 	"strings"
 	"sync"
+	"time"
+	"unicode"
 
 	"github.com/goki/freetype"
 	"github.com/goki/freetype/truetype"
@@ -15,7 +21,15 @@ import (
 	"golang.org/x/image/font"
 )
 
-var re = regexp.MustCompile(`(?m:^-\s*(\S{1,5})\b)`)
+// Начало заметки в старом текстовом формате: "- id заголовок"
+var re = regexp.MustCompile(`^-\s*(\S{1,5})\b\s*(.*)$`)
+
+var (
+	ErrEmptyNoteId     = errors.New("empty note id")
+	ErrBadNoteId       = errors.New("note id with spaces")
+	ErrDuplicateNoteId = errors.New("duplicate note id")
+	ErrNoNote          = errors.New("no such note")
+)
 
 func textWidthAndHeight(text string, fnt *truetype.Font, fontSize float64) (width int, height int, descent int) {
 	opts := truetype.Options{}
@@ -50,7 +64,13 @@ func textWidthAndHeight(text string, fnt *truetype.Font, fontSize float64) (widt
 	return width, height, descent
 }
 
-func textImage(text string, fnt *truetype.Font, fontSize float64) image.Image {
+// Картинка с текстом text черным цветом на прозрачном фоне. Если fnt == nil, то nil.
+func TextImage(text string, fnt *truetype.Font, fontSize float64) image.Image {
+	return ColorTextImage(text, color.Black, fnt, fontSize)
+}
+
+// То же, что TextImage, но текст цвета c
+func ColorTextImage(text string, c color.Color, fnt *truetype.Font, fontSize float64) image.Image {
 	if fnt == nil {
 		return nil
 	}
@@ -58,17 +78,17 @@ func textImage(text string, fnt *truetype.Font, fontSize float64) image.Image {
 	width, height, descent := textWidthAndHeight(text, fnt, fontSize)
 	textImg := image.NewRGBA(image.Rect(0, 0, width, height))
 
-	c := freetype.NewContext()
-	c.SetDst(textImg)
-	c.SetSrc(image.Black)
-	c.SetFont(fnt)
-	c.SetFontSize(fontSize)
-	//c.SetDPI(72)
-	c.SetClip(textImg.Bounds())
-	c.SetHinting(font.HintingNone)
+	ctx := freetype.NewContext()
+	ctx.SetDst(textImg)
+	ctx.SetSrc(image.NewUniform(c))
+	ctx.SetFont(fnt)
+	ctx.SetFontSize(fontSize)
+	//ctx.SetDPI(72)
+	ctx.SetClip(textImg.Bounds())
+	ctx.SetHinting(font.HintingNone)
 
 	pt := freetype.Pt(0, height-descent)
-	_, err := c.DrawString(text, pt)
+	_, err := ctx.DrawString(text, pt)
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -76,20 +96,148 @@ func textImage(text string, fnt *truetype.Font, fontSize float64) image.Image {
 	return textImg
 }
 
+// Цвет заметки в палитре редактора
+type NamedColor struct {
+	Name  string
+	Value string // см. Note.Color
+}
+
+// Цвета, которые предлагает редактор. В файле может быть и любой другой "#rrggbb"
+var Colors = []NamedColor{
+	{Name: "Black", Value: ""},
+	{Name: "Red", Value: "#c00000"},
+	{Name: "Green", Value: "#008000"},
+	{Name: "Blue", Value: "#0000c0"},
+	{Name: "Brown", Value: "#804000"},
+	{Name: "Purple", Value: "#800080"},
+}
+
+// Цвет заметки: "" - чёрный, иначе "#rrggbb"
+func ParseColor(s string) (color.NRGBA, error) {
+	if len(s) == 0 {
+		return color.NRGBA{A: 0xff}, nil
+	}
+
+	if len(s) != 7 || s[0] != '#' {
+		return color.NRGBA{}, fmt.Errorf("bad note color %q", s)
+	}
+
+	v, err := strconv.ParseUint(s[1:], 16, 32)
+	if err != nil {
+		return color.NRGBA{}, fmt.Errorf("bad note color %q", s)
+	}
+
+	return color.NRGBA{R: uint8(v >> 16), G: uint8(v >> 8), B: uint8(v), A: 0xff}, nil
+}
+
+// Заметка карты. Id ставится в клетки карты(map_model.Location.NoteId) и у существующей заметки
+// не меняется
 type Note struct {
-	noteId   string
-	noteImg  image.Image
-	position int // line in text
+	Id      string    `json:"id"`
+	Title   string    `json:"title"`
+	Body    string    `json:"body"`
+	Tags    []string  `json:"tags,omitempty"`
+	Color   string    `json:"color,omitempty"` // см. ParseColor
+	Created time.Time `json:"created"`         // нулевое у заметок из старого текстового формата
+}
+
+// Заметка в старом текстовом формате: "- id заголовок", потом текст
+func (n Note) Text() string {
+	return strings.TrimSpace(strings.TrimSpace("- "+n.Id+" "+n.Title) + "\n" + n.Body)
+}
+
+func (n Note) clone() Note {
+	n.Tags = slices.Clone(n.Tags)
+	return n
+}
+
+func (n Note) equal(o Note) bool {
+	return n.Id == o.Id && n.Title == o.Title && n.Body == o.Body && slices.Equal(n.Tags, o.Tags) && n.Color == o.Color && n.Created.Equal(o.Created)
+}
+
+// Id заметки не пустой и без пробелов, чтобы его можно было показать в клетке и найти в тексте
+func ValidateNoteId(noteId string) error {
+	if len(noteId) == 0 {
+		return ErrEmptyNoteId
+	}
+	if strings.IndexFunc(noteId, unicode.IsSpace) != -1 {
+		return fmt.Errorf("%w: %q", ErrBadNoteId, noteId)
+	}
+	return nil
+}
+
+// Разбирает старый текстовый формат, где заметка - строка "- id заголовок" и строки после неё.
+// Повторная заметка с тем же id дописывается к первой, текст до первой заметки становится
+// заметкой со свободным числовым id
+func ParseText(text string) []Note {
+	var notes []Note
+	var preamble []string
+
+	current := -1
+	for _, s := range strings.Split(text, "\n") {
+		sub := re.FindStringSubmatch(s)
+		if len(sub) != 3 {
+			if current == -1 {
+				preamble = append(preamble, s)
+			} else {
+				notes[current].Body += "\n" + s
+			}
+			continue
+		}
+
+		noteId, title := sub[1], strings.TrimLeft(sub[2], " \t.:)-")
+
+		current = slices.IndexFunc(notes, func(n Note) bool { return n.Id == noteId })
+		if current == -1 {
+			notes = append(notes, Note{Id: noteId, Title: title})
+			current = len(notes) - 1
+		} else {
+			notes[current].Body += "\n" + title
+		}
+	}
+
+	for i := range notes {
+		notes[i].Body = strings.TrimSpace(notes[i].Body)
+	}
+
+	if body := strings.TrimSpace(strings.Join(preamble, "\n")); len(body) > 0 {
+		notes = append([]Note{{Id: freeNoteId(notes), Body: body}}, notes...)
+	}
+
+	return notes
+}
+
+// Наименьший свободный числовой id
+func freeNoteId(notes []Note) string {
+	for i := 1; ; i++ {
+		noteId := strconv.Itoa(i)
+		if slices.IndexFunc(notes, func(n Note) bool { return n.Id == noteId }) == -1 {
+			return noteId
+		}
+	}
+}
+
+// Изменение заметок для listener'ов AddChangeListener
+type Change struct {
+	Added   []string // id добавленных заметок
+	Deleted []string // id удалённых заметок
+	Updated []string // id заметок, у которых изменились поля
+	Font    bool     // изменился шрифт, картинки всех заметок другие
+}
+
+type noteElem struct {
+	note    Note
+	noteImg image.Image
 }
 
 type NotesModel struct {
 	mutex    sync.Mutex
 	fontSize float64
 	font     *truetype.Font
-	text     string
-	notes    []Note
+	notes    []noteElem
 
-	listeners utils.Signal0 // listener'ы на изменение списка
+	listeners       utils.Signal0 // listener'ы на изменение списка
+	changeListeners utils.Signal1[Change]
 }
 
 func NewNotesModel(fontSize float64, font *truetype.Font) *NotesModel {
@@ -97,19 +245,20 @@ func NewNotesModel(fontSize float64, font *truetype.Font) *NotesModel {
 }
 
 func (m *NotesModel) MarshalJSON() ([]byte, error) {
-	m.mutex.Lock()
-	defer m.mutex.Unlock()
-
 	t := struct {
-		Text string `json:"text"`
-	}{Text: m.text}
+		Notes []Note `json:"notes"`
+	}{Notes: m.Notes()}
+
+	if t.Notes == nil {
+		t.Notes = []Note{}
+	}
 
 	return json.Marshal(t)
 }
 
 func (m *NotesModel) UnmarshalJSON(d []byte) error {
 	var t struct {
-		Text string `json:"text"`
+		Notes []Note `json:"notes"`
 	}
 
 	err := json.Unmarshal(d, &t)
@@ -117,115 +266,234 @@ func (m *NotesModel) UnmarshalJSON(d []byte) error {
 		return err
 	}
 
-	m.Update(t.Text)
+	return m.SetNotes(t.Notes)
+}
+
+func (m *NotesModel) emit(change Change) {
+	m.changeListeners.Emit(change)
+	m.listeners.Emit()
+}
 
-	return nil
+func (m *NotesModel) noteImage(note Note) image.Image {
+	c, err := ParseColor(note.Color)
+	if err != nil {
+		// TODO
+		fmt.Println(err)
+	}
+
+	return ColorTextImage(note.Id, c, m.font, m.fontSize)
 }
 
-func (m *NotesModel) Update(text string) {
-	send := false
+func (m *NotesModel) index(noteId string) int {
+	return slices.IndexFunc(m.notes, func(e noteElem) bool { return e.note.Id == noteId })
+}
+
+// Заменяет все заметки на notes
+func (m *NotesModel) SetNotes(notes []Note) error {
+	for i, note := range notes {
+		err := ValidateNoteId(note.Id)
+		if err != nil {
+			return err
+		}
+		if slices.IndexFunc(notes[:i], func(n Note) bool { return n.Id == note.Id }) != -1 {
+			return fmt.Errorf("%w: %q", ErrDuplicateNoteId, note.Id)
+		}
+	}
+
+	var change Change
 	func() {
 		m.mutex.Lock()
 		defer m.mutex.Unlock()
 
-		deleteNoteIds := m.getNoteIds()
+		elems := make([]noteElem, len(notes))
+		for i, note := range notes {
+			elems[i].note = note.clone()
 
-		entryNodeIds := make(map[string]int)
-		for i, s := range strings.Split(text, "\n") {
-			sub := re.FindStringSubmatch(s)
-			if len(sub) == 2 {
-				entryNodeIds[sub[1]] = i
+			index := m.index(note.Id)
+			if index == -1 {
+				change.Added = append(change.Added, note.Id)
+			} else if !m.notes[index].note.equal(note) {
+				change.Updated = append(change.Updated, note.Id)
 			}
-		}
 
-		for noteId, position := range entryNodeIds {
-			index := slices.Index(deleteNoteIds, noteId)
-			if index != -1 {
-				deleteNoteIds = slices.Delete(deleteNoteIds, index, index+1)
+			if index != -1 && m.notes[index].note.Color == note.Color {
+				elems[i].noteImg = m.notes[index].noteImg
 			} else {
-				result := m.add(noteId, position)
-				send = send || result
+				elems[i].noteImg = m.noteImage(note)
 			}
 		}
 
-		for _, n := range deleteNoteIds {
-			result := m.delete(n)
-			send = send || result
+		for _, e := range m.notes {
+			if slices.IndexFunc(notes, func(n Note) bool { return n.Id == e.note.Id }) == -1 {
+				change.Deleted = append(change.Deleted, e.note.Id)
+			}
 		}
 
-		m.text = text
+		m.notes = elems
 	}()
 
-	if send {
-		m.listeners.Emit()
+	if len(change.Added) > 0 || len(change.Deleted) > 0 || len(change.Updated) > 0 {
+		m.emit(change)
 	}
+
+	return nil
 }
 
-func (m *NotesModel) SetFont(fontSize float64, font *truetype.Font) {
-	m.mutex.Lock()
-	if m.font == font {
-		return
+// Добавляет заметку в конец списка. Нулевое время создания заменяется текущим
+func (m *NotesModel) Add(note Note) error {
+	err := ValidateNoteId(note.Id)
+	if err != nil {
+		return err
 	}
-	m.mutex.Unlock()
 
-	func() {
+	if note.Created.IsZero() {
+		note.Created = time.Now().Truncate(time.Second)
+	}
+
+	err = func() error {
 		m.mutex.Lock()
 		defer m.mutex.Unlock()
 
-		m.fontSize = fontSize
+		if m.index(note.Id) != -1 {
+			return fmt.Errorf("%w: %q", ErrDuplicateNoteId, note.Id)
+		}
 
-		for i := range m.notes {
-			m.notes[i].noteImg = textImage(m.notes[i].noteId, m.font, m.fontSize)
+		m.notes = append(m.notes, noteElem{note: note.clone(), noteImg: m.noteImage(note)})
+		return nil
+	}()
+	if err != nil {
+		return err
+	}
+
+	m.emit(Change{Added: []string{note.Id}})
+
+	return nil
+}
+
+// Меняет поля заметки note.Id
+func (m *NotesModel) Set(note Note) error {
+	send, err := func() (bool, error) {
+		m.mutex.Lock()
+		defer m.mutex.Unlock()
+
+		index := m.index(note.Id)
+		if index == -1 {
+			return false, fmt.Errorf("%w: %q", ErrNoNote, note.Id)
 		}
+
+		e := &m.notes[index]
+		if e.note.equal(note) {
+			return false, nil
+		}
+
+		if e.note.Color != note.Color {
+			e.noteImg = m.noteImage(note)
+		}
+		e.note = note.clone()
+
+		return true, nil
 	}()
 
-	m.listeners.Emit()
+	if send {
+		m.emit(Change{Updated: []string{note.Id}})
+	}
+
+	return err
 }
 
-func (m *NotesModel) add(noteId string, position int) bool {
-	index := slices.IndexFunc(m.notes, func(n Note) bool { return n.noteId == noteId })
-	if index != -1 {
-		return false
+func (m *NotesModel) Delete(noteId string) bool {
+	send := func() bool {
+		m.mutex.Lock()
+		defer m.mutex.Unlock()
+
+		index := m.index(noteId)
+		if index == -1 {
+			return false
+		}
+
+		m.notes = slices.Delete(m.notes, index, index+1)
+		return true
+	}()
+
+	if send {
+		m.emit(Change{Deleted: []string{noteId}})
 	}
 
-	m.notes = append(m.notes, Note{noteId: noteId, noteImg: textImage(noteId, m.font, m.fontSize), position: position})
+	return send
+}
 
-	return true
+// Наименьший свободный числовой id для новой заметки
+func (m *NotesModel) NewNoteId() string {
+	return freeNoteId(m.Notes())
 }
 
-func (m *NotesModel) delete(noteId string) bool {
-	index := slices.IndexFunc(m.notes, func(n Note) bool { return n.noteId == noteId })
+func (m *NotesModel) Note(noteId string) (Note, bool) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	index := m.index(noteId)
 	if index == -1 {
-		return false
+		return Note{}, false
 	}
 
-	m.notes = slices.Delete(m.notes, index, index+1)
-
-	return true
+	return m.notes[index].note.clone(), true
 }
 
-func (m *NotesModel) GetNoteImage(noteId string) image.Image {
+func (m *NotesModel) Notes() []Note {
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
 
-	index := slices.IndexFunc(m.notes, func(n Note) bool { return n.noteId == noteId })
-	if index == -1 {
-		return nil
+	var notes []Note
+	for _, e := range m.notes {
+		notes = append(notes, e.note.clone())
 	}
 
-	return m.notes[index].noteImg
+	return notes
+}
+
+// Все заметки в старом текстовом формате, см. ParseText
+func (m *NotesModel) Text() string {
+	var texts []string
+	for _, note := range m.Notes() {
+		texts = append(texts, note.Text())
+	}
+
+	return strings.Join(texts, "\n")
+}
+
+func (m *NotesModel) SetFont(fontSize float64, font *truetype.Font) {
+	m.mutex.Lock()
+	if m.font == font && m.fontSize == fontSize {
+		m.mutex.Unlock()
+		return
+	}
+	m.mutex.Unlock()
+
+	func() {
+		m.mutex.Lock()
+		defer m.mutex.Unlock()
+
+		m.font = font
+		m.fontSize = fontSize
+
+		for i := range m.notes {
+			m.notes[i].noteImg = m.noteImage(m.notes[i].note)
+		}
+	}()
+
+	m.emit(Change{Font: true})
 }
 
-func (m *NotesModel) GetNotePosition(noteId string) int {
+func (m *NotesModel) GetNoteImage(noteId string) image.Image {
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
 
-	index := slices.IndexFunc(m.notes, func(n Note) bool { return n.noteId == noteId })
+	index := m.index(noteId)
 	if index == -1 {
-		return -1
+		return nil
 	}
 
-	return m.notes[index].position
+	return m.notes[index].noteImg
 }
 
 func (m *NotesModel) Len() int {
@@ -239,25 +507,26 @@ func (m *NotesModel) GetNoteIdByIndex(index int) string {
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
 
-	return m.notes[index].noteId
-}
-
-func (m *NotesModel) getNoteIds() []string {
-	nodeIds := make([]string, len(m.notes))
-	for i, n := range m.notes {
-		nodeIds[i] = n.noteId
-	}
-
-	return nodeIds
+	return m.notes[index].note.Id
 }
 
 func (m *NotesModel) GetNoteIds() []string {
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
 
-	return m.getNoteIds()
+	nodeIds := make([]string, len(m.notes))
+	for i, e := range m.notes {
+		nodeIds[i] = e.note.Id
+	}
+
+	return nodeIds
 }
 
 func (m *NotesModel) AddDataChangeListener(listener func()) func() {
 	return m.listeners.AddSlot(listener)
 }
+
+// listener получает изменение до listener'ов AddChangeListener
+func (m *NotesModel) AddChangeListener(listener func(change Change)) func() {
+	return m.changeListeners.AddSlot(listener)
+}
@@ -0,0 +1,125 @@
+package party_model
+
+import (
+	"old-school-rpg-map-editor/utils"
+	"sync"
+)
+
+// Направление взгляда партии. Задаётся в координатах карты(без учёта поворота RotateModel).
+type Direction int
+
+const (
+	North Direction = 0
+	East  Direction = 1
+	South Direction = 2
+	West  Direction = 3
+)
+
+// Вектор единичного шага в направлении d
+func (d Direction) Vector() utils.Int2 {
+	switch d {
+	case North:
+		return utils.NewInt2(0, -1)
+	case East:
+		return utils.NewInt2(1, 0)
+	case South:
+		return utils.NewInt2(0, 1)
+	case West:
+		return utils.NewInt2(-1, 0)
+	}
+
+	panic("incorrect direction")
+}
+
+func (d Direction) TurnClockwise() Direction {
+	return (d + 1) % 4
+}
+
+func (d Direction) TurnCounterclockwise() Direction {
+	return (d + 3) % 4
+}
+
+type Move int
+
+const (
+	Forward     Move = 0
+	Backward    Move = 1
+	StrafeLeft  Move = 2
+	StrafeRight Move = 3
+	TurnLeft    Move = 4
+	TurnRight   Move = 5
+)
+
+// Считает куда попадёт партия после move. Сама модель при этом не меняется.
+func Next(pos utils.Int2, direction Direction, move Move) (utils.Int2, Direction) {
+	step := func(d Direction) utils.Int2 {
+		v := d.Vector()
+		return utils.NewInt2(pos.X+v.X, pos.Y+v.Y)
+	}
+
+	switch move {
+	case Forward:
+		return step(direction), direction
+	case Backward:
+		return step(direction.TurnClockwise().TurnClockwise()), direction
+	case StrafeLeft:
+		return step(direction.TurnCounterclockwise()), direction
+	case StrafeRight:
+		return step(direction.TurnClockwise()), direction
+	case TurnLeft:
+		return pos, direction.TurnCounterclockwise()
+	case TurnRight:
+		return pos, direction.TurnClockwise()
+	}
+
+	panic("incorrect move")
+}
+
+type PartyModel struct {
+	mutex     sync.Mutex
+	pos       utils.Int2
+	direction Direction
+
+	listeners utils.Signal0 // listener'ы на изменение списка
+}
+
+func NewPartyModel(pos utils.Int2, direction Direction) *PartyModel {
+	m := &PartyModel{pos: pos, direction: direction, listeners: utils.NewSignal0()}
+	return m
+}
+
+func (m *PartyModel) Get() (pos utils.Int2, direction Direction) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.pos, m.direction
+}
+
+func (m *PartyModel) Set(pos utils.Int2, direction Direction) {
+	send := func() bool {
+		m.mutex.Lock()
+		defer m.mutex.Unlock()
+
+		if m.pos == pos && m.direction == direction {
+			return false
+		}
+
+		m.pos = pos
+		m.direction = direction
+
+		return true
+	}()
+
+	if send {
+		m.listeners.Emit()
+	}
+}
+
+func (m *PartyModel) Next(move Move) (pos utils.Int2, direction Direction) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return Next(m.pos, m.direction, move)
+}
+
+func (m *PartyModel) AddDataChangeListener(listener func()) func() {
+	return m.listeners.AddSlot(listener)
+}
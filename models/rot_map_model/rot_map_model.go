@@ -30,6 +30,42 @@ func (m *RotMapModel) Model() *map_model.MapModel {
 	return m.model
 }
 
+// Приводит (x, y) к клетке карты(см. map_model.Dimensions.Normalize). Координаты повёрнутые.
+func (m *RotMapModel) NormalizePos(x, y int) (nX, nY int, err error) {
+	m.mutex.Lock()
+	model := m.model
+	rotate := m.rotate
+	m.mutex.Unlock()
+
+	pos, err := model.NormalizePos(rotate.TransformToRot(x, y))
+	if err != nil {
+		return x, y, err
+	}
+
+	nX, nY = rotate.TransformFromRot(pos.X, pos.Y)
+	return nX, nY, nil
+}
+
+// Приводит клетку (x, y) со стеной isRight к карте(см. map_model.Dimensions.NormalizeWall).
+// Координаты повёрнутые.
+func (m *RotMapModel) NormalizeWallPos(x, y int, isRight bool) (nX, nY int, err error) {
+	m.mutex.Lock()
+	model := m.model
+	rotate := m.rotate
+	m.mutex.Unlock()
+
+	rX, rY := rotate.TransformToRot(x, y)
+	rX, rY, rIsRight, _ := rotate.TranslateWallToRot(rX, rY, isRight)
+	pos, err := model.NormalizeWallPos(rX, rY, rIsRight)
+	if err != nil {
+		return x, y, err
+	}
+
+	// заворачивание сдвигает стену на целые размеры карты, сдвиг поворачивается так же, как клетка
+	dX, dY := rotate.TransformFromRot(pos.X-rX, pos.Y-rY)
+	return x + dX, y + dY, nil
+}
+
 func (m *RotMapModel) VisibleFloor(x, y int) (layerUuid uuid.UUID, floor uint32) {
 	m.mutex.Lock()
 	model := m.model
@@ -49,14 +85,14 @@ func (m *RotMapModel) Floor(x, y int, layerIndex int32) uint32 {
 	return model.Floor(x, y, layerIndex)
 }
 
-func (m *RotMapModel) SetFloor(x, y int, layerIndex int32, value uint32) {
+func (m *RotMapModel) SetFloor(x, y int, layerIndex int32, value uint32) error {
 	m.mutex.Lock()
 	model := m.model
 	rotate := m.rotate
 	m.mutex.Unlock()
 
 	x, y = rotate.TransformToRot(x, y)
-	model.SetFloor(x, y, layerIndex, value)
+	return model.SetFloor(x, y, layerIndex, value)
 }
 
 func (m *RotMapModel) VisibleWall(x, y int, isRight bool) (layerUuid uuid.UUID, wall uint32) {
@@ -66,7 +102,7 @@ func (m *RotMapModel) VisibleWall(x, y int, isRight bool) (layerUuid uuid.UUID,
 	m.mutex.Unlock()
 
 	x, y = rotate.TransformToRot(x, y)
-	x, y, isRight = rotate.TranslateWallToRot(x, y, isRight)
+	x, y, isRight, _ = rotate.TranslateWallToRot(x, y, isRight)
 
 	return model.VisibleWall(x, y, isRight)
 }
@@ -78,21 +114,70 @@ func (m *RotMapModel) Wall(x, y int, layerIndex int32, isRight bool) (wall uint3
 	m.mutex.Unlock()
 
 	x, y = rotate.TransformToRot(x, y)
-	x, y, isRight = rotate.TranslateWallToRot(x, y, isRight)
+	x, y, isRight, _ = rotate.TranslateWallToRot(x, y, isRight)
 
 	return model.Wall(x, y, layerIndex, isRight)
 }
 
-func (m *RotMapModel) SetWall(x, y int, layerIndex int32, isRight bool, value uint32) {
+func (m *RotMapModel) SetWall(x, y int, layerIndex int32, isRight bool, value uint32) error {
 	m.mutex.Lock()
 	model := m.model
 	rotate := m.rotate
 	m.mutex.Unlock()
 
 	x, y = rotate.TransformToRot(x, y)
-	x, y, isRight = rotate.TranslateWallToRot(x, y, isRight)
+	x, y, isRight, _ = rotate.TranslateWallToRot(x, y, isRight)
 
-	model.SetWall(x, y, layerIndex, isRight, value)
+	return model.SetWall(x, y, layerIndex, isRight, value)
+}
+
+func (m *RotMapModel) VisibleWallKind(x, y int, isRight bool) (layerUuid uuid.UUID, kind map_model.WallKind) {
+	m.mutex.Lock()
+	model := m.model
+	rotate := m.rotate
+	m.mutex.Unlock()
+
+	x, y = rotate.TransformToRot(x, y)
+	x, y, isRight, reversed := rotate.TranslateWallToRot(x, y, isRight)
+
+	layerUuid, kind = model.VisibleWallKind(x, y, isRight)
+	if reversed {
+		kind = kind.Reversed()
+	}
+
+	return layerUuid, kind
+}
+
+func (m *RotMapModel) WallKind(x, y int, layerIndex int32, isRight bool) map_model.WallKind {
+	m.mutex.Lock()
+	model := m.model
+	rotate := m.rotate
+	m.mutex.Unlock()
+
+	x, y = rotate.TransformToRot(x, y)
+	x, y, isRight, reversed := rotate.TranslateWallToRot(x, y, isRight)
+
+	kind := model.WallKind(x, y, layerIndex, isRight)
+	if reversed {
+		kind = kind.Reversed()
+	}
+
+	return kind
+}
+
+func (m *RotMapModel) SetWallKind(x, y int, layerIndex int32, isRight bool, value map_model.WallKind) error {
+	m.mutex.Lock()
+	model := m.model
+	rotate := m.rotate
+	m.mutex.Unlock()
+
+	x, y = rotate.TransformToRot(x, y)
+	x, y, isRight, reversed := rotate.TranslateWallToRot(x, y, isRight)
+	if reversed {
+		value = value.Reversed()
+	}
+
+	return model.SetWallKind(x, y, layerIndex, isRight, value)
 }
 
 func (m *RotMapModel) VisibleNoteId(x, y int) (layerUuid uuid.UUID, noteId string) {
@@ -114,14 +199,101 @@ func (m *RotMapModel) NoteId(x, y int, layerIndex int32) string {
 	return model.NoteId(x, y, layerIndex)
 }
 
-func (m *RotMapModel) SetNoteId(x, y int, layerIndex int32, value string) {
+func (m *RotMapModel) SetNoteId(x, y int, layerIndex int32, value string) error {
+	m.mutex.Lock()
+	model := m.model
+	rotate := m.rotate
+	m.mutex.Unlock()
+
+	x, y = rotate.TransformToRot(x, y)
+	return model.SetNoteId(x, y, layerIndex, value)
+}
+
+func (m *RotMapModel) VisibleMarkers(x, y int) (layerUuid uuid.UUID, markers []map_model.Marker) {
+	m.mutex.Lock()
+	model := m.model
+	rotate := m.rotate
+	m.mutex.Unlock()
+
+	return model.VisibleMarkers(rotate.TransformToRot(x, y))
+}
+
+func (m *RotMapModel) Markers(x, y int, layerIndex int32) []map_model.Marker {
+	m.mutex.Lock()
+	model := m.model
+	rotate := m.rotate
+	m.mutex.Unlock()
+
+	x, y = rotate.TransformToRot(x, y)
+	return model.Markers(x, y, layerIndex)
+}
+
+func (m *RotMapModel) SetMarkers(x, y int, layerIndex int32, value []map_model.Marker) error {
+	m.mutex.Lock()
+	model := m.model
+	rotate := m.rotate
+	m.mutex.Unlock()
+
+	x, y = rotate.TransformToRot(x, y)
+	return model.SetMarkers(x, y, layerIndex, value)
+}
+
+func (m *RotMapModel) VisibleLink(x, y int) (layerUuid uuid.UUID, link *map_model.Link) {
+	m.mutex.Lock()
+	model := m.model
+	rotate := m.rotate
+	m.mutex.Unlock()
+
+	return model.VisibleLink(rotate.TransformToRot(x, y))
+}
+
+func (m *RotMapModel) Link(x, y int, layerIndex int32) *map_model.Link {
+	m.mutex.Lock()
+	model := m.model
+	rotate := m.rotate
+	m.mutex.Unlock()
+
+	x, y = rotate.TransformToRot(x, y)
+	return model.Link(x, y, layerIndex)
+}
+
+func (m *RotMapModel) SetLink(x, y int, layerIndex int32, value *map_model.Link) error {
 	m.mutex.Lock()
 	model := m.model
 	rotate := m.rotate
 	m.mutex.Unlock()
 
 	x, y = rotate.TransformToRot(x, y)
-	model.SetNoteId(x, y, layerIndex, value)
+	return model.SetLink(x, y, layerIndex, value)
+}
+
+func (m *RotMapModel) VisibleEffects(x, y int) map_model.Effects {
+	m.mutex.Lock()
+	model := m.model
+	rotate := m.rotate
+	m.mutex.Unlock()
+
+	return model.VisibleEffects(rotate.TransformToRot(x, y))
+}
+
+func (m *RotMapModel) Effects(x, y int, layerIndex int32) map_model.Effects {
+	m.mutex.Lock()
+	model := m.model
+	rotate := m.rotate
+	m.mutex.Unlock()
+
+	x, y = rotate.TransformToRot(x, y)
+	return model.Effects(x, y, layerIndex)
+}
+
+func (m *RotMapModel) SetEffects(x, y int, layerIndex int32, value map_model.Effects) error {
+	m.mutex.Lock()
+	model := m.model
+	rotate := m.rotate
+	m.mutex.Unlock()
+
+	x, y = rotate.TransformToRot(x, y)
+	return model.SetEffects(x, y, layerIndex, value)
 }
 
 func (m *RotMapModel) Bounds(layerIndex int32) (leftTop, rightBottom utils.Int2) {
@@ -150,7 +322,7 @@ func (m *RotMapModel) Bounds(layerIndex int32) (leftTop, rightBottom utils.Int2)
 	return leftTop, rightBottom
 }
 
-func (m *RotMapModel) MoveTo(layerIndex int32, offsetX, offsetY int) {
+func (m *RotMapModel) MoveTo(layerIndex int32, offsetX, offsetY int) error {
 	m.mutex.Lock()
 	model := m.model
 	rotate := m.rotate
@@ -158,9 +330,146 @@ func (m *RotMapModel) MoveTo(layerIndex int32, offsetX, offsetY int) {
 
 	offsetX, offsetY = rotate.TransformToRot(offsetX, offsetY)
 
-	model.MoveTo(layerIndex, offsetX, offsetY)
+	return model.MoveTo(layerIndex, offsetX, offsetY)
 }
 
 func (m *RotMapModel) AddDataChangeListener(listener func()) func() {
 	return m.listeners.AddSlot(listener)
 }
+
+// См. map_model.MapModel.AddChangeListener, клетки в повёрнутых координатах. Поворот в изменения
+// не попадает, см. rotate_model.RotateModel.AddDataChangeListener.
+func (m *RotMapModel) AddChangeListener(listener func(change map_model.Change)) func() {
+	m.mutex.Lock()
+	model := m.model
+	rotate := m.rotate
+	m.mutex.Unlock()
+
+	return model.AddChangeListener(func(change map_model.Change) {
+		change.Cells = rotate.TransformRegionFromRot(change.Cells)
+		listener(change)
+	})
+}
+
+// Транзакция RotMapModel.Edit, координаты повёрнутые
+type Tx struct {
+	tx     *map_model.Tx
+	rotate *rotate_model.RotateModel
+}
+
+// См. map_model.MapModel.Edit
+func (m *RotMapModel) Edit(edit func(t *Tx)) (map[map_model.LayerCell]map_model.LocationEdit, error) {
+	m.mutex.Lock()
+	model := m.model
+	rotate := m.rotate
+	m.mutex.Unlock()
+
+	return model.Edit(func(t *map_model.Tx) {
+		edit(&Tx{tx: t, rotate: rotate})
+	})
+}
+
+// Меняет клетку (x, y) слоя layerIndex через f
+func (t *Tx) update(x, y int, layerIndex int32, f func(location *map_model.Location)) {
+	location := t.tx.Location(x, y, layerIndex)
+	f(&location)
+	t.tx.SetLocation(x, y, layerIndex, location)
+}
+
+func (t *Tx) Floor(x, y int, layerIndex int32) uint32 {
+	x, y = t.rotate.TransformToRot(x, y)
+	return t.tx.Location(x, y, layerIndex).Floor
+}
+
+func (t *Tx) SetFloor(x, y int, layerIndex int32, value uint32) {
+	x, y = t.rotate.TransformToRot(x, y)
+	t.update(x, y, layerIndex, func(location *map_model.Location) {
+		location.Floor = value
+	})
+}
+
+func (t *Tx) Link(x, y int, layerIndex int32) *map_model.Link {
+	x, y = t.rotate.TransformToRot(x, y)
+	return t.tx.Location(x, y, layerIndex).Link
+}
+
+func (t *Tx) SetLink(x, y int, layerIndex int32, value *map_model.Link) {
+	x, y = t.rotate.TransformToRot(x, y)
+	t.update(x, y, layerIndex, func(location *map_model.Location) {
+		location.Link = value
+	})
+}
+
+func (t *Tx) NoteId(x, y int, layerIndex int32) string {
+	x, y = t.rotate.TransformToRot(x, y)
+	return t.tx.Location(x, y, layerIndex).NoteId
+}
+
+func (t *Tx) SetNoteId(x, y int, layerIndex int32, value string) {
+	x, y = t.rotate.TransformToRot(x, y)
+	t.update(x, y, layerIndex, func(location *map_model.Location) {
+		location.NoteId = value
+	})
+}
+
+func (t *Tx) Markers(x, y int, layerIndex int32) []map_model.Marker {
+	x, y = t.rotate.TransformToRot(x, y)
+	return t.tx.Location(x, y, layerIndex).Markers
+}
+
+// См. map_model.MapModel.SetMarkers
+func (t *Tx) SetMarkers(x, y int, layerIndex int32, value []map_model.Marker) {
+	if len(value) == 0 {
+		value = nil
+	}
+
+	x, y = t.rotate.TransformToRot(x, y)
+	t.update(x, y, layerIndex, func(location *map_model.Location) {
+		location.Markers = value
+	})
+}
+
+func (t *Tx) Effects(x, y int, layerIndex int32) map_model.Effects {
+	x, y = t.rotate.TransformToRot(x, y)
+	return t.tx.Location(x, y, layerIndex).Effects
+}
+
+func (t *Tx) SetEffects(x, y int, layerIndex int32, value map_model.Effects) {
+	x, y = t.rotate.TransformToRot(x, y)
+	t.update(x, y, layerIndex, func(location *map_model.Location) {
+		location.Effects = value
+	})
+}
+
+func (t *Tx) Wall(x, y int, layerIndex int32, isRight bool) (wall uint32, kind map_model.WallKind) {
+	x, y = t.rotate.TransformToRot(x, y)
+	x, y, isRight, reversed := t.rotate.TranslateWallToRot(x, y, isRight)
+
+	location := t.tx.Location(x, y, layerIndex)
+	if isRight {
+		wall, kind = location.RightWall, location.RightWallKind
+	} else {
+		wall, kind = location.BottomWall, location.BottomWallKind
+	}
+	if reversed {
+		kind = kind.Reversed()
+	}
+
+	return wall, kind
+}
+
+func (t *Tx) SetWall(x, y int, layerIndex int32, isRight bool, value uint32, kind map_model.WallKind) {
+	x, y = t.rotate.TransformToRot(x, y)
+	x, y, isRight, reversed := t.rotate.TranslateWallToRot(x, y, isRight)
+	if reversed {
+		kind = kind.Reversed()
+	}
+
+	t.update(x, y, layerIndex, func(location *map_model.Location) {
+		if isRight {
+			location.RightWall, location.RightWallKind = value, kind
+		} else {
+			location.BottomWall, location.BottomWallKind = value, kind
+		}
+	})
+}
@@ -45,7 +45,7 @@ func (m *RotSelectModel) SelectWall(x int, y int, isRight bool) {
 	m.mutex.Unlock()
 
 	x, y = rotate.TransformToRot(x, y)
-	x, y, isRight = rotate.TranslateWallToRot(x, y, isRight)
+	x, y, isRight, _ = rotate.TranslateWallToRot(x, y, isRight)
 
 	model.SelectWall(x, y, isRight)
 }
@@ -67,7 +67,7 @@ func (m *RotSelectModel) UnselectWall(x int, y int, isRight bool) {
 	m.mutex.Unlock()
 
 	x, y = rotate.TransformToRot(x, y)
-	x, y, isRight = rotate.TranslateWallToRot(x, y, isRight)
+	x, y, isRight, _ = rotate.TranslateWallToRot(x, y, isRight)
 	model.UnselectWall(x, y, isRight)
 }
 
@@ -88,10 +88,50 @@ func (m *RotSelectModel) IsWallSelected(x int, y int, isRight bool) bool {
 	m.mutex.Unlock()
 
 	x, y = rotate.TransformToRot(x, y)
-	x, y, isRight = rotate.TranslateWallToRot(x, y, isRight)
+	x, y, isRight, _ = rotate.TranslateWallToRot(x, y, isRight)
 	return model.IsWallSelected(x, y, isRight)
 }
 
+func (m *RotSelectModel) SelectMarker(x int, y int, index int) {
+	m.mutex.Lock()
+	model := m.model
+	rotate := m.rotate
+	m.mutex.Unlock()
+
+	x, y = rotate.TransformToRot(x, y)
+	model.SelectMarker(x, y, index)
+}
+
+func (m *RotSelectModel) UnselectMarker(x int, y int, index int) {
+	m.mutex.Lock()
+	model := m.model
+	rotate := m.rotate
+	m.mutex.Unlock()
+
+	x, y = rotate.TransformToRot(x, y)
+	model.UnselectMarker(x, y, index)
+}
+
+func (m *RotSelectModel) IsMarkerSelected(x int, y int, index int) bool {
+	m.mutex.Lock()
+	model := m.model
+	rotate := m.rotate
+	m.mutex.Unlock()
+
+	x, y = rotate.TransformToRot(x, y)
+	return model.IsMarkerSelected(x, y, index)
+}
+
+func (m *RotSelectModel) SelectedMarkers(x int, y int) uint32 {
+	m.mutex.Lock()
+	model := m.model
+	rotate := m.rotate
+	m.mutex.Unlock()
+
+	x, y = rotate.TransformToRot(x, y)
+	return model.SelectedMarkers(x, y)
+}
+
 func (m *RotSelectModel) Bounds() (leftTop, rightBottom utils.Int2) {
 	m.mutex.Lock()
 	model := m.model
@@ -128,8 +168,9 @@ func (m *RotSelectModel) At(x, y int) select_model.Selected {
 
 	var selected select_model.Selected
 	selected.Floor = model.At(x, y).Floor
+	selected.Markers = model.At(x, y).Markers
 	{
-		x, y, isRight := rotate.TranslateWallToRot(x, y, true)
+		x, y, isRight, _ := rotate.TranslateWallToRot(x, y, true)
 		at := model.At(x, y)
 		if isRight {
 			selected.RightWall = at.RightWall
@@ -138,7 +179,7 @@ func (m *RotSelectModel) At(x, y int) select_model.Selected {
 		}
 	}
 	{
-		x, y, isRight := rotate.TranslateWallToRot(x, y, false)
+		x, y, isRight, _ := rotate.TranslateWallToRot(x, y, false)
 		at := model.At(x, y)
 		if isRight {
 			selected.BottomWall = at.RightWall
@@ -164,3 +205,16 @@ func (m *RotSelectModel) MoveTo(offsetX, offsetY int) {
 func (m *RotSelectModel) AddDataChangeListener(listener func()) func() {
 	return m.listeners.AddSlot(listener)
 }
+
+// См. select_model.SelectModel.AddChangeListener, клетки в повёрнутых координатах
+func (m *RotSelectModel) AddChangeListener(listener func(change select_model.Change)) func() {
+	m.mutex.Lock()
+	model := m.model
+	rotate := m.rotate
+	m.mutex.Unlock()
+
+	return model.AddChangeListener(func(change select_model.Change) {
+		change.Cells = rotate.TransformRegionFromRot(change.Cells)
+		listener(change)
+	})
+}
@@ -34,7 +34,11 @@ func (m *RotateModel) transformToRot(x, y int) (tX, tY int) {
 	panic("incorrect angle")
 }
 
-func (m *RotateModel) translateWallToRot(x, y int, isRight bool) (tX, tY int, tIsRight bool) {
+// reversed - направление "вперёд" у стены(в сторону увеличения x или y, см. map_model.WallKind)
+// после поворота стало направлением "назад"
+func (m *RotateModel) translateWallToRot(x, y int, isRight bool) (tX, tY int, tIsRight bool, reversed bool) {
+	reversed = (m.angle == 90 && isRight) || m.angle == 180 || (m.angle == 270 && !isRight)
+
 	if m.angle == 90 {
 		if isRight {
 			isRight = false
@@ -57,7 +61,7 @@ func (m *RotateModel) translateWallToRot(x, y int, isRight bool) (tX, tY int, tI
 		}
 	}
 
-	return x, y, isRight
+	return x, y, isRight, reversed
 }
 
 func (m *RotateModel) transformFromRot(x, y int) (tX, tY int) {
@@ -80,7 +84,7 @@ func (m *RotateModel) TransformToRot(x, y int) (tX, tY int) {
 	return m.transformToRot(x, y)
 }
 
-func (m *RotateModel) TranslateWallToRot(x, y int, isRight bool) (tX, tY int, tIsRight bool) {
+func (m *RotateModel) TranslateWallToRot(x, y int, isRight bool) (tX, tY int, tIsRight bool, reversed bool) {
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
 	return m.translateWallToRot(x, y, isRight)
@@ -92,6 +96,52 @@ func (m *RotateModel) TransformFromRot(x, y int) (tX, tY int) {
 	return m.transformFromRot(x, y)
 }
 
+// Область клеток r в повёрнутых координатах
+func (m *RotateModel) TransformRegionFromRot(r utils.Region) utils.Region {
+	if r.All || r.IsEmpty() {
+		return r
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	minX, minY := m.transformFromRot(r.Min.X, r.Min.Y)
+	maxX, maxY := m.transformFromRot(r.Max.X-1, r.Max.Y-1)
+
+	return utils.NewRegion(utils.NewInt2(utils.Min(minX, maxX), utils.Min(minY, maxY)), utils.NewInt2(utils.Max(minX, maxX)+1, utils.Max(minY, maxY)+1))
+}
+
+func (m *RotateModel) Angle() int {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.angle
+}
+
+// angle должен быть кратен 90
+func (m *RotateModel) SetAngle(angle int) {
+	angle = (angle%360 + 360) % 360
+
+	m.mutex.Lock()
+	same := m.angle == angle
+	m.mutex.Unlock()
+
+	if same {
+		return
+	}
+
+	m.beforeRotateListeners.Emit()
+
+	func() {
+		m.mutex.Lock()
+		defer m.mutex.Unlock()
+
+		m.angle = angle
+	}()
+
+	m.listeners.Emit()
+	m.afterRotateListeners.Emit()
+}
+
 func (m *RotateModel) RotateClockwise() {
 	m.beforeRotateListeners.Emit()
 
@@ -14,6 +14,12 @@ type Selected struct {
 	Floor      bool
 	RightWall  bool
 	BottomWall bool
+	Markers    uint32 // отдельно выделенные отметки клетки, бит на индекс отметки. С Floor выделены все отметки
+}
+
+// Изменение выделения для listener'ов AddChangeListener
+type Change struct {
+	Cells utils.Region // клетки, у которых изменилось выделение
 }
 
 type SelectModel struct {
@@ -22,7 +28,8 @@ type SelectModel struct {
 	mapModel           *map_model.MapModel
 	selectedLayerModel *selected_layer_model.SelectedLayerModel
 
-	listeners utils.Signal0 // listener'ы на изменение списка
+	listeners       utils.Signal0 // listener'ы на изменение списка
+	changeListeners utils.Signal1[Change]
 }
 
 func NewSelectModel(mapModel *map_model.MapModel, selectedLayerModel *selected_layer_model.SelectedLayerModel) *SelectModel {
@@ -34,19 +41,30 @@ func NewSelectModel(mapModel *map_model.MapModel, selectedLayerModel *selected_l
 }
 
 func (m *SelectModel) Clear() {
+	var change Change
+
 	func() {
 		m.mutex.Lock()
 		defer m.mutex.Unlock()
 
+		change.Cells = utils.NewRegion(m.bounds())
+
 		m.selected = make(map[utils.Int2]Selected)
 	}()
 
+	m.emit(change)
+}
+
+// Сообщает listener'ам об изменении
+func (m *SelectModel) emit(change Change) {
+	m.changeListeners.Emit(change)
 	m.listeners.Emit()
 }
 
 func (m *SelectModel) selectFloor(x int, y int) bool {
-	v := m.mapModel.Floor(x, y, m.selectedLayerModel.Selected())
-	if v > 0 {
+	// вместе с floor выделяются и остальные свойства клетки
+	v := m.mapModel.Location(x, y, m.selectedLayerModel.Selected())
+	if v.Floor > 0 || v.Link != nil || v.Effects != 0 || len(v.Markers) > 0 {
 		pos := utils.NewInt2(x, y)
 
 		selected := m.selected[pos]
@@ -68,7 +86,7 @@ func (m *SelectModel) SelectFloor(x int, y int) {
 	}()
 
 	if send {
-		m.listeners.Emit()
+		m.emit(Change{Cells: utils.NewCellRegion(x, y)})
 	}
 }
 
@@ -106,15 +124,77 @@ func (m *SelectModel) SelectWall(x int, y int, isRight bool) {
 	}()
 
 	if send {
-		m.listeners.Emit()
+		m.emit(Change{Cells: utils.NewCellRegion(x, y)})
+	}
+}
+
+func (m *SelectModel) selectMarker(x int, y int, index int) bool {
+	markers := m.mapModel.Markers(x, y, m.selectedLayerModel.Selected())
+	if index < 0 || index >= len(markers) {
+		return false
+	}
+
+	pos := utils.NewInt2(x, y)
+
+	selected := m.selected[pos]
+	selected.Markers |= 1 << index
+	m.selected[pos] = selected
+
+	return true
+}
+
+// Выделяет одну отметку клетки по её индексу
+func (m *SelectModel) SelectMarker(x int, y int, index int) {
+	send := func() bool {
+		m.mutex.Lock()
+		defer m.mutex.Unlock()
+
+		return m.selectMarker(x, y, index)
+	}()
+
+	if send {
+		m.emit(Change{Cells: utils.NewCellRegion(x, y)})
+	}
+}
+
+// Выделяет клетки выбранного слоя, у которых есть хотя бы один из effects
+func (m *SelectModel) SelectByEffects(effects map_model.Effects) {
+	var change Change
+
+	send := func() bool {
+		m.mutex.Lock()
+		defer m.mutex.Unlock()
+
+		changed := false
+
+		for pos, location := range m.mapModel.Locations(m.selectedLayerModel.Selected()) {
+			if location.Effects&effects != 0 && !m.at(pos.X, pos.Y).Floor {
+				selected := m.selected[pos]
+				selected.Floor = true
+				m.selected[pos] = selected
+
+				change.Cells = change.Cells.Union(utils.NewCellRegion(pos.X, pos.Y))
+				changed = true
+			}
+		}
+
+		return changed
+	}()
+
+	if send {
+		m.emit(change)
 	}
 }
 
 func (m *SelectModel) UnselectAll() {
+	var change Change
+
 	send := func() bool {
 		m.mutex.Lock()
 		defer m.mutex.Unlock()
 
+		change.Cells = utils.NewRegion(m.bounds())
+
 		l := len(m.selected)
 		if l > 0 {
 			maps.Clear(m.selected)
@@ -125,12 +205,12 @@ func (m *SelectModel) UnselectAll() {
 	}()
 
 	if send {
-		m.listeners.Emit()
+		m.emit(change)
 	}
 }
 
 func isEmptySelected(s Selected) bool {
-	return !s.Floor && !s.RightWall && !s.BottomWall
+	return !s.Floor && !s.RightWall && !s.BottomWall && s.Markers == 0
 }
 
 func (m *SelectModel) unselectFloor(x int, y int) bool {
@@ -160,7 +240,7 @@ func (m *SelectModel) UnselectFloor(x int, y int) {
 	}()
 
 	if send {
-		m.listeners.Emit()
+		m.emit(Change{Cells: utils.NewCellRegion(x, y)})
 	}
 }
 
@@ -195,7 +275,38 @@ func (m *SelectModel) UnselectWall(x int, y int, isRight bool) {
 	}()
 
 	if send {
-		m.listeners.Emit()
+		m.emit(Change{Cells: utils.NewCellRegion(x, y)})
+	}
+}
+
+func (m *SelectModel) unselectMarker(x int, y int, index int) bool {
+	pos := utils.NewInt2(x, y)
+
+	v, exists := m.selected[pos]
+	if exists {
+		v.Markers &^= 1 << index
+		m.selected[pos] = v
+
+		if isEmptySelected(v) {
+			delete(m.selected, pos)
+		}
+
+		return true
+	}
+
+	return false
+}
+
+func (m *SelectModel) UnselectMarker(x int, y int, index int) {
+	send := func() bool {
+		m.mutex.Lock()
+		defer m.mutex.Unlock()
+
+		return m.unselectMarker(x, y, index)
+	}()
+
+	if send {
+		m.emit(Change{Cells: utils.NewCellRegion(x, y)})
 	}
 }
 
@@ -223,6 +334,22 @@ func (m *SelectModel) IsWallSelected(x int, y int, isRight bool) bool {
 	}
 }
 
+func (m *SelectModel) IsMarkerSelected(x int, y int, index int) bool {
+	return m.SelectedMarkers(x, y)&(1<<index) != 0
+}
+
+// Биты выделенных отметок клетки. Если выделен floor, выделены все отметки
+func (m *SelectModel) SelectedMarkers(x int, y int) uint32 {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	v := m.at(x, y)
+	if v.Floor {
+		return math.MaxUint32
+	}
+	return v.Markers
+}
+
 func (m *SelectModel) bounds() (leftTop, rightBottom utils.Int2) {
 	leftTop = utils.NewInt2(math.MaxInt32, math.MaxInt32)
 	rightBottom = utils.NewInt2(math.MinInt32, math.MinInt32)
@@ -281,10 +408,11 @@ func (m *SelectModel) At(x, y int) Selected {
 	return m.at(x, y)
 }
 
-func (m *SelectModel) moveTo(offsetX, offsetY int) bool {
+// Сдвигает выделение, возвращает клетки, у которых изменилось выделение
+func (m *SelectModel) moveTo(offsetX, offsetY int) (utils.Region, bool) {
 	leftTop, rightBottom := m.bounds()
 	if leftTop == rightBottom {
-		return false
+		return utils.Region{}, false
 	}
 
 	newSelected := make(map[utils.Int2]Selected)
@@ -298,19 +426,23 @@ func (m *SelectModel) moveTo(offsetX, offsetY int) bool {
 
 	m.selected = newSelected
 
-	return true
+	return utils.NewRegion(leftTop, rightBottom).Union(utils.NewRegion(m.bounds())), true
 }
 
 func (m *SelectModel) MoveTo(offsetX, offsetY int) {
+	var change Change
+
 	send := func() bool {
 		m.mutex.Lock()
 		defer m.mutex.Unlock()
 
-		return m.moveTo(offsetX, offsetY)
+		var moved bool
+		change.Cells, moved = m.moveTo(offsetX, offsetY)
+		return moved
 	}()
 
 	if send {
-		m.listeners.Emit()
+		m.emit(change)
 	}
 }
 
@@ -318,6 +450,11 @@ func (m *SelectModel) AddDataChangeListener(listener func()) func() {
 	return m.listeners.AddSlot(listener)
 }
 
+// listener получает изменение до listener'ов AddDataChangeListener
+func (m *SelectModel) AddChangeListener(listener func(change Change)) func() {
+	return m.changeListeners.AddSlot(listener)
+}
+
 func (m *SelectModel) Selected() map[utils.Int2]Selected {
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
@@ -326,16 +463,22 @@ func (m *SelectModel) Selected() map[utils.Int2]Selected {
 }
 
 func (m *SelectModel) SetSelected(selected map[utils.Int2]Selected) {
+	var change Change
+
 	send := func() bool {
 		m.mutex.Lock()
 		defer m.mutex.Unlock()
 
+		change.Cells = utils.NewRegion(m.bounds())
+
 		m.selected = maps.Clone(selected)
 
+		change.Cells = change.Cells.Union(utils.NewRegion(m.bounds()))
+
 		return true
 	}()
 
 	if send {
-		m.listeners.Emit()
+		m.emit(change)
 	}
 }
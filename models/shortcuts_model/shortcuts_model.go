@@ -21,6 +21,14 @@ const (
 
 	RotateMapClockwise        ShortcutType = "Rotate the map clockwise"
 	RotateMapCounterClockwise ShortcutType = "Rotate the map counterclockwise"
+
+	PartyForward     ShortcutType = "Move the party forward"
+	PartyBackward    ShortcutType = "Move the party backward"
+	PartyStrafeLeft  ShortcutType = "Strafe the party left"
+	PartyStrafeRight ShortcutType = "Strafe the party right"
+	PartyTurnLeft    ShortcutType = "Turn the party left"
+	PartyTurnRight   ShortcutType = "Turn the party right"
+	PartyFollowLink  ShortcutType = "Follow the link under the party"
 )
 
 var modifiers = map[string]string{
@@ -82,6 +90,14 @@ func NewShortcutsModel() *ShortcutsModel {
 
 			RotateMapClockwise:        {"E"},
 			RotateMapCounterClockwise: {"Q"},
+
+			PartyForward:     {"Up"},
+			PartyBackward:    {"Down"},
+			PartyStrafeLeft:  {","},
+			PartyStrafeRight: {"."},
+			PartyTurnLeft:    {"Left"},
+			PartyTurnRight:   {"Right"},
+			PartyFollowLink:  {"Return"},
 		},
 	}
 }
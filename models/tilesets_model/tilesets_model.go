@@ -0,0 +1,104 @@
+package tilesets_model
+
+import (
+	"fmt"
+	"old-school-rpg-map-editor/common/tileset"
+	"old-school-rpg-map-editor/utils"
+	"sync"
+)
+
+// Доступные наборы тайлов: набор по умолчанию и наборы из директории настроек
+type TilesetsModel struct {
+	mutex          sync.Mutex
+	dir            string
+	defaultTileset *tileset.Tileset
+	tilesets       []*tileset.Tileset
+	decoded        map[*tileset.Tileset]tileset.Decoded
+
+	listeners utils.Signal0 // listener'ы на изменение списка
+}
+
+func NewTilesetsModel(defaultTileset *tileset.Tileset, dir string) (*TilesetsModel, error) {
+	decoded, err := defaultTileset.Decode()
+	if err != nil {
+		return nil, err
+	}
+
+	return &TilesetsModel{
+		dir:            dir,
+		defaultTileset: defaultTileset,
+		decoded:        map[*tileset.Tileset]tileset.Decoded{defaultTileset: decoded},
+	}, nil
+}
+
+// Директория пользовательских наборов
+func (m *TilesetsModel) Dir() string {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	return m.dir
+}
+
+// Перечитывает наборы из директории. Наборы, которые не загрузились, пропускаются.
+func (m *TilesetsModel) Reload() error {
+	tilesets, err := tileset.LoadAll(m.Dir())
+
+	func() {
+		m.mutex.Lock()
+		defer m.mutex.Unlock()
+
+		m.tilesets = tilesets
+	}()
+
+	m.listeners.Emit()
+
+	return err
+}
+
+func (m *TilesetsModel) Default() *tileset.Tileset {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	return m.defaultTileset
+}
+
+// Все наборы, первый - набор по умолчанию
+func (m *TilesetsModel) Tilesets() []*tileset.Tileset {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	return append([]*tileset.Tileset{m.defaultTileset}, m.tilesets...)
+}
+
+// Набор карты и его картинки. Если набора нет(например, карту открыли на другом компьютере)
+// или он битый, то возвращается набор по умолчанию.
+func (m *TilesetsModel) Get(ref tileset.Ref) (*tileset.Tileset, tileset.Decoded) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	t := ref.Embedded
+	if t == nil && len(ref.Name) > 0 {
+		t = tileset.Find(append([]*tileset.Tileset{m.defaultTileset}, m.tilesets...), ref.Name)
+	}
+	if t == nil {
+		t = m.defaultTileset
+	}
+
+	decoded, exists := m.decoded[t]
+	if !exists {
+		var err error
+		decoded, err = t.Decode()
+		if err != nil {
+			// TODO
+			fmt.Println(err)
+			return m.defaultTileset, m.decoded[m.defaultTileset]
+		}
+		m.decoded[t] = decoded
+	}
+
+	return t, decoded
+}
+
+func (m *TilesetsModel) AddDataChangeListener(listener func()) func() {
+	return m.listeners.AddSlot(listener)
+}
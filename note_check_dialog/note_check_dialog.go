@@ -0,0 +1,243 @@
+package note_check_dialog
+
+import (
+	"fmt"
+	"old-school-rpg-map-editor/common"
+	"old-school-rpg-map-editor/common/validate"
+	"old-school-rpg-map-editor/models/maps_model"
+	"old-school-rpg-map-editor/models/notes_model"
+	"old-school-rpg-map-editor/models/rot_map_model"
+	"old-school-rpg-map-editor/undo_redo"
+	"strings"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+	"github.com/google/uuid"
+	"golang.org/x/exp/slices"
+)
+
+var _ dialog.Dialog = noteCheckDialog{}
+
+// Сверка заметок с клетками карты и исправления, которые можно отменить через Undo
+type noteCheckDialog struct {
+	dialog.Dialog
+	parent fyne.Window
+}
+
+func reportText(report validate.NotesReport) string {
+	if report.IsEmpty() {
+		return "No problems"
+	}
+
+	var b strings.Builder
+
+	if len(report.Dangling) > 0 {
+		fmt.Fprintf(&b, "Cells with notes that do not exist (%d):\n", len(report.Dangling))
+		for _, ref := range report.Dangling {
+			fmt.Fprintf(&b, "    %s: layer %d (%d, %d)\n", ref.NoteId, ref.Cell.LayerIndex, ref.Cell.Pos.X, ref.Cell.Pos.Y)
+		}
+	}
+
+	if len(report.Unused) > 0 {
+		fmt.Fprintf(&b, "Notes not on map (%d):\n    %s\n", len(report.Unused), strings.Join(report.Unused, ", "))
+	}
+
+	if len(report.Duplicates) > 0 {
+		fmt.Fprintf(&b, "Notes that differ only in case (%d):\n", len(report.Duplicates))
+		for _, noteIds := range report.Duplicates {
+			fmt.Fprintf(&b, "    %s\n", strings.Join(noteIds, ", "))
+		}
+	}
+
+	return strings.TrimSpace(b.String())
+}
+
+// Убирает из клеток и их отметок id несуществующих заметок. Сами отметки остаются
+func removeDanglingAction(mapElem maps_model.MapElem, report validate.NotesReport) undo_redo.UndoRedoAction {
+	refs := report.Dangling
+	rotateModel := mapElem.RotateModel
+
+	return undo_redo.NewEditAction(func(t *rot_map_model.Tx) {
+		for _, ref := range refs {
+			x, y := rotateModel.TransformFromRot(ref.Cell.Pos.X, ref.Cell.Pos.Y)
+			if t.NoteId(x, y, ref.Cell.LayerIndex) == ref.NoteId {
+				t.SetNoteId(x, y, ref.Cell.LayerIndex, "")
+			}
+
+			markers := slices.Clone(t.Markers(x, y, ref.Cell.LayerIndex))
+			for i := range markers {
+				if markers[i].NoteId == ref.NoteId {
+					markers[i].NoteId = ""
+				}
+			}
+			t.SetMarkers(x, y, ref.Cell.LayerIndex, markers)
+		}
+	})
+}
+
+// Добавляет пустые заметки для id, которые стоят в клетках. Id, которые не могут быть id
+// заметки, остаются как есть
+func createMissingAction(mapElem maps_model.MapElem, report validate.NotesReport) undo_redo.UndoRedoAction {
+	var notes []notes_model.Note
+	created := time.Now().Truncate(time.Second)
+	for _, noteId := range report.DanglingIds() {
+		if notes_model.ValidateNoteId(noteId) == nil {
+			notes = append(notes, notes_model.Note{Id: noteId, Created: created})
+		}
+	}
+
+	return undo_redo.NewUpdateNotesAction(notes, nil)
+}
+
+// Удаляет заметки, которых нет на карте
+func deleteUnusedAction(mapElem maps_model.MapElem, report validate.NotesReport) undo_redo.UndoRedoAction {
+	return undo_redo.NewUpdateNotesAction(nil, slices.Clone(report.Unused))
+}
+
+// Сливает заметки, которые отличаются только регистром, в первую заметку группы: клетки и отметки
+// остальных переходят к ней, их заголовок(если у первой его нет), текст и теги дописываются к ней,
+// а сами они удаляются. Возвращает контейнер, уже сделанный на карте, как контейнеры UI
+func mergeDuplicatesAction(mapElem maps_model.MapElem, report validate.NotesReport) undo_redo.UndoRedoAction {
+	renames := make(map[string]string)
+	var notes []notes_model.Note
+	var deleteIds []string
+	for _, noteIds := range report.Duplicates {
+		note, ok := mapElem.NotesModel.Note(noteIds[0])
+		if !ok {
+			continue
+		}
+
+		for _, noteId := range noteIds[1:] {
+			duplicate, ok := mapElem.NotesModel.Note(noteId)
+			if !ok {
+				continue
+			}
+
+			if len(note.Title) == 0 {
+				note.Title = duplicate.Title
+			}
+			if len(strings.TrimSpace(duplicate.Body)) > 0 {
+				if len(note.Body) > 0 {
+					note.Body += "\n\n"
+				}
+				note.Body += duplicate.Body
+			}
+			for _, tag := range duplicate.Tags {
+				if !slices.Contains(note.Tags, tag) {
+					note.Tags = append(note.Tags, tag)
+				}
+			}
+
+			renames[noteId] = note.Id
+			deleteIds = append(deleteIds, noteId)
+		}
+
+		notes = append(notes, note)
+	}
+
+	noteCells := mapElem.Model.NoteCells()
+	rotateModel := mapElem.RotateModel
+
+	editAction := undo_redo.NewEditAction(func(t *rot_map_model.Tx) {
+		for from, to := range renames {
+			for _, cell := range noteCells[from] {
+				x, y := rotateModel.TransformFromRot(cell.Pos.X, cell.Pos.Y)
+				if t.NoteId(x, y, cell.LayerIndex) == from {
+					t.SetNoteId(x, y, cell.LayerIndex, to)
+				}
+
+				markers := slices.Clone(t.Markers(x, y, cell.LayerIndex))
+				for i := range markers {
+					if markers[i].NoteId == from {
+						markers[i].NoteId = to
+					}
+				}
+				t.SetMarkers(x, y, cell.LayerIndex, markers)
+			}
+		}
+	})
+
+	actionModels := undo_redo.NewUndoRedoActionModels(mapElem.Model, mapElem.RotateModel, mapElem.RotMapModel, mapElem.RotSelectModel, mapElem.SelectModel, mapElem.ModeModel, mapElem.SelectedLayerModel, mapElem.CenterModel, mapElem.PartyModel, mapElem.NotesModel)
+	actions := undo_redo.NewUndoRedoContainer()
+
+	// клетки уже на карте и отметок в них не прибавляется, поэтому правка не может не получиться
+	editAction.Redo(actionModels)
+	actions.Add(editAction)
+
+	updateNotesAction := undo_redo.NewUpdateNotesAction(notes, deleteIds)
+	updateNotesAction.Redo(actionModels)
+	actions.Add(updateNotesAction)
+
+	return actions
+}
+
+func NewNoteCheckDialog(parent fyne.Window, mapsModel *maps_model.MapsModel, mapId uuid.UUID) noteCheckDialog {
+	var report validate.NotesReport
+
+	reportLabel := widget.NewLabel("")
+
+	var removeDangling, createMissing, deleteUnused, mergeDuplicates *widget.Button
+
+	update := func() {
+		mapElem := mapsModel.GetById(mapId)
+		if (mapElem.MapId == uuid.UUID{}) {
+			report = validate.NotesReport{}
+		} else {
+			report = validate.CheckNotes(mapElem.Model, mapElem.NotesModel)
+		}
+
+		reportLabel.SetText(reportText(report))
+
+		for _, b := range []*widget.Button{removeDangling, createMissing} {
+			if len(report.Dangling) > 0 {
+				b.Enable()
+			} else {
+				b.Disable()
+			}
+		}
+		if len(report.Unused) > 0 {
+			deleteUnused.Enable()
+		} else {
+			deleteUnused.Disable()
+		}
+		if len(report.Duplicates) > 0 {
+			mergeDuplicates.Enable()
+		} else {
+			mergeDuplicates.Disable()
+		}
+	}
+
+	fix := func(newAction func(mapElem maps_model.MapElem, report validate.NotesReport) undo_redo.UndoRedoAction) func() {
+		return func() {
+			mapElem := mapsModel.GetById(mapId)
+			if (mapElem.MapId == uuid.UUID{}) {
+				return
+			}
+
+			err := common.MakeAction(newAction(mapElem, report), mapsModel, mapId, nil)
+			if err != nil {
+				dialog.ShowError(err, parent)
+			}
+
+			update()
+		}
+	}
+
+	removeDangling = widget.NewButton("Remove missing notes from cells", fix(removeDanglingAction))
+	createMissing = widget.NewButton("Create missing notes", fix(createMissingAction))
+	deleteUnused = widget.NewButton("Delete notes not on map", fix(deleteUnusedAction))
+	mergeDuplicates = widget.NewButton("Merge notes that differ only in case", fix(mergeDuplicatesAction))
+
+	update()
+
+	buttons := container.NewVBox(removeDangling, createMissing, deleteUnused, mergeDuplicates)
+	content := container.NewBorder(nil, buttons, nil, nil, container.NewScroll(reportLabel))
+
+	d := dialog.NewCustom("Check notes", "Close", content, parent)
+	d.Resize(fyne.NewSize(450, 400))
+
+	return noteCheckDialog{Dialog: d, parent: parent}
+}
@@ -0,0 +1,79 @@
+package note_search_dialog
+
+import (
+	"fmt"
+	"old-school-rpg-map-editor/common/note_search"
+	"old-school-rpg-map-editor/models/maps_model"
+	"strings"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+)
+
+var _ dialog.Dialog = noteSearchDialog{}
+
+// Поиск заметок во всех открытых картах. Выбранный результат закрывает диалог и
+// передаётся в onSelected
+type noteSearchDialog struct {
+	dialog.Dialog
+	parent fyne.Window
+}
+
+func resultText(r note_search.Result) string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "%s: %s", r.MapName, r.NoteId)
+	if r.OnMap {
+		fmt.Fprintf(&b, " (%d, %d), level %d", r.Cell.Pos.X, r.Cell.Pos.Y, r.Level)
+	} else {
+		b.WriteString(", not on map")
+	}
+
+	if len(r.Title) > 0 {
+		b.WriteString(" - " + r.Title)
+	}
+
+	return b.String()
+}
+
+func NewNoteSearchDialog(parent fyne.Window, mapsModel *maps_model.MapsModel, onSelected func(r note_search.Result)) noteSearchDialog {
+	var results []note_search.Result
+
+	countLabel := widget.NewLabel("")
+
+	list := widget.NewList(
+		func() int {
+			return len(results)
+		},
+		func() fyne.CanvasObject {
+			return widget.NewLabel("")
+		},
+		func(id widget.ListItemID, o fyne.CanvasObject) {
+			o.(*widget.Label).SetText(resultText(results[id]))
+		},
+	)
+
+	queryEntry := widget.NewEntry()
+	queryEntry.SetPlaceHolder("Note id, title, text or tag")
+	queryEntry.OnChanged = func(s string) {
+		results = note_search.Search(mapsModel, s)
+		countLabel.SetText(fmt.Sprintf("%d found in %d maps", len(results), note_search.MapCount(results)))
+		list.UnselectAll()
+		list.Refresh()
+	}
+	queryEntry.OnChanged("")
+
+	content := container.NewBorder(queryEntry, countLabel, nil, nil, list)
+
+	d := dialog.NewCustom("Search notes", "Close", content, parent)
+	d.Resize(fyne.NewSize(500, 400))
+
+	list.OnSelected = func(id widget.ListItemID) {
+		d.Hide()
+		onSelected(results[id])
+	}
+
+	return noteSearchDialog{Dialog: d, parent: parent}
+}
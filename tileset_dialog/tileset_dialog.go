@@ -0,0 +1,134 @@
+package tileset_dialog
+
+import (
+	"fmt"
+	"old-school-rpg-map-editor/common"
+	"old-school-rpg-map-editor/common/tileset"
+	"old-school-rpg-map-editor/models/maps_model"
+	"old-school-rpg-map-editor/models/tilesets_model"
+	"old-school-rpg-map-editor/undo_redo"
+	"strings"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+	"github.com/google/uuid"
+)
+
+var _ dialog.Dialog = tilesetDialog{}
+
+// Диалог выбора набора тайлов карты. Набор из директории настроек карта хранит по имени,
+// встроенный - целиком вместе с картинками.
+type tilesetDialog struct {
+	dialog.Dialog
+	parent        fyne.Window
+	tilesetSelect *widget.Select
+}
+
+// Описание набора для диалога: размеры и подписи тайлов
+func describe(t *tileset.Tileset) string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "Tile size %d, wall width %d\n", t.TileSize, t.WallWidth)
+
+	b.WriteString("Floors:")
+	for i, tile := range t.Floors {
+		fmt.Fprintf(&b, "\n  %d: %s", i, tile)
+	}
+
+	b.WriteString("\nWalls:")
+	for i, tile := range t.Walls {
+		fmt.Fprintf(&b, "\n  %d: %s", i, tile)
+	}
+
+	return b.String()
+}
+
+func NewTilesetDialog(parent fyne.Window, mapsModel *maps_model.MapsModel, mapId uuid.UUID, tilesetsModel *tilesets_model.TilesetsModel) tilesetDialog {
+	current := mapsModel.GetById(mapId).Model.Tileset()
+
+	var tilesets []*tileset.Tileset
+
+	infoLabel := widget.NewLabel("")
+	tilesetSelect := widget.NewSelect(nil, func(s string) {})
+	tilesetSelect.OnChanged = func(s string) {
+		index := tilesetSelect.SelectedIndex()
+		if index >= 0 {
+			infoLabel.SetText(describe(tilesets[index]))
+		}
+	}
+
+	embedCheck := widget.NewCheck("", nil)
+	embedCheck.SetChecked(current.Embedded != nil)
+
+	// встроенный в карту набор идёт последним, его может не быть в директории настроек
+	updateOptions := func() {
+		tilesets = tilesetsModel.Tilesets()
+
+		var options []string
+		for _, t := range tilesets {
+			options = append(options, t.Name)
+		}
+		if current.Embedded != nil {
+			tilesets = append(tilesets, current.Embedded)
+			options = append(options, current.String())
+		}
+		tilesetSelect.Options = options
+
+		selected, _ := tilesetsModel.Get(current)
+		for i, t := range tilesets {
+			if t == selected {
+				tilesetSelect.SetSelectedIndex(i)
+			}
+		}
+		tilesetSelect.Refresh()
+	}
+	updateOptions()
+
+	reloadButton := widget.NewButton("Reload", func() {
+		if err := tilesetsModel.Reload(); err != nil {
+			dialog.ShowError(err, parent)
+		}
+		updateOptions()
+	})
+
+	items := []*widget.FormItem{
+		widget.NewFormItem("Tileset", container.NewBorder(nil, nil, nil, reloadButton, tilesetSelect)),
+		widget.NewFormItem("", infoLabel),
+		widget.NewFormItem("Embed in map file", embedCheck),
+		widget.NewFormItem("", widget.NewLabel("Tilesets are loaded from "+tilesetsModel.Dir())),
+	}
+
+	d := dialog.NewForm("Tileset", "Ok", "Cancel", items, func(b bool) {
+		if !b {
+			return
+		}
+
+		index := tilesetSelect.SelectedIndex()
+		if index < 0 {
+			return
+		}
+		t := tilesets[index]
+
+		var ref tileset.Ref
+		switch {
+		case embedCheck.Checked:
+			ref.Embedded = t
+		case t != tilesetsModel.Default():
+			ref.Name = t.Name
+		}
+		if ref == current {
+			return
+		}
+
+		err := common.MakeAction(undo_redo.NewSetTilesetAction(ref), mapsModel, mapId, nil)
+		if err != nil {
+			// TODO
+			fmt.Println(err)
+			return
+		}
+	}, parent)
+
+	return tilesetDialog{d, parent, tilesetSelect}
+}
@@ -0,0 +1,93 @@
+package undo_history_dialog
+
+import (
+	"fmt"
+	"old-school-rpg-map-editor/common"
+	"old-school-rpg-map-editor/models/maps_model"
+	"old-school-rpg-map-editor/undo_redo"
+	"strconv"
+	"strings"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+	"github.com/google/uuid"
+)
+
+var _ dialog.Dialog = undoHistoryDialog{}
+
+// Дерево правок карты. Выбранная правка становится текущей, так можно вернуться в ветку,
+// брошенную после Undo.
+type undoHistoryDialog struct {
+	dialog.Dialog
+	parent fyne.Window
+}
+
+func label(e undo_redo.UndoRedoElement, current uint64) string {
+	text := "Start"
+	if e.Action != nil {
+		text = fmt.Sprintf("%d: %s", e.ChangeGeneration, strings.ReplaceAll(undo_redo.ActionName(e.Action), "_", " "))
+	}
+	if e.ChangeGeneration == current {
+		text += " (current)"
+	}
+	return text
+}
+
+func NewUndoHistoryDialog(parent fyne.Window, mapsModel *maps_model.MapsModel, mapId uuid.UUID) undoHistoryDialog {
+	mapElem := mapsModel.GetById(mapId)
+	queue := mapElem.UndoRedoQueue
+
+	uid := func(changeGeneration uint64) widget.TreeNodeID {
+		return strconv.FormatUint(changeGeneration, 10)
+	}
+	generation := func(uid widget.TreeNodeID) uint64 {
+		g, _ := strconv.ParseUint(uid, 10, 64)
+		return g
+	}
+
+	tree := widget.NewTree(
+		func(id widget.TreeNodeID) []widget.TreeNodeID {
+			if id == "" {
+				return []widget.TreeNodeID{uid(queue.Root().ChangeGeneration)}
+			}
+
+			var ids []widget.TreeNodeID
+			for _, e := range queue.Children(generation(id)) {
+				ids = append(ids, uid(e.ChangeGeneration))
+			}
+			return ids
+		},
+		func(id widget.TreeNodeID) bool {
+			return id == "" || len(queue.Children(generation(id))) > 0
+		},
+		func(branch bool) fyne.CanvasObject {
+			return widget.NewLabel("")
+		},
+		func(id widget.TreeNodeID, branch bool, o fyne.CanvasObject) {
+			o.(*widget.Label).SetText(label(queue.Action(generation(id)), mapElem.ChangeGeneration))
+		},
+	)
+	tree.OpenAllBranches()
+
+	selected := mapElem.ChangeGeneration
+	tree.OnSelected = func(id widget.TreeNodeID) {
+		selected = generation(id)
+	}
+	tree.Select(uid(selected))
+	tree.ScrollTo(uid(selected))
+
+	d := dialog.NewCustomConfirm("Undo history", "Go to", "Close", tree, func(b bool) {
+		if !b || selected == mapElem.ChangeGeneration {
+			return
+		}
+
+		err := common.SwitchHistory(mapsModel, mapId, selected)
+		if err != nil {
+			dialog.ShowError(err, parent)
+		}
+	}, parent)
+	d.Resize(fyne.NewSize(400, 500))
+
+	return undoHistoryDialog{Dialog: d, parent: parent}
+}
@@ -1,10 +1,14 @@
 package undo_redo
 
 import (
+	"fmt"
+	"old-school-rpg-map-editor/common/tileset"
 	"old-school-rpg-map-editor/models/center_model"
 	"old-school-rpg-map-editor/models/copy_model"
 	"old-school-rpg-map-editor/models/map_model"
 	"old-school-rpg-map-editor/models/mode_model"
+	"old-school-rpg-map-editor/models/notes_model"
+	"old-school-rpg-map-editor/models/party_model"
 	"old-school-rpg-map-editor/models/rot_map_model"
 	"old-school-rpg-map-editor/models/rot_select_model"
 	"old-school-rpg-map-editor/models/rotate_model"
@@ -16,6 +20,7 @@ import (
 
 	"github.com/elliotchance/pie/v2"
 	"github.com/google/uuid"
+	"golang.org/x/exp/maps"
 	"golang.org/x/exp/slices"
 )
 
@@ -28,9 +33,11 @@ type UndoRedoActionModels struct {
 	Mm  *mode_model.ModeModel
 	Slm *selected_layer_model.SelectedLayerModel
 	Cm  *center_model.CenterModel
+	Pm  *party_model.PartyModel
+	Nm  *notes_model.NotesModel
 }
 
-func NewUndoRedoActionModels(m *map_model.MapModel, r *rotate_model.RotateModel, rm *rot_map_model.RotMapModel, rs *rot_select_model.RotSelectModel, sm *select_model.SelectModel, mm *mode_model.ModeModel, slm *selected_layer_model.SelectedLayerModel, cm *center_model.CenterModel) UndoRedoActionModels {
+func NewUndoRedoActionModels(m *map_model.MapModel, r *rotate_model.RotateModel, rm *rot_map_model.RotMapModel, rs *rot_select_model.RotSelectModel, sm *select_model.SelectModel, mm *mode_model.ModeModel, slm *selected_layer_model.SelectedLayerModel, cm *center_model.CenterModel, pm *party_model.PartyModel, nm *notes_model.NotesModel) UndoRedoActionModels {
 	return UndoRedoActionModels{
 		M:   m,
 		R:   r,
@@ -40,6 +47,8 @@ func NewUndoRedoActionModels(m *map_model.MapModel, r *rotate_model.RotateModel,
 		Mm:  mm,
 		Slm: slm,
 		Cm:  cm,
+		Pm:  pm,
+		Nm:  nm,
 	}
 }
 
@@ -49,6 +58,22 @@ type UndoRedoAction interface {
 	//IsChangeSaveFile() bool
 }
 
+// Action, Redo которого может не получиться, например, из-за клетки за краем карты(см.
+// map_model.ErrOutOfBounds). Неудачный Redo ничего не меняет, а Err возвращает его ошибку.
+// Такой action нельзя добавлять ни в историю, ни в контейнер.
+type FailableAction interface {
+	UndoRedoAction
+	Err() error
+}
+
+// Ошибка последнего Redo action'а, nil - Redo получился
+func ActionErr(action UndoRedoAction) error {
+	if a, ok := action.(FailableAction); ok {
+		return a.Err()
+	}
+	return nil
+}
+
 type UndoRedoActionContainer interface {
 	UndoRedoAction
 	Add(a UndoRedoAction) bool
@@ -99,6 +124,15 @@ func (c *UndoRedoContainer) Undo(m UndoRedoActionModels) {
 	}
 }
 
+// Откатывает и убирает сделанные action'ы, когда следующий за ними не получился
+func (c *UndoRedoContainer) rollback(m UndoRedoActionModels) {
+	c.Undo(m)
+
+	c.mutex.Lock()
+	c.actions = nil
+	c.mutex.Unlock()
+}
+
 func (c *UndoRedoContainer) Len() int {
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
@@ -166,6 +200,7 @@ type SetFloorAction struct {
 	layerId  uuid.UUID
 	value    uint32
 	oldValue uint32
+	err      error
 }
 
 func NewSetFloorAction(pos utils.Int2, layerId uuid.UUID, value uint32) *SetFloorAction {
@@ -175,7 +210,11 @@ func NewSetFloorAction(pos utils.Int2, layerId uuid.UUID, value uint32) *SetFloo
 func (a *SetFloorAction) Redo(m UndoRedoActionModels) {
 	layerIndex := m.M.LayerIndexById(a.layerId)
 	a.oldValue = m.Rm.Floor(a.pos.X, a.pos.Y, layerIndex)
-	m.Rm.SetFloor(a.pos.X, a.pos.Y, layerIndex, a.value)
+	a.err = m.Rm.SetFloor(a.pos.X, a.pos.Y, layerIndex, a.value)
+}
+
+func (a *SetFloorAction) Err() error {
+	return a.err
 }
 
 func (a *SetFloorAction) Undo(m UndoRedoActionModels) {
@@ -188,22 +227,97 @@ type SetWallAction struct {
 	layerId  uuid.UUID
 	isRight  bool
 	value    uint32
+	kind     map_model.WallKind
 	oldValue uint32
+	oldKind  map_model.WallKind
+	err      error
 }
 
-func NewSetWallAction(pos utils.Int2, layerId uuid.UUID, isRight bool, value uint32) *SetWallAction {
-	return &SetWallAction{pos: pos, layerId: layerId, isRight: isRight, value: value}
+func NewSetWallAction(pos utils.Int2, layerId uuid.UUID, isRight bool, value uint32, kind map_model.WallKind) *SetWallAction {
+	return &SetWallAction{pos: pos, layerId: layerId, isRight: isRight, value: value, kind: kind}
 }
 
 func (a *SetWallAction) Redo(m UndoRedoActionModels) {
 	layerIndex := m.M.LayerIndexById(a.layerId)
 	a.oldValue = m.Rm.Wall(a.pos.X, a.pos.Y, layerIndex, a.isRight)
-	m.Rm.SetWall(a.pos.X, a.pos.Y, layerIndex, a.isRight, a.value)
+	a.oldKind = m.Rm.WallKind(a.pos.X, a.pos.Y, layerIndex, a.isRight)
+	a.err = m.Rm.SetWall(a.pos.X, a.pos.Y, layerIndex, a.isRight, a.value)
+	if a.err != nil {
+		return
+	}
+	a.err = m.Rm.SetWallKind(a.pos.X, a.pos.Y, layerIndex, a.isRight, a.kind)
+}
+
+func (a *SetWallAction) Err() error {
+	return a.err
 }
 
 func (a *SetWallAction) Undo(m UndoRedoActionModels) {
 	layerIndex := m.M.LayerIndexById(a.layerId)
 	m.Rm.SetWall(a.pos.X, a.pos.Y, layerIndex, a.isRight, a.oldValue)
+	m.Rm.SetWallKind(a.pos.X, a.pos.Y, layerIndex, a.isRight, a.oldKind)
+}
+
+type layerCell struct {
+	layerId uuid.UUID
+	pos     utils.Int2
+}
+
+// Правка многих клеток одной транзакцией(см. rot_map_model.RotMapModel.Edit). edit вызывается
+// только при первом Redo, повтор и откат применяют запомненное содержимое клеток.
+type EditAction struct {
+	edit  func(t *rot_map_model.Tx)
+	edits map[layerCell]map_model.LocationEdit // слои по uuid, индексы слоёв могут поменяться
+	err   error
+}
+
+func NewEditAction(edit func(t *rot_map_model.Tx)) *EditAction {
+	return &EditAction{edit: edit}
+}
+
+func (a *EditAction) Redo(m UndoRedoActionModels) {
+	if a.edits == nil {
+		edits, err := m.Rm.Edit(a.edit)
+		if err != nil {
+			a.err = err
+			return
+		}
+
+		a.edits = make(map[layerCell]map_model.LocationEdit, len(edits))
+		for cell, edit := range edits {
+			a.edits[layerCell{layerId: m.M.LayerInfo(cell.LayerIndex).Uuid, pos: cell.Pos}] = edit
+		}
+	} else {
+		a.apply(m, false)
+	}
+}
+
+func (a *EditAction) Err() error {
+	return a.err
+}
+
+func (a *EditAction) Undo(m UndoRedoActionModels) {
+	a.apply(m, true)
+}
+
+func (a *EditAction) apply(m UndoRedoActionModels, undo bool) {
+	// внутри транзакции MapModel недоступна, индексы слоёв находим заранее
+	layerIndices := make(map[uuid.UUID]int32)
+	for cell := range a.edits {
+		if _, exists := layerIndices[cell.layerId]; !exists {
+			layerIndices[cell.layerId] = m.M.LayerIndexById(cell.layerId)
+		}
+	}
+
+	m.M.Edit(func(t *map_model.Tx) {
+		for cell, edit := range a.edits {
+			location := edit.After
+			if undo {
+				location = edit.Before
+			}
+			t.SetLocation(cell.pos.X, cell.pos.Y, layerIndices[cell.layerId], location)
+		}
+	})
 }
 
 type SetNoteIdAction struct {
@@ -211,6 +325,7 @@ type SetNoteIdAction struct {
 	layerId  uuid.UUID
 	value    string
 	oldValue string
+	err      error
 }
 
 func NewSetNoteIdAction(pos utils.Int2, layerId uuid.UUID, value string) *SetNoteIdAction {
@@ -220,7 +335,11 @@ func NewSetNoteIdAction(pos utils.Int2, layerId uuid.UUID, value string) *SetNot
 func (a *SetNoteIdAction) Redo(m UndoRedoActionModels) {
 	layerIndex := m.M.LayerIndexById(a.layerId)
 	a.oldValue = m.Rm.NoteId(a.pos.X, a.pos.Y, layerIndex)
-	m.Rm.SetNoteId(a.pos.X, a.pos.Y, layerIndex, a.value)
+	a.err = m.Rm.SetNoteId(a.pos.X, a.pos.Y, layerIndex, a.value)
+}
+
+func (a *SetNoteIdAction) Err() error {
+	return a.err
 }
 
 func (a *SetNoteIdAction) Undo(m UndoRedoActionModels) {
@@ -228,19 +347,184 @@ func (a *SetNoteIdAction) Undo(m UndoRedoActionModels) {
 	m.Rm.SetNoteId(a.pos.X, a.pos.Y, layerIndex, a.oldValue)
 }
 
+// Заменяет все заметки(см. notes_model.NotesModel.SetNotes). Новые правки делает UpdateNotesAction,
+// этот action остался для истории из уже сохранённых файлов
+type SetNotesAction struct {
+	notes    []notes_model.Note
+	oldNotes []notes_model.Note
+}
+
+func (a *SetNotesAction) Redo(m UndoRedoActionModels) {
+	a.oldNotes = m.Nm.Notes()
+	err := m.Nm.SetNotes(a.notes)
+	if err != nil {
+		// TODO
+		fmt.Println(err)
+	}
+}
+
+func (a *SetNotesAction) Undo(m UndoRedoActionModels) {
+	err := m.Nm.SetNotes(a.oldNotes)
+	if err != nil {
+		// TODO
+		fmt.Println(err)
+	}
+}
+
+// Добавляет или заменяет заметки set и удаляет заметки deleteIds. Undo возвращает только эти
+// заметки: остальные могли поменять в notes_widget мимо истории, и их правки не теряются
+type UpdateNotesAction struct {
+	set       []notes_model.Note
+	deleteIds []string
+	oldNotes  []notes_model.Note // заменённые и удалённые заметки, как были до Redo
+	addedIds  []string           // заметки set, которых до Redo не было
+}
+
+func NewUpdateNotesAction(set []notes_model.Note, deleteIds []string) *UpdateNotesAction {
+	return &UpdateNotesAction{set: set, deleteIds: deleteIds}
+}
+
+func (a *UpdateNotesAction) Redo(m UndoRedoActionModels) {
+	a.oldNotes, a.addedIds = nil, nil
+
+	for _, noteId := range a.deleteIds {
+		if note, ok := m.Nm.Note(noteId); ok {
+			a.oldNotes = append(a.oldNotes, note)
+			m.Nm.Delete(noteId)
+		}
+	}
+
+	for _, note := range a.set {
+		var err error
+		if old, ok := m.Nm.Note(note.Id); ok {
+			a.oldNotes = append(a.oldNotes, old)
+			err = m.Nm.Set(note)
+		} else {
+			a.addedIds = append(a.addedIds, note.Id)
+			err = m.Nm.Add(note)
+		}
+		if err != nil {
+			// TODO
+			fmt.Println(err)
+		}
+	}
+}
+
+func (a *UpdateNotesAction) Undo(m UndoRedoActionModels) {
+	for _, noteId := range a.addedIds {
+		m.Nm.Delete(noteId)
+	}
+
+	// удалённые заметки возвращаются в конец списка
+	for _, note := range a.oldNotes {
+		var err error
+		if _, ok := m.Nm.Note(note.Id); ok {
+			err = m.Nm.Set(note)
+		} else {
+			err = m.Nm.Add(note)
+		}
+		if err != nil {
+			// TODO
+			fmt.Println(err)
+		}
+	}
+}
+
+type SetLinkAction struct {
+	pos      utils.Int2
+	layerId  uuid.UUID
+	value    *map_model.Link
+	oldValue *map_model.Link
+	err      error
+}
+
+func NewSetLinkAction(pos utils.Int2, layerId uuid.UUID, value *map_model.Link) *SetLinkAction {
+	return &SetLinkAction{pos: pos, layerId: layerId, value: value}
+}
+
+func (a *SetLinkAction) Redo(m UndoRedoActionModels) {
+	layerIndex := m.M.LayerIndexById(a.layerId)
+	a.oldValue = m.Rm.Link(a.pos.X, a.pos.Y, layerIndex)
+	a.err = m.Rm.SetLink(a.pos.X, a.pos.Y, layerIndex, a.value)
+}
+
+func (a *SetLinkAction) Err() error {
+	return a.err
+}
+
+func (a *SetLinkAction) Undo(m UndoRedoActionModels) {
+	layerIndex := m.M.LayerIndexById(a.layerId)
+	m.Rm.SetLink(a.pos.X, a.pos.Y, layerIndex, a.oldValue)
+}
+
+type SetEffectsAction struct {
+	pos      utils.Int2
+	layerId  uuid.UUID
+	value    map_model.Effects
+	oldValue map_model.Effects
+	err      error
+}
+
+func NewSetEffectsAction(pos utils.Int2, layerId uuid.UUID, value map_model.Effects) *SetEffectsAction {
+	return &SetEffectsAction{pos: pos, layerId: layerId, value: value}
+}
+
+func (a *SetEffectsAction) Redo(m UndoRedoActionModels) {
+	layerIndex := m.M.LayerIndexById(a.layerId)
+	a.oldValue = m.Rm.Effects(a.pos.X, a.pos.Y, layerIndex)
+	a.err = m.Rm.SetEffects(a.pos.X, a.pos.Y, layerIndex, a.value)
+}
+
+func (a *SetEffectsAction) Err() error {
+	return a.err
+}
+
+func (a *SetEffectsAction) Undo(m UndoRedoActionModels) {
+	layerIndex := m.M.LayerIndexById(a.layerId)
+	m.Rm.SetEffects(a.pos.X, a.pos.Y, layerIndex, a.oldValue)
+}
+
+type SetMarkersAction struct {
+	pos      utils.Int2
+	layerId  uuid.UUID
+	value    []map_model.Marker
+	oldValue []map_model.Marker
+	err      error
+}
+
+func NewSetMarkersAction(pos utils.Int2, layerId uuid.UUID, value []map_model.Marker) *SetMarkersAction {
+	return &SetMarkersAction{pos: pos, layerId: layerId, value: value}
+}
+
+func (a *SetMarkersAction) Redo(m UndoRedoActionModels) {
+	layerIndex := m.M.LayerIndexById(a.layerId)
+	a.oldValue = m.Rm.Markers(a.pos.X, a.pos.Y, layerIndex)
+	a.err = m.Rm.SetMarkers(a.pos.X, a.pos.Y, layerIndex, a.value)
+}
+
+func (a *SetMarkersAction) Err() error {
+	return a.err
+}
+
+func (a *SetMarkersAction) Undo(m UndoRedoActionModels) {
+	layerIndex := m.M.LayerIndexById(a.layerId)
+	m.Rm.SetMarkers(a.pos.X, a.pos.Y, layerIndex, a.oldValue)
+}
+
 type AddLayerAction struct {
 	layerId   uuid.UUID
 	name      string
 	visible   bool
 	layerType map_model.LayerType
+	level     int32
 }
 
-func NewAddLayerAction(name string, visible bool, layerType map_model.LayerType) *AddLayerAction {
-	return &AddLayerAction{layerId: uuid.New(), name: name, visible: visible, layerType: layerType}
+func NewAddLayerAction(name string, visible bool, layerType map_model.LayerType, level int32) *AddLayerAction {
+	return &AddLayerAction{layerId: uuid.New(), name: name, visible: visible, layerType: layerType, level: level}
 }
 
 func (a *AddLayerAction) Redo(m UndoRedoActionModels) {
-	layerIndex := m.M.AddLayerWithId(a.layerId, a.layerType)
+	layerIndex := m.M.AddLayerWithId(a.layerId, a.layerType, a.level)
 	m.M.SetName(layerIndex, a.name)
 	m.M.SetVisible(layerIndex, a.visible)
 }
@@ -296,14 +580,114 @@ func (a *MoveLayerAction) Redo(m UndoRedoActionModels) {
 }
 
 func (a *MoveLayerAction) Undo(m UndoRedoActionModels) {
-	diff := m.M.LayerIndexById(a.layerId) - a.oldIndex
-	if diff > 0 {
-		m.M.MoveDown(a.oldIndex, diff)
+	index := m.M.LayerIndexById(a.layerId)
+	if index > a.oldIndex {
+		m.M.MoveUp(index, index-a.oldIndex)
+	} else if index < a.oldIndex {
+		m.M.MoveDown(index, a.oldIndex-index)
+	}
+}
+
+type SetLayerLevelAction struct {
+	layerId  uuid.UUID
+	level    int32
+	oldLevel int32
+}
+
+func NewSetLayerLevelAction(layerId uuid.UUID, level int32) *SetLayerLevelAction {
+	return &SetLayerLevelAction{layerId: layerId, level: level}
+}
+
+func (a *SetLayerLevelAction) Redo(m UndoRedoActionModels) {
+	layerIndex := m.M.LayerIndexById(a.layerId)
+	a.oldLevel = m.M.LayerInfo(layerIndex).Level
+	m.M.SetLayerLevel(layerIndex, a.level)
+}
+
+func (a *SetLayerLevelAction) Undo(m UndoRedoActionModels) {
+	m.M.SetLayerLevel(m.M.LayerIndexById(a.layerId), a.oldLevel)
+}
+
+type SetLevelAction struct {
+	level    int32
+	oldLevel int32
+}
+
+func NewSetLevelAction(level int32) *SetLevelAction {
+	return &SetLevelAction{level: level}
+}
+
+func (a *SetLevelAction) Redo(m UndoRedoActionModels) {
+	a.oldLevel = m.M.Level()
+	m.M.SetLevel(a.level)
+}
+
+func (a *SetLevelAction) Undo(m UndoRedoActionModels) {
+	m.M.SetLevel(a.oldLevel)
+}
+
+// Переходит на другой уровень. Если на уровне нет слоёв, то создаёт слой. Если есть
+// move layer, то он переезжает на новый уровень вместе с пользователем.
+type ChangeLevelAction struct {
+	level   int32
+	actions *UndoRedoContainer
+}
+
+func NewChangeLevelAction(level int32) *ChangeLevelAction {
+	return &ChangeLevelAction{level: level, actions: NewUndoRedoContainer()}
+}
+
+func (a *ChangeLevelAction) Redo(m UndoRedoActionModels) {
+	if a.actions.Len() == 0 {
+		if m.M.Level() == a.level {
+			return
+		}
+
+		moveLayerIndex := pie.FirstOr(m.M.LayerIndexByType(map_model.MoveLayerType), -1)
+
+		setLevelAction := NewSetLevelAction(a.level)
+		setLevelAction.Redo(m)
+		a.actions.Add(setLevelAction)
+
+		if len(m.M.LayerIndicesByLevel(a.level)) == 0 {
+			addLayerAction := NewAddLayerAction("Layer1", true, map_model.RegularLayerType, a.level)
+			addLayerAction.Redo(m)
+			a.actions.Add(addLayerAction)
+		}
+
+		firstLayerIndex := m.M.LayerIndicesByLevel(a.level)[0]
+
+		if moveLayerIndex != -1 {
+			moveLayerId := m.M.LayerInfo(moveLayerIndex).Uuid
+
+			setLayerLevelAction := NewSetLayerLevelAction(moveLayerId, a.level)
+			setLayerLevelAction.Redo(m)
+			a.actions.Add(setLayerLevelAction)
+
+			// move layer должен лежать прямо над слоем, в который его потом смержат
+			offset := firstLayerIndex - moveLayerIndex
+			if offset > 0 {
+				offset--
+			}
+			moveLayerAction := NewMoveLayerAction(int(offset), moveLayerId)
+			moveLayerAction.Redo(m)
+			a.actions.Add(moveLayerAction)
+
+			firstLayerIndex = m.M.LayerIndexById(moveLayerId)
+		}
+
+		setSelectedLayerAction := NewSetSelectedLayerAction(firstLayerIndex)
+		setSelectedLayerAction.Redo(m)
+		a.actions.Add(setSelectedLayerAction)
 	} else {
-		m.M.MoveUp(a.oldIndex, -diff)
+		a.actions.Redo(m)
 	}
 }
 
+func (a *ChangeLevelAction) Undo(m UndoRedoActionModels) {
+	a.actions.Undo(m)
+}
+
 type ClearLayerAction struct {
 	layerId   uuid.UUID
 	locations map[utils.Int2]map_model.Location
@@ -323,9 +707,78 @@ func (a *ClearLayerAction) Undo(m UndoRedoActionModels) {
 	m.M.SetLocations(m.M.LayerIndexById(a.layerId), a.locations)
 }
 
+type SetLocationsAction struct {
+	layerId      uuid.UUID
+	locations    map[utils.Int2]map_model.Location
+	oldLocations map[utils.Int2]map_model.Location
+	err          error
+}
+
+// locations в координатах карты(без учёта поворота)
+func NewSetLocationsAction(layerId uuid.UUID, locations map[utils.Int2]map_model.Location) *SetLocationsAction {
+	return &SetLocationsAction{layerId: layerId, locations: locations}
+}
+
+func (a *SetLocationsAction) Redo(m UndoRedoActionModels) {
+	layerIndex := m.M.LayerIndexById(a.layerId)
+	a.oldLocations = m.M.Locations(layerIndex)
+	a.err = m.M.SetLocations(layerIndex, maps.Clone(a.locations))
+}
+
+func (a *SetLocationsAction) Err() error {
+	return a.err
+}
+
+func (a *SetLocationsAction) Undo(m UndoRedoActionModels) {
+	m.M.SetLocations(m.M.LayerIndexById(a.layerId), a.oldLocations)
+}
+
+// Добавляет на текущий уровень новый слой name с клетками locations и выбирает его
+type ImportLayerAction struct {
+	name      string
+	locations map[utils.Int2]map_model.Location
+	actions   *UndoRedoContainer
+	err       error
+}
+
+func NewImportLayerAction(name string, locations map[utils.Int2]map_model.Location) *ImportLayerAction {
+	return &ImportLayerAction{name: name, locations: locations, actions: NewUndoRedoContainer()}
+}
+
+func (a *ImportLayerAction) Redo(m UndoRedoActionModels) {
+	if a.actions.Len() == 0 {
+		addLayerAction := NewAddLayerAction(a.name, true, map_model.RegularLayerType, m.M.Level())
+		addLayerAction.Redo(m)
+		a.actions.Add(addLayerAction)
+
+		setLocationsAction := NewSetLocationsAction(addLayerAction.layerId, a.locations)
+		setLocationsAction.Redo(m)
+		if a.err = setLocationsAction.Err(); a.err != nil {
+			a.actions.rollback(m)
+			return
+		}
+		a.actions.Add(setLocationsAction)
+
+		setSelectedLayerAction := NewSetSelectedLayerAction(m.M.LayerIndexById(addLayerAction.layerId))
+		setSelectedLayerAction.Redo(m)
+		a.actions.Add(setSelectedLayerAction)
+	} else {
+		a.actions.Redo(m)
+	}
+}
+
+func (a *ImportLayerAction) Err() error {
+	return a.err
+}
+
+func (a *ImportLayerAction) Undo(m UndoRedoActionModels) {
+	a.actions.Undo(m)
+}
+
 type MoveToSelectedAction struct {
 	offset      utils.Int2
 	moveLayerId uuid.UUID
+	err         error
 }
 
 func NewMoveToSelectedAction(moveLayerId uuid.UUID, offset utils.Int2) *MoveToSelectedAction {
@@ -335,10 +788,17 @@ func NewMoveToSelectedAction(moveLayerId uuid.UUID, offset utils.Int2) *MoveToSe
 func (a *MoveToSelectedAction) Redo(m UndoRedoActionModels) {
 	moveLayerIndex := m.M.LayerIndexById(a.moveLayerId)
 
-	m.Rm.MoveTo(moveLayerIndex, a.offset.X, a.offset.Y)
+	a.err = m.Rm.MoveTo(moveLayerIndex, a.offset.X, a.offset.Y)
+	if a.err != nil {
+		return
+	}
 	m.Rs.MoveTo(a.offset.X, a.offset.Y)
 }
 
+func (a *MoveToSelectedAction) Err() error {
+	return a.err
+}
+
 func (a *MoveToSelectedAction) Undo(m UndoRedoActionModels) {
 	moveLayerIndex := m.M.LayerIndexById(a.moveLayerId)
 
@@ -352,17 +812,23 @@ const (
 	Floor      SelectType = 0
 	RightWall  SelectType = 1
 	BottomWall SelectType = 2
+	Marker     SelectType = 3
 )
 
 type SelectAction struct {
 	pos        utils.Int2
 	selectType SelectType
+	marker     int // индекс отметки в клетке для Marker
 }
 
 func NewSelectAction(pos utils.Int2, selectType SelectType) *SelectAction {
 	return &SelectAction{pos: pos, selectType: selectType}
 }
 
+func NewSelectMarkerAction(pos utils.Int2, marker int) *SelectAction {
+	return &SelectAction{pos: pos, selectType: Marker, marker: marker}
+}
+
 func (a *SelectAction) Redo(m UndoRedoActionModels) {
 	if a.selectType == Floor {
 		m.Rs.SelectFloor(a.pos.X, a.pos.Y)
@@ -370,6 +836,8 @@ func (a *SelectAction) Redo(m UndoRedoActionModels) {
 		m.Rs.SelectWall(a.pos.X, a.pos.Y, true)
 	} else if a.selectType == BottomWall {
 		m.Rs.SelectWall(a.pos.X, a.pos.Y, false)
+	} else if a.selectType == Marker {
+		m.Rs.SelectMarker(a.pos.X, a.pos.Y, a.marker)
 	}
 }
 
@@ -380,6 +848,8 @@ func (a *SelectAction) Undo(m UndoRedoActionModels) {
 		m.Rs.UnselectWall(a.pos.X, a.pos.Y, true)
 	} else if a.selectType == BottomWall {
 		m.Rs.UnselectWall(a.pos.X, a.pos.Y, false)
+	} else if a.selectType == Marker {
+		m.Rs.UnselectMarker(a.pos.X, a.pos.Y, a.marker)
 	}
 }
 
@@ -400,6 +870,24 @@ func (a *UnselectAllAction) Undo(m UndoRedoActionModels) {
 	m.Sm.SetSelected(a.selected)
 }
 
+type SelectByEffectsAction struct {
+	effects     map_model.Effects
+	oldSelected map[utils.Int2]select_model.Selected
+}
+
+func NewSelectByEffectsAction(effects map_model.Effects) *SelectByEffectsAction {
+	return &SelectByEffectsAction{effects: effects}
+}
+
+func (a *SelectByEffectsAction) Redo(m UndoRedoActionModels) {
+	a.oldSelected = m.Sm.Selected()
+	m.Sm.SelectByEffects(a.effects)
+}
+
+func (a *SelectByEffectsAction) Undo(m UndoRedoActionModels) {
+	m.Sm.SetSelected(a.oldSelected)
+}
+
 type SetSelectedAction struct {
 	selected    map[utils.Int2]select_model.Selected
 	oldSelected map[utils.Int2]select_model.Selected
@@ -422,6 +910,7 @@ type MergeLayersAction struct {
 	fromLayerId uuid.UUID
 	toLayerId   uuid.UUID
 	actions     *UndoRedoContainer
+	err         error
 }
 
 func NewMergeLayersAction(fromLayerId uuid.UUID, toLayerId uuid.UUID) *MergeLayersAction {
@@ -431,28 +920,40 @@ func NewMergeLayersAction(fromLayerId uuid.UUID, toLayerId uuid.UUID) *MergeLaye
 func (a *MergeLayersAction) Redo(m UndoRedoActionModels) {
 	if a.actions.Len() == 0 {
 		fromLayerIndex := m.M.LayerIndexById(a.fromLayerId)
+		toLayerIndex := m.M.LayerIndexById(a.toLayerId)
 
 		leftTop, rightBottom := m.Rm.Bounds(fromLayerIndex)
 
-		for y := leftTop.Y; y < rightBottom.Y; y++ {
-			for x := leftTop.X; x < rightBottom.X; x++ {
-				if v := m.Rm.Floor(x, y, fromLayerIndex); v > 0 {
-					action := NewSetFloorAction(utils.NewInt2(x, y), a.toLayerId, m.Rm.Floor(x, y, fromLayerIndex))
-					action.Redo(m)
-					a.actions.Add(action)
-				}
-				if v := m.Rm.Wall(x, y, fromLayerIndex, true); v > 0 {
-					action := NewSetWallAction(utils.NewInt2(x, y), a.toLayerId, true, v)
-					action.Redo(m)
-					a.actions.Add(action)
-				}
-				if v := m.Rm.Wall(x, y, fromLayerIndex, false); v > 0 {
-					action := NewSetWallAction(utils.NewInt2(x, y), a.toLayerId, false, v)
-					action.Redo(m)
-					a.actions.Add(action)
+		editAction := NewEditAction(func(t *rot_map_model.Tx) {
+			for y := leftTop.Y; y < rightBottom.Y; y++ {
+				for x := leftTop.X; x < rightBottom.X; x++ {
+					if v := t.Floor(x, y, fromLayerIndex); v > 0 {
+						t.SetFloor(x, y, toLayerIndex, v)
+					}
+					if v := t.Link(x, y, fromLayerIndex); v != nil {
+						t.SetLink(x, y, toLayerIndex, v)
+					}
+					if v := t.Effects(x, y, fromLayerIndex); v != 0 {
+						t.SetEffects(x, y, toLayerIndex, v|t.Effects(x, y, toLayerIndex))
+					}
+					if v := t.Markers(x, y, fromLayerIndex); len(v) > 0 {
+						// больше MaxMarkers отметок Edit не примет, и слияние не получится
+						t.SetMarkers(x, y, toLayerIndex, append(slices.Clone(t.Markers(x, y, toLayerIndex)), v...))
+					}
+					if v, kind := t.Wall(x, y, fromLayerIndex, true); v > 0 {
+						t.SetWall(x, y, toLayerIndex, true, v, kind)
+					}
+					if v, kind := t.Wall(x, y, fromLayerIndex, false); v > 0 {
+						t.SetWall(x, y, toLayerIndex, false, v, kind)
+					}
 				}
 			}
+		})
+		editAction.Redo(m)
+		if a.err = editAction.Err(); a.err != nil {
+			return
 		}
+		a.actions.Add(editAction)
 
 		deleteLayerAction := NewDeleteLayerAction(a.fromLayerId)
 		deleteLayerAction.Redo(m)
@@ -462,6 +963,10 @@ func (a *MergeLayersAction) Redo(m UndoRedoActionModels) {
 	}
 }
 
+func (a *MergeLayersAction) Err() error {
+	return a.err
+}
+
 func (a *MergeLayersAction) Undo(m UndoRedoActionModels) {
 	a.actions.Undo(m)
 }
@@ -470,6 +975,7 @@ func (a *MergeLayersAction) Undo(m UndoRedoActionModels) {
 type MergeLayerDownAction struct {
 	fromLayerId uuid.UUID
 	actions     *UndoRedoContainer
+	err         error
 }
 
 func NewMergeLayerDownAction(fromLayerId uuid.UUID) *MergeLayerDownAction {
@@ -483,12 +989,19 @@ func (a *MergeLayerDownAction) Redo(m UndoRedoActionModels) {
 
 		action := NewMergeLayersAction(a.fromLayerId, toLayerId)
 		action.Redo(m)
+		if a.err = action.Err(); a.err != nil {
+			return
+		}
 		a.actions.Add(action)
 	} else {
 		a.actions.Redo(m)
 	}
 }
 
+func (a *MergeLayerDownAction) Err() error {
+	return a.err
+}
+
 func (a *MergeLayerDownAction) Undo(m UndoRedoActionModels) {
 	a.actions.Undo(m)
 }
@@ -496,6 +1009,7 @@ func (a *MergeLayerDownAction) Undo(m UndoRedoActionModels) {
 type SetModeAndMergeDownMoveLayerAction struct {
 	mode    mode_model.Mode
 	actions *UndoRedoContainer
+	err     error
 }
 
 func NewSetModeAndMergeDownMoveLayerAction(mode mode_model.Mode) *SetModeAndMergeDownMoveLayerAction {
@@ -514,6 +1028,9 @@ func (a *SetModeAndMergeDownMoveLayerAction) Redo(m UndoRedoActionModels) {
 			if leftTop != rightBottom {
 				moveAction := NewMergeLayerDownAction(moveLayerId)
 				moveAction.Redo(m)
+				if a.err = moveAction.Err(); a.err != nil {
+					return
+				}
 				a.actions.Add(moveAction)
 
 				setSelectedLayerAction := NewSetSelectedLayerAction(moveLayerIndex)
@@ -532,6 +1049,10 @@ func (a *SetModeAndMergeDownMoveLayerAction) Redo(m UndoRedoActionModels) {
 	}
 }
 
+func (a *SetModeAndMergeDownMoveLayerAction) Err() error {
+	return a.err
+}
+
 func (a *SetModeAndMergeDownMoveLayerAction) Undo(m UndoRedoActionModels) {
 	a.actions.Undo(m)
 }
@@ -597,25 +1118,43 @@ func (a *CutAction) Redo(m UndoRedoActionModels) {
 		unselectAction.Redo(m)
 		a.actions.Add(unselectAction)
 
-		for pos, location := range a.copyResult.Locations {
-			x, y := m.R.TransformToRot(pos.X, pos.Y)
+		layerIndex := m.M.LayerIndexById(a.copyResult.LayerId)
 
-			if location.Floor > 0 {
-				action := NewSetFloorAction(utils.NewInt2(x, y), a.copyResult.LayerId, 0)
-				action.Redo(m)
-				a.actions.Add(action)
-			}
-			if location.RightWall > 0 {
-				action := NewSetWallAction(utils.NewInt2(x, y), a.copyResult.LayerId, true, 0)
-				action.Redo(m)
-				a.actions.Add(action)
-			}
-			if location.BottomWall > 0 {
-				action := NewSetWallAction(utils.NewInt2(x, y), a.copyResult.LayerId, false, 0)
-				action.Redo(m)
-				a.actions.Add(action)
+		editAction := NewEditAction(func(t *rot_map_model.Tx) {
+			for pos, location := range a.copyResult.Locations {
+				x, y := m.R.TransformToRot(pos.X, pos.Y)
+
+				if location.Floor > 0 {
+					t.SetFloor(x, y, layerIndex, 0)
+				}
+				if location.Link != nil {
+					t.SetLink(x, y, layerIndex, nil)
+				}
+				if location.Effects != 0 {
+					t.SetEffects(x, y, layerIndex, 0)
+				}
+				if len(location.Markers) > 0 {
+					// скопированы могут быть не все отметки клетки
+					var markers []map_model.Marker
+					for _, marker := range t.Markers(x, y, layerIndex) {
+						if i := slices.Index(location.Markers, marker); i != -1 {
+							location.Markers = slices.Delete(slices.Clone(location.Markers), i, i+1)
+						} else {
+							markers = append(markers, marker)
+						}
+					}
+					t.SetMarkers(x, y, layerIndex, markers)
+				}
+				if location.RightWall > 0 {
+					t.SetWall(x, y, layerIndex, true, 0, map_model.RegularWall)
+				}
+				if location.BottomWall > 0 {
+					t.SetWall(x, y, layerIndex, false, 0, map_model.RegularWall)
+				}
 			}
-		}
+		})
+		editAction.Redo(m)
+		a.actions.Add(editAction)
 	} else {
 		a.actions.Redo(m)
 	}
@@ -629,6 +1168,7 @@ type PasteToMoveLayerAction struct {
 	pos        utils.Int2
 	copyResult copy_model.CopyResult
 	actions    *UndoRedoContainer
+	err        error
 }
 
 func NewPasteToMoveLayerAction(pos utils.Int2, copyResult copy_model.CopyResult) *PasteToMoveLayerAction {
@@ -658,7 +1198,7 @@ func (a *PasteToMoveLayerAction) Redo(m UndoRedoActionModels) {
 		selectedLayerBefore := m.Slm.Selected()
 		selectedLayerIdBefore := m.M.Layer(selectedLayerBefore).Uuid
 
-		addPastedLayerAction := NewAddLayerAction("Pasted layer", true, map_model.MoveLayerType)
+		addPastedLayerAction := NewAddLayerAction("Pasted layer", true, map_model.MoveLayerType, m.M.Level())
 		addPastedLayerAction.Redo(m)
 		a.actions.Add(addPastedLayerAction)
 
@@ -681,41 +1221,52 @@ func (a *PasteToMoveLayerAction) Redo(m UndoRedoActionModels) {
 
 		selected := make(map[utils.Int2]select_model.Selected)
 
-		// если какие-то блоки были выделены, то переносим их в moveLayer
-		for pos, location := range a.copyResult.Locations {
-			pos.X, pos.Y = m.R.TransformToRot(pos.X, pos.Y)
+		moveLayerIndex = m.M.LayerIndexById(moveLayerId)
 
-			pos.X -= leftTop.X
-			pos.Y -= leftTop.Y
-
-			if location.Floor > 0 {
-				action := NewSetFloorAction(pos, moveLayerId, location.Floor)
-				action.Redo(m)
-				a.actions.Add(action)
+		// если какие-то блоки были выделены, то переносим их в moveLayer
+		editAction := NewEditAction(func(t *rot_map_model.Tx) {
+			for pos, location := range a.copyResult.Locations {
+				pos.X, pos.Y = m.R.TransformToRot(pos.X, pos.Y)
 
-				s := selected[pos]
-				s.Floor = true
-				selected[pos] = s
-			}
-			if location.RightWall > 0 {
-				action := NewSetWallAction(pos, moveLayerId, true, location.RightWall)
-				action.Redo(m)
-				a.actions.Add(action)
+				pos.X -= leftTop.X
+				pos.Y -= leftTop.Y
 
 				s := selected[pos]
-				s.RightWall = true
-				selected[pos] = s
-			}
-			if location.BottomWall > 0 {
-				action := NewSetWallAction(pos, moveLayerId, false, location.BottomWall)
-				action.Redo(m)
-				a.actions.Add(action)
-
-				s := selected[pos]
-				s.BottomWall = true
-				selected[pos] = s
+				if location.Floor > 0 {
+					t.SetFloor(pos.X, pos.Y, moveLayerIndex, location.Floor)
+					s.Floor = true
+				}
+				if location.Link != nil {
+					t.SetLink(pos.X, pos.Y, moveLayerIndex, location.Link)
+					s.Floor = true
+				}
+				if location.Effects != 0 {
+					t.SetEffects(pos.X, pos.Y, moveLayerIndex, location.Effects)
+					s.Floor = true
+				}
+				if len(location.Markers) > 0 {
+					t.SetMarkers(pos.X, pos.Y, moveLayerIndex, location.Markers)
+					s.Markers = 1<<len(location.Markers) - 1
+				}
+				if location.RightWall > 0 {
+					t.SetWall(pos.X, pos.Y, moveLayerIndex, true, location.RightWall, location.RightWallKind)
+					s.RightWall = true
+				}
+				if location.BottomWall > 0 {
+					t.SetWall(pos.X, pos.Y, moveLayerIndex, false, location.BottomWall, location.BottomWallKind)
+					s.BottomWall = true
+				}
+				if s != (select_model.Selected{}) {
+					selected[pos] = s
+				}
 			}
+		})
+		editAction.Redo(m)
+		if a.err = editAction.Err(); a.err != nil {
+			a.actions.rollback(m)
+			return
 		}
+		a.actions.Add(editAction)
 
 		action := NewSetSelectedAction(selected)
 		action.Redo(m)
@@ -729,6 +1280,10 @@ func (a *PasteToMoveLayerAction) Redo(m UndoRedoActionModels) {
 	}
 }
 
+func (a *PasteToMoveLayerAction) Err() error {
+	return a.err
+}
+
 func (a *PasteToMoveLayerAction) Undo(m UndoRedoActionModels) {
 	a.actions.Undo(m)
 }
@@ -768,3 +1323,153 @@ func (a *SetCenterAction) Redo(m UndoRedoActionModels) {
 func (a *SetCenterAction) Undo(m UndoRedoActionModels) {
 	m.Cm.Set(a.oldPos)
 }
+
+type SetDimensionsAction struct {
+	dimensions    map_model.Dimensions
+	oldDimensions map_model.Dimensions
+	err           error
+}
+
+func NewSetDimensionsAction(dimensions map_model.Dimensions) *SetDimensionsAction {
+	return &SetDimensionsAction{dimensions: dimensions}
+}
+
+func (a *SetDimensionsAction) Redo(m UndoRedoActionModels) {
+	a.oldDimensions = m.M.Dimensions()
+	a.err = m.M.SetDimensions(a.dimensions)
+}
+
+func (a *SetDimensionsAction) Err() error {
+	return a.err
+}
+
+func (a *SetDimensionsAction) Undo(m UndoRedoActionModels) {
+	m.M.SetDimensions(a.oldDimensions)
+}
+
+type SetTilesetAction struct {
+	ref    tileset.Ref
+	oldRef tileset.Ref
+}
+
+func NewSetTilesetAction(ref tileset.Ref) *SetTilesetAction {
+	return &SetTilesetAction{ref: ref}
+}
+
+func (a *SetTilesetAction) Redo(m UndoRedoActionModels) {
+	a.oldRef = m.M.Tileset()
+	m.M.SetTileset(a.ref)
+}
+
+func (a *SetTilesetAction) Undo(m UndoRedoActionModels) {
+	m.M.SetTileset(a.oldRef)
+}
+
+type SetPartyAction struct {
+	pos          utils.Int2
+	direction    party_model.Direction
+	oldPos       utils.Int2
+	oldDirection party_model.Direction
+}
+
+func NewSetPartyAction(pos utils.Int2, direction party_model.Direction) *SetPartyAction {
+	return &SetPartyAction{pos: pos, direction: direction}
+}
+
+func (a *SetPartyAction) Redo(m UndoRedoActionModels) {
+	a.oldPos, a.oldDirection = m.Pm.Get()
+	m.Pm.Set(a.pos, a.direction)
+}
+
+func (a *SetPartyAction) Undo(m UndoRedoActionModels) {
+	m.Pm.Set(a.oldPos, a.oldDirection)
+}
+
+// Перемещает партию и рисует floor под ней в слое layerId, если там ещё ничего нет
+type StepPartyAction struct {
+	move    party_model.Move
+	layerId uuid.UUID
+	floor   uint32
+	actions *UndoRedoContainer
+	err     error
+}
+
+func NewStepPartyAction(move party_model.Move, layerId uuid.UUID, floor uint32) *StepPartyAction {
+	return &StepPartyAction{move: move, layerId: layerId, floor: floor, actions: NewUndoRedoContainer()}
+}
+
+func (a *StepPartyAction) Redo(m UndoRedoActionModels) {
+	if a.actions.Len() == 0 {
+		pos, direction := m.Pm.Next(a.move)
+
+		// на завёрнутой карте партия выходит с противоположного края, шаг за край ограниченной - ошибка
+		pos, a.err = m.M.NormalizePos(pos.X, pos.Y)
+		if a.err != nil {
+			return
+		}
+
+		if a.floor > 0 {
+			// SetFloorAction работает с повёрнутыми координатами, а у партии координаты карты
+			x, y := m.R.TransformFromRot(pos.X, pos.Y)
+
+			layerIndex := m.M.LayerIndexById(a.layerId)
+			if layerIndex != -1 && m.Rm.Floor(x, y, layerIndex) == 0 {
+				action := NewSetFloorAction(utils.NewInt2(x, y), a.layerId, a.floor)
+				action.Redo(m)
+				if a.err = action.Err(); a.err != nil {
+					return
+				}
+				a.actions.Add(action)
+			}
+		}
+
+		action := NewSetPartyAction(pos, direction)
+		action.Redo(m)
+		a.actions.Add(action)
+	} else {
+		a.actions.Redo(m)
+	}
+}
+
+func (a *StepPartyAction) Err() error {
+	return a.err
+}
+
+func (a *StepPartyAction) Undo(m UndoRedoActionModels) {
+	a.actions.Undo(m)
+}
+
+// Переходит по link'у внутри карты: меняет уровень, переносит туда партию и центрирует карту.
+// center - новый центр карты в пикселях(см. CenterModel)
+type FollowLinkAction struct {
+	link    map_model.Link
+	center  utils.Int2
+	actions *UndoRedoContainer
+}
+
+func NewFollowLinkAction(link map_model.Link, center utils.Int2) *FollowLinkAction {
+	return &FollowLinkAction{link: link, center: center, actions: NewUndoRedoContainer()}
+}
+
+func (a *FollowLinkAction) Redo(m UndoRedoActionModels) {
+	if a.actions.Len() == 0 {
+		changeLevelAction := NewChangeLevelAction(a.link.Level)
+		changeLevelAction.Redo(m)
+		a.actions.Add(changeLevelAction)
+
+		_, direction := m.Pm.Get()
+		setPartyAction := NewSetPartyAction(a.link.Target, direction)
+		setPartyAction.Redo(m)
+		a.actions.Add(setPartyAction)
+
+		setCenterAction := NewSetCenterAction(a.center)
+		setCenterAction.Redo(m)
+		a.actions.Add(setCenterAction)
+	} else {
+		a.actions.Redo(m)
+	}
+}
+
+func (a *FollowLinkAction) Undo(m UndoRedoActionModels) {
+	a.actions.Undo(m)
+}
@@ -0,0 +1,8 @@
+package undo_redo
+
+// История правок карты, как она хранится в .map файле
+type History struct {
+	Queue            *UndoRedoQueue `json:"queue"`
+	ChangeGeneration uint64         `json:"generation"` // правка, на которой карта сохранена
+	Angle            int            `json:"angle"`      // поворот карты: action'ы хранят повёрнутые координаты
+}
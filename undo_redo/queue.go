@@ -1,10 +1,13 @@
 package undo_redo
 
 import (
+	"encoding/json"
 	"errors"
-	"old-school-rpg-map-editor/utils"
+	"fmt"
+	"sort"
+	"sync"
 
-	"github.com/elliotchance/pie/v2"
+	"golang.org/x/exp/maps"
 	"golang.org/x/exp/slices"
 )
 
@@ -13,16 +16,43 @@ type UndoRedoElement struct {
 	ChangeGeneration uint64
 }
 
+type undoRedoNode struct {
+	element  UndoRedoElement
+	parent   uint64   // ChangeGeneration родителя
+	children []uint64 // по порядку создания
+	redo     uint64   // потомок, в который ведёт Redo; 0 - некуда
+}
+
+// Дерево правок. Корень - начало истории(Action == nil), у каждого узла может быть несколько
+// потомков: правка после Undo начинает новую ветку, а старая остаётся и в неё можно вернуться(см. Switch).
+// Redo идёт в ту ветку, где были последний раз.
 type UndoRedoQueue struct {
-	actions              []UndoRedoElement
+	mutex                sync.Mutex
+	nodes                map[uint64]*undoRedoNode
+	root                 uint64
 	nextChangeGeneration uint64
-	maxElements          int
-
-	lastRemovedChangeGeneration uint64 // если мы сделали undo всех элементов, то надо знать какой теперь generation
+	maxElements          int // 0 - без ограничения
 }
 
 func NewUndoRedoQueue(maxElements int) *UndoRedoQueue {
-	return &UndoRedoQueue{nextChangeGeneration: 1, maxElements: maxElements}
+	return &UndoRedoQueue{
+		nodes:                map[uint64]*undoRedoNode{0: {}},
+		nextChangeGeneration: 1,
+		maxElements:          maxElements,
+	}
+}
+
+// Меняет ограничение на число правок, лишние удалятся при следующем AddAction
+func (q *UndoRedoQueue) SetMaxElements(maxElements int) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	q.maxElements = maxElements
+}
+
+func isEmptyContainer(action UndoRedoAction) bool {
+	container, ok := action.(UndoRedoActionContainer)
+	return ok && container.Len() == 0
 }
 
 func (q *UndoRedoQueue) AddAction(currentChangeGeneration uint64, action UndoRedoAction) (changeGeneration uint64, err error) {
@@ -30,88 +60,286 @@ func (q *UndoRedoQueue) AddAction(currentChangeGeneration uint64, action UndoRed
 		panic("action == nil")
 	}
 
-	if currentChangeGeneration > 0 {
-		index := slices.IndexFunc(q.actions, func(e UndoRedoElement) bool {
-			return e.ChangeGeneration == currentChangeGeneration
-		})
-		if index == -1 {
-			return 0, errors.New("cannot find generation")
-		}
-		q.actions = q.actions[:index+1]
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	node, exists := q.nodes[currentChangeGeneration]
+	if !exists {
+		return 0, errors.New("cannot find generation")
+	}
+
+	// Удаляем UndoRedoContainer которые пустые. Новый action может оказаться пустым
+	// UndoRedoContainer, в него могли ещё ничего не положить
+	for node.element.ChangeGeneration != q.root && len(node.children) == 0 && isEmptyContainer(node.element.Action) {
+		q.remove(node)
+		node = q.nodes[node.parent]
 	}
 
 	changeGeneration = q.nextChangeGeneration
 	q.nextChangeGeneration++
 
-	q.actions = append(q.actions, UndoRedoElement{Action: action, ChangeGeneration: changeGeneration})
+	q.nodes[changeGeneration] = &undoRedoNode{
+		element: UndoRedoElement{Action: action, ChangeGeneration: changeGeneration},
+		parent:  node.element.ChangeGeneration,
+	}
+	node.children = append(node.children, changeGeneration)
+	node.redo = changeGeneration
+
+	q.trim(changeGeneration)
+
+	return
+}
 
-	removeOldFrom := utils.Max(0, len(q.actions)-q.maxElements)
-	if removeOldFrom != 0 {
-		q.lastRemovedChangeGeneration = q.actions[removeOldFrom-1].ChangeGeneration
-		q.actions = q.actions[removeOldFrom:]
+// Удаляет лист node
+func (q *UndoRedoQueue) remove(node *undoRedoNode) {
+	parent := q.nodes[node.parent]
+	index := slices.Index(parent.children, node.element.ChangeGeneration)
+	parent.children = slices.Delete(parent.children, index, index+1)
+	if parent.redo == node.element.ChangeGeneration {
+		parent.redo = 0
+		if len(parent.children) > 0 {
+			parent.redo = parent.children[len(parent.children)-1]
+		}
 	}
 
-	// Удаляем UndoRedoContainer которые пустые. Не удаляем последний UndoRedoContainer, так как
-	// в него могли ещё ничего не положить
-	newActions := pie.Filter(q.actions[:len(q.actions)-1], func(a UndoRedoElement) bool {
-		if container, ok := a.Action.(UndoRedoActionContainer); ok {
-			return container.Len() > 0
+	delete(q.nodes, node.element.ChangeGeneration)
+}
+
+// Удаляет правки сверх maxElements. Сначала самые старые брошенные ветки, потом
+// начало истории. Путь к current не трогается.
+func (q *UndoRedoQueue) trim(current uint64) {
+	for q.maxElements > 0 && len(q.nodes)-1 > q.maxElements {
+		var oldestLeaf *undoRedoNode
+		for _, node := range q.nodes {
+			if len(node.children) == 0 && node.element.ChangeGeneration != current && node.element.ChangeGeneration != q.root &&
+				(oldestLeaf == nil || node.element.ChangeGeneration < oldestLeaf.element.ChangeGeneration) {
+				oldestLeaf = node
+			}
 		}
-		return true
-	})
-	newActions = append(newActions, q.actions[len(q.actions)-1])
-	q.actions = newActions
 
-	return
+		if oldestLeaf != nil {
+			q.remove(oldestLeaf)
+			continue
+		}
+
+		// осталась одна цепочка: первая правка становится началом истории
+		root := q.nodes[q.root]
+		delete(q.nodes, q.root)
+		q.root = root.children[0]
+		q.nodes[q.root].element.Action = nil
+	}
 }
 
 func (q *UndoRedoQueue) Action(changeGeneration uint64) UndoRedoElement {
-	if changeGeneration == q.lastRemovedChangeGeneration {
-		return UndoRedoElement{Action: nil, ChangeGeneration: changeGeneration}
-	}
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
 
-	index := slices.IndexFunc(q.actions, func(e UndoRedoElement) bool {
-		return e.ChangeGeneration == changeGeneration
-	})
-	if index == -1 {
+	node, exists := q.nodes[changeGeneration]
+	if !exists {
 		return UndoRedoElement{}
 	}
 
-	return q.actions[index]
+	return node.element
 }
 
 func (q *UndoRedoQueue) ActionBefore(changeGeneration uint64) UndoRedoElement {
-	index := slices.IndexFunc(q.actions, func(e UndoRedoElement) bool {
-		return e.ChangeGeneration == changeGeneration
-	})
-	if index == -1 {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	node, exists := q.nodes[changeGeneration]
+	if !exists || changeGeneration == q.root {
 		return UndoRedoElement{}
 	}
 
-	if index == 0 {
-		return UndoRedoElement{Action: nil, ChangeGeneration: q.lastRemovedChangeGeneration}
+	return q.nodes[node.parent].element
+}
+
+func (q *UndoRedoQueue) ActionAfter(changeGeneration uint64) UndoRedoElement {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	node, exists := q.nodes[changeGeneration]
+	if !exists || node.redo == 0 {
+		return UndoRedoElement{}
 	}
 
-	return q.actions[index-1]
+	return q.nodes[node.redo].element
 }
 
-func (q *UndoRedoQueue) ActionAfter(changeGeneration uint64) UndoRedoElement {
-	var index int
-
-	if changeGeneration == q.lastRemovedChangeGeneration {
-		index = -1
-	} else {
-		index = slices.IndexFunc(q.actions, func(e UndoRedoElement) bool {
-			return e.ChangeGeneration == changeGeneration
-		})
-		if index == -1 {
-			return UndoRedoElement{}
+func (q *UndoRedoQueue) Contains(changeGeneration uint64) bool {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	_, exists := q.nodes[changeGeneration]
+	return exists
+}
+
+// Нет ни одной правки
+func (q *UndoRedoQueue) IsEmpty() bool {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	return len(q.nodes) == 1
+}
+
+// Начало истории
+func (q *UndoRedoQueue) Root() UndoRedoElement {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	return q.nodes[q.root].element
+}
+
+// Правки, сделанные после changeGeneration, по порядку создания
+func (q *UndoRedoQueue) Children(changeGeneration uint64) []UndoRedoElement {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	node, exists := q.nodes[changeGeneration]
+	if !exists {
+		return nil
+	}
+
+	res := make([]UndoRedoElement, 0, len(node.children))
+	for _, g := range node.children {
+		res = append(res, q.nodes[g].element)
+	}
+
+	return res
+}
+
+// Переход из from в to по дереву: сначала Undo для undo(по порядку), потом Redo для redo.
+// Ветка с to становится веткой для Redo.
+func (q *UndoRedoQueue) Switch(from, to uint64) (undo, redo []UndoRedoElement, err error) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	if _, exists := q.nodes[from]; !exists {
+		return nil, nil, errors.New("cannot find generation")
+	}
+	if _, exists := q.nodes[to]; !exists {
+		return nil, nil, errors.New("cannot find generation")
+	}
+
+	ancestors := make(map[uint64]struct{})
+	for g := from; ; g = q.nodes[g].parent {
+		ancestors[g] = struct{}{}
+		if g == q.root {
+			break
 		}
 	}
 
-	if index == len(q.actions)-1 {
-		return UndoRedoElement{}
+	ancestor := to
+	for {
+		if _, exists := ancestors[ancestor]; exists {
+			break
+		}
+		redo = append(redo, q.nodes[ancestor].element)
+		node := q.nodes[ancestor]
+		q.nodes[node.parent].redo = ancestor
+		ancestor = node.parent
+	}
+	for i, j := 0, len(redo)-1; i < j; i, j = i+1, j-1 {
+		redo[i], redo[j] = redo[j], redo[i]
 	}
 
-	return q.actions[index+1]
+	for g := from; g != ancestor; g = q.nodes[g].parent {
+		undo = append(undo, q.nodes[g].element)
+	}
+
+	return undo, redo, nil
+}
+
+type undoRedoNodeJson struct {
+	ChangeGeneration uint64          `json:"generation"`
+	Parent           uint64          `json:"parent"`
+	Redo             uint64          `json:"redo,omitempty"`
+	Action           json.RawMessage `json:"action,omitempty"`
+}
+
+func (q *UndoRedoQueue) MarshalJSON() ([]byte, error) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	t := struct {
+		Root                 uint64             `json:"root"`
+		NextChangeGeneration uint64             `json:"next_generation"`
+		Nodes                []undoRedoNodeJson `json:"nodes"`
+	}{Root: q.root, NextChangeGeneration: q.nextChangeGeneration}
+
+	// потомок всегда новее родителя, так что при загрузке родитель будет раньше
+	generations := maps.Keys(q.nodes)
+	sort.Slice(generations, func(i, j int) bool { return generations[i] < generations[j] })
+
+	for _, g := range generations {
+		node := q.nodes[g]
+
+		var action json.RawMessage
+		if node.element.Action != nil {
+			var err error
+			action, err = marshalAction(node.element.Action)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		t.Nodes = append(t.Nodes, undoRedoNodeJson{ChangeGeneration: g, Parent: node.parent, Redo: node.redo, Action: action})
+	}
+
+	return json.Marshal(t)
+}
+
+func (q *UndoRedoQueue) UnmarshalJSON(d []byte) error {
+	var t struct {
+		Root                 uint64             `json:"root"`
+		NextChangeGeneration uint64             `json:"next_generation"`
+		Nodes                []undoRedoNodeJson `json:"nodes"`
+	}
+
+	err := json.Unmarshal(d, &t)
+	if err != nil {
+		return err
+	}
+
+	nodes := make(map[uint64]*undoRedoNode, len(t.Nodes))
+	for _, n := range t.Nodes {
+		if _, exists := nodes[n.ChangeGeneration]; exists || n.ChangeGeneration >= t.NextChangeGeneration {
+			return fmt.Errorf("bad generation %d", n.ChangeGeneration)
+		}
+
+		node := &undoRedoNode{element: UndoRedoElement{ChangeGeneration: n.ChangeGeneration}, parent: n.Parent, redo: n.Redo}
+
+		if n.ChangeGeneration != t.Root {
+			parent, exists := nodes[n.Parent]
+			if !exists {
+				return fmt.Errorf("generation %d: no parent %d", n.ChangeGeneration, n.Parent)
+			}
+			parent.children = append(parent.children, n.ChangeGeneration)
+
+			node.element.Action, err = unmarshalAction(n.Action)
+			if err != nil {
+				return fmt.Errorf("generation %d: %w", n.ChangeGeneration, err)
+			}
+		}
+
+		nodes[n.ChangeGeneration] = node
+	}
+
+	if _, exists := nodes[t.Root]; !exists {
+		return errors.New("no root")
+	}
+	for _, node := range nodes {
+		if node.redo != 0 && !slices.Contains(node.children, node.redo) {
+			node.redo = 0
+		}
+	}
+
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	q.nodes = nodes
+	q.root = t.Root
+	q.nextChangeGeneration = t.NextChangeGeneration
+
+	return nil
 }
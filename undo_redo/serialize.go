@@ -0,0 +1,385 @@
+package undo_redo
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"old-school-rpg-map-editor/common/tileset"
+	"old-school-rpg-map-editor/models/copy_model"
+	"old-school-rpg-map-editor/models/map_model"
+	"old-school-rpg-map-editor/utils"
+	"reflect"
+
+	"github.com/google/uuid"
+	"golang.org/x/exp/slices"
+)
+
+// Сохраняемые поля action'а: имя в json -> указатель на поле. Сохраняется и то, что
+// запомнил Redo(старые значения и т.д.), чтобы после загрузки работали Undo и Redo.
+type actionFields map[string]any
+
+type serializableAction interface {
+	UndoRedoAction
+	fields() actionFields
+}
+
+// Имена action'ов в файле. Имена менять нельзя, иначе не загрузится сохранённая история
+var actionTypes = map[string]func() serializableAction{
+	"container":                          func() serializableAction { return NewUndoRedoContainer() },
+	"set_center_container":               func() serializableAction { return NewSetCenterContainer() },
+	"rotate_map_container":               func() serializableAction { return NewRotateMapContainer() },
+	"set_floor":                          func() serializableAction { return &SetFloorAction{} },
+	"set_wall":                           func() serializableAction { return &SetWallAction{} },
+	"edit":                               func() serializableAction { return &EditAction{} },
+	"set_note_id":                        func() serializableAction { return &SetNoteIdAction{} },
+	"set_notes":                          func() serializableAction { return &SetNotesAction{} },
+	"update_notes":                       func() serializableAction { return &UpdateNotesAction{} },
+	"set_link":                           func() serializableAction { return &SetLinkAction{} },
+	"set_effects":                        func() serializableAction { return &SetEffectsAction{} },
+	"set_markers":                        func() serializableAction { return &SetMarkersAction{} },
+	"add_layer":                          func() serializableAction { return &AddLayerAction{} },
+	"delete_layer":                       func() serializableAction { return &DeleteLayerAction{} },
+	"move_layer":                         func() serializableAction { return &MoveLayerAction{} },
+	"set_layer_level":                    func() serializableAction { return &SetLayerLevelAction{} },
+	"set_level":                          func() serializableAction { return &SetLevelAction{} },
+	"change_level":                       func() serializableAction { return NewChangeLevelAction(0) },
+	"clear_layer":                        func() serializableAction { return &ClearLayerAction{} },
+	"set_locations":                      func() serializableAction { return &SetLocationsAction{} },
+	"import_layer":                       func() serializableAction { return NewImportLayerAction("", nil) },
+	"move_to_selected":                   func() serializableAction { return &MoveToSelectedAction{} },
+	"select":                             func() serializableAction { return &SelectAction{} },
+	"unselect_all":                       func() serializableAction { return &UnselectAllAction{} },
+	"select_by_effects":                  func() serializableAction { return &SelectByEffectsAction{} },
+	"set_selected":                       func() serializableAction { return &SetSelectedAction{} },
+	"merge_layers":                       func() serializableAction { return NewMergeLayersAction(uuid.UUID{}, uuid.UUID{}) },
+	"merge_layer_down":                   func() serializableAction { return NewMergeLayerDownAction(uuid.UUID{}) },
+	"set_mode_and_merge_down_move_layer": func() serializableAction { return NewSetModeAndMergeDownMoveLayerAction(0) },
+	"set_mode":                           func() serializableAction { return &SetModeAction{} },
+	"rotate_clockwise":                   func() serializableAction { return &RotateClockwiseAction{} },
+	"rotate_counterclockwise":            func() serializableAction { return &RotateCounterclockwiseAction{} },
+	"cut":                                func() serializableAction { return NewCutAction(copy_model.CopyResult{}) },
+	"paste_to_move_layer":                func() serializableAction { return NewPasteToMoveLayerAction(utils.Int2{}, copy_model.CopyResult{}) },
+	"set_selected_layer":                 func() serializableAction { return &SetSelectedLayerAction{} },
+	"set_center":                         func() serializableAction { return &SetCenterAction{} },
+	"set_dimensions":                     func() serializableAction { return &SetDimensionsAction{} },
+	"set_tileset":                        func() serializableAction { return NewSetTilesetAction(tileset.Ref{}) },
+	"set_party":                          func() serializableAction { return &SetPartyAction{} },
+	"step_party":                         func() serializableAction { return NewStepPartyAction(0, uuid.UUID{}, 0) },
+	"follow_link":                        func() serializableAction { return NewFollowLinkAction(map_model.Link{}, utils.Int2{}) },
+}
+
+var actionNames = func() map[reflect.Type]string {
+	names := make(map[reflect.Type]string, len(actionTypes))
+	for name, newAction := range actionTypes {
+		names[reflect.TypeOf(newAction())] = name
+	}
+	return names
+}()
+
+// Имя action'а в файле, пустое для неизвестного action'а
+func ActionName(action UndoRedoAction) string {
+	return actionNames[reflect.TypeOf(action)]
+}
+
+type actionJson struct {
+	Type string                     `json:"type"`
+	Data map[string]json.RawMessage `json:"data,omitempty"`
+}
+
+func marshalAction(action UndoRedoAction) ([]byte, error) {
+	name := ActionName(action)
+	if len(name) == 0 {
+		return nil, fmt.Errorf("cannot save action %T", action)
+	}
+
+	t := actionJson{Type: name, Data: make(map[string]json.RawMessage)}
+	for key, field := range action.(serializableAction).fields() {
+		d, err := json.Marshal(field)
+		if err != nil {
+			return nil, fmt.Errorf("%s.%s: %w", name, key, err)
+		}
+		t.Data[key] = d
+	}
+
+	return json.Marshal(t)
+}
+
+func unmarshalAction(d []byte) (UndoRedoAction, error) {
+	var t actionJson
+	err := json.Unmarshal(d, &t)
+	if err != nil {
+		return nil, err
+	}
+
+	newAction, exists := actionTypes[t.Type]
+	if !exists {
+		return nil, fmt.Errorf("unknown action %q", t.Type)
+	}
+
+	action := newAction()
+	for key, field := range action.fields() {
+		if d, exists := t.Data[key]; exists {
+			err := json.Unmarshal(d, field)
+			if err != nil {
+				return nil, fmt.Errorf("%s.%s: %w", t.Type, key, err)
+			}
+		}
+	}
+
+	return action, nil
+}
+
+// Список action'ов контейнера, каждый со своим типом
+type actionList []UndoRedoAction
+
+func (l *actionList) MarshalJSON() ([]byte, error) {
+	t := make([]json.RawMessage, 0, len(*l))
+	for _, action := range *l {
+		d, err := marshalAction(action)
+		if err != nil {
+			return nil, err
+		}
+		t = append(t, d)
+	}
+
+	return json.Marshal(t)
+}
+
+func (l *actionList) UnmarshalJSON(d []byte) error {
+	var t []json.RawMessage
+	err := json.Unmarshal(d, &t)
+	if err != nil {
+		return err
+	}
+
+	*l = make(actionList, 0, len(t))
+	for _, d := range t {
+		action, err := unmarshalAction(d)
+		if err != nil {
+			return err
+		}
+		*l = append(*l, action)
+	}
+
+	return nil
+}
+
+// Action'ы контейнера. Контейнер может пополняться во время сохранения(автосохранение
+// идёт в своей goroutine), поэтому под его mutex
+type containerActions UndoRedoContainer
+
+func (c *containerActions) MarshalJSON() ([]byte, error) {
+	c.mutex.Lock()
+	actions := actionList(slices.Clone(c.actions))
+	c.mutex.Unlock()
+
+	return actions.MarshalJSON()
+}
+
+func (c *containerActions) UnmarshalJSON(d []byte) error {
+	var actions actionList
+	err := actions.UnmarshalJSON(d)
+	if err != nil {
+		return err
+	}
+
+	c.mutex.Lock()
+	c.actions = actions
+	c.mutex.Unlock()
+
+	return nil
+}
+
+// Правки EditAction списком: ключ-структуру json в map не умеет
+type editList map[layerCell]map_model.LocationEdit
+
+type editJson struct {
+	LayerId uuid.UUID          `json:"layer_id"`
+	Pos     utils.Int2         `json:"pos"`
+	Before  map_model.Location `json:"before"`
+	After   map_model.Location `json:"after"`
+}
+
+func (l *editList) MarshalJSON() ([]byte, error) {
+	if *l == nil {
+		return nil, errors.New("edit action was not done")
+	}
+
+	t := make([]editJson, 0, len(*l))
+	for cell, edit := range *l {
+		t = append(t, editJson{LayerId: cell.layerId, Pos: cell.pos, Before: edit.Before, After: edit.After})
+	}
+
+	return json.Marshal(t)
+}
+
+func (l *editList) UnmarshalJSON(d []byte) error {
+	var t []editJson
+	err := json.Unmarshal(d, &t)
+	if err != nil {
+		return err
+	}
+
+	*l = make(editList, len(t))
+	for _, e := range t {
+		(*l)[layerCell{layerId: e.LayerId, pos: e.Pos}] = map_model.LocationEdit{Before: e.Before, After: e.After}
+	}
+
+	return nil
+}
+
+func (c *UndoRedoContainer) fields() actionFields {
+	return actionFields{"actions": (*containerActions)(c)}
+}
+
+func (a *SetFloorAction) fields() actionFields {
+	return actionFields{"pos": &a.pos, "layer_id": &a.layerId, "value": &a.value, "old_value": &a.oldValue}
+}
+
+func (a *SetWallAction) fields() actionFields {
+	return actionFields{"pos": &a.pos, "layer_id": &a.layerId, "is_right": &a.isRight, "value": &a.value, "kind": &a.kind, "old_value": &a.oldValue, "old_kind": &a.oldKind}
+}
+
+func (a *EditAction) fields() actionFields {
+	return actionFields{"edits": (*editList)(&a.edits)}
+}
+
+func (a *SetNoteIdAction) fields() actionFields {
+	return actionFields{"pos": &a.pos, "layer_id": &a.layerId, "value": &a.value, "old_value": &a.oldValue}
+}
+
+func (a *SetNotesAction) fields() actionFields {
+	return actionFields{"notes": &a.notes, "old_notes": &a.oldNotes}
+}
+
+func (a *UpdateNotesAction) fields() actionFields {
+	return actionFields{"set": &a.set, "delete_ids": &a.deleteIds, "old_notes": &a.oldNotes, "added_ids": &a.addedIds}
+}
+
+func (a *SetLinkAction) fields() actionFields {
+	return actionFields{"pos": &a.pos, "layer_id": &a.layerId, "value": &a.value, "old_value": &a.oldValue}
+}
+
+func (a *SetEffectsAction) fields() actionFields {
+	return actionFields{"pos": &a.pos, "layer_id": &a.layerId, "value": &a.value, "old_value": &a.oldValue}
+}
+
+func (a *SetMarkersAction) fields() actionFields {
+	return actionFields{"pos": &a.pos, "layer_id": &a.layerId, "value": &a.value, "old_value": &a.oldValue}
+}
+
+func (a *AddLayerAction) fields() actionFields {
+	return actionFields{"layer_id": &a.layerId, "name": &a.name, "visible": &a.visible, "layer_type": &a.layerType, "level": &a.level}
+}
+
+func (a *DeleteLayerAction) fields() actionFields {
+	return actionFields{"layer_id": &a.layerId, "layer": &a.layer, "layer_index": &a.layerIndex}
+}
+
+func (a *MoveLayerAction) fields() actionFields {
+	return actionFields{"offset": &a.offset, "layer_id": &a.layerId, "old_index": &a.oldIndex}
+}
+
+func (a *SetLayerLevelAction) fields() actionFields {
+	return actionFields{"layer_id": &a.layerId, "level": &a.level, "old_level": &a.oldLevel}
+}
+
+func (a *SetLevelAction) fields() actionFields {
+	return actionFields{"level": &a.level, "old_level": &a.oldLevel}
+}
+
+func (a *ChangeLevelAction) fields() actionFields {
+	return actionFields{"level": &a.level, "actions": (*containerActions)(a.actions)}
+}
+
+func (a *ClearLayerAction) fields() actionFields {
+	return actionFields{"layer_id": &a.layerId, "locations": &a.locations}
+}
+
+func (a *SetLocationsAction) fields() actionFields {
+	return actionFields{"layer_id": &a.layerId, "locations": &a.locations, "old_locations": &a.oldLocations}
+}
+
+func (a *ImportLayerAction) fields() actionFields {
+	return actionFields{"name": &a.name, "locations": &a.locations, "actions": (*containerActions)(a.actions)}
+}
+
+func (a *MoveToSelectedAction) fields() actionFields {
+	return actionFields{"offset": &a.offset, "move_layer_id": &a.moveLayerId}
+}
+
+func (a *SelectAction) fields() actionFields {
+	return actionFields{"pos": &a.pos, "select_type": &a.selectType, "marker": &a.marker}
+}
+
+func (a *UnselectAllAction) fields() actionFields {
+	return actionFields{"selected": &a.selected}
+}
+
+func (a *SelectByEffectsAction) fields() actionFields {
+	return actionFields{"effects": &a.effects, "old_selected": &a.oldSelected}
+}
+
+func (a *SetSelectedAction) fields() actionFields {
+	return actionFields{"selected": &a.selected, "old_selected": &a.oldSelected}
+}
+
+func (a *MergeLayersAction) fields() actionFields {
+	return actionFields{"from_layer_id": &a.fromLayerId, "to_layer_id": &a.toLayerId, "actions": (*containerActions)(a.actions)}
+}
+
+func (a *MergeLayerDownAction) fields() actionFields {
+	return actionFields{"from_layer_id": &a.fromLayerId, "actions": (*containerActions)(a.actions)}
+}
+
+func (a *SetModeAndMergeDownMoveLayerAction) fields() actionFields {
+	return actionFields{"mode": &a.mode, "actions": (*containerActions)(a.actions)}
+}
+
+func (a *SetModeAction) fields() actionFields {
+	return actionFields{"mode": &a.mode, "old_mode": &a.oldMode}
+}
+
+func (a *RotateClockwiseAction) fields() actionFields {
+	return actionFields{}
+}
+
+func (a *RotateCounterclockwiseAction) fields() actionFields {
+	return actionFields{}
+}
+
+func (a *CutAction) fields() actionFields {
+	return actionFields{"copy_result": &a.copyResult, "actions": (*containerActions)(a.actions)}
+}
+
+func (a *PasteToMoveLayerAction) fields() actionFields {
+	return actionFields{"pos": &a.pos, "copy_result": &a.copyResult, "actions": (*containerActions)(a.actions)}
+}
+
+func (a *SetSelectedLayerAction) fields() actionFields {
+	return actionFields{"value": &a.value, "old_value": &a.oldValue}
+}
+
+func (a *SetCenterAction) fields() actionFields {
+	return actionFields{"pos": &a.pos, "old_pos": &a.oldPos}
+}
+
+func (a *SetDimensionsAction) fields() actionFields {
+	return actionFields{"dimensions": &a.dimensions, "old_dimensions": &a.oldDimensions}
+}
+
+func (a *SetTilesetAction) fields() actionFields {
+	return actionFields{"ref": &a.ref, "old_ref": &a.oldRef}
+}
+
+func (a *SetPartyAction) fields() actionFields {
+	return actionFields{"pos": &a.pos, "direction": &a.direction, "old_pos": &a.oldPos, "old_direction": &a.oldDirection}
+}
+
+func (a *StepPartyAction) fields() actionFields {
+	return actionFields{"move": &a.move, "layer_id": &a.layerId, "floor": &a.floor, "actions": (*containerActions)(a.actions)}
+}
+
+func (a *FollowLinkAction) fields() actionFields {
+	return actionFields{"link": &a.link, "center": &a.center, "actions": (*containerActions)(a.actions)}
+}
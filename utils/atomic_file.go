@@ -0,0 +1,48 @@
+package utils
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// Записывает файл через временный файл в той же директории и rename, так что при падении
+// на диске остаётся либо старое, либо новое содержимое целиком
+func WriteFileAtomic(filePath string, write func(w io.Writer) error) error {
+	f, err := os.CreateTemp(filepath.Dir(filePath), filepath.Base(filePath)+".*.tmp")
+	if err != nil {
+		return err
+	}
+
+	tmpPath := f.Name()
+	ok := false
+	defer func() {
+		if !ok {
+			f.Close()
+			os.Remove(tmpPath)
+		}
+	}()
+
+	err = write(f)
+	if err != nil {
+		return err
+	}
+
+	err = f.Sync()
+	if err != nil {
+		return err
+	}
+
+	err = f.Close()
+	if err != nil {
+		return err
+	}
+
+	err = os.Rename(tmpPath, filePath)
+	if err != nil {
+		return err
+	}
+
+	ok = true
+	return nil
+}
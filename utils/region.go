@@ -0,0 +1,37 @@
+package utils
+
+// Область клеток [Min, Max). All - все клетки, Min и Max не важны.
+type Region struct {
+	All      bool
+	Min, Max Int2
+}
+
+func NewRegion(min, max Int2) Region {
+	return Region{Min: min, Max: max}
+}
+
+func NewCellRegion(x, y int) Region {
+	return Region{Min: NewInt2(x, y), Max: NewInt2(x+1, y+1)}
+}
+
+func NewAllRegion() Region {
+	return Region{All: true}
+}
+
+func (r Region) IsEmpty() bool {
+	return !r.All && (r.Min.X >= r.Max.X || r.Min.Y >= r.Max.Y)
+}
+
+// Наименьшая область, в которую входят r и o
+func (r Region) Union(o Region) Region {
+	switch {
+	case r.All || o.All:
+		return NewAllRegion()
+	case r.IsEmpty():
+		return o
+	case o.IsEmpty():
+		return r
+	}
+
+	return NewRegion(NewInt2(Min(r.Min.X, o.Min.X), Min(r.Min.Y, o.Min.Y)), NewInt2(Max(r.Max.X, o.Max.X), Max(r.Max.Y, o.Max.Y)))
+}
@@ -1,41 +1,60 @@
 package doc_tabs_widget
 
 import (
+	"errors"
 	"fmt"
-	"image"
 	"old-school-rpg-map-editor/common"
-	"old-school-rpg-map-editor/configuration"
+	"old-school-rpg-map-editor/common/map_renderer"
+	"old-school-rpg-map-editor/common/note_links"
 	"old-school-rpg-map-editor/models/map_model"
 	"old-school-rpg-map-editor/models/maps_model"
 	"old-school-rpg-map-editor/models/selected_map_tab_model"
+	"old-school-rpg-map-editor/models/tilesets_model"
 	"old-school-rpg-map-editor/undo_redo"
 	"old-school-rpg-map-editor/utils"
+	"old-school-rpg-map-editor/widgets/effects_widget"
 	"old-school-rpg-map-editor/widgets/layers_widget"
+	"old-school-rpg-map-editor/widgets/links_widget"
 	"old-school-rpg-map-editor/widgets/map_widget"
+	"old-school-rpg-map-editor/widgets/markers_widget"
 	"old-school-rpg-map-editor/widgets/notes_widget"
 	"old-school-rpg-map-editor/widgets/palette_widget"
+	"old-school-rpg-map-editor/widgets/wall_kind_widget"
 	"path/filepath"
 
+	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
 	"github.com/elliotchance/pie/v2"
 	"github.com/google/uuid"
 	"golang.org/x/exp/slices"
 )
 
-func newMapWidget(mapsModel *maps_model.MapsModel, mapId uuid.UUID, isClickFloor bool, floorPaletteWidget *palette_widget.PaletteWidget, wallPaletteWidget *palette_widget.PaletteWidget, notesWidget *notes_widget.NotesWidget, paletteTabFloors *container.TabItem, paletteTabNotes *container.TabItem, paletteTabs *container.AppTabs, layersWidget *layers_widget.LayersWidget, floorImage, wallImage, floorSelectedImage, wallSelectedImage image.Image, imageConfig configuration.ImageConfig) *map_widget.MapWidget {
+func newMapWidget(window fyne.Window, mapsModel *maps_model.MapsModel, mapId uuid.UUID, isClickFloor bool, floorPaletteWidget *palette_widget.PaletteWidget, wallPaletteWidget *palette_widget.PaletteWidget, wallKindWidget *wall_kind_widget.WallKindWidget, notesWidget *notes_widget.NotesWidget, linksWidget *links_widget.LinksWidget, effectsWidget *effects_widget.EffectsWidget, markersWidget *markers_widget.MarkersWidget, paletteTabFloors *container.TabItem, paletteTabNotes *container.TabItem, paletteTabLinks *container.TabItem, paletteTabEffects *container.TabItem, paletteTabMarkers *container.TabItem, paletteTabs *container.AppTabs, layersWidget *layers_widget.LayersWidget, tilesetsModel *tilesets_model.TilesetsModel) *map_widget.MapWidget {
 	mapElem := mapsModel.GetById(mapId)
 	model := mapElem.Model
 	rotModel := mapElem.RotMapModel
 
 	var moveSelectedContainer *undo_redo.UndoRedoContainer
+	// первая ошибка перетаскивания, показывается по его окончании
+	var moveSelectedErr error
 
-	mapWidget := map_widget.NewMapWidget(floorImage, wallImage, floorSelectedImage, wallSelectedImage,
-		imageConfig, mapElem.RotateModel, mapElem.RotMapModel, mapElem.RotSelectModel, mapElem.ModeModel, mapElem.NotesModel, mapElem.CenterModel, func(x, y int) {
+	t, images := tilesetsModel.Get(model.Tileset())
+
+	mapWidget := map_widget.NewMapWidget(images.Floor, images.Wall, images.FloorSelected, images.WallSelected,
+		t.ImageConfig(), mapElem.RotateModel, mapElem.RotMapModel, mapElem.RotSelectModel, mapElem.ModeModel, mapElem.NotesModel, mapElem.CenterModel, mapElem.PartyModel, func(x, y int) {
 			selectedTab := paletteTabs.Selected()
 			if selectedTab == nil {
 				return
 			}
 
+			// на завёрнутой карте клик по призраку попадает в клетку с противоположного края
+			x, y, err := rotModel.NormalizePos(x, y)
+			if err != nil {
+				dialog.ShowError(err, window)
+				return
+			}
+
 			if selectedTab == paletteTabFloors {
 				activeLayer := mapElem.SelectedLayerModel.Selected()
 				layerId := model.LayerInfo(activeLayer).Uuid
@@ -47,8 +66,7 @@ func newMapWidget(mapsModel *maps_model.MapsModel, mapId uuid.UUID, isClickFloor
 
 				err := common.MakeAction(undo_redo.NewSetFloorAction(utils.NewInt2(x, y), layerId, value), mapsModel, mapId, nil)
 				if err != nil {
-					// TODO
-					fmt.Println(err)
+					dialog.ShowError(err, window)
 					return
 				}
 			} else if selectedTab == paletteTabNotes {
@@ -61,33 +79,112 @@ func newMapWidget(mapsModel *maps_model.MapsModel, mapId uuid.UUID, isClickFloor
 				}
 
 				err := common.MakeAction(undo_redo.NewSetNoteIdAction(utils.NewInt2(x, y), layerId, value), mapsModel, mapId, nil)
+				if err != nil {
+					dialog.ShowError(err, window)
+					return
+				}
+			} else if selectedTab == paletteTabEffects {
+				activeLayer := mapElem.SelectedLayerModel.Selected()
+				layerId := model.LayerInfo(activeLayer).Uuid
+
+				selected := effectsWidget.Selected()
+				if selected == 0 {
+					return
+				}
+
+				value := rotModel.Effects(x, y, model.LayerIndexById(layerId))
+				if value.Has(selected) {
+					value &^= selected
+				} else {
+					value |= selected
+				}
+
+				err := common.MakeAction(undo_redo.NewSetEffectsAction(utils.NewInt2(x, y), layerId, value), mapsModel, mapId, nil)
+				if err != nil {
+					dialog.ShowError(err, window)
+					return
+				}
+			} else if selectedTab == paletteTabLinks {
+				activeLayer := mapElem.SelectedLayerModel.Selected()
+				layerId := model.LayerInfo(activeLayer).Uuid
+
+				value, err := linksWidget.Link()
+				if err != nil {
+					// TODO
+					fmt.Println(err)
+					return
+				}
+
+				oldValue := rotModel.Link(x, y, model.LayerIndexById(layerId))
+				if (oldValue == nil && value == nil) || (oldValue != nil && value != nil && *oldValue == *value) {
+					return
+				}
+
+				err = common.MakeAction(undo_redo.NewSetLinkAction(utils.NewInt2(x, y), layerId, value), mapsModel, mapId, nil)
+				if err != nil {
+					dialog.ShowError(err, window)
+					return
+				}
+			} else if selectedTab == paletteTabMarkers {
+				activeLayer := mapElem.SelectedLayerModel.Selected()
+				layerId := model.LayerInfo(activeLayer).Uuid
+
+				marker, err := markersWidget.Marker()
 				if err != nil {
 					// TODO
 					fmt.Println(err)
 					return
 				}
+
+				value := slices.Clone(rotModel.Markers(x, y, model.LayerIndexById(layerId)))
+				if i := slices.Index(value, marker); i != -1 {
+					value = slices.Delete(value, i, i+1)
+				} else if len(value) < map_model.MaxMarkers {
+					value = append(value, marker)
+				} else {
+					return
+				}
+
+				err = common.MakeAction(undo_redo.NewSetMarkersAction(utils.NewInt2(x, y), layerId, value), mapsModel, mapId, nil)
+				if err != nil {
+					dialog.ShowError(err, window)
+					return
+				}
 			}
 		}, func(x, y int, isRight bool) {
+			// на завёрнутой карте клик по призраку попадает в клетку с противоположного края,
+			// стены левой и верхней границы карты лежат в клетке за краем
+			x, y, err := rotModel.NormalizeWallPos(x, y, isRight)
+			if err != nil {
+				dialog.ShowError(err, window)
+				return
+			}
+
 			activeLayer := mapElem.SelectedLayerModel.Selected()
 			layerId := model.LayerInfo(activeLayer).Uuid
 
 			value := uint32(wallPaletteWidget.Selected())
+			kind := wallKindWidget.Selected()
+			if value == 0 {
+				kind = map_model.RegularWall
+			}
 			{
 				wall := rotModel.Wall(x, y, model.LayerIndexById(layerId), isRight)
-				if wall == value {
+				wallKind := rotModel.WallKind(x, y, model.LayerIndexById(layerId), isRight)
+				if wall == value && wallKind == kind {
 					return
 				}
 			}
 
-			err := common.MakeAction(undo_redo.NewSetWallAction(utils.NewInt2(x, y), layerId, isRight, value), mapsModel, mapId, nil)
+			err = common.MakeAction(undo_redo.NewSetWallAction(utils.NewInt2(x, y), layerId, isRight, value, kind), mapsModel, mapId, nil)
 			if err != nil {
-				// TODO
-				fmt.Println(err)
+				dialog.ShowError(err, window)
 				return
 			}
 		}, func(offsetX, offsetY int, moveType map_widget.MoveSelectedToType) {
 			if moveType == map_widget.BeginMoveSelectedTo {
 				moveSelectedContainer = undo_redo.NewUndoRedoContainer()
+				moveSelectedErr = nil
 			}
 
 			if moveSelectedContainer != nil {
@@ -95,10 +192,21 @@ func newMapWidget(mapsModel *maps_model.MapsModel, mapId uuid.UUID, isClickFloor
 				moveLayerId := mapElem.Model.LayerInfo(moveLayerIndex).Uuid
 
 				action := undo_redo.NewMoveToSelectedAction(moveLayerId, utils.NewInt2(offsetX, offsetY))
-				action.Redo(undo_redo.NewUndoRedoActionModels(mapElem.Model, mapElem.RotateModel, mapElem.RotMapModel, mapElem.RotSelectModel, mapElem.SelectModel, mapElem.ModeModel, mapElem.SelectedLayerModel, mapElem.CenterModel))
-				moveSelectedContainer.Add(action)
+				action.Redo(undo_redo.NewUndoRedoActionModels(mapElem.Model, mapElem.RotateModel, mapElem.RotMapModel, mapElem.RotSelectModel, mapElem.SelectModel, mapElem.ModeModel, mapElem.SelectedLayerModel, mapElem.CenterModel, mapElem.PartyModel, mapElem.NotesModel))
+				// сдвиг за край карты пропускаем, слой остаётся на месте
+				if err := action.Err(); err != nil {
+					if moveSelectedErr == nil {
+						moveSelectedErr = err
+					}
+				} else {
+					moveSelectedContainer.Add(action)
+				}
 
 				if moveType == map_widget.FinishMoveSelectedTo {
+					if moveSelectedErr != nil {
+						dialog.ShowError(moveSelectedErr, window)
+					}
+
 					err := common.MakeAction(moveSelectedContainer, mapsModel, mapId, nil)
 					if err != nil {
 						// TODO
@@ -127,7 +235,7 @@ func newMapWidget(mapsModel *maps_model.MapsModel, mapId uuid.UUID, isClickFloor
 
 			addNewAction := func(pos utils.Int2, selectType undo_redo.SelectType) {
 				action := undo_redo.NewSelectAction(pos, selectType)
-				action.Redo(undo_redo.NewUndoRedoActionModels(mapElem.Model, mapElem.RotateModel, mapElem.RotMapModel, mapElem.RotSelectModel, mapElem.SelectModel, mapElem.ModeModel, mapElem.SelectedLayerModel, mapElem.CenterModel))
+				action.Redo(undo_redo.NewUndoRedoActionModels(mapElem.Model, mapElem.RotateModel, mapElem.RotMapModel, mapElem.RotSelectModel, mapElem.SelectModel, mapElem.ModeModel, mapElem.SelectedLayerModel, mapElem.CenterModel, mapElem.PartyModel, mapElem.NotesModel))
 				actions.Add(action)
 			}
 
@@ -143,6 +251,26 @@ func newMapWidget(mapsModel *maps_model.MapsModel, mapId uuid.UUID, isClickFloor
 				addNewAction(pos, undo_redo.BottomWall)
 			}
 
+			err := common.MakeAction(actions, mapsModel, mapId, nil)
+			if err != nil {
+				// TODO
+				fmt.Println(err)
+				return
+			}
+		}, func(x, y int, index int) {
+			// клик по отметке выделяет только её, как новая рамка
+			actions := undo_redo.NewUndoRedoContainer()
+
+			actionModels := undo_redo.NewUndoRedoActionModels(mapElem.Model, mapElem.RotateModel, mapElem.RotMapModel, mapElem.RotSelectModel, mapElem.SelectModel, mapElem.ModeModel, mapElem.SelectedLayerModel, mapElem.CenterModel, mapElem.PartyModel, mapElem.NotesModel)
+
+			unselectAllAction := undo_redo.NewUnselectAllAction()
+			unselectAllAction.Redo(actionModels)
+			actions.Add(unselectAllAction)
+
+			selectAction := undo_redo.NewSelectMarkerAction(utils.NewInt2(x, y), index)
+			selectAction.Redo(actionModels)
+			actions.Add(selectAction)
+
 			err := common.MakeAction(actions, mapsModel, mapId, nil)
 			if err != nil {
 				// TODO
@@ -175,7 +303,7 @@ type DocTabsWidget struct {
 	IsFloorTabSelected func() bool
 }
 
-func NewDocTabsWidget(mapsModel *maps_model.MapsModel, selectedMapTabModel *selected_map_tab_model.SelectedMapTabModel, floorPaletteWidget *palette_widget.PaletteWidget, wallPaletteWidget *palette_widget.PaletteWidget, notesWidget *notes_widget.NotesWidget, paletteTabFloors *container.TabItem, paletteTabNotes *container.TabItem, paletteTabs *container.AppTabs, layersWidget *layers_widget.LayersWidget, floorImage, wallImage, floorSelectedImage, wallSelectedImage image.Image, imageConfig configuration.ImageConfig) *DocTabsWidget {
+func NewDocTabsWidget(window fyne.Window, mapsModel *maps_model.MapsModel, selectedMapTabModel *selected_map_tab_model.SelectedMapTabModel, floorPaletteWidget *palette_widget.PaletteWidget, wallPaletteWidget *palette_widget.PaletteWidget, wallKindWidget *wall_kind_widget.WallKindWidget, notesWidget *notes_widget.NotesWidget, linksWidget *links_widget.LinksWidget, effectsWidget *effects_widget.EffectsWidget, markersWidget *markers_widget.MarkersWidget, paletteTabFloors *container.TabItem, paletteTabNotes *container.TabItem, paletteTabLinks *container.TabItem, paletteTabEffects *container.TabItem, paletteTabMarkers *container.TabItem, paletteTabs *container.AppTabs, layersWidget *layers_widget.LayersWidget, tilesetsModel *tilesets_model.TilesetsModel) *DocTabsWidget {
 	w := &DocTabsWidget{}
 	w.container = container.NewDocTabs()
 	w.mapsModel = mapsModel
@@ -224,12 +352,13 @@ func NewDocTabsWidget(mapsModel *maps_model.MapsModel, selectedMapTabModel *sele
 
 				if index > -1 {
 					tabs[index].Text = tabName
+					updateTiles(tilesetsModel, m.Model, tabs[index].Content.(*map_widget.MapWidget))
 					if w.container.Selected() == d.ExternalData {
 						w.container.OnSelected(w.container.Selected())
 					}
 					tabs = slices.Delete(tabs, index, index+1)
 				} else {
-					mapWidget := newMapWidget(mapsModel, m.MapId, w.IsFloorTabSelected(), floorPaletteWidget, wallPaletteWidget, notesWidget, paletteTabFloors, paletteTabNotes, paletteTabs, layersWidget, floorImage, wallImage, floorSelectedImage, wallSelectedImage, imageConfig)
+					mapWidget := newMapWidget(window, mapsModel, m.MapId, w.IsFloorTabSelected(), floorPaletteWidget, wallPaletteWidget, wallKindWidget, notesWidget, linksWidget, effectsWidget, markersWidget, paletteTabFloors, paletteTabNotes, paletteTabLinks, paletteTabEffects, paletteTabMarkers, paletteTabs, layersWidget, tilesetsModel)
 					item := container.NewTabItem(tabName, mapWidget)
 
 					w.container.Append(item)
@@ -245,6 +374,14 @@ func NewDocTabsWidget(mapsModel *maps_model.MapsModel, selectedMapTabModel *sele
 		}
 	})
 
+	tilesetsModel.AddDataChangeListener(func() {
+		for _, d := range mapsModel.GetIdAndExternalData() {
+			if mapWidget := GetMapWidget(d.ExternalData); mapWidget != nil {
+				updateTiles(tilesetsModel, mapsModel.GetById(d.MapId).Model, mapWidget)
+			}
+		}
+	})
+
 	selectedMapTabModel.AddDataChangeListener(func() {
 		mapElem := mapsModel.GetById(selectedMapTabModel.Selected())
 		if (mapElem.MapId != uuid.UUID{}) {
@@ -255,14 +392,178 @@ func NewDocTabsWidget(mapsModel *maps_model.MapsModel, selectedMapTabModel *sele
 	return w
 }
 
+// Перерисовывает карту тайлами её набора, если набор сменился
+func updateTiles(tilesetsModel *tilesets_model.TilesetsModel, model *map_model.MapModel, mapWidget *map_widget.MapWidget) {
+	t, images := tilesetsModel.Get(model.Tileset())
+	mapWidget.SetTiles(map_renderer.TileImages(images), t.ImageConfig())
+}
+
 func (w *DocTabsWidget) Container() *container.DocTabs {
 	return w.container
 }
 
+// Карты открытых табов по порядку
+func (w *DocTabsWidget) MapIds() []uuid.UUID {
+	var mapIds []uuid.UUID
+	for _, item := range w.container.Items {
+		if mapElem := w.mapsModel.GetByExternalData(item); (mapElem.MapId != uuid.UUID{}) {
+			mapIds = append(mapIds, mapElem.MapId)
+		}
+	}
+	return mapIds
+}
+
+// Масштаб таба карты mapId, 0 - таба нет
+func (w *DocTabsWidget) Scale(mapId uuid.UUID) float32 {
+	if mapWidget := GetMapWidget(w.mapsModel.GetById(mapId).ExternalData); mapWidget != nil {
+		return mapWidget.Scale()
+	}
+	return 0
+}
+
+func (w *DocTabsWidget) SetScale(mapId uuid.UUID, scale float32) {
+	if mapWidget := GetMapWidget(w.mapsModel.GetById(mapId).ExternalData); mapWidget != nil {
+		mapWidget.SetScale(scale)
+	}
+}
+
 func GetMapWidget(externalData any) *map_widget.MapWidget {
-	tabItem := externalData.(*container.TabItem)
+	tabItem, _ := externalData.(*container.TabItem)
 	if tabItem == nil {
 		return nil
 	}
 	return tabItem.Content.(*map_widget.MapWidget)
 }
+
+// Значение для CenterModel, при котором клетка (x, y)(повёрнутые координаты) окажется в центре
+// виджета карты target. У только что открытой карты виджета может ещё не быть, тогда центр
+// считается по тайлам её набора в масштабе нового виджета
+func cellCenter(tilesetsModel *tilesets_model.TilesetsModel, target maps_model.MapElem, x, y int) utils.Int2 {
+	if mapWidget := GetMapWidget(target.ExternalData); mapWidget != nil {
+		return mapWidget.CellCenter(x, y)
+	}
+
+	t, _ := tilesetsModel.Get(target.Model.Tileset())
+	return map_widget.CellCenter(t.ImageConfig(), map_widget.DefaultScale, x, y)
+}
+
+// Карта, в которую ведёт путь file из карты mapId: пустой file - сама карта, иначе уже открытая
+// или только что открытая карта файла. Относительный путь считается от папки карты mapId.
+// historyErr - см. maps_model.MapsModel.Open
+func openLinkedMap(mapsModel *maps_model.MapsModel, mapId uuid.UUID, file string) (targetId uuid.UUID, historyErr error, err error) {
+	if len(file) == 0 {
+		return mapId, nil, nil
+	}
+
+	filePath, err := note_links.ResolveFile(file, mapsModel.GetById(mapId).FilePath)
+	if err != nil {
+		return uuid.UUID{}, nil, err
+	}
+
+	if targetId := mapsModel.GetByFilePath(filePath).MapId; (targetId != uuid.UUID{}) {
+		return targetId, nil, nil
+	}
+
+	return mapsModel.Open(filePath)
+}
+
+// Переходит по link'у из карты mapId. Если link ведёт в другой файл, то открывает его(или
+// переключается на уже открытый таб). historyErr - см. maps_model.MapsModel.Open
+func FollowLink(mapsModel *maps_model.MapsModel, selectedMapTabModel *selected_map_tab_model.SelectedMapTabModel, tilesetsModel *tilesets_model.TilesetsModel, mapId uuid.UUID, link map_model.Link) (historyErr error, err error) {
+	targetId, historyErr, err := openLinkedMap(mapsModel, mapId, link.File)
+	if err != nil {
+		return nil, err
+	}
+
+	target := mapsModel.GetById(targetId)
+
+	x, y := target.RotateModel.TransformFromRot(link.Target.X, link.Target.Y)
+
+	err = common.MakeAction(undo_redo.NewFollowLinkAction(link, cellCenter(tilesetsModel, target, x, y)), mapsModel, targetId, nil)
+	if err != nil {
+		return historyErr, err
+	}
+
+	selectedMapTabModel.SetSelected(targetId)
+
+	return historyErr, nil
+}
+
+// Показывает клетку cell(координаты карты) карты mapId: переключается на её таб и уровень,
+// центрирует карту на клетке и мигает ей
+func ShowCell(mapsModel *maps_model.MapsModel, selectedMapTabModel *selected_map_tab_model.SelectedMapTabModel, tilesetsModel *tilesets_model.TilesetsModel, mapId uuid.UUID, cell map_model.LayerCell) error {
+	target := mapsModel.GetById(mapId)
+	if (target.MapId == uuid.UUID{}) {
+		return errors.New("map is closed")
+	}
+
+	return ShowPos(mapsModel, selectedMapTabModel, tilesetsModel, mapId, cell.Pos, target.Model.LayerInfo(cell.LayerIndex).Level)
+}
+
+// Как ShowCell, но клетка задаётся координатами карты и уровнем
+func ShowPos(mapsModel *maps_model.MapsModel, selectedMapTabModel *selected_map_tab_model.SelectedMapTabModel, tilesetsModel *tilesets_model.TilesetsModel, mapId uuid.UUID, pos utils.Int2, level int32) error {
+	target := mapsModel.GetById(mapId)
+	if (target.MapId == uuid.UUID{}) {
+		return errors.New("map is closed")
+	}
+
+	selectedMapTabModel.SetSelected(mapId)
+
+	x, y := target.RotateModel.TransformFromRot(pos.X, pos.Y)
+
+	center := cellCenter(tilesetsModel, target, x, y)
+
+	actionModels := undo_redo.NewUndoRedoActionModels(target.Model, target.RotateModel, target.RotMapModel, target.RotSelectModel, target.SelectModel, target.ModeModel, target.SelectedLayerModel, target.CenterModel, target.PartyModel, target.NotesModel)
+	actions := undo_redo.NewUndoRedoContainer()
+
+	if level != target.Model.Level() {
+		changeLevelAction := undo_redo.NewChangeLevelAction(level)
+		changeLevelAction.Redo(actionModels)
+		actions.Add(changeLevelAction)
+	}
+
+	setCenterAction := undo_redo.NewSetCenterAction(center)
+	setCenterAction.Redo(actionModels)
+	actions.Add(setCenterAction)
+
+	err := common.MakeAction(actions, mapsModel, mapId, nil)
+	if err != nil {
+		return err
+	}
+
+	if mapWidget := GetMapWidget(target.ExternalData); mapWidget != nil {
+		mapWidget.Flash(x, y)
+	}
+
+	return nil
+}
+
+// Переходит по ссылке из заметки карты mapId: открывает карту ссылки, если её нет среди открытых,
+// и показывает клетку ссылки или первую клетку с заметкой ссылки. Возвращает карту ссылки,
+// historyErr - см. maps_model.MapsModel.Open
+func FollowNoteLink(mapsModel *maps_model.MapsModel, selectedMapTabModel *selected_map_tab_model.SelectedMapTabModel, tilesetsModel *tilesets_model.TilesetsModel, mapId uuid.UUID, link note_links.Link) (targetId uuid.UUID, historyErr error, err error) {
+	targetId, historyErr, err = openLinkedMap(mapsModel, mapId, link.File)
+	if err != nil {
+		return uuid.UUID{}, nil, err
+	}
+
+	target := mapsModel.GetById(targetId)
+
+	if link.Cell != nil {
+		level := target.Model.Level()
+		if link.Level != nil {
+			level = *link.Level
+		}
+		return targetId, historyErr, ShowPos(mapsModel, selectedMapTabModel, tilesetsModel, targetId, *link.Cell, level)
+	}
+
+	if len(link.NoteId) > 0 {
+		if cells := target.Model.NoteCells()[link.NoteId]; len(cells) > 0 {
+			return targetId, historyErr, ShowCell(mapsModel, selectedMapTabModel, tilesetsModel, targetId, cells[0])
+		}
+	}
+
+	selectedMapTabModel.SetSelected(targetId)
+
+	return targetId, historyErr, nil
+}
@@ -0,0 +1,118 @@
+package effects_widget
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"old-school-rpg-map-editor/common"
+	"old-school-rpg-map-editor/common/overlays"
+	"old-school-rpg-map-editor/models/map_model"
+	"old-school-rpg-map-editor/models/maps_model"
+	"old-school-rpg-map-editor/models/mode_model"
+	"old-school-rpg-map-editor/models/selected_map_tab_model"
+	"old-school-rpg-map-editor/undo_redo"
+	"sync"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/canvas"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+	"github.com/google/uuid"
+)
+
+const iconSize = 16
+
+func makeEffectIcon(effect map_model.Effects) *canvas.Image {
+	img := image.NewRGBA(image.Rect(0, 0, iconSize, iconSize))
+	draw.Draw(img, img.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	overlays.DrawEffectIcon(img, img.Bounds().Inset(1), effect)
+
+	icon := canvas.NewImageFromImage(img)
+	icon.FillMode = canvas.ImageFillOriginal
+	return icon
+}
+
+// Палитра effects. Клик по карте включает отмеченные effects в клетке, если их там нет, и выключает, если есть.
+type EffectsWidget struct {
+	mutex     sync.Mutex
+	container *fyne.Container
+	selected  map_model.Effects
+}
+
+func NewEffectsWidget(window fyne.Window, mapsModel *maps_model.MapsModel, selectedMapTabModel *selected_map_tab_model.SelectedMapTabModel) *EffectsWidget {
+	w := &EffectsWidget{selected: map_model.AllEffects[0]}
+
+	checks := container.NewVBox()
+	for _, effect := range map_model.AllEffects {
+		effect := effect
+
+		check := widget.NewCheck(effect.String(), func(b bool) {
+			w.mutex.Lock()
+			defer w.mutex.Unlock()
+
+			if b {
+				w.selected |= effect
+			} else {
+				w.selected &^= effect
+			}
+		})
+		check.SetChecked(w.selected.Has(effect))
+
+		checks.Add(container.NewHBox(makeEffectIcon(effect), check))
+	}
+
+	// выделяет все клетки выбранного слоя с отмеченными effects
+	selectCells := widget.NewButton("Select cells", func() {
+		mapElem := mapsModel.GetById(selectedMapTabModel.Selected())
+		if (mapElem.MapId == uuid.UUID{}) {
+			return
+		}
+
+		effects := w.Selected()
+		if effects == 0 {
+			return
+		}
+
+		actions := undo_redo.NewUndoRedoContainer()
+
+		actionModels := undo_redo.NewUndoRedoActionModels(mapElem.Model, mapElem.RotateModel, mapElem.RotMapModel, mapElem.RotSelectModel, mapElem.SelectModel, mapElem.ModeModel, mapElem.SelectedLayerModel, mapElem.CenterModel, mapElem.PartyModel, mapElem.NotesModel)
+
+		if mapElem.ModeModel.Mode() != mode_model.SelectMode {
+			setModeAction := undo_redo.NewSetModeAndMergeDownMoveLayerAction(mode_model.SelectMode)
+			setModeAction.Redo(actionModels)
+			if err := setModeAction.Err(); err != nil {
+				dialog.ShowError(err, window)
+				return
+			}
+			actions.Add(setModeAction)
+		}
+
+		selectAction := undo_redo.NewSelectByEffectsAction(effects)
+		selectAction.Redo(actionModels)
+		actions.Add(selectAction)
+
+		err := common.MakeAction(actions, mapsModel, mapElem.MapId, nil)
+		if err != nil {
+			// TODO
+			fmt.Println(err)
+			return
+		}
+	})
+
+	w.container = container.NewBorder(nil, selectCells, nil, nil, container.NewVScroll(checks))
+
+	return w
+}
+
+func (w *EffectsWidget) Selected() map_model.Effects {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	return w.selected
+}
+
+func (w *EffectsWidget) Container() *fyne.Container {
+	return w.container
+}
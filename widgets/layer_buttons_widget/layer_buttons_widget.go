@@ -16,8 +16,26 @@ import (
 	"fyne.io/fyne/v2/theme"
 	"fyne.io/fyne/v2/widget"
 	"github.com/google/uuid"
+	"golang.org/x/exp/slices"
 )
 
+// Смещение до соседнего слоя того же уровня в направлении direction(-1 или 1). Если соседа нет, то 0.
+func neighbourLayerOffset(m *map_model.MapModel, layerIndex int32, direction int) int {
+	indices := m.LayerIndicesByLevel(m.LayerInfo(layerIndex).Level)
+
+	index := slices.Index(indices, layerIndex)
+	if index == -1 {
+		return 0
+	}
+
+	index += direction
+	if index < 0 || index >= len(indices) {
+		return 0
+	}
+
+	return int(indices[index] - layerIndex)
+}
+
 type LayerButtonsWidget struct {
 	mapsModel           *maps_model.MapsModel
 	selectedMapTabModel *selected_map_tab_model.SelectedMapTabModel
@@ -40,7 +58,7 @@ func NewLayerButtonsWidget(parent fyne.Window, mapsModel *maps_model.MapsModel,
 	w.addLayerButtom = widget.NewButtonWithIcon("", theme.ContentAddIcon(), func() {
 		mapElem := mapsModel.GetById(selectedMapTabModel.Selected())
 
-		err := common.MakeAction(undo_redo.NewAddLayerAction("Layer", true, map_model.RegularLayerType), w.mapsModel, mapElem.MapId, nil)
+		err := common.MakeAction(undo_redo.NewAddLayerAction("Layer", true, map_model.RegularLayerType, mapElem.Model.Level()), w.mapsModel, mapElem.MapId, nil)
 		if err != nil {
 			// TODO
 			fmt.Println(err)
@@ -68,7 +86,12 @@ func NewLayerButtonsWidget(parent fyne.Window, mapsModel *maps_model.MapsModel,
 		activeLayer := mapElem.SelectedLayerModel.Selected()
 		layerId := locations.LayerInfo(activeLayer).Uuid
 
-		err := common.MakeAction(undo_redo.NewMoveLayerAction(-1, layerId), w.mapsModel, mapElem.MapId, nil)
+		offset := neighbourLayerOffset(locations, activeLayer, -1)
+		if offset == 0 {
+			return
+		}
+
+		err := common.MakeAction(undo_redo.NewMoveLayerAction(offset, layerId), w.mapsModel, mapElem.MapId, nil)
 		if err != nil {
 			// TODO
 			fmt.Println(err)
@@ -82,7 +105,12 @@ func NewLayerButtonsWidget(parent fyne.Window, mapsModel *maps_model.MapsModel,
 		activeLayer := mapElem.SelectedLayerModel.Selected()
 		layerId := locations.LayerInfo(activeLayer).Uuid
 
-		err := common.MakeAction(undo_redo.NewMoveLayerAction(1, layerId), w.mapsModel, mapElem.MapId, nil)
+		offset := neighbourLayerOffset(locations, activeLayer, 1)
+		if offset == 0 {
+			return
+		}
+
+		err := common.MakeAction(undo_redo.NewMoveLayerAction(offset, layerId), w.mapsModel, mapElem.MapId, nil)
 		if err != nil {
 			// TODO
 			fmt.Println(err)
@@ -135,24 +163,32 @@ func NewLayerButtonsWidget(parent fyne.Window, mapsModel *maps_model.MapsModel,
 
 			layerIndex := mapElem.SelectedLayerModel.Selected()
 
-			if layerIndex == 0 {
+			if neighbourLayerOffset(mapElem.Model, layerIndex, -1) == 0 {
 				w.moveUpLayerButtom.Disable()
 			} else {
 				w.moveUpLayerButtom.Enable()
 			}
-			if layerIndex == int32(mapElem.Model.NumLayers()-1) {
+			if neighbourLayerOffset(mapElem.Model, layerIndex, 1) == 0 {
 				w.moveDownLayerButtom.Disable()
 			} else {
 				w.moveDownLayerButtom.Enable()
 			}
 			w.addLayerButtom.Enable()
-			w.removeLayerButtom.Enable()
+			// последний слой уровня не удаляем, иначе уровень пропадёт вместе с выбранным слоем
+			if len(mapElem.Model.LayerIndicesByLevel(mapElem.Model.Level())) > 1 {
+				w.removeLayerButtom.Enable()
+			} else {
+				w.removeLayerButtom.Disable()
+			}
 			w.renameLayerButtom.Enable()
 		}
 		updateButtonState()
 
-		disconnectSelectedMapTab.AddSlot(mapElem.Model.AddDataChangeListener(func() {
-			updateButtonState()
+		disconnectSelectedMapTab.AddSlot(mapElem.Model.AddChangeListener(func(change map_model.Change) {
+			switch change.Property {
+			case map_model.LayersChange, map_model.LayerLevelChange, map_model.LevelChange:
+				updateButtonState()
+			}
 		}))
 		disconnectSelectedMapTab.AddSlot(mapElem.SelectedLayerModel.AddDataChangeListener(func() {
 			updateButtonState()
@@ -12,6 +12,7 @@ import (
 	"fyne.io/fyne/v2/layout"
 	"fyne.io/fyne/v2/widget"
 	"github.com/google/uuid"
+	"golang.org/x/exp/slices"
 )
 
 type LayersWidget struct {
@@ -64,14 +65,17 @@ func NewLayersWidget(visibleIcon, invisibleIcon fyne.Resource) *LayersWidget {
 	clearListHandlers(&w.List)
 
 	w.List.OnSelected = func(id widget.ListItemID) {
-		if w.selectedLayerModel != nil {
-			if w.mapModel != nil {
-				indices := w.mapModel.LayerIndexByType(map_model.MoveLayerType)
-				if len(indices) > 0 {
-					id = int(indices[0])
-				}
+		if w.selectedLayerModel != nil && w.mapModel != nil {
+			layerIndex := w.layerIndex(id)
+
+			indices := w.mapModel.LayerIndexByType(map_model.MoveLayerType)
+			if len(indices) > 0 {
+				layerIndex = indices[0]
+			}
+
+			if layerIndex >= 0 {
+				w.selectedLayerModel.SetSelected(layerIndex)
 			}
-			w.selectedLayerModel.SetSelected(int32(id))
 		}
 	}
 
@@ -95,12 +99,12 @@ func (w *LayersWidget) SetMapModel(mapModel *map_model.MapModel) {
 	if mapModel == nil {
 		clearListHandlers(&w.List)
 	} else {
-		w.List.Length = func() int { return mapModel.NumLayers() }
+		w.List.Length = func() int { return len(mapModel.LayerIndicesByLevel(mapModel.Level())) }
 		w.List.CreateItem = func() fyne.CanvasObject {
 			return newRow(w.visibleIcon)
 		}
 		w.List.UpdateItem = func(i widget.ListItemID, o fyne.CanvasObject) {
-			layer := mapModel.LayerInfo(int32(i))
+			layer := mapModel.LayerInfo(w.layerIndex(i))
 			if (layer.Uuid == uuid.UUID{}) {
 				return
 			}
@@ -108,7 +112,12 @@ func (w *LayersWidget) SetMapModel(mapModel *map_model.MapModel) {
 			dataChanged(o.(*fyne.Container), mapModel, layer, w.visibleIcon, w.invisibleIcon)
 		}
 
-		w.disconnectMapModel.AddSlot(mapModel.AddDataChangeListener(w.Refresh))
+		// список показывает слои, а не клетки
+		w.disconnectMapModel.AddSlot(mapModel.AddChangeListener(func(change map_model.Change) {
+			if change.Property != map_model.CellsChange {
+				w.Refresh()
+			}
+		}))
 
 		var activeLayerBeforeDelete uuid.UUID
 		var nextActiveLayerBeforeDelete uuid.UUID // на случай, если удалили activeLayerBeforeDelete
@@ -135,7 +144,7 @@ func (w *LayersWidget) SetMapModel(mapModel *map_model.MapModel) {
 			}
 
 			if index >= 0 {
-				w.Select(int(index))
+				w.selectLayer(index)
 			}
 
 			activeLayerBeforeDelete = uuid.UUID{}
@@ -153,7 +162,7 @@ func (w *LayersWidget) SetMapModel(mapModel *map_model.MapModel) {
 		w.disconnectMapModel.AddSlot(mapModel.AddAfterMoveLayerListener(func() {
 			index := mapModel.LayerIndexById(activeLayerBeforeMove)
 			if index >= 0 {
-				w.Select(int(index))
+				w.selectLayer(index)
 			}
 
 			activeLayerBeforeMove = uuid.UUID{}
@@ -163,6 +172,26 @@ func (w *LayersWidget) SetMapModel(mapModel *map_model.MapModel) {
 	w.Refresh()
 }
 
+// В списке показываются только слои текущего уровня, поэтому индекс в списке не совпадает с индексом слоя
+func (w *LayersWidget) layerIndex(id widget.ListItemID) int32 {
+	indices := w.mapModel.LayerIndicesByLevel(w.mapModel.Level())
+	if id < 0 || id >= len(indices) {
+		return -1
+	}
+	return indices[id]
+}
+
+func (w *LayersWidget) selectLayer(layerIndex int32) {
+	if w.mapModel == nil {
+		return
+	}
+
+	id := slices.Index(w.mapModel.LayerIndicesByLevel(w.mapModel.Level()), layerIndex)
+	if id >= 0 {
+		w.Select(id)
+	}
+}
+
 func (w *LayersWidget) MapModel() *map_model.MapModel {
 	return w.mapModel
 }
@@ -181,7 +210,7 @@ func (a *LayersWidget) SetSelectedLayerModel(selectedLayerModel *selected_layer_
 
 	if selectedLayerModel != nil {
 		a.disconnectSelectedLayerModel.AddSlot(selectedLayerModel.AddDataChangeListener(func() {
-			a.Select(int(selectedLayerModel.Selected()))
+			a.selectLayer(selectedLayerModel.Selected())
 		}))
 	}
 }
@@ -0,0 +1,144 @@
+package level_widget
+
+import (
+	"fmt"
+	"old-school-rpg-map-editor/common"
+	"old-school-rpg-map-editor/models/map_model"
+	"old-school-rpg-map-editor/models/maps_model"
+	"old-school-rpg-map-editor/models/selected_map_tab_model"
+	"old-school-rpg-map-editor/undo_redo"
+	"old-school-rpg-map-editor/utils"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+	"github.com/google/uuid"
+	"golang.org/x/exp/slices"
+)
+
+func levelName(level int32) string {
+	return fmt.Sprintf("Level %d", level)
+}
+
+// Переключатель уровней(этажей) подземелья у текущей карты
+type LevelWidget struct {
+	mapsModel           *maps_model.MapsModel
+	selectedMapTabModel *selected_map_tab_model.SelectedMapTabModel
+
+	container   *fyne.Container
+	levelSelect *widget.Select
+	upButton    *widget.Button
+	downButton  *widget.Button
+
+	levels   []int32
+	updating bool // levelSelect меняется из кода, а не пользователем
+}
+
+func NewLevelWidget(mapsModel *maps_model.MapsModel, selectedMapTabModel *selected_map_tab_model.SelectedMapTabModel) *LevelWidget {
+	w := &LevelWidget{
+		mapsModel:           mapsModel,
+		selectedMapTabModel: selectedMapTabModel,
+	}
+
+	w.levelSelect = widget.NewSelect(nil, func(s string) {
+		if w.updating {
+			return
+		}
+
+		index := w.levelSelect.SelectedIndex()
+		if index < 0 || index >= len(w.levels) {
+			return
+		}
+
+		w.changeLevel(w.levels[index])
+	})
+
+	// уровни нумеруются сверху вниз, так что "вверх" это на единицу меньше
+	w.upButton = widget.NewButtonWithIcon("", theme.MoveUpIcon(), func() {
+		mapElem := mapsModel.GetById(selectedMapTabModel.Selected())
+		w.changeLevel(mapElem.Model.Level() - 1)
+	})
+	w.downButton = widget.NewButtonWithIcon("", theme.MoveDownIcon(), func() {
+		mapElem := mapsModel.GetById(selectedMapTabModel.Selected())
+		w.changeLevel(mapElem.Model.Level() + 1)
+	})
+
+	w.container = container.NewBorder(nil, nil, nil, container.NewHBox(w.upButton, w.downButton), w.levelSelect)
+
+	disableAll := func() {
+		w.levelSelect.Disable()
+		w.upButton.Disable()
+		w.downButton.Disable()
+	}
+	disableAll()
+
+	mapsModel.AddDataChangeListener(func() {
+		if mapsModel.Length() == 0 {
+			disableAll()
+		}
+	})
+
+	var disconnectSelectedMapTab utils.Signal0
+	selectedMapTabModel.AddDataChangeListener(func() {
+		disconnectSelectedMapTab.Emit()
+		disconnectSelectedMapTab.Clear()
+
+		mapElem := mapsModel.GetById(selectedMapTabModel.Selected())
+		if (mapElem.MapId == uuid.UUID{}) {
+			disableAll()
+			return
+		}
+
+		update := func() {
+			levels := mapElem.Model.Levels()
+			level := mapElem.Model.Level()
+
+			w.updating = true
+			defer func() { w.updating = false }()
+
+			if !slices.Equal(levels, w.levels) {
+				w.levels = levels
+
+				options := make([]string, len(levels))
+				for i, l := range levels {
+					options[i] = levelName(l)
+				}
+				w.levelSelect.Options = options
+			}
+			w.levelSelect.SetSelected(levelName(level))
+
+			w.levelSelect.Enable()
+			w.upButton.Enable()
+			w.downButton.Enable()
+		}
+		update()
+
+		disconnectSelectedMapTab.AddSlot(mapElem.Model.AddChangeListener(func(change map_model.Change) {
+			switch change.Property {
+			case map_model.LayersChange, map_model.LayerLevelChange, map_model.LevelChange:
+				update()
+			}
+		}))
+	})
+
+	return w
+}
+
+func (w *LevelWidget) changeLevel(level int32) {
+	mapElem := w.mapsModel.GetById(w.selectedMapTabModel.Selected())
+	if (mapElem.MapId == uuid.UUID{}) {
+		return
+	}
+
+	err := common.MakeAction(undo_redo.NewChangeLevelAction(level), w.mapsModel, mapElem.MapId, nil)
+	if err != nil {
+		// TODO
+		fmt.Println(err)
+		return
+	}
+}
+
+func (w *LevelWidget) Container() *fyne.Container {
+	return w.container
+}
@@ -0,0 +1,158 @@
+package links_widget
+
+import (
+	"errors"
+	"fmt"
+	"old-school-rpg-map-editor/models/map_model"
+	"old-school-rpg-map-editor/models/maps_model"
+	"old-school-rpg-map-editor/models/selected_map_tab_model"
+	"old-school-rpg-map-editor/utils"
+	"path/filepath"
+	"strconv"
+	"sync"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/storage"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+	"github.com/google/uuid"
+)
+
+const noLinkName = "None"
+
+var linkTypes = []map_model.LinkType{
+	map_model.StairsUpLink,
+	map_model.StairsDownLink,
+	map_model.TeleportLink,
+	map_model.PitLink,
+	map_model.ChuteLink,
+}
+
+// Палитра link'ов: тип перехода и клетка, куда он ведёт. Клик по карте ставит в клетку Link().
+type LinksWidget struct {
+	mutex     sync.Mutex
+	container *fyne.Container
+
+	typeSelect *widget.Select
+	xEntry     *widget.Entry
+	yEntry     *widget.Entry
+	levelEntry *widget.Entry
+	fileEntry  *widget.Entry
+}
+
+func NewLinksWidget(window fyne.Window, mapsModel *maps_model.MapsModel, selectedMapTabModel *selected_map_tab_model.SelectedMapTabModel) *LinksWidget {
+	w := &LinksWidget{}
+
+	options := []string{noLinkName}
+	for _, t := range linkTypes {
+		options = append(options, t.String())
+	}
+
+	w.typeSelect = widget.NewSelect(options, nil)
+	w.typeSelect.SetSelectedIndex(1)
+
+	w.xEntry = widget.NewEntry()
+	w.xEntry.SetText("0")
+	w.yEntry = widget.NewEntry()
+	w.yEntry.SetText("0")
+	w.levelEntry = widget.NewEntry()
+	w.levelEntry.SetText("0")
+	w.fileEntry = widget.NewEntry()
+	w.fileEntry.SetPlaceHolder("This map")
+
+	// переход туда, где сейчас стоит партия
+	fromParty := widget.NewButtonWithIcon("Party position", theme.MediaPlayIcon(), func() {
+		mapElem := mapsModel.GetById(selectedMapTabModel.Selected())
+		if (mapElem.MapId == uuid.UUID{}) {
+			return
+		}
+
+		pos, _ := mapElem.PartyModel.Get()
+		w.xEntry.SetText(strconv.Itoa(pos.X))
+		w.yEntry.SetText(strconv.Itoa(pos.Y))
+		w.levelEntry.SetText(strconv.Itoa(int(mapElem.Model.Level())))
+		w.fileEntry.SetText("")
+	})
+
+	browse := widget.NewButtonWithIcon("", theme.FolderOpenIcon(), func() {
+		d := dialog.NewFileOpen(func(uc fyne.URIReadCloser, err error) {
+			if uc == nil {
+				return
+			}
+
+			defer uc.Close()
+
+			if err != nil {
+				// TODO
+				fmt.Println(err)
+				return
+			}
+
+			path := uc.URI().Path()
+
+			// путь храним относительно текущей карты, чтобы каталог с картами можно было переносить
+			mapElem := mapsModel.GetById(selectedMapTabModel.Selected())
+			if len(mapElem.FilePath) > 0 {
+				if rel, err := filepath.Rel(filepath.Dir(mapElem.FilePath), path); err == nil {
+					path = rel
+				}
+			}
+
+			w.fileEntry.SetText(path)
+		}, window)
+		d.SetFilter(storage.NewExtensionFileFilter([]string{".map"}))
+		d.Resize(window.Canvas().Size())
+		d.Show()
+	})
+
+	form := widget.NewForm(
+		widget.NewFormItem("Type", w.typeSelect),
+		widget.NewFormItem("X", w.xEntry),
+		widget.NewFormItem("Y", w.yEntry),
+		widget.NewFormItem("Level", w.levelEntry),
+		widget.NewFormItem("File", container.NewBorder(nil, nil, nil, browse, w.fileEntry)),
+	)
+
+	w.container = container.NewBorder(nil, fromParty, nil, nil, form)
+
+	return w
+}
+
+// Link, который будет поставлен в клетку. nil - убрать link из клетки.
+func (w *LinksWidget) Link() (*map_model.Link, error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	index := w.typeSelect.SelectedIndex()
+	if index <= 0 {
+		return nil, nil
+	}
+
+	x, err := strconv.Atoi(w.xEntry.Text)
+	if err != nil {
+		return nil, errors.New("incorrect link x")
+	}
+
+	y, err := strconv.Atoi(w.yEntry.Text)
+	if err != nil {
+		return nil, errors.New("incorrect link y")
+	}
+
+	level, err := strconv.ParseInt(w.levelEntry.Text, 10, 32)
+	if err != nil {
+		return nil, errors.New("incorrect link level")
+	}
+
+	return &map_model.Link{
+		Type:   linkTypes[index-1],
+		File:   w.fileEntry.Text,
+		Level:  int32(level),
+		Target: utils.NewInt2(x, y),
+	}, nil
+}
+
+func (w *LinksWidget) Container() *fyne.Container {
+	return w.container
+}
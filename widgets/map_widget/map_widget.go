@@ -5,21 +5,26 @@ import (
 	"image"
 	"image/color"
 	"image/draw"
+	"old-school-rpg-map-editor/common/map_renderer"
+	"old-school-rpg-map-editor/common/overlays"
 	"old-school-rpg-map-editor/configuration"
 	"old-school-rpg-map-editor/models/center_model"
+	"old-school-rpg-map-editor/models/map_model"
 	"old-school-rpg-map-editor/models/mode_model"
 	"old-school-rpg-map-editor/models/notes_model"
+	"old-school-rpg-map-editor/models/party_model"
 	"old-school-rpg-map-editor/models/rot_map_model"
 	"old-school-rpg-map-editor/models/rot_select_model"
 	"old-school-rpg-map-editor/models/rotate_model"
+	"old-school-rpg-map-editor/models/select_model"
 	"old-school-rpg-map-editor/utils"
 	"sync"
+	"time"
 
 	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/canvas"
 	"fyne.io/fyne/v2/driver/desktop"
 	"fyne.io/fyne/v2/widget"
-	"github.com/disintegration/imaging"
 )
 
 type Mode int
@@ -30,6 +35,9 @@ const (
 	MoveMode   Mode = 2 // перемещаем элементы из selected
 )
 
+// Масштаб нового виджета
+const DefaultScale float32 = 1.
+
 type MoveSelectedToType int
 
 const (
@@ -70,18 +78,11 @@ type draggedSecondary struct {
 
 type MapWidget struct {
 	widget.BaseWidget
-	mutex                  sync.Mutex
-	origFloorImage         image.Image
-	floorImage             image.Image // resized
-	origWallImage          image.Image
-	wallImage              image.Image // resized
-	wallImage90            image.Image // resized
-	origFloorSelectedImage image.Image
-	floorSelectedImage     image.Image // resized
-	origWallSelectedImage  image.Image
-	wallSelectedImage      image.Image // resized
-	wallSelectedImage90    image.Image // resized
-	imageConfig            configuration.ImageConfig
+	mutex       sync.Mutex
+	origTiles   map_renderer.TileImages
+	tiles       map_renderer.Tiles // resized
+	imageConfig configuration.ImageConfig
+	chunkCache  *map_renderer.ChunkCache
 
 	mapModel              *rot_map_model.RotMapModel
 	disconnectMapModel    utils.Signal0
@@ -95,40 +96,46 @@ type MapWidget struct {
 	disconnectNotesModel  utils.Signal0
 	centerModel           *center_model.CenterModel
 	disconnectCenterModel utils.Signal0
+	partyModel            *party_model.PartyModel
+	disconnectPartyModel  utils.Signal0
 
 	clickFloor     func(x, y int)
 	clickWall      func(x, y int, isRight bool /*or bottom*/)
 	moveSelectedTo func(offsetX, offsetY int, moveType MoveSelectedToType)
 	selectArea     func(floors []utils.Int2, rightWall []utils.Int2, bottomWall []utils.Int2)
+	selectMarker   func(x, y int, index int)
 	unselectAll    func()
 	isClickFloor   bool // обрабатывать click на floor или wall
 	modeData       modeData
 	//offset                 utils.Float2
 	scale            float32
 	draggedSecondary draggedSecondary
+
+	flash           *utils.Int2 // клетка, которую подсвечивает Flash
+	flashVisible    bool
+	flashGeneration uint64 // новый Flash отменяет мигание предыдущего
 }
 
-func NewMapWidget(floorImage image.Image, wallImage image.Image, floorSelectedImage image.Image, wallSelectedImage image.Image, imageConfig configuration.ImageConfig, rotateModel *rotate_model.RotateModel, mapModel *rot_map_model.RotMapModel, selectModel *rot_select_model.RotSelectModel, modeModel *mode_model.ModeModel, notesModel *notes_model.NotesModel, centerModel *center_model.CenterModel, clickFloor func(x, y int), clickWall func(x, y int, isRight bool), moveSelectedTo func(offsetX, offsetY int, moveType MoveSelectedToType), selectArea func(floors []utils.Int2, rightWall []utils.Int2, bottomWall []utils.Int2), unselectAll func()) *MapWidget {
+func NewMapWidget(floorImage image.Image, wallImage image.Image, floorSelectedImage image.Image, wallSelectedImage image.Image, imageConfig configuration.ImageConfig, rotateModel *rotate_model.RotateModel, mapModel *rot_map_model.RotMapModel, selectModel *rot_select_model.RotSelectModel, modeModel *mode_model.ModeModel, notesModel *notes_model.NotesModel, centerModel *center_model.CenterModel, partyModel *party_model.PartyModel, clickFloor func(x, y int), clickWall func(x, y int, isRight bool), moveSelectedTo func(offsetX, offsetY int, moveType MoveSelectedToType), selectArea func(floors []utils.Int2, rightWall []utils.Int2, bottomWall []utils.Int2), selectMarker func(x, y int, index int), unselectAll func()) *MapWidget {
 	w := &MapWidget{
-		origFloorImage:         floorImage,
-		floorImage:             floorImage,
-		origWallImage:          wallImage,
-		wallImage:              wallImage,
-		wallImage90:            imaging.Rotate270(wallImage),
-		origFloorSelectedImage: floorSelectedImage,
-		floorSelectedImage:     floorSelectedImage,
-		origWallSelectedImage:  wallSelectedImage,
-		wallSelectedImage:      wallSelectedImage,
-		wallSelectedImage90:    imaging.Rotate270(wallSelectedImage),
-		imageConfig:            imageConfig,
-		clickFloor:             clickFloor,
-		clickWall:              clickWall,
-		moveSelectedTo:         moveSelectedTo,
-		selectArea:             selectArea,
-		unselectAll:            unselectAll,
-		modeData:               &setModeData{},
-		scale:                  1.,
+		origTiles: map_renderer.TileImages{
+			Floor:         floorImage,
+			Wall:          wallImage,
+			FloorSelected: floorSelectedImage,
+			WallSelected:  wallSelectedImage,
+		},
+		imageConfig:    imageConfig,
+		clickFloor:     clickFloor,
+		clickWall:      clickWall,
+		moveSelectedTo: moveSelectedTo,
+		selectArea:     selectArea,
+		selectMarker:   selectMarker,
+		unselectAll:    unselectAll,
+		modeData:       &setModeData{},
+		scale:          DefaultScale,
+		chunkCache:     map_renderer.NewChunkCache(),
 	}
+	w.tiles = map_renderer.NewTiles(w.origTiles, w.scale)
 
 	w.SetRotateModel(rotateModel)
 	w.SetMapModel(mapModel)
@@ -136,6 +143,7 @@ func NewMapWidget(floorImage image.Image, wallImage image.Image, floorSelectedIm
 	w.SetModeModel(modeModel)
 	w.SetNotesModel(notesModel)
 	w.SetCenterModel(centerModel)
+	w.SetPartyModel(partyModel)
 
 	w.ExtendBaseWidget(w)
 	return w
@@ -148,6 +156,7 @@ func (w *MapWidget) Destroy() {
 	w.SetModeModel(nil)
 	w.SetNotesModel(nil)
 	w.SetCenterModel(nil)
+	w.SetPartyModel(nil)
 }
 
 func (w *MapWidget) CreateRenderer() fyne.WidgetRenderer {
@@ -190,6 +199,33 @@ func (w *MapWidget) isWallSelected(model *rot_select_model.RotSelectModel, x, y
 	return false
 }
 
+// x, y - координаты на экране в пикселях. Возвращает клетку и индекс отметки под x, y или -1
+func (w *MapWidget) markerAt(x, y uint) (mapX, mapY int, index int) {
+	fFloorSize := float32(w.imageConfig.FloorSize)
+	scaledFloorWbSize := int((fFloorSize + 1) * w.scale) // With Border
+	scaledFloorWobSize := int(fFloorSize * w.scale)      // Without Border
+
+	center := w.centerModel.Get()
+
+	mapX, mapY, _, _ = w.screenPixelToFloorCoords(x, y, uint(scaledFloorWbSize), center)
+
+	_, markers := w.mapModel.VisibleMarkers(mapX, mapY)
+	if len(markers) == 0 {
+		return mapX, mapY, -1
+	}
+
+	pX, pY := w.floorCoordsToScreenPixel(mapX, mapY, 0, 0, uint(scaledFloorWbSize), center)
+	rect := image.Rect(pX, pY, pX+scaledFloorWobSize, pY+scaledFloorWobSize)
+
+	return mapX, mapY, overlays.MarkerAt(rect, len(markers), image.Pt(int(x), int(y)))
+}
+
+// x, y - координаты на экране в пикселях
+func (w *MapWidget) isMarkerSelected(model *rot_select_model.RotSelectModel, x, y uint) bool {
+	mapX, mapY, index := w.markerAt(x, y)
+	return index != -1 && model.IsMarkerSelected(mapX, mapY, index)
+}
+
 func (w *MapWidget) Tapped(ev *fyne.PointEvent) {
 	w.mutex.Lock()
 	once := sync.Once{}
@@ -221,7 +257,12 @@ func (w *MapWidget) Tapped(ev *fyne.PointEvent) {
 				w.clickWall(mapX, mapY, true)
 			}
 		}
-		//case *selectModeData:
+	case *selectModeData:
+		mapX, mapY, index := w.markerAt(uint(ev.Position.X), uint(ev.Position.Y))
+		if index != -1 {
+			once.Do(w.mutex.Unlock)
+			w.selectMarker(mapX, mapY, index)
+		}
 	}
 }
 
@@ -335,7 +376,8 @@ func (w *MapWidget) Dragged(ev *fyne.DragEvent) {
 
 		if mode.begin == nil {
 			if w.isFloorSelected(w.selectModel, uint(ev.Position.X), uint(ev.Position.Y)) ||
-				w.isWallSelected(w.selectModel, uint(ev.Position.X), uint(ev.Position.Y)) {
+				w.isWallSelected(w.selectModel, uint(ev.Position.X), uint(ev.Position.Y)) ||
+				w.isMarkerSelected(w.selectModel, uint(ev.Position.X), uint(ev.Position.Y)) {
 
 				mapX, mapY, _, _ := w.screenPixelToFloorCoords(uint(ev.Position.X), uint(ev.Position.Y), uint(scaledFloorWbSize), center)
 
@@ -489,6 +531,76 @@ func (w *MapWidget) Center() utils.Int2 {
 	return utils.NewInt2(mapX, mapY)
 }
 
+// Значение для CenterModel, при котором клетка (x, y) окажется в центре виджета
+func (w *MapWidget) CellCenter(x, y int) utils.Int2 {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	return CellCenter(w.imageConfig, w.scale, x, y)
+}
+
+// Как MapWidget.CellCenter, но для виджета с тайлами imageConfig в масштабе scale, например, если
+// виджета ещё нет
+func CellCenter(imageConfig configuration.ImageConfig, scale float32, x, y int) utils.Int2 {
+	floorSize := int((float32(imageConfig.FloorSize) + 1) * scale)
+
+	return utils.NewInt2(x*floorSize+floorSize/2, y*floorSize+floorSize/2)
+}
+
+const (
+	flashBlinks = 3
+	flashPeriod = 400 * time.Millisecond
+)
+
+// Мигает рамкой вокруг клетки (x, y)(повёрнутые координаты), например, найденной заметки
+func (w *MapWidget) Flash(x, y int) {
+	w.mutex.Lock()
+	w.flashGeneration++
+	generation := w.flashGeneration
+	w.flash = &utils.Int2{X: x, Y: y}
+	w.mutex.Unlock()
+
+	go func() {
+		for i := 0; i <= flashBlinks*2; i++ {
+			stop := func() bool {
+				w.mutex.Lock()
+				defer w.mutex.Unlock()
+
+				if w.flashGeneration != generation {
+					return true
+				}
+				w.flashVisible = i%2 == 0
+				if i == flashBlinks*2 {
+					w.flash = nil
+				}
+				return false
+			}()
+			if stop {
+				return
+			}
+
+			w.Refresh()
+			time.Sleep(flashPeriod / 2)
+		}
+	}()
+}
+
+// Меняет картинки и размеры тайлов(например, при смене набора тайлов карты)
+func (w *MapWidget) SetTiles(images map_renderer.TileImages, imageConfig configuration.ImageConfig) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if w.origTiles == images && w.imageConfig == imageConfig {
+		return
+	}
+
+	w.origTiles = images
+	w.imageConfig = imageConfig
+	w.tiles = map_renderer.NewTiles(w.origTiles, w.scale)
+
+	w.Refresh()
+}
+
 func (w *MapWidget) Scale() float32 {
 	w.mutex.Lock()
 	defer w.mutex.Unlock()
@@ -501,20 +613,8 @@ func (w *MapWidget) setScale(v float32) bool {
 		return false
 	}
 
-	floorBounds := w.origFloorImage.Bounds()
-	wallBounds := w.origWallImage.Bounds()
-
 	w.scale = v
-
-	w.floorImage = imaging.Resize(w.origFloorImage, int(float32(floorBounds.Dx())*w.scale), int(float32(floorBounds.Dy())*w.scale), imaging.Lanczos)
-
-	w.wallImage = imaging.Resize(w.origWallImage, int(float32(wallBounds.Dx())*w.scale), int(float32(wallBounds.Dy())*w.scale), imaging.Lanczos)
-	w.wallImage90 = imaging.Rotate270(w.wallImage)
-
-	w.floorSelectedImage = imaging.Resize(w.origFloorSelectedImage, int(float32(floorBounds.Dx())*w.scale), int(float32(floorBounds.Dy())*w.scale), imaging.Lanczos)
-
-	w.wallSelectedImage = imaging.Resize(w.origWallSelectedImage, int(float32(wallBounds.Dx())*w.scale), int(float32(wallBounds.Dy())*w.scale), imaging.Lanczos)
-	w.wallSelectedImage90 = imaging.Rotate270(w.wallSelectedImage)
+	w.tiles = map_renderer.NewTiles(w.origTiles, w.scale)
 
 	return true
 }
@@ -574,6 +674,28 @@ func (w *MapWidget) setMoveMode() {
 	}
 }
 
+// Перерисовывает карту целиком, без кэша
+func (w *MapWidget) invalidateAll() {
+	w.chunkCache.InvalidateAll()
+	w.Refresh()
+}
+
+// Перерисовывает клетки cells(в повёрнутых координатах)
+func (w *MapWidget) invalidate(cells utils.Region) {
+	if cells.IsEmpty() {
+		return
+	}
+
+	// у завёрнутой карты клетка видна ещё и призраками за краем
+	if cells.All || w.mapModel == nil || w.mapModel.Model().Dimensions().Wrap {
+		w.chunkCache.InvalidateAll()
+	} else {
+		w.chunkCache.Invalidate(image.Rect(cells.Min.X, cells.Min.Y, cells.Max.X, cells.Max.Y))
+	}
+
+	w.Refresh()
+}
+
 func (w *MapWidget) SetMapModel(mapModel *rot_map_model.RotMapModel) {
 	if w.mapModel == mapModel {
 		return
@@ -586,8 +708,12 @@ func (w *MapWidget) SetMapModel(mapModel *rot_map_model.RotMapModel) {
 
 	w.mapModel = mapModel
 
+	w.chunkCache.InvalidateAll()
+
 	if mapModel != nil {
-		w.disconnectMapModel.AddSlot(mapModel.AddDataChangeListener(w.Refresh))
+		w.disconnectMapModel.AddSlot(mapModel.AddChangeListener(func(change map_model.Change) {
+			w.invalidate(change.Cells)
+		}))
 	}
 
 	w.Refresh()
@@ -606,7 +732,7 @@ func (w *MapWidget) SetRotateModel(rotateModel *rotate_model.RotateModel) {
 	w.rotateModel = rotateModel
 
 	if rotateModel != nil {
-		w.disconnectRotateModel.AddSlot(rotateModel.AddDataChangeListener(w.Refresh))
+		w.disconnectRotateModel.AddSlot(rotateModel.AddDataChangeListener(w.invalidateAll))
 
 		var offsetBeforeRotate utils.Int2
 		w.disconnectRotateModel.AddSlot(rotateModel.AddBeforeRotateListener(func() {
@@ -649,8 +775,12 @@ func (w *MapWidget) SetSelectModel(selectModel *rot_select_model.RotSelectModel)
 
 	w.selectModel = selectModel
 
+	w.chunkCache.InvalidateAll()
+
 	if selectModel != nil {
-		w.disconnectSelectModel = selectModel.AddDataChangeListener(w.Refresh)
+		w.disconnectSelectModel = selectModel.AddChangeListener(func(change select_model.Change) {
+			w.invalidate(change.Cells)
+		})
 	}
 
 	w.Refresh()
@@ -694,8 +824,10 @@ func (w *MapWidget) SetNotesModel(notesModel *notes_model.NotesModel) {
 
 	w.notesModel = notesModel
 
+	w.chunkCache.InvalidateAll()
+
 	if notesModel != nil {
-		w.disconnectNotesModel.AddSlot(notesModel.AddDataChangeListener(w.Refresh))
+		w.disconnectNotesModel.AddSlot(notesModel.AddDataChangeListener(w.invalidateAll))
 	}
 
 	w.Refresh()
@@ -741,6 +873,25 @@ func (w *MapWidget) SetCenterModel(centerModel *center_model.CenterModel) {
 	w.Refresh()
 }
 
+func (w *MapWidget) SetPartyModel(partyModel *party_model.PartyModel) {
+	if w.partyModel == partyModel {
+		return
+	}
+
+	if w.partyModel != nil {
+		w.disconnectPartyModel.Emit()
+		w.disconnectPartyModel.Clear()
+	}
+
+	w.partyModel = partyModel
+
+	if partyModel != nil {
+		w.disconnectPartyModel.AddSlot(partyModel.AddDataChangeListener(w.Refresh))
+	}
+
+	w.Refresh()
+}
+
 // mapX, mapY - координаты у w.getFloor(); imgX, imgY - координата у floor в mapX, mapY.
 func (w *MapWidget) screenPixelToFloorCoords(x, y uint, floorSize uint, center utils.Int2) (mapX, mapY int, imgX, imgY uint) {
 	// Делим с округлением в меньшую сторону. Т.е.: `1 / 2 == 0` и `-1 / 2 == -1`
@@ -790,8 +941,8 @@ type mapWidgetRenderer struct {
 
 func newMapWidgetRenderer(w *MapWidget) *mapWidgetRenderer {
 	backgroundUniform := image.NewUniform(color.RGBA{0xff, 0xff, 0xff, 0xff})
-	wallUniform := image.NewUniform(color.RGBA{0xaa, 0xaa, 0xaa, 0xff})
 	selectUniform := image.NewUniform(color.RGBA{0xaa, 0xaa, 0xff, 0xff})
+	flashUniform := image.NewUniform(color.RGBA{0xff, 0x40, 0x40, 0xff})
 
 	var img *image.RGBA
 
@@ -813,8 +964,6 @@ func newMapWidgetRenderer(w *MapWidget) *mapWidgetRenderer {
 
 		scaledFloorWbSize := int((fFloorSize + 1) * w.scale) // With Border
 		scaledFloorWobSize := int(fFloorSize * w.scale)      // Without Border
-		scaledWallWidth := int(float32(w.imageConfig.WallWidth) * w.scale)
-		halfScaledWallWidth := int(float32(w.imageConfig.WallWidth) * w.scale / 2)
 
 		center := w.centerModel.Get()
 
@@ -828,75 +977,38 @@ func newMapWidgetRenderer(w *MapWidget) *mapWidgetRenderer {
 			return image.Rect(pX, pY, int(pX)+scaledFloorWobSize, int(pY)+scaledFloorWobSize)
 		}
 
-		for y := mapTop; y < mapBottom; y++ {
-			for x := mapLeft; x < mapRight; x++ {
-				_, index := w.mapModel.VisibleFloor(x, y)
-				if index > 0 {
-					rect := floorRect(x, y)
-					draw.Draw(img, rect, w.floorImage, image.Pt(int(index)*int(fFloorSize*w.scale), 0), draw.Src)
-				}
-			}
+		frame := map_renderer.Frame{
+			Map:         w.mapModel,
+			Tiles:       w.tiles,
+			ImageConfig: w.imageConfig,
+			Scale:       w.scale,
+			Cells:       image.Rect(mapLeft, mapTop, mapRight, mapBottom),
+			FloorRect:   floorRect,
 		}
-
-		for y := mapTop; y < mapBottom; y++ {
-			for x := mapLeft; x < mapRight; x++ {
-				_, rightIndex := w.mapModel.VisibleWall(x, y, true)
-				_, bottomIndex := w.mapModel.VisibleWall(x, y, false)
-				rect := floorRect(x, y)
-
-				if rightIndex > 0 {
-					wallRect := image.Rect(rect.Max.X-halfScaledWallWidth, rect.Min.Y, rect.Max.X+halfScaledWallWidth, rect.Max.Y)
-					draw.Draw(img, wallRect, w.wallImage, image.Pt(int(rightIndex)*scaledWallWidth, 0), draw.Over)
-				} else {
-					wallRect := image.Rect(rect.Max.X, rect.Min.Y, rect.Max.X+int(w.scale), rect.Max.Y)
-					draw.Draw(img, wallRect, wallUniform, image.Point{}, draw.Src)
-				}
-
-				if bottomIndex > 0 {
-					wallRect := image.Rect(rect.Min.X, rect.Max.Y-halfScaledWallWidth, rect.Max.X, rect.Max.Y+halfScaledWallWidth)
-					draw.Draw(img, wallRect, w.wallImage90, image.Pt(0, int(bottomIndex)*scaledWallWidth), draw.Over)
-				} else {
-					wallRect := image.Rect(rect.Min.X, rect.Max.Y, rect.Max.X, rect.Max.Y+int(w.scale))
-					draw.Draw(img, wallRect, wallUniform, image.Point{}, draw.Src)
-				}
-			}
+		if w.selectModel != nil {
+			frame.Select = w.selectModel
 		}
-
-		{
-			for y := mapTop; y < mapBottom; y++ {
-				for x := mapLeft; x < mapRight; x++ {
-					if w.selectModel.IsFloorSelected(x, y) {
-						rect := floorRect(x, y)
-						draw.Draw(img, rect, w.floorSelectedImage, image.Pt(0, 0), draw.Over)
-					}
-				}
-			}
-
-			for y := mapTop; y < mapBottom; y++ {
-				for x := mapLeft; x < mapRight; x++ {
-					rect := floorRect(x, y)
-
-					if w.selectModel.IsWallSelected(x, y, true) {
-						wallRect := image.Rect(rect.Max.X-halfScaledWallWidth, rect.Min.Y, rect.Max.X+halfScaledWallWidth, rect.Max.Y)
-						draw.Draw(img, wallRect, w.wallSelectedImage, image.Pt(0, 0), draw.Over)
-					}
-
-					if w.selectModel.IsWallSelected(x, y, false) {
-						wallRect := image.Rect(rect.Min.X, rect.Max.Y-halfScaledWallWidth, rect.Max.X, rect.Max.Y+halfScaledWallWidth)
-						draw.Draw(img, wallRect, w.wallSelectedImage90, image.Pt(0, 0), draw.Over)
-					}
-				}
-			}
+		if w.notesModel != nil {
+			frame.Notes = w.notesModel
+		}
+		if w.partyModel != nil {
+			pos, direction := w.partyModel.Get()
+			x, y := w.rotateModel.TransformFromRot(pos.X, pos.Y)
+			v := direction.Vector()
+			dX, dY := w.rotateModel.TransformFromRot(v.X, v.Y)
+			frame.Party = &map_renderer.Party{Pos: utils.NewInt2(x, y), Direction: utils.NewInt2(dX, dY)}
 		}
 
-		for y := mapTop; y < mapBottom; y++ {
-			for x := mapLeft; x < mapRight; x++ {
-				_, value := w.mapModel.VisibleNoteId(x, y)
-				if len(value) > 0 {
-					rect := floorRect(x, y)
-					noteImg := w.notesModel.GetNoteImage(value)
-					draw.Draw(img, rect, noteImg, image.Point{}, draw.Src)
-				}
+		w.chunkCache.Draw(img, frame)
+
+		if w.flash != nil && w.flashVisible {
+			rect := floorRect(w.flash.X, w.flash.Y).Inset(-2)
+			for i := 0; i < 3; i++ {
+				draw.Draw(img, image.Rect(rect.Min.X, rect.Min.Y, rect.Max.X, rect.Min.Y+1), flashUniform, image.Point{}, draw.Src)
+				draw.Draw(img, image.Rect(rect.Min.X, rect.Max.Y-1, rect.Max.X, rect.Max.Y), flashUniform, image.Point{}, draw.Src)
+				draw.Draw(img, image.Rect(rect.Min.X, rect.Min.Y, rect.Min.X+1, rect.Max.Y), flashUniform, image.Point{}, draw.Src)
+				draw.Draw(img, image.Rect(rect.Max.X-1, rect.Min.Y, rect.Max.X, rect.Max.Y), flashUniform, image.Point{}, draw.Src)
+				rect = rect.Inset(-1)
 			}
 		}
 
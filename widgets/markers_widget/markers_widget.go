@@ -0,0 +1,103 @@
+package markers_widget
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"old-school-rpg-map-editor/common/overlays"
+	"old-school-rpg-map-editor/models/map_model"
+	"old-school-rpg-map-editor/models/notes_model"
+	"strings"
+	"sync"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/canvas"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/widget"
+)
+
+const iconSize = 16
+
+func makeMarkerIcon(icon map_model.MarkerIcon) *canvas.Image {
+	img := image.NewRGBA(image.Rect(0, 0, iconSize, iconSize))
+	draw.Draw(img, img.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	overlays.DrawMarkerIcon(img, img.Bounds().Inset(1), icon)
+
+	canvasImage := canvas.NewImageFromImage(img)
+	canvasImage.FillMode = canvas.ImageFillOriginal
+	return canvasImage
+}
+
+// Палитра отметок. Клик по карте добавляет в клетку отметку, если такой там нет, и убирает, если есть.
+type MarkersWidget struct {
+	mutex     sync.Mutex
+	container *fyne.Container
+	icon      map_model.MarkerIcon
+	noteId    string
+}
+
+func NewMarkersWidget() *MarkersWidget {
+	w := &MarkersWidget{icon: map_model.MarkerIcons[0]}
+
+	options := make([]string, 0, len(map_model.MarkerIcons))
+	for _, icon := range map_model.MarkerIcons {
+		options = append(options, icon.String())
+	}
+
+	radio := widget.NewRadioGroup(options, func(s string) {
+		w.mutex.Lock()
+		defer w.mutex.Unlock()
+
+		for _, icon := range map_model.MarkerIcons {
+			if icon.String() == s {
+				w.icon = icon
+			}
+		}
+	})
+	radio.Required = true
+	radio.SetSelected(w.icon.String())
+
+	icons := container.NewVBox()
+	for _, icon := range map_model.MarkerIcons {
+		// иконки вровень со строчками radio
+		icons.Add(container.NewCenter(makeMarkerIcon(icon)))
+	}
+
+	noteIdEntry := widget.NewEntry()
+	noteIdEntry.SetPlaceHolder("Note id (optional)")
+	noteIdEntry.Validator = func(s string) error {
+		s = strings.TrimSpace(s)
+		if len(s) == 0 {
+			return nil
+		}
+		return notes_model.ValidateNoteId(s)
+	}
+	noteIdEntry.OnChanged = func(s string) {
+		w.mutex.Lock()
+		defer w.mutex.Unlock()
+
+		w.noteId = strings.TrimSpace(s)
+	}
+
+	w.container = container.NewBorder(nil, noteIdEntry, nil, nil, container.NewVScroll(container.NewHBox(icons, radio)))
+
+	return w
+}
+
+// Отметка, которую ставит клик по карте
+func (w *MarkersWidget) Marker() (map_model.Marker, error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if len(w.noteId) > 0 {
+		if err := notes_model.ValidateNoteId(w.noteId); err != nil {
+			return map_model.Marker{}, err
+		}
+	}
+
+	return map_model.Marker{Icon: w.icon, NoteId: w.noteId}, nil
+}
+
+func (w *MarkersWidget) Container() *fyne.Container {
+	return w.container
+}
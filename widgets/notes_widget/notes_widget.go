@@ -2,16 +2,23 @@ package notes_widget
 
 import (
 	"bytes"
+	"fmt"
 	"image"
 	"image/draw"
 	"image/png"
 	"log"
+	"net/url"
+	"old-school-rpg-map-editor/common/note_links"
 	"old-school-rpg-map-editor/models/notes_model"
 	"old-school-rpg-map-editor/utils"
+	"strings"
 
 	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/canvas"
 	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/theme"
 	"fyne.io/fyne/v2/widget"
+	"golang.org/x/exp/slices"
 )
 
 func makeSetNoteIcon(buttonSize fyne.Size, border, note image.Image, selected bool) fyne.Resource {
@@ -44,63 +51,411 @@ func makeSetNoteIcon(buttonSize fyne.Size, border, note image.Image, selected bo
 	return fyne.NewStaticResource("notes.png", buf.Bytes())
 }
 
+// Список заметок карты и редактор выбранной заметки. Выбранная заметка ставится кликом в клетку
 type NotesWidget struct {
 	container  *fyne.Container
 	selected   string
 	model      *notes_model.NotesModel
 	disconnect utils.Signal0
 
+	noteIds []string // заметки в list, по порядку модели
+	editing bool     // изменение заметки пришло из редактора, его поля не перезаписываем
+
+	list           *widget.List
+	setNoteOnFloor *widget.Button
+	border         image.Image
+	idEntry        *widget.Entry
+	idLabel        *widget.Label
+	titleEntry     *widget.Entry
+	tagsEntry      *widget.Entry
+	colorSelect    *widget.Select
+	createdLabel   *widget.Label
+	bodyEntry      *widget.Entry
+	bodyTabs       *container.AppTabs
+	previewTab     *container.TabItem
+	preview        *widget.RichText
+	brokenLabel    *widget.Label
+	editor         *fyne.Container
+
 	OnSelected func(value string)
+	OnSearch   func()
+	OnCheck    func()                           // сверка заметок с клетками карты
+	OnLink     func(link note_links.Link)       // клик по ссылке на заметку, клетку или карту
+	CheckLink  func(link note_links.Link) error // nil - ссылки не проверяются
 }
 
-func NewNotesWidget(model *notes_model.NotesModel, border image.Image, searchIcon, searchSelectedIcon fyne.Resource) *NotesWidget {
-	setNoteOnFloor := widget.NewButtonWithIcon("", nil, func() {})
-	notesTools := container.NewHBox(widget.NewButtonWithIcon("", searchIcon, func() {}), setNoteOnFloor)
+// Ссылка внутри карт: вместо открытия URL клик уходит в onTapped. Hyperlink создаётся здесь,
+// а не берётся из HyperlinkSegment.Visual, устройство которого - внутреннее дело Fyne
+type linkSegment struct {
+	*widget.HyperlinkSegment
+	onTapped func()
+}
 
-	notesEntry := widget.NewEntry()
-	notesEntry.MultiLine = true
+func (s *linkSegment) Visual() fyne.CanvasObject {
+	link := widget.NewHyperlink(s.Text, s.URL)
+	// RichText выравнивает по базовой линии текста Hyperlink, лежащий первым в контейнере
+	c := &fyne.Container{Layout: unpadLayout{}, Objects: []fyne.CanvasObject{link}}
+	s.Update(c)
+	return c
+}
 
-	w := &NotesWidget{}
+func (s *linkSegment) Update(o fyne.CanvasObject) {
+	link := o.(*fyne.Container).Objects[0].(*widget.Hyperlink)
+	link.Text = s.Text
+	link.URL = s.URL
+	link.Alignment = s.Alignment
+	link.OnTapped = s.onTapped
+	link.Refresh()
+}
 
-	w.SetNotesModel(model)
+// Убирает отступы Hyperlink, чтобы ссылка стояла в строке вровень с текстом, как у HyperlinkSegment
+type unpadLayout struct{}
+
+func (unpadLayout) Layout(objects []fyne.CanvasObject, size fyne.Size) {
+	pad := theme.Padding() * 2
+	objects[0].Move(fyne.NewPos(-pad, -pad))
+	objects[0].Resize(size.Add(fyne.NewSize(pad*2, pad*2)))
+}
+
+func (unpadLayout) MinSize(objects []fyne.CanvasObject) fyne.Size {
+	pad := theme.Padding() * 2
+	return objects[0].MinSize().Subtract(fyne.NewSize(pad*2, pad*2))
+}
+
+func colorName(value string) string {
+	index := slices.IndexFunc(notes_model.Colors, func(c notes_model.NamedColor) bool { return c.Value == value })
+	if index == -1 {
+		return value
+	}
+	return notes_model.Colors[index].Name
+}
 
-	notesEntry.OnChanged = func(s string) {
-		if w.model != nil {
-			w.model.Update(s)
+func colorValue(name string) string {
+	index := slices.IndexFunc(notes_model.Colors, func(c notes_model.NamedColor) bool { return c.Name == name })
+	if index == -1 {
+		return name
+	}
+	return notes_model.Colors[index].Value
+}
+
+// Теги через запятую
+func parseTags(s string) []string {
+	var tags []string
+	for _, tag := range strings.Split(s, ",") {
+		if tag = strings.TrimSpace(tag); len(tag) > 0 && !slices.Contains(tags, tag) {
+			tags = append(tags, tag)
 		}
 	}
+	return tags
+}
 
-	sel := widget.NewSelect(nil, func(s string) {})
+func NewNotesWidget(model *notes_model.NotesModel, border image.Image, searchIcon, searchSelectedIcon fyne.Resource) *NotesWidget {
+	w := &NotesWidget{border: border}
 
-	sel.OnChanged = func(s string) {
-		w.selected = s
-		if w.OnSelected != nil {
-			w.OnSelected(s)
+	search := widget.NewButtonWithIcon("", searchIcon, func() {
+		if w.OnSearch != nil {
+			w.OnSearch()
+		}
+	})
+	w.setNoteOnFloor = widget.NewButtonWithIcon("", nil, func() {})
+	check := widget.NewButtonWithIcon("", theme.WarningIcon(), func() {
+		if w.OnCheck != nil {
+			w.OnCheck()
 		}
+	})
 
-		var image image.Image
-		if w.model != nil {
-			image = w.model.GetNoteImage(s)
+	// id новой заметки, пустой - свободный числовой
+	w.idEntry = widget.NewEntry()
+	w.idEntry.SetPlaceHolder("New note id")
+	w.idEntry.Validator = func(s string) error {
+		if len(s) == 0 || w.model == nil {
+			return nil
+		}
+		err := notes_model.ValidateNoteId(s)
+		if err == nil && slices.Contains(w.model.GetNoteIds(), s) {
+			err = fmt.Errorf("%w: %q", notes_model.ErrDuplicateNoteId, s)
+		}
+		return err
+	}
+
+	add := widget.NewButtonWithIcon("", theme.ContentAddIcon(), func() {
+		if w.model == nil {
+			return
 		}
 
-		if image != nil {
-			setNoteOnFloor.Icon = makeSetNoteIcon(setNoteOnFloor.Size(), border, image, true)
-			setNoteOnFloor.Refresh()
-		} else {
-			// TODO: ставим в setNoteOnFloor placeholder
+		noteId := strings.TrimSpace(w.idEntry.Text)
+		if len(noteId) == 0 {
+			noteId = w.model.NewNoteId()
 		}
 
-		if position := w.model.GetNotePosition(s); notesEntry.CursorRow != position {
-			notesEntry.CursorRow = position
-			notesEntry.Refresh()
+		err := w.model.Add(notes_model.Note{Id: noteId})
+		if err != nil {
+			// TODO
+			fmt.Println(err)
+			return
+		}
+
+		w.idEntry.SetText("")
+		w.SelectNote(noteId)
+	})
+
+	remove := widget.NewButtonWithIcon("", theme.DeleteIcon(), func() {
+		if w.model != nil && len(w.selected) > 0 {
+			w.model.Delete(w.selected)
 		}
+	})
+
+	notesTools := container.NewBorder(nil, nil, container.NewHBox(search, w.setNoteOnFloor), container.NewHBox(add, remove, check), w.idEntry)
+
+	w.list = widget.NewList(
+		func() int {
+			return len(w.noteIds)
+		},
+		func() fyne.CanvasObject {
+			return container.NewHBox(canvas.NewText("", nil), widget.NewLabel(""))
+		},
+		func(id widget.ListItemID, o fyne.CanvasObject) {
+			var note notes_model.Note
+			if w.model != nil && id < len(w.noteIds) {
+				note, _ = w.model.Note(w.noteIds[id])
+			}
+
+			c, err := notes_model.ParseColor(note.Color)
+			if err != nil {
+				c, _ = notes_model.ParseColor("")
+			}
+
+			objects := o.(*fyne.Container).Objects
+			text := objects[0].(*canvas.Text)
+			text.Text = note.Id
+			text.Color = c
+			text.TextStyle.Bold = true
+			text.Refresh()
+			objects[1].(*widget.Label).SetText(note.Title)
+		},
+	)
+	w.list.OnSelected = func(id widget.ListItemID) {
+		if id < len(w.noteIds) {
+			w.setSelected(w.noteIds[id])
+		}
+	}
+	w.list.OnUnselected = func(id widget.ListItemID) {
+		w.setSelected("")
+	}
+
+	w.idLabel = widget.NewLabel("")
+	w.titleEntry = widget.NewEntry()
+	w.tagsEntry = widget.NewEntry()
+	w.tagsEntry.SetPlaceHolder("tag, tag")
+	var colorNames []string
+	for _, c := range notes_model.Colors {
+		colorNames = append(colorNames, c.Name)
+	}
+	w.colorSelect = widget.NewSelect(colorNames, nil)
+	w.createdLabel = widget.NewLabel("")
+	w.bodyEntry = widget.NewEntry()
+	w.bodyEntry.MultiLine = true
+	w.bodyEntry.Wrapping = fyne.TextWrapWord
+
+	w.titleEntry.OnChanged = func(s string) {
+		w.update(func(note *notes_model.Note) { note.Title = s })
+	}
+	w.tagsEntry.OnChanged = func(s string) {
+		w.update(func(note *notes_model.Note) { note.Tags = parseTags(s) })
+	}
+	w.colorSelect.OnChanged = func(s string) {
+		w.update(func(note *notes_model.Note) { note.Color = colorValue(s) })
+	}
+	w.bodyEntry.OnChanged = func(s string) {
+		w.update(func(note *notes_model.Note) { note.Body = s })
 	}
 
-	w.container = container.NewBorder(container.NewBorder(nil, nil, notesTools, nil, sel), nil, nil, nil, notesEntry)
+	form := widget.NewForm(
+		widget.NewFormItem("Id", w.idLabel),
+		widget.NewFormItem("Title", w.titleEntry),
+		widget.NewFormItem("Tags", w.tagsEntry),
+		widget.NewFormItem("Color", w.colorSelect),
+		widget.NewFormItem("Created", w.createdLabel),
+	)
+	w.preview = widget.NewRichText()
+	w.preview.Wrapping = fyne.TextWrapWord
+	w.brokenLabel = widget.NewLabel("")
+	w.brokenLabel.Wrapping = fyne.TextWrapWord
+	w.brokenLabel.Hide()
+	w.previewTab = container.NewTabItem("Preview", container.NewBorder(nil, w.brokenLabel, nil, nil, container.NewVScroll(w.preview)))
+	w.bodyTabs = container.NewAppTabs(container.NewTabItem("Text", w.bodyEntry), w.previewTab)
+	w.bodyTabs.OnSelected = func(*container.TabItem) {
+		w.updatePreview()
+	}
+
+	w.editor = container.NewBorder(form, nil, nil, nil, w.bodyTabs)
+
+	split := container.NewVSplit(w.list, w.editor)
+	w.container = container.NewBorder(notesTools, nil, nil, nil, split)
+
+	w.updateEditor()
+	w.SetNotesModel(model)
 
 	return w
 }
 
+// Меняет поля выбранной заметки из редактора
+func (w *NotesWidget) update(f func(note *notes_model.Note)) {
+	if w.model == nil || w.editing {
+		return
+	}
+
+	note, ok := w.model.Note(w.selected)
+	if !ok {
+		return
+	}
+
+	f(&note)
+
+	w.editing = true
+	err := w.model.Set(note)
+	w.editing = false
+	if err != nil {
+		// TODO
+		fmt.Println(err)
+	}
+}
+
+// Заполняет редактор полями выбранной заметки
+func (w *NotesWidget) updateEditor() {
+	note, ok := notes_model.Note{}, false
+	if w.model != nil {
+		note, ok = w.model.Note(w.selected)
+	}
+
+	// OnChanged полей не должен писать в модель то, что сам и прочитал
+	w.editing = true
+	defer func() { w.editing = false }()
+
+	w.idLabel.SetText(note.Id)
+	w.titleEntry.SetText(note.Title)
+	w.tagsEntry.SetText(strings.Join(note.Tags, ", "))
+	if ok {
+		w.colorSelect.SetSelected(colorName(note.Color))
+	} else {
+		w.colorSelect.ClearSelected()
+	}
+	w.createdLabel.SetText("")
+	if !note.Created.IsZero() {
+		w.createdLabel.SetText(note.Created.Local().Format("2006-01-02 15:04"))
+	}
+	w.bodyEntry.SetText(note.Body)
+
+	if ok {
+		w.editor.Show()
+	} else {
+		w.editor.Hide()
+	}
+
+	w.updatePreview()
+}
+
+// Заменяет ссылки внутри карт в segments на linkSegment, битые ссылки дописывает в broken
+func (w *NotesWidget) linkSegments(segments []widget.RichTextSegment, broken *[]string) []widget.RichTextSegment {
+	for i, segment := range segments {
+		switch segment := segment.(type) {
+		case *widget.ParagraphSegment:
+			segment.Texts = w.linkSegments(segment.Texts, broken)
+		case *widget.ListSegment:
+			segment.Items = w.linkSegments(segment.Items, broken)
+		case *widget.HyperlinkSegment:
+			if segment.URL == nil {
+				continue
+			}
+
+			destination := segment.URL.String()
+			if d, err := url.PathUnescape(destination); err == nil {
+				destination = d
+			}
+
+			link, ok, err := note_links.Parse(destination)
+			if !ok {
+				continue
+			}
+			if err == nil && w.CheckLink != nil {
+				err = w.CheckLink(link)
+			}
+			if err != nil {
+				*broken = append(*broken, fmt.Sprintf("%s: %v", destination, err))
+				segment.Text += " (broken)"
+			}
+
+			segments[i] = &linkSegment{HyperlinkSegment: segment, onTapped: func() {
+				if ok && w.OnLink != nil {
+					w.OnLink(link)
+				}
+			}}
+		}
+	}
+
+	return segments
+}
+
+// Показывает текст выбранной заметки разметкой Markdown, если открыта вкладка Preview
+func (w *NotesWidget) updatePreview() {
+	if w.bodyTabs.Selected() != w.previewTab {
+		return
+	}
+
+	var note notes_model.Note
+	if w.model != nil {
+		note, _ = w.model.Note(w.selected)
+	}
+
+	var broken []string
+	w.preview.Segments = w.linkSegments(widget.NewRichTextFromMarkdown(note_links.Markdown(note.Body)).Segments, &broken)
+	w.preview.Refresh()
+
+	if len(broken) > 0 {
+		w.brokenLabel.SetText("Broken links:\n" + strings.Join(broken, "\n"))
+		w.brokenLabel.Show()
+	} else {
+		w.brokenLabel.Hide()
+	}
+}
+
+func (w *NotesWidget) updateSetNoteIcon() {
+	var image image.Image
+	if w.model != nil {
+		image = w.model.GetNoteImage(w.selected)
+	}
+
+	if image != nil {
+		w.setNoteOnFloor.Icon = makeSetNoteIcon(w.setNoteOnFloor.Size(), w.border, image, true)
+	} else {
+		// TODO: ставим в setNoteOnFloor placeholder
+		w.setNoteOnFloor.Icon = nil
+	}
+	w.setNoteOnFloor.Refresh()
+}
+
+func (w *NotesWidget) setSelected(noteId string) {
+	if w.selected == noteId {
+		return
+	}
+
+	w.selected = noteId
+	if w.OnSelected != nil {
+		w.OnSelected(noteId)
+	}
+
+	w.updateSetNoteIcon()
+	w.updateEditor()
+}
+
+// Выбирает заметку noteId в списке, если она есть
+func (w *NotesWidget) SelectNote(noteId string) {
+	if index := slices.Index(w.noteIds, noteId); index != -1 {
+		w.list.Select(index)
+		w.list.ScrollTo(index)
+	}
+}
+
 func (w *NotesWidget) SetNotesModel(model *notes_model.NotesModel) {
 	if w.model == model {
 		return
@@ -112,15 +467,47 @@ func (w *NotesWidget) SetNotesModel(model *notes_model.NotesModel) {
 	}
 
 	w.model = model
+	w.noteIds = nil
+	w.list.UnselectAll()
+	w.setSelected("")
 
 	if model != nil {
-		sel := w.container.Objects[1].(*fyne.Container).Objects[0].(*widget.Select)
-		w.disconnect.AddSlot(model.AddDataChangeListener(func() {
-			sel.Options = w.model.GetNoteIds()
-			sel.Refresh()
+		w.noteIds = model.GetNoteIds()
+		w.disconnect.AddSlot(model.AddChangeListener(func(change notes_model.Change) {
+			if change.Font {
+				w.updateSetNoteIcon()
+				return
+			}
+
+			w.noteIds = w.model.GetNoteIds()
+			w.list.Refresh()
+
+			if slices.Contains(change.Deleted, w.selected) {
+				w.list.UnselectAll()
+				w.setSelected("")
+				return
+			}
+
+			// индекс выбранной заметки мог сдвинуться
+			if index := slices.Index(w.noteIds, w.selected); index != -1 {
+				w.list.Select(index)
+			}
+
+			if slices.Contains(change.Updated, w.selected) {
+				w.updateSetNoteIcon()
+				if !w.editing {
+					w.updateEditor()
+					return
+				}
+			}
+
+			// ссылки выбранной заметки могли стать битыми или наоборот
+			w.updatePreview()
 		}))
 	}
 
+	w.list.Refresh()
+	w.updateEditor()
 	w.container.Refresh()
 }
 
@@ -4,6 +4,7 @@ import (
 	"image"
 	"image/color"
 	"image/draw"
+	"old-school-rpg-map-editor/utils"
 	"sync"
 
 	"fyne.io/fyne/v2"
@@ -21,7 +22,10 @@ type PaletteWidget struct {
 	elemWidth    uint
 	elemHeight   uint
 	widthPadding uint
+	labels       []string // подписи тайлов, показываются под палитрой
 	selected     int
+
+	selectedListeners utils.Signal0
 }
 
 func NewPaletteWidget(img image.Image, elemWidth uint, elemHeight uint, widthPadding uint) *PaletteWidget {
@@ -30,6 +34,30 @@ func NewPaletteWidget(img image.Image, elemWidth uint, elemHeight uint, widthPad
 	return w
 }
 
+// Меняет картинку палитры(например, при смене набора тайлов). Если выбранного тайла в новой
+// картинке нет, то выбирается первый.
+func (w *PaletteWidget) SetImage(img image.Image, elemWidth uint, elemHeight uint, widthPadding uint, labels []string) {
+	send := func() bool {
+		w.mutex.Lock()
+		defer w.mutex.Unlock()
+
+		w.img, w.elemWidth, w.elemHeight, w.widthPadding, w.labels = img, elemWidth, elemHeight, widthPadding, labels
+
+		if w.selected >= img.Bounds().Dx()/int(elemWidth) {
+			w.selected = 0
+			return true
+		}
+
+		return false
+	}()
+
+	w.Refresh()
+
+	if send {
+		w.selectedListeners.Emit()
+	}
+}
+
 func (w *PaletteWidget) Selected() int {
 	w.mutex.Lock()
 	defer w.mutex.Unlock()
@@ -37,32 +65,55 @@ func (w *PaletteWidget) Selected() int {
 	return w.selected
 }
 
-func (w *PaletteWidget) Tapped(ev *fyne.PointEvent) {
+// Подпись выбранного тайла
+func (w *PaletteWidget) SelectedLabel() string {
 	w.mutex.Lock()
 	defer w.mutex.Unlock()
 
-	x := int(ev.Position.X)
-	y := int(ev.Position.Y)
+	if w.selected < len(w.labels) {
+		return w.labels[w.selected]
+	}
+	return ""
+}
+
+func (w *PaletteWidget) Tapped(ev *fyne.PointEvent) {
+	send := func() bool {
+		w.mutex.Lock()
+		defer w.mutex.Unlock()
+
+		x := int(ev.Position.X)
+		y := int(ev.Position.Y)
 
-	step := int(w.elemWidth) + 2*int(w.widthPadding) + 1
+		step := int(w.elemWidth) + 2*int(w.widthPadding) + 1
 
-	rect := image.Rect(1, 1, step, int(w.elemHeight)+1)
-	for i := 0; i != w.img.Bounds().Dx()/int(w.elemWidth); i++ {
-		if x >= rect.Min.X && y >= rect.Min.Y && x <= rect.Max.X && y <= rect.Max.Y {
-			w.selected = i
-			w.Refresh()
-			return
-		}
+		rect := image.Rect(1, 1, step, int(w.elemHeight)+1)
+		for i := 0; i != w.img.Bounds().Dx()/int(w.elemWidth); i++ {
+			if x >= rect.Min.X && y >= rect.Min.Y && x <= rect.Max.X && y <= rect.Max.Y {
+				w.selected = i
+				w.Refresh()
+				return true
+			}
 
-		rect = rect.Add(image.Pt(step, 0))
-		if rect.Max.X > int(w.Size().Width) {
-			rect.Min.X = 1
-			rect.Max.X = step
-			rect = rect.Add(image.Pt(0, int(w.elemHeight)+1))
+			rect = rect.Add(image.Pt(step, 0))
+			if rect.Max.X > int(w.Size().Width) {
+				rect.Min.X = 1
+				rect.Max.X = step
+				rect = rect.Add(image.Pt(0, int(w.elemHeight)+1))
+			}
 		}
+
+		return false
+	}()
+
+	if send {
+		w.selectedListeners.Emit()
 	}
 }
 
+func (w *PaletteWidget) AddSelectedListener(listener func()) func() {
+	return w.selectedListeners.AddSlot(listener)
+}
+
 func (w *PaletteWidget) CreateRenderer() fyne.WidgetRenderer {
 	return newPaletteWidgetRenderer(w)
 }
@@ -1,23 +1,30 @@
 package toolbar_widget
 
 import (
-	"compress/gzip"
-	"encoding/json"
 	"fmt"
+	"old-school-rpg-map-editor/ascii_map_dialog"
 	"old-school-rpg-map-editor/common"
+	"old-school-rpg-map-editor/common/formats"
 	"old-school-rpg-map-editor/common/load_save"
+	"old-school-rpg-map-editor/common/map_renderer"
+	"old-school-rpg-map-editor/export_png_dialog"
+	"old-school-rpg-map-editor/map_properties_dialog"
 	"old-school-rpg-map-editor/models/center_model"
 	"old-school-rpg-map-editor/models/copy_model"
 	"old-school-rpg-map-editor/models/map_model"
 	"old-school-rpg-map-editor/models/maps_model"
 	"old-school-rpg-map-editor/models/mode_model"
 	"old-school-rpg-map-editor/models/notes_model"
+	"old-school-rpg-map-editor/models/party_model"
 	"old-school-rpg-map-editor/models/rot_map_model"
 	"old-school-rpg-map-editor/models/rot_select_model"
 	"old-school-rpg-map-editor/models/rotate_model"
 	"old-school-rpg-map-editor/models/select_model"
 	"old-school-rpg-map-editor/models/selected_layer_model"
 	"old-school-rpg-map-editor/models/selected_map_tab_model"
+	"old-school-rpg-map-editor/models/tilesets_model"
+	"old-school-rpg-map-editor/tileset_dialog"
+	"old-school-rpg-map-editor/undo_history_dialog"
 	"old-school-rpg-map-editor/undo_redo"
 	"old-school-rpg-map-editor/utils"
 	"old-school-rpg-map-editor/widgets/doc_tabs_widget"
@@ -45,17 +52,22 @@ type ToolbarWidget struct {
 	saveFile    *toolbar_action.ToolbarAction
 	undo        *toolbar_action.ToolbarAction
 	redo        *toolbar_action.ToolbarAction
+	history     *toolbar_action.ToolbarAction
 	rotateLeft  *toolbar_action.ToolbarAction
 	rotateRight *toolbar_action.ToolbarAction
 	copy        *toolbar_action.ToolbarAction
 	cut         *toolbar_action.ToolbarAction
 	paste       *toolbar_action.ToolbarAction
+	properties  *toolbar_action.ToolbarAction
+	exportPng   *toolbar_action.ToolbarAction
+	asciiMap    *toolbar_action.ToolbarAction
+	tilesets    *toolbar_action.ToolbarAction
 
 	currentMapId uuid.UUID
 	disconnect   utils.Signal0
 }
 
-func NewToolbar(window fyne.Window, fnt *truetype.Font, mapsModel *maps_model.MapsModel, selectedMapTabModel *selected_map_tab_model.SelectedMapTabModel, copyModel *copy_model.CopyModel, rotateLeftIcon, rotateRightIcon, setModeIcon, setModeSelectedIcon, selectModeIcon, selectModeSelectedIcon, moveModeIcon, moveModeSelectedIcon fyne.Resource) *ToolbarWidget {
+func NewToolbar(window fyne.Window, fnt *truetype.Font, mapsModel *maps_model.MapsModel, selectedMapTabModel *selected_map_tab_model.SelectedMapTabModel, copyModel *copy_model.CopyModel, tilesetsModel *tilesets_model.TilesetsModel, rotateLeftIcon, rotateRightIcon, setModeIcon, setModeSelectedIcon, selectModeIcon, selectModeSelectedIcon, moveModeIcon, moveModeSelectedIcon fyne.Resource) *ToolbarWidget {
 	w := &ToolbarWidget{
 		Toolbar:      widget.Toolbar{},
 		mapsModel:    mapsModel,
@@ -70,7 +82,7 @@ func NewToolbar(window fyne.Window, fnt *truetype.Font, mapsModel *maps_model.Ma
 			mapModel.SetName(moveLayerIndex, "MOVE")
 		*/
 
-		layerIndex := mapModel.AddLayerWithId(uuid.New(), map_model.RegularLayerType)
+		layerIndex := mapModel.AddLayerWithId(uuid.New(), map_model.RegularLayerType, 0)
 		mapModel.SetName(layerIndex, "Layer1")
 
 		selectedLayerModel := selected_layer_model.NewSelectedLayerModel()
@@ -79,10 +91,11 @@ func NewToolbar(window fyne.Window, fnt *truetype.Font, mapsModel *maps_model.Ma
 		selectModel := select_model.NewSelectModel(mapModel, selectedLayerModel)
 		rotSelectModel := rot_select_model.NewRotSelectModel(selectModel, rotateModel)
 		notesModel := notes_model.NewNotesModel(8, fnt)
-		undoRedoQueue := undo_redo.NewUndoRedoQueue(100 /*TODO*/)
+		undoRedoQueue := mapsModel.NewUndoRedoQueue()
 		centerModel := center_model.NewCenterModel(utils.Int2{})
+		partyModel := party_model.NewPartyModel(utils.Int2{}, party_model.North)
 
-		mapsModel.Add(mapModel, selectModel, mode_model.NewModeModel(), rotateModel, rotMapModel, rotSelectModel, notesModel, undoRedoQueue, selectedLayerModel, centerModel, "")
+		mapsModel.Add(mapModel, selectModel, mode_model.NewModeModel(), rotateModel, rotMapModel, rotSelectModel, notesModel, undoRedoQueue, selectedLayerModel, centerModel, partyModel, "")
 	})
 
 	openFile := toolbar_action.NewToolbarAction(theme.FolderOpenIcon(), func() {
@@ -99,26 +112,41 @@ func NewToolbar(window fyne.Window, fnt *truetype.Font, mapsModel *maps_model.Ma
 				return
 			}
 
-			mapModel, notesModel, err := load_save.LoadMapFile(uc)
+			filePath := uc.URI().Path()
+
+			format, err := formats.ByPath(filePath)
 			if err != nil {
 				// TODO
 				fmt.Println(err)
 				return
 			}
 
-			notesModel.SetFont(8, fnt)
+			// вместе с .map файлом загружается история правок
+			if format.Name == formats.NativeFormat {
+				_, historyErr, err := mapsModel.Load(uc, filePath)
+				if err != nil {
+					// TODO
+					fmt.Println(err)
+					return
+				}
+				if historyErr != nil {
+					dialog.ShowError(historyErr, window)
+				}
+				return
+			}
 
-			selectedLayerModel := selected_layer_model.NewSelectedLayerModel()
-			rotateModel := rotate_model.NewRotateModel(0)
-			selectModel := select_model.NewSelectModel(mapModel, selectedLayerModel)
-			rotMapModel := rot_map_model.NewRotMapMode(mapModel, rotateModel)
-			rotSelectModel := rot_select_model.NewRotSelectModel(selectModel, rotateModel)
-			undoRedoQueue := undo_redo.NewUndoRedoQueue(100 /*TODO*/)
-			centerModel := center_model.NewCenterModel(utils.Int2{})
+			mapModel, notesModel, err := format.Read(uc)
+			if err != nil {
+				// TODO
+				fmt.Println(err)
+				return
+			}
 
-			mapsModel.Add(mapModel, selectModel, mode_model.NewModeModel(), rotateModel, rotMapModel, rotSelectModel, notesModel, undoRedoQueue, selectedLayerModel, centerModel, uc.URI().Path())
+			// импортированная из другого формата карта сохраняется уже в .map
+			mapId := mapsModel.AddLoaded(mapModel, notesModel, nil, "")
+			mapsModel.MarkUnsaved(mapId)
 		}, window)
-		d.SetFilter(storage.NewExtensionFileFilter([]string{".map"}))
+		d.SetFilter(storage.NewExtensionFileFilter(formats.Extensions(true)))
 		d.Resize(window.Canvas().Size())
 		d.Show()
 	})
@@ -137,53 +165,53 @@ func NewToolbar(window fyne.Window, fnt *truetype.Font, mapsModel *maps_model.Ma
 				return
 			}
 
-			var t struct {
-				Version    int                     `json:"version"`
-				MapModel   *map_model.MapModel     `json:"map"`
-				NotesModel *notes_model.NotesModel `json:"notes"`
-			}
-
 			mapElem := mapsModel.GetById(selectedMapTabModel.Selected())
-			t.Version = 1
-			t.MapModel = mapElem.Model
-			t.NotesModel = mapElem.NotesModel
 
-			d, err := json.Marshal(&t)
+			format, err := formats.ByPath(uc.URI().Path())
 			if err != nil {
-				// TODO
-				fmt.Println(err)
+				dialog.ShowError(err, window)
 				return
 			}
 
-			writer := gzip.NewWriter(uc)
-			defer writer.Close()
-
-			_, err = writer.Write(d)
+			if format.Name == formats.NativeFormat {
+				err = load_save.SaveMapFileWithHistory(uc, mapElem.Model, mapElem.NotesModel, mapsModel.History(mapElem.MapId))
+			} else {
+				err = format.Write(uc, mapElem.Model, mapElem.NotesModel)
+			}
 			if err != nil {
 				// TODO
 				fmt.Println(err)
 				return
 			}
 
-			mapsModel.SetFilePath(mapElem.MapId, uc.URI().Path())
-			mapsModel.UpdateSaveChangeGeneration(mapElem.MapId)
+			// в другие форматы карта только экспортируется
+			if format.Name == formats.NativeFormat {
+				mapsModel.SetFilePath(mapElem.MapId, uc.URI().Path())
+				mapsModel.UpdateSaveChangeGeneration(mapElem.MapId)
+			}
 		}, window)
-		d.SetFilter(storage.NewExtensionFileFilter([]string{".map"}))
+		d.SetFilter(storage.NewExtensionFileFilter(formats.Extensions(false)))
 		d.Resize(window.Canvas().Size())
 		d.Show()
 	})
 
 	w.setModeToolbarAction = mode_toolbar_action.NewModeToolbarAction(setModeIcon, setModeSelectedIcon, mode_model.SetMode, func(mm *mode_model.ModeModel, m mode_model.Mode) {
 		mapElem := mapsModel.GetById(selectedMapTabModel.Selected())
-		SetMode(mapsModel, mapElem.MapId, mode_model.SetMode)
+		if err := SetMode(mapsModel, mapElem.MapId, mode_model.SetMode); err != nil {
+			dialog.ShowError(err, window)
+		}
 	})
 	w.selectModeToolbarAction = mode_toolbar_action.NewModeToolbarAction(selectModeIcon, selectModeSelectedIcon, mode_model.SelectMode, func(mm *mode_model.ModeModel, m mode_model.Mode) {
 		mapElem := mapsModel.GetById(selectedMapTabModel.Selected())
-		SetMode(mapsModel, mapElem.MapId, mode_model.SelectMode)
+		if err := SetMode(mapsModel, mapElem.MapId, mode_model.SelectMode); err != nil {
+			dialog.ShowError(err, window)
+		}
 	})
 	w.moveModeToolbarAction = mode_toolbar_action.NewModeToolbarAction(moveModeIcon, moveModeSelectedIcon, mode_model.MoveMode, func(mm *mode_model.ModeModel, m mode_model.Mode) {
 		mapElem := mapsModel.GetById(selectedMapTabModel.Selected())
-		SetMode(mapsModel, mapElem.MapId, mode_model.MoveMode)
+		if err := SetMode(mapsModel, mapElem.MapId, mode_model.MoveMode); err != nil {
+			dialog.ShowError(err, window)
+		}
 	})
 
 	w.rotateLeft = toolbar_action.NewToolbarAction(rotateLeftIcon, func() {
@@ -212,6 +240,15 @@ func NewToolbar(window fyne.Window, fnt *truetype.Font, mapsModel *maps_model.Ma
 	w.redo = toolbar_action.NewToolbarAction(theme.ContentRedoIcon(), func() {
 		Redo(selectedMapTabModel, mapsModel)
 	})
+	w.history = toolbar_action.NewToolbarAction(theme.HistoryIcon(), func() {
+		mapElem := mapsModel.GetById(selectedMapTabModel.Selected())
+		if (mapElem.MapId == uuid.UUID{}) {
+			return
+		}
+
+		dialog := undo_history_dialog.NewUndoHistoryDialog(window, mapsModel, mapElem.MapId)
+		dialog.Show()
+	})
 
 	w.cut = toolbar_action.NewToolbarAction(theme.ContentCutIcon(), func() {
 		mapElem := mapsModel.GetById(selectedMapTabModel.Selected())
@@ -237,10 +274,14 @@ func NewToolbar(window fyne.Window, fnt *truetype.Font, mapsModel *maps_model.Ma
 
 		actions := undo_redo.NewUndoRedoContainer()
 
-		actionModels := undo_redo.NewUndoRedoActionModels(mapElem.Model, mapElem.RotateModel, mapElem.RotMapModel, mapElem.RotSelectModel, mapElem.SelectModel, mapElem.ModeModel, mapElem.SelectedLayerModel, mapElem.CenterModel)
+		actionModels := undo_redo.NewUndoRedoActionModels(mapElem.Model, mapElem.RotateModel, mapElem.RotMapModel, mapElem.RotSelectModel, mapElem.SelectModel, mapElem.ModeModel, mapElem.SelectedLayerModel, mapElem.CenterModel, mapElem.PartyModel, mapElem.NotesModel)
 
 		action := undo_redo.NewSetModeAndMergeDownMoveLayerAction(mode_model.MoveMode)
 		action.Redo(actionModels)
+		if err := action.Err(); err != nil {
+			dialog.ShowError(err, window)
+			return
+		}
 		actions.Add(action)
 
 		mapWidget := doc_tabs_widget.GetMapWidget(mapElem.ExternalData)
@@ -262,6 +303,11 @@ func NewToolbar(window fyne.Window, fnt *truetype.Font, mapsModel *maps_model.Ma
 
 		pasteToMoveLayerAction := undo_redo.NewPasteToMoveLayerAction(pastePos, copyResult)
 		pasteToMoveLayerAction.Redo(actionModels)
+		if err := pasteToMoveLayerAction.Err(); err != nil {
+			actions.Undo(actionModels)
+			dialog.ShowError(err, window)
+			return
+		}
 		actions.Add(pasteToMoveLayerAction)
 
 		err := common.MakeAction(actions, mapsModel, mapElem.MapId, nil)
@@ -272,6 +318,47 @@ func NewToolbar(window fyne.Window, fnt *truetype.Font, mapsModel *maps_model.Ma
 		}
 	})
 
+	w.properties = toolbar_action.NewToolbarAction(theme.SettingsIcon(), func() {
+		mapElem := mapsModel.GetById(selectedMapTabModel.Selected())
+		if (mapElem.MapId == uuid.UUID{}) {
+			return
+		}
+
+		dialog := map_properties_dialog.NewMapPropertiesDialog(window, mapsModel, mapElem.MapId)
+		dialog.Show()
+	})
+
+	w.exportPng = toolbar_action.NewToolbarAction(theme.DownloadIcon(), func() {
+		mapElem := mapsModel.GetById(selectedMapTabModel.Selected())
+		if (mapElem.MapId == uuid.UUID{}) {
+			return
+		}
+
+		t, images := tilesetsModel.Get(mapElem.Model.Tileset())
+		dialog := export_png_dialog.NewExportPngDialog(window, mapsModel, mapElem.MapId, map_renderer.TileImages(images), t.ImageConfig(), fnt)
+		dialog.Show()
+	})
+
+	w.asciiMap = toolbar_action.NewToolbarAction(theme.DocumentIcon(), func() {
+		mapElem := mapsModel.GetById(selectedMapTabModel.Selected())
+		if (mapElem.MapId == uuid.UUID{}) {
+			return
+		}
+
+		dialog := ascii_map_dialog.NewAsciiMapDialog(window, mapsModel, mapElem.MapId)
+		dialog.Show()
+	})
+
+	w.tilesets = toolbar_action.NewToolbarAction(theme.ColorPaletteIcon(), func() {
+		mapElem := mapsModel.GetById(selectedMapTabModel.Selected())
+		if (mapElem.MapId == uuid.UUID{}) {
+			return
+		}
+
+		dialog := tileset_dialog.NewTilesetDialog(window, mapsModel, mapElem.MapId, tilesetsModel)
+		dialog.Show()
+	})
+
 	w.Items = append(w.Items,
 		newFile,
 		openFile,
@@ -283,6 +370,7 @@ func NewToolbar(window fyne.Window, fnt *truetype.Font, mapsModel *maps_model.Ma
 		widget.NewToolbarSeparator(),
 		w.undo,
 		w.redo,
+		w.history,
 		widget.NewToolbarSeparator(),
 		w.setModeToolbarAction,
 		w.selectModeToolbarAction,
@@ -292,6 +380,11 @@ func NewToolbar(window fyne.Window, fnt *truetype.Font, mapsModel *maps_model.Ma
 		toolbar_action.NewToolbarAction(theme.ZoomOutIcon(), func() {}),
 		w.rotateLeft,
 		w.rotateRight,
+		widget.NewToolbarSeparator(),
+		w.properties,
+		w.exportPng,
+		w.asciiMap,
+		w.tilesets,
 	)
 
 	disableButtons := func() {
@@ -360,6 +453,11 @@ func (w *ToolbarWidget) setMapElem(mapElem maps_model.MapElem) {
 		w.copy.ToolbarObject().(*widget.Button).Disable()
 		w.cut.ToolbarObject().(*widget.Button).Disable()
 		w.paste.ToolbarObject().(*widget.Button).Disable()
+		w.properties.ToolbarObject().(*widget.Button).Disable()
+		w.exportPng.ToolbarObject().(*widget.Button).Disable()
+		w.asciiMap.ToolbarObject().(*widget.Button).Disable()
+		w.tilesets.ToolbarObject().(*widget.Button).Disable()
+		w.history.ToolbarObject().(*widget.Button).Disable()
 	} else {
 		w.setModeToolbarAction.SetModeModel(mapElem.ModeModel)
 		w.setModeToolbarAction.ToolbarObject().(*widget.Button).Enable()
@@ -382,7 +480,11 @@ func (w *ToolbarWidget) setMapElem(mapElem maps_model.MapElem) {
 				w.cut.ToolbarObject().(*widget.Button).Enable()
 			}
 		}
-		w.disconnect.AddSlot(mapElem.Model.AddDataChangeListener(mapModelDataChangeListener))
+		w.disconnect.AddSlot(mapElem.Model.AddChangeListener(func(change map_model.Change) {
+			if change.Property == map_model.LayersChange {
+				mapModelDataChangeListener()
+			}
+		}))
 		mapModelDataChangeListener()
 
 		saveChangeGenerationListener := func(mapElem maps_model.MapElem) {
@@ -414,6 +516,11 @@ func (w *ToolbarWidget) setMapElem(mapElem maps_model.MapElem) {
 
 		w.rotateLeft.ToolbarObject().(*widget.Button).Enable()
 		w.rotateRight.ToolbarObject().(*widget.Button).Enable()
+		w.properties.ToolbarObject().(*widget.Button).Enable()
+		w.exportPng.ToolbarObject().(*widget.Button).Enable()
+		w.asciiMap.ToolbarObject().(*widget.Button).Enable()
+		w.tilesets.ToolbarObject().(*widget.Button).Enable()
+		w.history.ToolbarObject().(*widget.Button).Enable()
 	}
 }
 
@@ -421,7 +528,7 @@ func Undo(selectedMapTabModel *selected_map_tab_model.SelectedMapTabModel, mapsM
 	mapElem := mapsModel.GetById(selectedMapTabModel.Selected())
 	action := mapElem.UndoRedoQueue.Action(mapElem.ChangeGeneration)
 	if action.Action != nil {
-		action.Action.Undo(undo_redo.NewUndoRedoActionModels(mapElem.Model, mapElem.RotateModel, mapElem.RotMapModel, mapElem.RotSelectModel, mapElem.SelectModel, mapElem.ModeModel, mapElem.SelectedLayerModel, mapElem.CenterModel))
+		action.Action.Undo(undo_redo.NewUndoRedoActionModels(mapElem.Model, mapElem.RotateModel, mapElem.RotMapModel, mapElem.RotSelectModel, mapElem.SelectModel, mapElem.ModeModel, mapElem.SelectedLayerModel, mapElem.CenterModel, mapElem.PartyModel, mapElem.NotesModel))
 		actionBefore := mapElem.UndoRedoQueue.ActionBefore(mapElem.ChangeGeneration)
 		mapsModel.SetChangeGeneration(mapElem.MapId, actionBefore.ChangeGeneration)
 	}
@@ -431,19 +538,19 @@ func Redo(selectedMapTabModel *selected_map_tab_model.SelectedMapTabModel, mapsM
 	mapElem := mapsModel.GetById(selectedMapTabModel.Selected())
 	actionAfter := mapElem.UndoRedoQueue.ActionAfter(mapElem.ChangeGeneration)
 	if actionAfter.Action != nil {
-		actionAfter.Action.Redo(undo_redo.NewUndoRedoActionModels(mapElem.Model, mapElem.RotateModel, mapElem.RotMapModel, mapElem.RotSelectModel, mapElem.SelectModel, mapElem.ModeModel, mapElem.SelectedLayerModel, mapElem.CenterModel))
+		actionAfter.Action.Redo(undo_redo.NewUndoRedoActionModels(mapElem.Model, mapElem.RotateModel, mapElem.RotMapModel, mapElem.RotSelectModel, mapElem.SelectModel, mapElem.ModeModel, mapElem.SelectedLayerModel, mapElem.CenterModel, mapElem.PartyModel, mapElem.NotesModel))
 		mapsModel.SetChangeGeneration(mapElem.MapId, actionAfter.ChangeGeneration)
 	}
 }
 
-func SetMode(mapsModel *maps_model.MapsModel, mapId uuid.UUID, mode mode_model.Mode) {
+func SetMode(mapsModel *maps_model.MapsModel, mapId uuid.UUID, mode mode_model.Mode) error {
 	mapElem := mapsModel.GetById(mapId)
 
 	if mode == mode_model.SetMode || mode == mode_model.SelectMode {
 		if mapElem.ModeModel.Mode() != mode {
 			actions := undo_redo.NewUndoRedoContainer()
 
-			actionModels := undo_redo.NewUndoRedoActionModels(mapElem.Model, mapElem.RotateModel, mapElem.RotMapModel, mapElem.RotSelectModel, mapElem.SelectModel, mapElem.ModeModel, mapElem.SelectedLayerModel, mapElem.CenterModel)
+			actionModels := undo_redo.NewUndoRedoActionModels(mapElem.Model, mapElem.RotateModel, mapElem.RotMapModel, mapElem.RotSelectModel, mapElem.SelectModel, mapElem.ModeModel, mapElem.SelectedLayerModel, mapElem.CenterModel, mapElem.PartyModel, mapElem.NotesModel)
 
 			unselectAllAction := undo_redo.NewUnselectAllAction()
 			unselectAllAction.Redo(actionModels)
@@ -451,18 +558,19 @@ func SetMode(mapsModel *maps_model.MapsModel, mapId uuid.UUID, mode mode_model.M
 
 			setModeAndMergeDownMoveLayerAction := undo_redo.NewSetModeAndMergeDownMoveLayerAction(mode)
 			setModeAndMergeDownMoveLayerAction.Redo(actionModels)
+			if err := setModeAndMergeDownMoveLayerAction.Err(); err != nil {
+				actions.Undo(actionModels)
+				return err
+			}
 			actions.Add(setModeAndMergeDownMoveLayerAction)
 
-			err := common.MakeAction(actions, mapsModel, mapElem.MapId, nil)
-			if err != nil {
-				// TODO
-				fmt.Println(err)
-				return
-			}
+			return common.MakeAction(actions, mapsModel, mapElem.MapId, nil)
 		}
 	} else if mode == mode_model.MoveMode {
 
 	}
+
+	return nil
 }
 
 func Copy(m *map_model.MapModel, slm *selected_layer_model.SelectedLayerModel, r *rotate_model.RotateModel, rS *rot_select_model.RotSelectModel, rM *rot_map_model.RotMapModel) copy_model.CopyResult {
@@ -489,18 +597,45 @@ func Copy(m *map_model.MapModel, slm *selected_layer_model.SelectedLayerModel, r
 						l.Floor = v
 					})
 				}
+				if v := rM.Link(x, y, slm.Selected()); v != nil {
+					setLocation(func(l *map_model.Location) {
+						l.Link = v
+					})
+				}
+				if v := rM.Effects(x, y, slm.Selected()); v != 0 {
+					setLocation(func(l *map_model.Location) {
+						l.Effects = v
+					})
+				}
+			}
+			if selected.Floor || selected.Markers != 0 {
+				var markers []map_model.Marker
+				for i, marker := range rM.Markers(x, y, slm.Selected()) {
+					if selected.Floor || selected.Markers&(1<<i) != 0 {
+						markers = append(markers, marker)
+					}
+				}
+				if len(markers) > 0 {
+					setLocation(func(l *map_model.Location) {
+						l.Markers = markers
+					})
+				}
 			}
 			if selected.RightWall {
 				if v := rM.Wall(x, y, slm.Selected(), true); v > 0 {
+					kind := rM.WallKind(x, y, slm.Selected(), true)
 					setLocation(func(l *map_model.Location) {
 						l.RightWall = v
+						l.RightWallKind = kind
 					})
 				}
 			}
 			if selected.BottomWall {
 				if v := rM.Wall(x, y, slm.Selected(), false); v > 0 {
+					kind := rM.WallKind(x, y, slm.Selected(), false)
 					setLocation(func(l *map_model.Location) {
 						l.BottomWall = v
+						l.BottomWallKind = kind
 					})
 				}
 			}
@@ -0,0 +1,53 @@
+package wall_kind_widget
+
+import (
+	"old-school-rpg-map-editor/models/map_model"
+	"sync"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/widget"
+)
+
+// Выбор вида стены(дверь, секретная дверь и т.д.), которую ставит палитра стен
+type WallKindWidget struct {
+	mutex      sync.Mutex
+	container  *fyne.Container
+	kindSelect *widget.Select
+	selected   map_model.WallKind
+}
+
+func NewWallKindWidget() *WallKindWidget {
+	w := &WallKindWidget{}
+
+	options := make([]string, 0, len(map_model.WallKinds))
+	for _, k := range map_model.WallKinds {
+		options = append(options, k.String())
+	}
+
+	w.kindSelect = widget.NewSelect(options, func(s string) {
+		w.mutex.Lock()
+		defer w.mutex.Unlock()
+
+		index := w.kindSelect.SelectedIndex()
+		if index >= 0 {
+			w.selected = map_model.WallKinds[index]
+		}
+	})
+	w.kindSelect.SetSelectedIndex(0)
+
+	w.container = container.NewMax(w.kindSelect)
+
+	return w
+}
+
+func (w *WallKindWidget) Selected() map_model.WallKind {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	return w.selected
+}
+
+func (w *WallKindWidget) Container() *fyne.Container {
+	return w.container
+}